@@ -0,0 +1,448 @@
+/**
+* @license
+* Copyright 2020 Dynatrace LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Plan the approver is shown and apply applies when no saved plan is used
+const approvalPlanFileName = "approval.tfplan"
+
+// ============================================================
+// Approval between plan and apply
+// ============================================================
+
+// Human gate invoked with the plan summary before apply; returns whether to proceed
+type approver interface {
+	Approve(summary string) (bool, error)
+}
+
+// Approver used by publishConfiguration, nil when applies are not gated
+var applyApprover approver
+
+// Create the approver selected by the "approver" config key
+func newApprover(config map[string]string) (approver, error) {
+	timeout := time.Hour
+	if value := config["approval_timeout"]; value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid approval_timeout: %w", err)
+		}
+		timeout = parsed
+	}
+
+	switch config["approver"] {
+	case "":
+		return nil, nil
+	case "prompt":
+		return &promptApprover{}, nil
+	case "slack":
+		for _, key := range []string{"slack_bot_token", "slack_channel", "slack_signing_secret"} {
+			if config[key] == "" {
+				return nil, fmt.Errorf("approver = slack requires %s", key)
+			}
+		}
+		botToken, err := resolveConfigValue(config["slack_bot_token"])
+		if err != nil {
+			return nil, fmt.Errorf("slack_bot_token: %w", err)
+		}
+		signingSecret, err := resolveConfigValue(config["slack_signing_secret"])
+		if err != nil {
+			return nil, fmt.Errorf("slack_signing_secret: %w", err)
+		}
+		listenAddr := config["slack_listen_addr"]
+		if listenAddr == "" {
+			listenAddr = ":8088"
+		}
+		return &slackApprover{
+			botToken:      botToken,
+			channel:       config["slack_channel"],
+			signingSecret: signingSecret,
+			listenAddr:    listenAddr,
+			timeout:       timeout,
+		}, nil
+	case "web":
+		listenAddr := config["web_approval_addr"]
+		if listenAddr == "" {
+			listenAddr = "127.0.0.1:0"
+		}
+		secret, err := resolveConfigValue(config["web_approval_secret"])
+		if err != nil {
+			return nil, fmt.Errorf("web_approval_secret: %w", err)
+		}
+		return &webApprover{secret: secret, listenAddr: listenAddr, timeout: timeout}, nil
+	default:
+		return nil, fmt.Errorf("unknown approver %q (expected prompt, slack or web)", config["approver"])
+	}
+}
+
+// Extract resource actions and the totals line from plan output
+func summarizePlan(output string) (string, bool) {
+	var lines []string
+	changes := true
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(trimmed, "# ") && (strings.Contains(trimmed, " will be ") || strings.Contains(trimmed, " must be ")):
+			lines = append(lines, trimmed)
+		case strings.HasPrefix(trimmed, "Plan:"):
+			lines = append(lines, trimmed)
+		case strings.HasPrefix(trimmed, "No changes."):
+			changes = false
+			lines = append(lines, trimmed)
+		}
+	}
+	return strings.Join(lines, "\n"), changes
+}
+
+// Plan to a file for apply: the checked plan when exclusions, scopes, schemas
+// or readiness are verified, otherwise a plain plan of the selected targets
+func writeApplyPlan(terraformPath string, logFile *os.File) (string, error) {
+	if planChecksEnabled() {
+		return planWithExclusions(terraformPath, logFile)
+	}
+	args := append([]string{"plan", "-out=" + approvalPlanFileName}, parallelismArgs()...)
+	args = append(args, targetArgs()...)
+	args = append(args, replaceArgs()...)
+	args = append(args, variableArgs...)
+	if err := executeTerraformCommand(terraformPath, logFile, args...); err != nil {
+		os.Remove(approvalPlanFileName)
+		return "", err
+	}
+	return approvalPlanFileName, nil
+}
+
+// Plan to a file and ask the configured approver; returns the plan file so apply
+// applies exactly the approved changes, or "" when the plan has no changes
+func approveApply(terraformPath string, logFile *os.File) (string, error) {
+	fmt.Println("Running Terraform plan for approval...")
+	planFile, err := writeApplyPlan(terraformPath, logFile)
+	if err != nil {
+		return "", fmt.Errorf("plan failed: %w", err)
+	}
+	output, err := outputTerraformCommand(terraformPath, logFile, "show", "-no-color", planFile)
+	if err == nil {
+		if _, changes := summarizePlan(string(output)); !changes {
+			os.Remove(planFile)
+			return "", nil
+		}
+		err = approvePlanOutput(string(output))
+	}
+	if err != nil {
+		os.Remove(planFile)
+		return "", err
+	}
+	return planFile, nil
+}
+
+// Ask the configured approver to accept the changes in plan output
+func approvePlanOutput(output string) error {
+	summary, changes := summarizePlan(output)
+	if !changes {
+		return nil
+	}
+
+	publishf("approval", "start", "Waiting for approval")
+	approved, err := applyApprover.Approve(summary)
+	if err != nil {
+		publishf("approval", "error", "Approval failed: %v", err)
+		return fmt.Errorf("approval failed: %w", err)
+	}
+	if !approved {
+		publishf("approval", "error", "Apply was rejected")
+		return errors.New("apply was rejected")
+	}
+	publishf("approval", "done", "Apply approved")
+	fmt.Println("Apply approved.")
+	return nil
+}
+
+// Sign a value with HMAC-SHA256
+func signValue(secret, value string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// ============================================================
+// Terminal prompt approver
+// ============================================================
+
+type promptApprover struct{}
+
+func (a *promptApprover) Approve(summary string) (bool, error) {
+	if nonInteractive {
+		return false, fmt.Errorf("cannot prompt for approval in non-interactive mode; configure approver = slack or web")
+	}
+	fmt.Println("\n" + summary)
+	fmt.Print("Apply these changes? (yes/no): ")
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && answer == "" {
+		return false, err
+	}
+	return strings.TrimSpace(strings.ToLower(answer)) == "yes", nil
+}
+
+// ============================================================
+// Slack interactive message approver
+// ============================================================
+
+// Posts the plan summary with Approve/Reject buttons and waits for the click,
+// which Slack delivers to the app's interactivity request URL (served on listenAddr)
+type slackApprover struct {
+	botToken      string
+	channel       string
+	signingSecret string
+	listenAddr    string
+	timeout       time.Duration
+}
+
+func (a *slackApprover) Approve(summary string) (bool, error) {
+	requestID := strconv.FormatInt(time.Now().UnixNano(), 36)
+
+	listener, err := net.Listen("tcp", a.listenAddr)
+	if err != nil {
+		return false, fmt.Errorf("failed to listen for Slack actions: %w", err)
+	}
+	decisions := make(chan bool, 1)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/slack/actions", func(w http.ResponseWriter, r *http.Request) {
+		approved, ok := a.handleAction(r, requestID)
+		if !ok {
+			http.Error(w, "invalid request", http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		select {
+		case decisions <- approved:
+		default:
+		}
+	})
+	server := &http.Server{Handler: mux}
+	go server.Serve(listener)
+	defer server.Shutdown(context.Background())
+
+	if err := a.postMessage(summary, requestID); err != nil {
+		return false, err
+	}
+	fmt.Printf("Waiting for approval in Slack channel %s (timeout %s)...\n", a.channel, a.timeout)
+
+	select {
+	case approved := <-decisions:
+		return approved, nil
+	case <-time.After(a.timeout):
+		return false, errors.New("timed out waiting for Slack approval")
+	}
+}
+
+// Post the approval request with interactive buttons
+func (a *slackApprover) postMessage(summary, requestID string) error {
+	button := func(text, style, actionID string) map[string]interface{} {
+		return map[string]interface{}{
+			"type":      "button",
+			"text":      map[string]string{"type": "plain_text", "text": text},
+			"style":     style,
+			"action_id": actionID,
+			"value":     requestID,
+		}
+	}
+	payload, _ := json.Marshal(map[string]interface{}{
+		"channel": a.channel,
+		"text":    "Terraform apply requires approval",
+		"blocks": []interface{}{
+			map[string]interface{}{
+				"type": "section",
+				"text": map[string]string{"type": "mrkdwn", "text": "*Terraform apply requires approval*\n```" + summary + "```"},
+			},
+			map[string]interface{}{
+				"type":     "actions",
+				"elements": []interface{}{button("Approve", "primary", "approve"), button("Reject", "danger", "reject")},
+			},
+		},
+	})
+
+	req, err := http.NewRequest(http.MethodPost, "https://slack.com/api/chat.postMessage", strings.NewReader(string(payload)))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+a.botToken)
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to post Slack message: %w", err)
+	}
+	body, err := readAPIResponse(resp)
+	if err != nil {
+		return fmt.Errorf("failed to post Slack message: %w", err)
+	}
+	var result struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil || !result.OK {
+		return fmt.Errorf("failed to post Slack message: %s", result.Error)
+	}
+	return nil
+}
+
+// Verify the Slack request signature and decode the clicked button
+func (a *slackApprover) handleAction(r *http.Request, requestID string) (bool, bool) {
+	if r.Method != http.MethodPost {
+		return false, false
+	}
+	timestamp := r.Header.Get("X-Slack-Request-Timestamp")
+	sent, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || time.Since(time.Unix(sent, 0)).Abs() > 5*time.Minute {
+		return false, false
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		return false, false
+	}
+	expected := "v0=" + signValue(a.signingSecret, "v0:"+timestamp+":"+string(body))
+	if !hmac.Equal([]byte(expected), []byte(r.Header.Get("X-Slack-Signature"))) {
+		return false, false
+	}
+
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		return false, false
+	}
+	var payload struct {
+		Actions []struct {
+			ActionID string `json:"action_id"`
+			Value    string `json:"value"`
+		} `json:"actions"`
+	}
+	if err := json.Unmarshal([]byte(form.Get("payload")), &payload); err != nil || len(payload.Actions) == 0 {
+		return false, false
+	}
+	action := payload.Actions[0]
+	if action.Value != requestID {
+		return false, false
+	}
+	return action.ActionID == "approve", true
+}
+
+// ============================================================
+// Signed-URL web page approver
+// ============================================================
+
+var approvalPageTemplate = template.Must(template.New("approval").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Approve Terraform apply</title></head>
+<body style="font-family: sans-serif; margin: 2em;">
+<h1>Terraform apply requires approval</h1>
+<pre style="background: #f4f4f4; padding: 1em;">{{.Summary}}</pre>
+<form method="post" action="{{.ApproveURL}}" style="display: inline;"><button type="submit">Approve</button></form>
+<form method="post" action="{{.RejectURL}}" style="display: inline;"><button type="submit">Reject</button></form>
+</body>
+</html>
+`))
+
+// Serves an approval page whose approve/reject links are HMAC-signed for this request
+type webApprover struct {
+	secret     string
+	listenAddr string
+	timeout    time.Duration
+}
+
+func (a *webApprover) Approve(summary string) (bool, error) {
+	secret := a.secret
+	if secret == "" {
+		generated, err := generateShareToken()
+		if err != nil {
+			return false, err
+		}
+		secret = generated
+	}
+	requestID := strconv.FormatInt(time.Now().UnixNano(), 36)
+	signedPath := func(decision string) string {
+		return fmt.Sprintf("/%s?id=%s&sig=%s", decision, requestID, signValue(secret, requestID+":"+decision))
+	}
+
+	listener, err := net.Listen("tcp", a.listenAddr)
+	if err != nil {
+		return false, fmt.Errorf("failed to listen for approval: %w", err)
+	}
+
+	decisions := make(chan bool, 1)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if !hmac.Equal([]byte(r.URL.Query().Get("sig")), []byte(signValue(secret, requestID+":view"))) {
+			http.Error(w, "invalid signature", http.StatusForbidden)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		approvalPageTemplate.Execute(w, map[string]string{
+			"Summary":    summary,
+			"ApproveURL": signedPath("approve"),
+			"RejectURL":  signedPath("reject"),
+		})
+	})
+	for _, decision := range []string{"approve", "reject"} {
+		decision := decision
+		mux.HandleFunc("/"+decision, func(w http.ResponseWriter, r *http.Request) {
+			sig := r.URL.Query().Get("sig")
+			if r.Method != http.MethodPost || r.URL.Query().Get("id") != requestID ||
+				!hmac.Equal([]byte(sig), []byte(signValue(secret, requestID+":"+decision))) {
+				http.Error(w, "invalid signature", http.StatusForbidden)
+				return
+			}
+			fmt.Fprintf(w, "Recorded: %s. You can close this page.", decision)
+			select {
+			case decisions <- decision == "approve":
+			default:
+			}
+		})
+	}
+	server := &http.Server{Handler: mux}
+	go server.Serve(listener)
+	defer server.Shutdown(context.Background())
+
+	fmt.Printf("Approval page: http://%s/?sig=%s\n", listener.Addr(), signValue(secret, requestID+":view"))
+	fmt.Printf("Waiting for approval (timeout %s)...\n", a.timeout)
+
+	select {
+	case approved := <-decisions:
+		return approved, nil
+	case <-time.After(a.timeout):
+		return false, errors.New("timed out waiting for approval")
+	}
+}
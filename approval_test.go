@@ -0,0 +1,59 @@
+/**
+* @license
+* Copyright 2020 Dynatrace LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNewApproverResolvesSecrets(t *testing.T) {
+	dir := t.TempDir()
+	for name, value := range map[string]string{"bot": "xoxb-secret\n", "signing": "signing-secret\n", "web": "web-secret\n"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(value), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	slack, err := newApprover(map[string]string{
+		"approver":             "slack",
+		"slack_channel":        "#deploys",
+		"slack_bot_token":      "file:" + filepath.Join(dir, "bot"),
+		"slack_signing_secret": "file:" + filepath.Join(dir, "signing"),
+	})
+	if err != nil {
+		t.Fatalf("newApprover(slack): %v", err)
+	}
+	if a := slack.(*slackApprover); a.botToken != "xoxb-secret" || a.signingSecret != "signing-secret" {
+		t.Errorf("slack approver has bot token %q and signing secret %q, want the file contents", a.botToken, a.signingSecret)
+	}
+
+	web, err := newApprover(map[string]string{"approver": "web", "web_approval_secret": "file:" + filepath.Join(dir, "web")})
+	if err != nil {
+		t.Fatalf("newApprover(web): %v", err)
+	}
+	if a := web.(*webApprover); a.secret != "web-secret" {
+		t.Errorf("web approver has secret %q, want the file contents", a.secret)
+	}
+
+	_, err = newApprover(map[string]string{"approver": "web", "web_approval_secret": "file:" + filepath.Join(dir, "missing")})
+	if err == nil {
+		t.Error("newApprover with an unreadable web_approval_secret: want an error")
+	}
+}
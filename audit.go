@@ -0,0 +1,348 @@
+/**
+* @license
+* Copyright 2020 Dynatrace LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const auditDirName = "audit"
+
+// ============================================================
+// Audit event store
+// ============================================================
+
+// Single audit record
+type auditEvent struct {
+	Time   time.Time `json:"time"`
+	RunID  string    `json:"run_id"`
+	Kind   string    `json:"kind"`
+	Tenant string    `json:"tenant,omitempty"`
+	User   string    `json:"user,omitempty"`
+	// Public ID of the token or OAuth client used, never the secret
+	Identity string            `json:"identity,omitempty"`
+	Result   string            `json:"result"`
+	Detail   string            `json:"detail,omitempty"`
+	Fields   map[string]string `json:"fields,omitempty"`
+}
+
+// Audit store for one wrapper run; every run appends to its own file, created
+// with its first event, so that parallel runs never interleave writes. There
+// is no separate index: queryAuditEvents merges the files by time when read
+type auditStore struct {
+	mu    sync.Mutex
+	dir   string
+	runID string
+	file  *os.File
+	// Optional endpoint every event is also POSTed to, with its bearer token
+	webhook      string
+	webhookToken string
+}
+
+// Filter for querying audit events; zero values match everything
+type auditFilter struct {
+	Kind   string
+	Tenant string
+	Since  time.Time
+	Limit  int
+}
+
+// Audit store of the current run, nil when auditing is unavailable
+var audit *auditStore
+
+// Start the audit store of a run; its file is created when the first event is
+// recorded, so runs that record nothing leave no empty files behind
+func openAuditStore(dir string) (*auditStore, error) {
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return nil, err
+	}
+	runID := fmt.Sprintf("%s-%d-%s", time.Now().UTC().Format("20060102T150405Z"), os.Getpid(), hex.EncodeToString(suffix))
+	return &auditStore{dir: dir, runID: runID}, nil
+}
+
+// Create the run's audit file; called with mu held
+func (s *auditStore) openFile() error {
+	if s.file != nil {
+		return nil
+	}
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(filepath.Join(s.dir, s.runID+".jsonl"), os.O_CREATE|os.O_EXCL|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	s.file = file
+	return nil
+}
+
+// Close the audit file
+func (s *auditStore) Close() error {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	return s.file.Close()
+}
+
+// Append an event as a single JSON line
+func (s *auditStore) Record(event auditEvent) error {
+	if s == nil {
+		return nil
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+	event.RunID = s.runID
+	if event.User == "" {
+		event.User = osUserName()
+	}
+	if event.Identity == "" {
+		event.Identity = credentialIdentity()
+	}
+
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	if err = s.openFile(); err == nil {
+		_, err = s.file.Write(append(line, '\n'))
+	}
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return s.postWebhook(line)
+}
+
+// Send audit_webhook (and audit_webhook_token) events to the webhook as well
+func (s *auditStore) configureWebhook(config map[string]string) error {
+	if s == nil {
+		return nil
+	}
+	s.webhook, s.webhookToken = config["audit_webhook"], ""
+	if s.webhook == "" {
+		return nil
+	}
+	if value, found := config["audit_webhook_token"]; found {
+		token, err := resolveConfigValue(value)
+		if err != nil {
+			return fmt.Errorf("audit_webhook_token: %w", err)
+		}
+		s.webhookToken = token
+	}
+	return nil
+}
+
+// POST an encoded event to the webhook; the local file stays the record of truth
+func (s *auditStore) postWebhook(body []byte) error {
+	if s.webhook == "" {
+		return nil
+	}
+	req, err := http.NewRequest(http.MethodPost, s.webhook, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.webhookToken != "" {
+		req.Header.Set("Authorization", "Bearer "+s.webhookToken)
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("audit webhook: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("audit webhook: %s", resp.Status)
+	}
+	return nil
+}
+
+// Name of the user running the wrapper
+func osUserName() string {
+	if current, err := user.Current(); err == nil {
+		return current.Username
+	}
+	return os.Getenv("USER")
+}
+
+// Public part of the credential the run authenticates with: the token ID of
+// dt0c01.<id>.<secret> tokens, or the OAuth client ID
+func credentialIdentity() string {
+	for _, envKey := range []string{"DT_API_TOKEN", "DT_PLATFORM_TOKEN", "DT_CLUSTER_API_TOKEN"} {
+		if match := dynatraceTokenPattern.FindStringSubmatch(getEnv(envKey)); match != nil {
+			return match[1]
+		}
+	}
+	return getEnv("DT_CLIENT_ID")
+}
+
+// Outcome of an operation the user declined at its confirmation prompt
+var errCancelled = errors.New("cancelled at the confirmation prompt")
+
+// Record the outcome of a Terraform operation in the current run's audit file
+func recordAudit(kind string, runErr error) {
+	event := auditEvent{Kind: kind, Tenant: getEnv("DT_ENV_URL"), Result: "success"}
+	switch {
+	case errors.Is(runErr, errCancelled):
+		event.Result = "cancelled"
+	case runErr != nil:
+		event.Result = "failure"
+		event.Detail = runErr.Error()
+	}
+	if err := audit.Record(event); err != nil {
+		fmt.Printf("Warning: failed to write audit event: %v\n", err)
+	}
+}
+
+// Merge all run files into a single time-ordered list of matching events
+func queryAuditEvents(dir string, filter auditFilter) ([]auditEvent, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.jsonl"))
+	if err != nil {
+		return nil, err
+	}
+
+	var events []auditEvent
+	for _, fileName := range files {
+		file, err := os.Open(fileName)
+		if err != nil {
+			return nil, err
+		}
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			var event auditEvent
+			if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+				// A run that crashed mid-write leaves at most one partial line
+				continue
+			}
+			if (filter.Kind == "" || event.Kind == filter.Kind) &&
+				(filter.Tenant == "" || event.Tenant == filter.Tenant) &&
+				(filter.Since.IsZero() || !event.Time.Before(filter.Since)) {
+				events = append(events, event)
+			}
+		}
+		file.Close()
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Time.Before(events[j].Time) })
+	if filter.Limit > 0 && len(events) > filter.Limit {
+		events = events[len(events)-filter.Limit:]
+	}
+	return events, nil
+}
+
+// Print recent audit events
+func showHistory(dir string, limit int) error {
+	events, err := queryAuditEvents(dir, auditFilter{Limit: limit})
+	if err != nil {
+		return err
+	}
+	if len(events) == 0 {
+		fmt.Println("No recorded runs.")
+		return nil
+	}
+	for _, event := range events {
+		fmt.Printf("%s  %-8s %-8s %s", event.Time.Local().Format("2006-01-02 15:04:05"), event.Kind, event.Result, event.Tenant)
+		if event.User != "" {
+			fmt.Printf("  by %s", event.User)
+		}
+		if event.Identity != "" {
+			fmt.Printf(" as %s", event.Identity)
+		}
+		if event.Detail != "" {
+			fmt.Printf("  (%s)", event.Detail)
+		}
+		fmt.Println()
+	}
+	return nil
+}
+
+// Print run counts and failures per week and operation over the last days,
+// leaving out the learned parallelism the store also holds
+func showTrends(dir string, days int) error {
+	events, err := queryAuditEvents(dir, auditFilter{Since: time.Now().AddDate(0, 0, -days)})
+	if err != nil {
+		return err
+	}
+
+	type trendKey struct{ week, kind string }
+	type trend struct {
+		runs, failed int
+		tenants      map[string]bool
+	}
+	trends := make(map[trendKey]*trend)
+	var keys []trendKey
+	for _, event := range events {
+		if event.Kind == "parallelism" {
+			continue
+		}
+		year, week := event.Time.Local().ISOWeek()
+		key := trendKey{fmt.Sprintf("%d-W%02d", year, week), event.Kind}
+		t := trends[key]
+		if t == nil {
+			t = &trend{tenants: make(map[string]bool)}
+			trends[key] = t
+			keys = append(keys, key)
+		}
+		t.runs++
+		if event.Result == "failure" {
+			t.failed++
+		}
+		t.tenants[event.Tenant] = true
+	}
+	if len(keys) == 0 {
+		fmt.Printf("No recorded runs in the last %d days.\n", days)
+		return nil
+	}
+
+	sort.SliceStable(keys, func(i, j int) bool {
+		if keys[i].week != keys[j].week {
+			return keys[i].week < keys[j].week
+		}
+		return keys[i].kind < keys[j].kind
+	})
+	fmt.Printf("%-9s %-16s %5s %7s %8s\n", "Week", "Operation", "Runs", "Failed", "Tenants")
+	for _, key := range keys {
+		t := trends[key]
+		fmt.Printf("%-9s %-16s %5d %7d %8d\n", key.week, key.kind, t.runs, t.failed, len(t.tenants))
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+/**
+* @license
+* Copyright 2020 Dynatrace LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestAuditStoreConcurrentRuns(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), auditDirName)
+	const runs, eventsPerRun = 4, 50
+
+	// Tenants of a fan-out run record their results in parallel, each from
+	// several goroutines
+	stores := make([]*auditStore, runs)
+	var wg sync.WaitGroup
+	for i := range stores {
+		store, err := openAuditStore(dir)
+		if err != nil {
+			t.Fatalf("openAuditStore: %v", err)
+		}
+		stores[i] = store
+		for j := 0; j < eventsPerRun; j++ {
+			wg.Add(1)
+			go func(tenant string, seq int) {
+				defer wg.Done()
+				event := auditEvent{Kind: "apply", Tenant: tenant, User: "ci", Identity: "dt0c01.TEST", Result: "success",
+					Fields: map[string]string{"seq": strconv.Itoa(seq), "padding": fmt.Sprintf("%01000d", seq)}}
+				if err := store.Record(event); err != nil {
+					t.Errorf("Record: %v", err)
+				}
+			}(fmt.Sprintf("https://tenant%d.live.dynatrace.com", i), j)
+		}
+	}
+	wg.Wait()
+	for _, store := range stores {
+		store.Close()
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.jsonl"))
+	if len(files) != runs {
+		t.Errorf("got %d audit files, want one per run (%d)", len(files), runs)
+	}
+	events, err := queryAuditEvents(dir, auditFilter{})
+	if err != nil {
+		t.Fatalf("queryAuditEvents: %v", err)
+	}
+	if len(events) != runs*eventsPerRun {
+		t.Fatalf("read back %d events, want %d", len(events), runs*eventsPerRun)
+	}
+	perRun := make(map[string]map[string]bool)
+	for i, event := range events {
+		if i > 0 && event.Time.Before(events[i-1].Time) {
+			t.Errorf("event %d is out of time order", i)
+		}
+		if perRun[event.RunID] == nil {
+			perRun[event.RunID] = make(map[string]bool)
+		}
+		perRun[event.RunID][event.Fields["seq"]] = true
+	}
+	for _, store := range stores {
+		if got := len(perRun[store.runID]); got != eventsPerRun {
+			t.Errorf("run %s: read back %d distinct events, want %d", store.runID, got, eventsPerRun)
+		}
+	}
+
+	filtered, err := queryAuditEvents(dir, auditFilter{Tenant: "https://tenant1.live.dynatrace.com", Limit: 10})
+	if err != nil || len(filtered) != 10 {
+		t.Errorf("filtered query returned %d events, %v; want 10", len(filtered), err)
+	}
+}
+
+func TestAuditStoreCreatesFileOnFirstRecord(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), auditDirName)
+	store, err := openAuditStore(dir)
+	if err != nil {
+		t.Fatalf("openAuditStore: %v", err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("a run without events created %s: %v", dir, err)
+	}
+
+	store, _ = openAuditStore(dir)
+	defer store.Close()
+	if err := store.Record(auditEvent{Kind: "plan", User: "ci", Identity: "dt0c01.TEST", Result: "success"}); err != nil {
+		t.Fatalf("Record: %v", err)
+	}
+	if files, _ := filepath.Glob(filepath.Join(dir, "*.jsonl")); len(files) != 1 {
+		t.Errorf("got %d audit files after the first event, want 1", len(files))
+	}
+}
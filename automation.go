@@ -0,0 +1,211 @@
+/**
+* @license
+* Copyright 2020 Dynatrace LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+)
+
+// OAuth scopes the AutomationEngine resource types need
+var automationScopes = map[string][]string{
+	"dynatrace_automation_workflow":          {"automation:workflows:read", "automation:workflows:write"},
+	"dynatrace_automation_business_calendar": {"automation:calendars:read", "automation:calendars:write"},
+	"dynatrace_automation_scheduling_rule":   {"automation:rules:read", "automation:rules:write"},
+}
+
+// ============================================================
+// AutomationEngine readiness
+// ============================================================
+
+// Platform URL of a SaaS environment (https://<id>.apps.dynatrace.com), or ""
+// for environments without the platform such as Managed
+func platformEnvironmentURL(envURL string) string {
+	parsed, err := url.Parse(strings.TrimSpace(envURL))
+	if err != nil || parsed.Host == "" {
+		return ""
+	}
+	host := parsed.Hostname()
+	switch {
+	case strings.Contains(host, ".apps."):
+	case strings.Contains(host, ".live."):
+		host = strings.Replace(host, ".live.", ".apps.", 1)
+	default:
+		return ""
+	}
+	return "https://" + host
+}
+
+// AutomationEngine resource types in the bundle and the OAuth scopes they need
+func bundleAutomationScopes() ([]string, []string, error) {
+	blocks, err := parseTerraformFiles(".")
+	if err != nil {
+		return nil, nil, err
+	}
+	typeSet, scopeSet := make(map[string]bool), make(map[string]bool)
+	for _, block := range blocks {
+		if block.Type != "resource" || len(block.Labels) == 0 || !strings.HasPrefix(block.Labels[0], "dynatrace_automation_") {
+			continue
+		}
+		typeSet[block.Labels[0]] = true
+		scopes, known := automationScopes[block.Labels[0]]
+		if !known {
+			scopes = automationScopes["dynatrace_automation_workflow"]
+		}
+		for _, scope := range scopes {
+			scopeSet[scope] = true
+		}
+	}
+	var types, scopes []string
+	for resourceType := range typeSet {
+		types = append(types, resourceType)
+	}
+	for scope := range scopeSet {
+		scopes = append(scopes, scope)
+	}
+	sort.Strings(types)
+	sort.Strings(scopes)
+	return types, scopes, nil
+}
+
+// Scopes the OAuth client is not granted, asking for each separately since
+// a rejected grant does not say which scope is missing
+func missingOAuthScopes(clientID, clientSecret, accountID string, scopes []string) ([]string, error) {
+	var missing []string
+	for _, scope := range scopes {
+		_, err := requestOAuthToken(clientID, clientSecret, accountID, scope)
+		var apiErr *apiError
+		switch {
+		case err == nil:
+		case errors.As(err, &apiErr) && apiErr.StatusCode == 400:
+			var reply struct {
+				Error string `json:"error"`
+			}
+			json.Unmarshal([]byte(apiErr.Body), &reply)
+			if reply.Error != "invalid_scope" {
+				return nil, err
+			}
+			missing = append(missing, scope)
+		default:
+			return nil, err
+		}
+	}
+	return missing, nil
+}
+
+// Probe the AutomationEngine API of the environment with a bearer token
+func probeAutomationEngine(platformURL, token string) error {
+	req, err := http.NewRequest(http.MethodGet, platformURL+"/platform/automation/v1/workflows?limit=1", nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	_, err = readAPIResponse(resp)
+	return err
+}
+
+// Problems that would make the bundle's AutomationEngine resources fail with
+// 403 or 404 responses mid-apply; network failures are only warnings
+func automationProblems(scopes []string, oauthClient bool) []string {
+	platformURL := platformEnvironmentURL(getEnv("DT_ENV_URL"))
+	if platformURL == "" {
+		return []string{fmt.Sprintf("%s has no AutomationEngine; workflows need a Dynatrace SaaS environment on the platform", getEnv("DT_ENV_URL"))}
+	}
+
+	var problems []string
+	token := getEnv("DT_PLATFORM_TOKEN")
+	clientID, clientSecret, accountID := getEnv("DT_CLIENT_ID"), getEnv("DT_CLIENT_SECRET"), getEnv("DT_ACCOUNT_ID")
+	if oauthClient && clientID != "" && clientSecret != "" {
+		missing, err := missingOAuthScopes(clientID, clientSecret, accountID, scopes)
+		if err != nil {
+			fmt.Printf("Warning: could not check the OAuth client's automation scopes: %v\n", err)
+			return nil
+		}
+		if len(missing) > 0 {
+			problems = append(problems, fmt.Sprintf("OAuth client %s lacks the automation scopes %s; add them under Account Management > Identity & access management > OAuth clients", clientID, strings.Join(missing, ", ")))
+			return problems
+		}
+		oauthToken, err := requestOAuthToken(clientID, clientSecret, accountID, strings.Join(scopes, " "))
+		if err != nil {
+			fmt.Printf("Warning: could not check AutomationEngine: %v\n", err)
+			return nil
+		}
+		token = oauthToken.AccessToken
+	}
+	if token == "" {
+		return []string{"AutomationEngine resources need an OAuth client (oauth_client = true) or a platform token (platform_token = true)"}
+	}
+
+	err := probeAutomationEngine(platformURL, token)
+	var apiErr *apiError
+	switch {
+	case err == nil:
+	case errors.As(err, &apiErr) && apiErr.StatusCode == 404:
+		problems = append(problems, fmt.Sprintf("AutomationEngine is not enabled on %s; enable Workflows for the environment first", platformURL))
+	case errors.As(err, &apiErr) && (apiErr.StatusCode == 401 || apiErr.StatusCode == 403):
+		problems = append(problems, fmt.Sprintf("AutomationEngine rejected the credentials (%v); grant them %s", err, strings.Join(scopes, ", ")))
+	default:
+		fmt.Printf("Warning: could not check AutomationEngine: %v\n", err)
+	}
+	return problems
+}
+
+// Check the environment and credentials are ready for the bundle's AutomationEngine
+// resources; interactive runs can fix the credentials and check again, non-interactive
+// runs fail unless -force is given
+func checkAutomationReadiness(oauthClient bool) error {
+	types, scopes, err := bundleAutomationScopes()
+	if err != nil || len(types) == 0 {
+		return err
+	}
+	reader := bufio.NewReader(os.Stdin)
+	for {
+		problems := automationProblems(scopes, oauthClient)
+		if len(problems) == 0 {
+			publishf("validator", "info", "AutomationEngine is ready for %s", strings.Join(types, ", "))
+			return nil
+		}
+		message := fmt.Sprintf("environment is not ready for %s:\n  %s", strings.Join(types, ", "), strings.Join(problems, "\n  "))
+		switch {
+		case forceGuards:
+			fmt.Printf("Warning: %s\nContinuing because of -force.\n", message)
+			return nil
+		case nonInteractive:
+			return fmt.Errorf("%s\nrerun with -force to continue anyway", message)
+		}
+		fmt.Printf("The %s\nFix this and press Enter to check again, or type skip to continue: ", message)
+		answer, err := reader.ReadString('\n')
+		if err != nil {
+			return fmt.Errorf("%s", message)
+		}
+		if strings.TrimSpace(strings.ToLower(answer)) == "skip" {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,117 @@
+/**
+* @license
+* Copyright 2020 Dynatrace LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	smtypes "github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	ssmtypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+)
+
+// ============================================================
+// AWS Secrets Manager and SSM Parameter Store references
+// ============================================================
+
+// Load AWS configuration from the default credential chain (environment, shared
+// config, web identity, ECS/CodeBuild container or EC2 instance credentials);
+// the region of an ARN reference takes precedence over the configured region
+func loadAWSConfig(ctx context.Context, ref string) (aws.Config, error) {
+	var options []func(*awsconfig.LoadOptions) error
+	if fields := strings.Split(ref, ":"); len(fields) > 3 && fields[0] == "arn" && fields[3] != "" {
+		options = append(options, awsconfig.WithRegion(fields[3]))
+	}
+	cfg, err := awsconfig.LoadDefaultConfig(ctx, options...)
+	if err != nil {
+		return aws.Config{}, fmt.Errorf("failed to load AWS configuration: %w", err)
+	}
+	return cfg, nil
+}
+
+// Resolve "aws-sm:<secret-id>[#<key>]"; with a key, the secret string is parsed as
+// a JSON object and the key's value returned
+func resolveAWSSecret(ref string) (string, error) {
+	secretID, key, hasKey := strings.Cut(ref, "#")
+	if secretID == "" {
+		return "", fmt.Errorf("aws-sm reference must be of the form aws-sm:<secret-id>[#<key>]")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	cfg, err := loadAWSConfig(ctx, secretID)
+	if err != nil {
+		return "", err
+	}
+	out, err := secretsmanager.NewFromConfig(cfg).GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{SecretId: aws.String(secretID)})
+	var notFound *smtypes.ResourceNotFoundException
+	if errors.As(err, &notFound) {
+		return "", fmt.Errorf("AWS secret %s: %w", secretID, errSecretNotFound)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read AWS secret %s: %w", secretID, err)
+	}
+	value := aws.ToString(out.SecretString)
+	if !hasKey {
+		return value, nil
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(value), &fields); err != nil {
+		return "", fmt.Errorf("AWS secret %s is not a JSON object: %w", secretID, err)
+	}
+	field, found := fields[key]
+	if !found {
+		return "", fmt.Errorf("AWS secret %s has no key %s: %w", secretID, key, errSecretNotFound)
+	}
+	if s, isString := field.(string); isString {
+		return s, nil
+	}
+	return fmt.Sprint(field), nil
+}
+
+// Resolve "aws-ssm:<parameter-name>", decrypting SecureString parameters
+func resolveAWSParameter(ref string) (string, error) {
+	if ref == "" {
+		return "", fmt.Errorf("aws-ssm reference must be of the form aws-ssm:<parameter-name>")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	cfg, err := loadAWSConfig(ctx, ref)
+	if err != nil {
+		return "", err
+	}
+	out, err := ssm.NewFromConfig(cfg).GetParameter(ctx, &ssm.GetParameterInput{Name: aws.String(ref), WithDecryption: aws.Bool(true)})
+	var notFound *ssmtypes.ParameterNotFound
+	if errors.As(err, &notFound) {
+		return "", fmt.Errorf("AWS parameter %s: %w", ref, errSecretNotFound)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read AWS parameter %s: %w", ref, err)
+	}
+	return aws.ToString(out.Parameter.Value), nil
+}
@@ -0,0 +1,85 @@
+/**
+* @license
+* Copyright 2020 Dynatrace LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/security/keyvault/azsecrets"
+)
+
+// ============================================================
+// Azure Key Vault references
+// ============================================================
+
+// DefaultAzureCredential shared by all references in a run
+var azureCredential struct {
+	once sync.Once
+	cred azcore.TokenCredential
+	err  error
+}
+
+// Resolve "azkv:<vault>/<secret>[/<version>]" using DefaultAzureCredential
+// (environment, workload identity, managed identity, Azure CLI); vault is the
+// vault name or its full https://<name>.vault.azure.net URL host
+func resolveAzureSecret(ref string) (string, error) {
+	vault, secret, found := strings.Cut(ref, "/")
+	if !found || vault == "" || secret == "" {
+		return "", fmt.Errorf("azkv reference must be of the form azkv:<vault>/<secret>[/<version>]")
+	}
+	secret, version, _ := strings.Cut(secret, "/")
+
+	vaultURL := "https://" + vault
+	if !strings.Contains(vault, ".") {
+		vaultURL += ".vault.azure.net"
+	}
+
+	azureCredential.once.Do(func() {
+		azureCredential.cred, azureCredential.err = azidentity.NewDefaultAzureCredential(nil)
+	})
+	if azureCredential.err != nil {
+		return "", fmt.Errorf("failed to create Azure credential: %w", azureCredential.err)
+	}
+	client, err := azsecrets.NewClient(vaultURL, azureCredential.cred, nil)
+	if err != nil {
+		return "", err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	resp, err := client.GetSecret(ctx, secret, version, nil)
+	var respErr *azcore.ResponseError
+	if errors.As(err, &respErr) && respErr.StatusCode == http.StatusNotFound {
+		return "", fmt.Errorf("Azure Key Vault secret %s/%s: %w", vault, secret, errSecretNotFound)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read Azure Key Vault secret %s/%s: %w", vault, secret, err)
+	}
+	if resp.Value == nil {
+		return "", fmt.Errorf("Azure Key Vault secret %s/%s has no value", vault, secret)
+	}
+	return *resp.Value, nil
+}
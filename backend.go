@@ -0,0 +1,143 @@
+/**
+* @license
+* Copyright 2020 Dynatrace LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// File the backend block is generated into
+const backendFileName = "backend.tf"
+
+// First line of a generated backend.tf; files without it are never overwritten
+const backendMarker = "# Generated by the Dynatrace Terraform wrapper from the backend key; do not edit."
+
+// Settings each backend needs through backend_config.<key> or -backend-config
+var backendRequiredSettings = map[string][]string{
+	"s3":      {"bucket", "key", "region"},
+	"azurerm": {"resource_group_name", "storage_account_name", "container_name", "key"},
+	"gcs":     {"bucket"},
+	"http":    {"address"},
+	"cloud":   {"organization", "workspace"},
+}
+
+// ============================================================
+// Remote state backend
+// ============================================================
+
+// Generate backend.tf for the backend key (s3, azurerm, gcs, http or cloud) and
+// migrate the state on init when the bundle switches from local state or from
+// another backend
+func setupBackend(config map[string]string) error {
+	backend := config["backend"]
+	if backend == "" || cliStacksAction != "" {
+		return nil
+	}
+	required, known := backendRequiredSettings[backend]
+	if !known {
+		return fmt.Errorf("unknown backend %q (expected s3, azurerm, gcs, http or cloud)", backend)
+	}
+	for _, setting := range required {
+		if config["backend_config."+setting] == "" && !backendConfigFlagSet(setting) {
+			return fmt.Errorf("the %s backend needs backend_config.%s", backend, setting)
+		}
+	}
+
+	content := backendMarker + "\n" + backendBlock(backend, config)
+	existing, err := os.ReadFile(backendFileName)
+	if err == nil && !strings.HasPrefix(string(existing), backendMarker) {
+		return fmt.Errorf("%s exists and was not generated by the wrapper; remove it or the backend key", backendFileName)
+	}
+	if string(existing) != content {
+		if err := os.WriteFile(backendFileName, []byte(content), 0644); err != nil {
+			return err
+		}
+		fmt.Printf("Wrote the %s backend to %s.\n", backend, backendFileName)
+	}
+
+	if current := initializedBackend(); current != backend && !cliReconfigure {
+		_, statErr := os.Stat("terraform.tfstate")
+		if current != "" || statErr == nil {
+			from := current
+			if from == "" {
+				from = "local"
+			}
+			fmt.Printf("Switching from %s state to the %s backend; init migrates the state.\n", from, backend)
+			cliMigrateState = true
+		}
+	}
+	return nil
+}
+
+// Whether -backend-config sets the given key
+func backendConfigFlagSet(key string) bool {
+	for _, value := range cliBackendConfigs.values {
+		if name, _, found := strings.Cut(value, "="); found && strings.TrimSpace(name) == key {
+			return true
+		}
+	}
+	return false
+}
+
+// Terraform block for the backend; settings other than the cloud block's are
+// left to -backend-config so that secrets never land in backend.tf
+func backendBlock(backend string, config map[string]string) string {
+	if backend == "cloud" {
+		hostname := ""
+		if host := config["backend_config.hostname"]; host != "" {
+			hostname = "    hostname     = " + strconv.Quote(host) + "\n"
+		}
+		return fmt.Sprintf("terraform {\n  cloud {\n%s    organization = %s\n\n    workspaces {\n      name = %s\n    }\n  }\n}\n",
+			hostname, strconv.Quote(config["backend_config.organization"]), strconv.Quote(config["backend_config.workspace"]))
+	}
+	var keys []string
+	for key := range config {
+		if setting, found := strings.CutPrefix(key, "backend_config."); found {
+			keys = append(keys, setting)
+		}
+	}
+	sort.Strings(keys)
+	comment := ""
+	if len(keys) > 0 {
+		comment = "    # Settings passed on init: " + strings.Join(keys, ", ") + "\n"
+	}
+	return fmt.Sprintf("terraform {\n  backend %s {\n%s  }\n}\n", strconv.Quote(backend), comment)
+}
+
+// Type of the backend the working directory was last initialized with, "" for local state
+func initializedBackend() string {
+	content, err := os.ReadFile(filepath.Join(".terraform", "terraform.tfstate"))
+	if err != nil {
+		return ""
+	}
+	var state struct {
+		Backend *struct {
+			Type string `json:"type"`
+		} `json:"backend"`
+	}
+	if json.Unmarshal(content, &state) != nil || state.Backend == nil || state.Backend.Type == "local" {
+		return ""
+	}
+	return state.Backend.Type
+}
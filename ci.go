@@ -0,0 +1,159 @@
+/**
+* @license
+* Copyright 2020 Dynatrace LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Plan file written by the plan stage of the check pipeline
+const ciPlanFileName = "ci.tfplan"
+
+// Marker identifying a pre-push hook installed by the wrapper
+const ciHookMarker = "# Installed by the Dynatrace Terraform wrapper"
+
+// Exit codes of the check pipeline, one per failing stage
+const (
+	ciExitFormat   = 3
+	ciExitValidate = 4
+	ciExitPolicy   = 5
+	ciExitPlan     = 6
+)
+
+// ============================================================
+// Run the CI check pipeline locally
+// ============================================================
+
+// Single stage of the check pipeline
+type ciStage struct {
+	Name     string
+	ExitCode int
+	Run      func() error
+}
+
+// The stages -ci-local runs, in order. The plan stage plans exactly like -plan,
+// with the same parallelism, targets, replacements and plan checks, and
+// reports through planned whether the plan has changes
+func ciStages(terraformPath string, logFile *os.File, config map[string]string, planned *bool) []ciStage {
+	return []ciStage{
+		{"fmt", ciExitFormat, func() error {
+			return executeTerraformCommand(terraformPath, logFile, "fmt", "-check", "-recursive", "-diff")
+		}},
+		{"validate", ciExitValidate, func() error {
+			return executeTerraformCommand(terraformPath, logFile, "validate")
+		}},
+		{"policy", ciExitPolicy, func() error {
+			return runPolicyChecks(config)
+		}},
+		{"plan", ciExitPlan, func() error {
+			defer os.Remove(ciPlanFileName)
+			if err := checkStateTarget(terraformPath, logFile); err != nil {
+				return err
+			}
+			if err := writePlan(terraformPath, logFile, ciPlanFileName); err != nil {
+				return err
+			}
+			changes, err := planHasChanges(terraformPath, logFile, ciPlanFileName)
+			*planned = changes
+			return err
+		}},
+	}
+}
+
+// Lint the wrapper configuration and run the configured policy_command, if any,
+// in the package directory
+func runPolicyChecks(config map[string]string) error {
+	if !lintConfig(activeConfigFile()) {
+		return fmt.Errorf("%s has errors", activeConfigFile())
+	}
+	command := strings.Fields(config["policy_command"])
+	if len(command) == 0 {
+		return nil
+	}
+	cmd := exec.Command(command[0], command[1:]...)
+	stdout, stderr := newScrubWriter(os.Stdout), newScrubWriter(os.Stderr)
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+	err := cmd.Run()
+	stdout.Flush()
+	stderr.Flush()
+	if err != nil {
+		return fmt.Errorf("%s: %w", config["policy_command"], err)
+	}
+	return nil
+}
+
+// Run every stage, stopping at the first failure; returns the exit code of the
+// failed stage, else exitChanges when the plan has changes, like -plan
+func runCIPipeline(terraformPath string, logFile *os.File, config map[string]string) int {
+	planned := false
+	for _, stage := range ciStages(terraformPath, logFile, config, &planned) {
+		fmt.Printf("\n==> %s\n", stage.Name)
+		publishf("ci", "start", "Running %s", stage.Name)
+		if err := stage.Run(); err != nil {
+			explainTerraformError(err)
+			fmt.Printf("FAILED: %s: %v\n", stage.Name, err)
+			publishf("ci", "error", "%s failed: %v", stage.Name, err)
+			return stage.ExitCode
+		}
+		publishf("ci", "done", "%s passed", stage.Name)
+	}
+	if planned {
+		fmt.Println("\nAll checks passed; the plan has changes.")
+		return exitChanges
+	}
+	fmt.Println("\nAll checks passed.")
+	return exitOK
+}
+
+// Install a git pre-push hook running -ci-local in the package directory
+func installPrePushHook() error {
+	out, err := exec.Command("git", "rev-parse", "--path-format=absolute", "--git-path", "hooks").Output()
+	if err != nil {
+		return fmt.Errorf("not inside a git repository: %w", err)
+	}
+	hooksDir := strings.TrimSpace(string(out))
+	hookPath := filepath.Join(hooksDir, "pre-push")
+
+	if existing, err := os.ReadFile(hookPath); err == nil && !strings.Contains(string(existing), ciHookMarker) && !forceGuards {
+		return fmt.Errorf("%s already exists; use -force to replace it", hookPath)
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	dir, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+
+	// Planned changes are what a push is for, so only failed checks block it
+	hook := fmt.Sprintf("#!/bin/sh\n%s\ncd %q && %q -ci-local\ncode=$?\n[ $code -eq %d ] && exit 0\nexit $code\n", ciHookMarker, dir, executable, exitChanges)
+	if err := os.MkdirAll(hooksDir, 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(hookPath, []byte(hook), 0755); err != nil {
+		return err
+	}
+	fmt.Printf("Installed pre-push hook %s.\n", hookPath)
+	return nil
+}
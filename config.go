@@ -0,0 +1,433 @@
+/**
+* @license
+* Copyright 2020 Dynatrace LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// ============================================================
+// Load prepackaged configuration
+// ============================================================
+
+// Load configuration from file, layering any included files and the user-level
+// configuration beneath it
+func loadConfig(fileName string) (map[string]string, bool, bool, error) {
+	config := make(map[string]string)
+	if err := readUserConfig(config); err != nil {
+		return nil, false, false, err
+	}
+	if err := readConfigFile(fileName, config, make(map[string]bool)); err != nil {
+		return nil, false, false, err
+	}
+
+	apiToken := config["api_token"] == "true"
+	oauthClient := config["oauth_client"] == "true"
+
+	return config, apiToken, oauthClient, nil
+}
+
+// Use wrapper.toml when present, then wrapper.cfg.tmpl, otherwise wrapper.cfg
+func activeConfigFile() string {
+	for _, fileName := range []string{tomlConfigFileName, templateConfigFileName} {
+		if _, err := os.Stat(bundlePath(fileName)); err == nil {
+			return bundlePath(fileName)
+		}
+	}
+	return bundlePath(configFileName)
+}
+
+// Values passed with -tmpl-var for rendering configuration templates
+var templateVars = make(map[string]string)
+
+// Read a configuration file's contents, rendering it first if it is a template
+func readConfigSource(fileName string) (string, error) {
+	src, err := os.ReadFile(fileName)
+	if err != nil {
+		return "", err
+	}
+	if !strings.HasSuffix(fileName, ".tmpl") {
+		return string(src), nil
+	}
+	return renderConfigTemplate(fileName, string(src))
+}
+
+// Render a configuration template with -tmpl-var values (.Vars) and the
+// environment (.Env); referencing an undefined .Vars key is an error
+func renderConfigTemplate(fileName, src string) (string, error) {
+	env := make(map[string]string)
+	for _, entry := range os.Environ() {
+		if key, value, found := strings.Cut(entry, "="); found {
+			env[key] = value
+		}
+	}
+
+	funcs := template.FuncMap{
+		"env": os.Getenv,
+		"default": func(fallback, value string) string {
+			if value == "" {
+				return fallback
+			}
+			return value
+		},
+		"required": func(name, value string) (string, error) {
+			if value == "" {
+				return "", fmt.Errorf("%s is required", name)
+			}
+			return value, nil
+		},
+	}
+
+	tmpl, err := template.New(filepath.Base(fileName)).Funcs(funcs).Option("missingkey=error").Parse(src)
+	if err != nil {
+		return "", err
+	}
+
+	var out strings.Builder
+	data := map[string]map[string]string{"Vars": templateVars, "Env": env}
+	if err := tmpl.Execute(&out, data); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+// Path of the user-level configuration holding personal defaults for every bundle
+func userConfigPath() string {
+	configHome := os.Getenv("XDG_CONFIG_HOME")
+	if configHome == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		configHome = filepath.Join(home, ".config")
+	}
+	return filepath.Join(configHome, "dt-tf-wrapper", "config")
+}
+
+// Read the user-level configuration into config, if it exists
+func readUserConfig(config map[string]string) error {
+	userPath := userConfigPath()
+	if userPath == "" {
+		return nil
+	}
+	if _, err := os.Stat(userPath); err != nil {
+		return nil
+	}
+	return readConfigFile(userPath, config, make(map[string]bool))
+}
+
+// Apply operator preferences (log level, proxy, plugin cache) to the environment
+// unless the shell already sets them
+func applyUserSettings(config map[string]string) error {
+	settings := map[string][]string{
+		"log_level":        {"TF_LOG"},
+		"proxy":            {"HTTPS_PROXY", "HTTP_PROXY"},
+		"plugin_cache_dir": {"TF_PLUGIN_CACHE_DIR"},
+	}
+	for key, envKeys := range settings {
+		value := config[key]
+		if value == "" {
+			continue
+		}
+		if key == "plugin_cache_dir" {
+			if err := os.MkdirAll(value, 0755); err != nil {
+				return fmt.Errorf("failed to create plugin cache directory: %w", err)
+			}
+		}
+		for _, envKey := range envKeys {
+			if _, isSet := lookupEnv(envKey); !isSet {
+				exportEnv(envKey, value)
+			}
+		}
+	}
+	return nil
+}
+
+// Read a single configuration file into config; included files are merged where
+// the include directive appears so that later lines and files win
+func readConfigFile(fileName string, config map[string]string, including map[string]bool) error {
+	absPath, err := filepath.Abs(fileName)
+	if err != nil {
+		return err
+	}
+	if including[absPath] {
+		return fmt.Errorf("circular include of %s", fileName)
+	}
+	including[absPath] = true
+	defer delete(including, absPath)
+
+	if strings.HasSuffix(fileName, ".toml") {
+		return readTOMLConfigFile(fileName, config, including)
+	}
+
+	src, err := readConfigSource(fileName)
+	if err != nil {
+		return err
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(src))
+	for scanner.Scan() {
+		key, value, ok := parseConfigLine(scanner.Text())
+		if !ok {
+			continue
+		}
+
+		if key == "include" {
+			if err := readIncludedConfig(fileName, value, config, including); err != nil {
+				return err
+			}
+			continue
+		}
+
+		config[key] = value
+	}
+
+	return scanner.Err()
+}
+
+// Configuration file that sets key in the effective configuration: the active
+// configuration file or one it includes, else the user-level configuration or
+// one it includes; empty when none sets it
+func definingConfigFile(key string) (string, error) {
+	for _, fileName := range []string{activeConfigFile(), userConfigPath()} {
+		if fileName == "" {
+			continue
+		}
+		if _, err := os.Stat(fileName); err != nil {
+			continue
+		}
+		defining, err := configKeyFile(fileName, key, make(map[string]bool))
+		if err != nil || defining != "" {
+			return defining, err
+		}
+	}
+	return "", nil
+}
+
+// The file among fileName and its includes whose value for key wins, following
+// the order readConfigFile merges them in; empty when none sets key
+func configKeyFile(fileName, key string, including map[string]bool) (string, error) {
+	absPath, err := filepath.Abs(fileName)
+	if err != nil {
+		return "", err
+	}
+	if including[absPath] {
+		return "", fmt.Errorf("circular include of %s", fileName)
+	}
+	including[absPath] = true
+	defer delete(including, absPath)
+
+	if strings.HasSuffix(fileName, ".toml") {
+		return tomlConfigKeyFile(fileName, key, including)
+	}
+
+	src, err := readConfigSource(fileName)
+	if err != nil {
+		return "", err
+	}
+	var defining string
+	scanner := bufio.NewScanner(strings.NewReader(src))
+	for scanner.Scan() {
+		lineKey, value, ok := parseConfigLine(scanner.Text())
+		switch {
+		case !ok:
+		case lineKey == "include":
+			included, err := configKeyFile(includedConfigPath(fileName, value), key, including)
+			if err != nil {
+				return "", err
+			}
+			if included != "" {
+				defining = included
+			}
+		case lineKey == key:
+			defining = fileName
+		}
+	}
+	return defining, scanner.Err()
+}
+
+// Path of an included file, relative to the including file unless absolute
+func includedConfigPath(fileName, include string) string {
+	if filepath.IsAbs(include) {
+		return include
+	}
+	return filepath.Join(filepath.Dir(fileName), include)
+}
+
+// Read an included file, resolving its path relative to the including file
+func readIncludedConfig(fileName, include string, config map[string]string, including map[string]bool) error {
+	if err := readConfigFile(includedConfigPath(fileName, include), config, including); err != nil {
+		return fmt.Errorf("%s: include %s: %w", fileName, include, err)
+	}
+	return nil
+}
+
+// Parse a "key = value" line, skipping blank and comment lines; values may be
+// quoted to keep '=', '#' or ';' characters, otherwise trailing comments are dropped
+func parseConfigLine(line string) (string, string, bool) {
+	line = strings.TrimPrefix(line, "\ufeff")
+	line = strings.TrimSpace(strings.TrimRight(line, "\r"))
+	if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+		return "", "", false
+	}
+
+	index := strings.Index(line, "=")
+	if index < 0 {
+		return "", "", false
+	}
+	key, rest := strings.TrimSpace(line[:index]), strings.TrimSpace(line[index+1:])
+	if key == "" {
+		return "", "", false
+	}
+
+	if value, ok := unquoteConfigValue(rest); ok {
+		return key, value, true
+	}
+
+	for i := 1; i < len(rest); i++ {
+		if (rest[i] == '#' || rest[i] == ';') && (rest[i-1] == ' ' || rest[i-1] == '\t') {
+			rest = strings.TrimSpace(rest[:i])
+			break
+		}
+	}
+	return key, rest, true
+}
+
+// Return the contents of a single- or double-quoted value; anything after the
+// closing quote is treated as a comment
+func unquoteConfigValue(rest string) (string, bool) {
+	if len(rest) < 2 || (rest[0] != '"' && rest[0] != '\'') {
+		return "", false
+	}
+
+	quote := rest[0]
+	var value strings.Builder
+	for i := 1; i < len(rest); i++ {
+		switch {
+		case rest[i] == quote:
+			return value.String(), true
+		case quote == '"' && rest[i] == '\\' && i+1 < len(rest):
+			i++
+			value.WriteByte(rest[i])
+		default:
+			value.WriteByte(rest[i])
+		}
+	}
+	return "", false
+}
+
+// Wrapped by resolvers when the referenced secret or field does not exist, as
+// opposed to a store that cannot be reached or refuses access
+var errSecretNotFound = errors.New("secret not found")
+
+// Resolvers for value references, keyed by their prefix
+var secretResolvers = map[string]func(ref string) (string, error){
+	"file:":    readSecretFile,
+	"vault:":   resolveVaultSecret,
+	"aws-sm:":  resolveAWSSecret,
+	"aws-ssm:": resolveAWSParameter,
+	"azkv:":    resolveAzureSecret,
+	"gsm:":     resolveGoogleSecret,
+}
+
+// Split a value reference into its prefix and reference, if it is one
+func secretReference(value string) (string, string, bool) {
+	for prefix := range secretResolvers {
+		if ref, found := strings.CutPrefix(value, prefix); found {
+			return prefix, ref, true
+		}
+	}
+	return "", "", false
+}
+
+// Resolve value references to their contents; "file:<path>" reads the value
+// from a file such as a mounted Kubernetes or Docker secret, "vault:<path>#<field>"
+// from HashiCorp Vault, "aws-sm:" and "aws-ssm:" from AWS Secrets Manager and
+// SSM Parameter Store, "azkv:<vault>/<secret>" from Azure Key Vault and
+// "gsm:projects/<project>/secrets/<secret>" from Google Secret Manager
+func resolveConfigValue(value string) (string, error) {
+	if prefix, ref, found := secretReference(value); found {
+		return secretResolvers[prefix](ref)
+	}
+	return value, nil
+}
+
+// Read a secret value from a file
+func readSecretFile(path string) (string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret file: %w", err)
+	}
+	return strings.TrimRight(string(content), "\r\n"), nil
+}
+
+// Format a value for writing to a config file, quoting it when it would not
+// survive parsing unquoted; only \ and " are escaped, as unquoteConfigValue
+// takes the character after a backslash literally
+func formatConfigValue(value string) string {
+	if value != strings.TrimSpace(value) || strings.ContainsAny(value, "#;\"'") {
+		return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+	}
+	return value
+}
+
+// Check whether a configuration key holds a secret value
+func isSecretKey(key string) bool {
+	if strings.HasSuffix(key, ".prompt") || strings.HasSuffix(key, ".required") {
+		return false
+	}
+	upperKey := strings.ToUpper(key)
+	for _, marker := range []string{"TOKEN", "SECRET", "PASSWORD", "ENCRYPTION_KEY"} {
+		if strings.Contains(upperKey, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// Mask secret value for display
+func maskValue(value string) string {
+	if value == "" {
+		return ""
+	}
+	return "********"
+}
+
+// Print merged configuration with secrets masked
+func showEffectiveConfig(config map[string]string) {
+	keys := make([]string, 0, len(config))
+	for key := range config {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		value := config[key]
+		if isSecretKey(key) && value != "true" && value != "false" {
+			value = maskValue(value)
+		}
+		fmt.Printf("%s = %s\n", key, value)
+	}
+}
@@ -0,0 +1,148 @@
+/**
+* @license
+* Copyright 2020 Dynatrace LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseConfigLine(t *testing.T) {
+	tests := []struct {
+		line  string
+		key   string
+		value string
+		ok    bool
+	}{
+		{"DT_ENV_URL = https://abc12345.live.dynatrace.com", "DT_ENV_URL", "https://abc12345.live.dynatrace.com", true},
+		{"  parallelism=4  ", "parallelism", "4", true},
+		{"\ufeffapi_token = true\r", "api_token", "true", true},
+		{"# api_token = true", "", "", false},
+		{"; api_token = true", "", "", false},
+		{"", "", "", false},
+		{"no separator", "", "", false},
+		{" = value", "", "", false},
+		{"empty =", "empty", "", true},
+		{"timeout = 30m # per command", "timeout", "30m", true},
+		{"timeout = 30m\t; per command", "timeout", "30m", true},
+		{"DT_ENV_URL = https://host/#/dashboards", "DT_ENV_URL", "https://host/#/dashboards", true},
+		{"filter = a=b", "filter", "a=b", true},
+		{`secret = "dt0c01.A # not a comment" # comment`, "secret", "dt0c01.A # not a comment", true},
+		{`secret = 'single ; quoted' ; comment`, "secret", "single ; quoted", true},
+		{`secret = "escaped \" quote and \\ backslash"`, "secret", `escaped " quote and \ backslash`, true},
+		{`secret = 'no \escapes'`, "secret", `no \escapes`, true},
+		{`secret = "  padded  "`, "secret", "  padded  ", true},
+		{`secret = ""`, "secret", "", true},
+		{`secret = "unterminated # comment`, "secret", `"unterminated`, true},
+	}
+	for _, test := range tests {
+		key, value, ok := parseConfigLine(test.line)
+		if key != test.key || value != test.value || ok != test.ok {
+			t.Errorf("parseConfigLine(%q) = %q, %q, %v; want %q, %q, %v", test.line, key, value, ok, test.key, test.value, test.ok)
+		}
+	}
+}
+
+func TestUnquoteConfigValue(t *testing.T) {
+	tests := []struct {
+		rest  string
+		value string
+		ok    bool
+	}{
+		{`"quoted"`, "quoted", true},
+		{`'quoted'`, "quoted", true},
+		{`"a" trailing`, "a", true},
+		{`"mixed 'quotes'"`, "mixed 'quotes'", true},
+		{`'mixed "quotes"'`, `mixed "quotes"`, true},
+		{`"\\"`, `\`, true},
+		{`"`, "", false},
+		{`"open`, "", false},
+		{`"ends in escape\"`, "", false},
+		{"plain", "", false},
+		{"", "", false},
+	}
+	for _, test := range tests {
+		value, ok := unquoteConfigValue(test.rest)
+		if value != test.value || ok != test.ok {
+			t.Errorf("unquoteConfigValue(%q) = %q, %v; want %q, %v", test.rest, value, ok, test.value, test.ok)
+		}
+	}
+}
+
+func TestFormatConfigValueRoundTrip(t *testing.T) {
+	tests := []string{
+		"plain",
+		"https://abc12345.live.dynatrace.com",
+		`C:\Users\ops\token.txt`,
+		`say "hi"`,
+		`it's`,
+		"a # not a comment",
+		"a;b",
+		"  padded  ",
+		"tab\tinside #",
+		`\"already escaped\"`,
+		"ünïcode; text",
+	}
+	for _, value := range tests {
+		line := "key = " + formatConfigValue(value)
+		key, got, ok := parseConfigLine(line)
+		if !ok || key != "key" || got != value {
+			t.Errorf("parseConfigLine(%q) = %q, %q, %v; want %q", line, key, got, ok, value)
+		}
+	}
+}
+
+func TestDefiningConfigFile(t *testing.T) {
+	t.Chdir(t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	userPath := userConfigPath()
+	write := func(name, content string) {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(userPath, "DT_API_TOKEN = user\nDT_ENV_URL = https://user.live.dynatrace.com\n")
+	write(configFileName, "DT_ENV_URL = https://abc12345.live.dynatrace.com\ninclude = secrets/tokens.cfg\nDT_CLIENT_ID = bundle\n")
+	write(filepath.Join("secrets", "tokens.cfg"), "DT_API_TOKEN = included\nDT_CLIENT_ID = included\n")
+
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{"DT_API_TOKEN", filepath.Join("secrets", "tokens.cfg")},
+		{"DT_CLIENT_ID", configFileName},
+		{"DT_ENV_URL", configFileName},
+		{"DT_CLIENT_SECRET", ""},
+	}
+	for _, test := range tests {
+		got, err := definingConfigFile(test.key)
+		if err != nil || got != test.want {
+			t.Errorf("definingConfigFile(%s) = %q, %v; want %q", test.key, got, err, test.want)
+		}
+	}
+
+	write(configFileName, "DT_ENV_URL = https://abc12345.live.dynatrace.com\n")
+	if got, err := definingConfigFile("DT_API_TOKEN"); err != nil || got != userPath {
+		t.Errorf("token only in the user-level configuration: got %q, %v; want %q", got, err, userPath)
+	}
+}
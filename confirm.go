@@ -0,0 +1,136 @@
+/**
+* @license
+* Copyright 2020 Dynatrace LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Set by -confirm-apply or apply_confirm = true: apply asks before changing anything
+// instead of running with -auto-approve; ignored in non-interactive mode
+var (
+	cliConfirmApply bool
+	confirmApply    bool
+)
+
+var planTotalsPattern = regexp.MustCompile(`Plan: (\d+) to add, (\d+) to change, (\d+) to destroy`)
+
+// ============================================================
+// Interactive apply confirmation
+// ============================================================
+
+// Read apply_confirm
+func setupApplyConfirmation(config map[string]string) {
+	confirmApply = (cliConfirmApply || config["apply_confirm"] == "true") && !nonInteractive
+}
+
+// Number of changes in the totals line of plan output
+func planChangeCount(output string) int {
+	match := planTotalsPattern.FindStringSubmatch(output)
+	if match == nil {
+		return 0
+	}
+	total := 0
+	for _, count := range match[1:] {
+		n, _ := strconv.Atoi(count)
+		total += n
+	}
+	return total
+}
+
+// Show the plan summary and ask whether to apply it
+func askApplyConfirmation(output string) bool {
+	summary, _ := summarizePlan(output)
+	fmt.Printf("\n%s\n", summary)
+	fmt.Printf("Apply these %d changes? (yes/no): ", planChangeCount(output))
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "yes" || answer == "y"
+}
+
+// Observer of an apply run without -auto-approve: when Terraform asks for
+// approval it shows the summary, asks the user and feeds the answer to
+// Terraform's standard input
+type applyConfirmer struct {
+	io.Writer
+	mu       sync.Mutex
+	output   strings.Builder
+	asked    bool
+	stdin    *io.PipeReader
+	answer   *io.PipeWriter
+	approved bool
+}
+
+func newApplyConfirmer(observer io.Writer) *applyConfirmer {
+	stdin, answer := io.Pipe()
+	c := &applyConfirmer{stdin: stdin, answer: answer}
+	c.Writer = io.MultiWriter(observer, writerFunc(c.observe))
+	return c
+}
+
+// Standard input for the Terraform command
+func (c *applyConfirmer) Stdin() io.Reader {
+	return c.stdin
+}
+
+func (c *applyConfirmer) observe(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.output.Write(p)
+	if !c.asked && strings.Contains(c.output.String(), "Enter a value:") {
+		c.asked = true
+		output := c.output.String()
+		go func() {
+			approved := askApplyConfirmation(output)
+			c.mu.Lock()
+			c.approved = approved
+			c.mu.Unlock()
+			reply := "no"
+			if approved {
+				reply = "yes"
+			}
+			fmt.Fprintln(c.answer, reply)
+			c.answer.Close()
+		}()
+	}
+	return len(p), nil
+}
+
+// Whether Terraform asked for approval and the user declined
+func (c *applyConfirmer) Cancelled() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.asked && !c.approved
+}
+
+// Release Terraform's standard input once the command has finished
+func (c *applyConfirmer) Close() {
+	c.answer.Close()
+}
+
+// Adapter turning a function into an io.Writer
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) { return f(p) }
@@ -0,0 +1,196 @@
+/**
+* @license
+* Copyright 2020 Dynatrace LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Sources consulted for each credential unless credential_providers says otherwise
+var defaultCredentialChain = []string{"env", "config", "keychain", "session", "prompt"}
+
+// ============================================================
+// Credential providers
+// ============================================================
+
+// Value requested from the provider chain
+type credentialRequest struct {
+	EnvKey    string
+	PromptMsg string
+	Config    map[string]string
+	Reader    *bufio.Reader
+}
+
+// Source of credential values; found is false when the provider has no value so
+// the next provider in the chain is asked
+type credentialProvider interface {
+	Resolve(req credentialRequest) (value string, found bool, err error)
+}
+
+// Providers by the name used in credential_providers
+var credentialProviders = map[string]credentialProvider{
+	"env":      envProvider{},
+	"config":   configProvider{},
+	"keychain": keychainProvider{},
+	"session":  sessionProvider{},
+	"prompt":   promptProvider{},
+	"vault":    storeProvider{"vault:", func(base, envKey string) string { return base + "#" + envKey }},
+	"aws-sm":   storeProvider{"aws-sm:", func(base, envKey string) string { return base + "#" + envKey }},
+	"aws-ssm":  storeProvider{"aws-ssm:", func(base, envKey string) string { return strings.TrimRight(base, "/") + "/" + envKey }},
+	// Key Vault secret names allow only letters, digits and dashes
+	"azkv": storeProvider{"azkv:", func(base, envKey string) string { return base + "/" + strings.ReplaceAll(envKey, "_", "-") }},
+	"gsm":  storeProvider{"gsm:", func(base, envKey string) string { return base + "/secrets/" + envKey }},
+}
+
+// Ordered providers from credential_providers
+func credentialChain(config map[string]string) ([]credentialProvider, error) {
+	names := defaultCredentialChain
+	if value := config["credential_providers"]; value != "" {
+		names = nil
+		for _, name := range strings.Split(value, ",") {
+			names = append(names, strings.TrimSpace(name))
+		}
+	}
+	chain := make([]credentialProvider, 0, len(names))
+	for _, name := range names {
+		provider, found := credentialProviders[name]
+		if !found {
+			return nil, fmt.Errorf("unknown credential provider %q", name)
+		}
+		chain = append(chain, provider)
+	}
+	return chain, nil
+}
+
+// Values already in the environment
+type envProvider struct{}
+
+func (envProvider) Resolve(req credentialRequest) (string, bool, error) {
+	value, found := lookupEnv(req.EnvKey)
+	return value, found, nil
+}
+
+// Values in the configuration, with file:, vault: and cloud store references resolved
+type configProvider struct{}
+
+func (configProvider) Resolve(req credentialRequest) (string, bool, error) {
+	configValue, found := req.Config[req.EnvKey]
+	if !found {
+		return "", false, nil
+	}
+	value, err := resolveConfigValue(configValue)
+	if err != nil {
+		return "", false, fmt.Errorf("%s: %w", req.EnvKey, err)
+	}
+	return value, true, nil
+}
+
+// Secrets saved in the OS keychain
+type keychainProvider struct{}
+
+func (keychainProvider) Resolve(req credentialRequest) (string, bool, error) {
+	value, found := lookupKeychain(req.EnvKey, req.Config)
+	return value, found, nil
+}
+
+// Values prompted for by an earlier run of the session
+type sessionProvider struct{}
+
+func (sessionProvider) Resolve(req credentialRequest) (string, bool, error) {
+	value, found := lookupSessionCache(req.EnvKey)
+	return value, found, nil
+}
+
+// Secrets stored under a common location in a secret store, configured as
+// credentials.<provider> (e.g. credentials.vault = secret/data/dynatrace) and
+// named after the environment variable
+type storeProvider struct {
+	prefix    string
+	reference func(base, envKey string) string
+}
+
+func (p storeProvider) Resolve(req credentialRequest) (string, bool, error) {
+	base := req.Config["credentials."+strings.TrimSuffix(p.prefix, ":")]
+	if base == "" {
+		return "", false, nil
+	}
+	ref := p.reference(base, req.EnvKey)
+	value, err := secretResolvers[p.prefix](ref)
+	switch {
+	case errors.Is(err, errSecretNotFound):
+		// A store holding only some of the credentials is expected
+		publishf("credentials", "info", "%s%s not used: %v", p.prefix, ref, err)
+		return "", false, nil
+	case err != nil:
+		return "", false, fmt.Errorf("%s: %w", req.EnvKey, err)
+	}
+	return value, true, nil
+}
+
+// Interactive prompt honouring .prompt, .default and .required; in non-interactive
+// mode the default is used or a missing required value reported
+type promptProvider struct{}
+
+func (promptProvider) Resolve(req credentialRequest) (string, bool, error) {
+	envKey, config, promptMsg := req.EnvKey, req.Config, req.PromptMsg
+	if customPrompt, found := config[envKey+".prompt"]; found {
+		promptMsg = strings.TrimSpace(customPrompt) + " "
+	}
+	defaultValue := config[envKey+".default"]
+	if defaultValue != "" {
+		promptMsg += fmt.Sprintf("[%s] ", defaultValue)
+	}
+	required := config[envKey+".required"] == "true"
+
+	if nonInteractive {
+		switch {
+		case defaultValue != "":
+			return defaultValue, true, nil
+		case required || builtinEnvKeys[envKey]:
+			return "", false, errMissingValue
+		}
+		return "", false, nil
+	}
+
+	for {
+		fmt.Print(promptMsg)
+		inputValue, err := readPromptInput(envKey, req.Reader)
+		if inputValue == "" {
+			inputValue = defaultValue
+		}
+		if inputValue == "" && required && err == nil {
+			fmt.Printf("%s is required.\n", envKey)
+			continue
+		}
+		if inputValue != "" && err == nil {
+			if invalid := validateCredentialInput(envKey, inputValue); invalid != nil {
+				fmt.Printf("Invalid %s: %v. Please try again.\n", envKey, invalid)
+				continue
+			}
+		}
+		if inputValue != defaultValue {
+			storeSessionCache(envKey, inputValue)
+			offerKeychainSave(envKey, inputValue, config, req.Reader)
+		}
+		// Declared variables left empty are not passed so Terraform uses its default
+		return inputValue, inputValue != "" || !isDeclaredVar(envKey, config), nil
+	}
+}
@@ -0,0 +1,63 @@
+/**
+* @license
+* Copyright 2020 Dynatrace LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestStoreProviderErrors(t *testing.T) {
+	vault := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/secret/dynatrace":
+			w.Write([]byte(`{"data": {"DT_API_TOKEN": "dt0c01.ABC.SECRET"}}`))
+		case "/v1/secret/denied":
+			http.Error(w, `{"errors": ["permission denied"]}`, http.StatusForbidden)
+		default:
+			http.Error(w, `{"errors": []}`, http.StatusNotFound)
+		}
+	}))
+	defer vault.Close()
+	t.Setenv("VAULT_ADDR", vault.URL)
+	t.Setenv("VAULT_TOKEN", "test")
+
+	tests := []struct {
+		name      string
+		base      string
+		envKey    string
+		wantValue string
+		wantFound bool
+		wantErr   bool
+	}{
+		{"stored", "secret/dynatrace", "DT_API_TOKEN", "dt0c01.ABC.SECRET", true, false},
+		{"field not stored", "secret/dynatrace", "DT_CLIENT_SECRET", "", false, false},
+		{"secret not stored", "secret/other", "DT_API_TOKEN", "", false, false},
+		{"access denied", "secret/denied", "DT_API_TOKEN", "", false, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := credentialRequest{EnvKey: test.envKey, Config: map[string]string{"credentials.vault": test.base}}
+			value, found, err := credentialProviders["vault"].Resolve(req)
+			if value != test.wantValue || found != test.wantFound || (err != nil) != test.wantErr {
+				t.Errorf("Resolve = %q, %v, %v; want %q, %v, error %v", value, found, err, test.wantValue, test.wantFound, test.wantErr)
+			}
+		})
+	}
+}
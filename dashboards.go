@@ -0,0 +1,228 @@
+/**
+* @license
+* Copyright 2020 Dynatrace LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// Directory pulled dashboards are written to unless -dashboard-file is given
+const dashboardDirName = "dashboards"
+
+// File the resources of newly pulled dashboards are declared in
+const dashboardResourceFileName = "dashboards.tf"
+
+// ============================================================
+// Dashboard JSON round-trip
+// ============================================================
+
+// Dashboard JSON as the provider manages it: without the ID and the metadata
+// the environment maintains
+func normalizeDashboard(dashboard map[string]any) map[string]any {
+	delete(dashboard, "id")
+	delete(dashboard, "metadata")
+	return dashboard
+}
+
+// Fetch a dashboard's JSON from the environment
+func fetchDashboard(id string) (map[string]any, error) {
+	var dashboard map[string]any
+	if err := dynatraceGet("/api/config/v1/dashboards/"+url.PathEscape(id), &dashboard); err != nil {
+		return nil, err
+	}
+	return normalizeDashboard(dashboard), nil
+}
+
+// Read a local dashboard JSON file
+func readDashboardFile(fileName string) (map[string]any, error) {
+	content, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	var dashboard map[string]any
+	if err := json.Unmarshal(content, &dashboard); err != nil {
+		return nil, fmt.Errorf("%s is not valid dashboard JSON: %w", fileName, err)
+	}
+	return normalizeDashboard(dashboard), nil
+}
+
+// Address of the dynatrace_json_dashboard resource whose contents reference
+// fileName, empty when none does
+func dashboardResourceFor(fileName string) (string, error) {
+	blocks, err := parseTerraformFiles(".")
+	if err != nil {
+		return "", err
+	}
+	reference := filepath.ToSlash(filepath.Clean(fileName))
+	for _, block := range blocks {
+		if block.Type != "resource" || len(block.Labels) != 2 || block.Labels[0] != "dynatrace_json_dashboard" {
+			continue
+		}
+		if strings.Contains(block.Attributes["contents"], reference) {
+			return block.Labels[0] + "." + block.Labels[1], nil
+		}
+	}
+	return "", nil
+}
+
+// Pull a dashboard's JSON into fileName (dashboards/<name>.json when empty) and,
+// unless a dynatrace_json_dashboard already references the file, declare one in
+// dashboards.tf and import the dashboard into state
+func pullDashboard(terraformPath string, logFile *os.File, id, fileName string) error {
+	dashboard, err := fetchDashboard(id)
+	if err != nil {
+		return fmt.Errorf("failed to fetch dashboard %s: %w", id, err)
+	}
+	metadata, _ := dashboard["dashboardMetadata"].(map[string]any)
+	title, _ := metadata["name"].(string)
+	name := strings.ToLower(strings.Trim(hclIdentifierPattern.ReplaceAllString(title, "_"), "_"))
+	if name == "" || name[0] >= '0' && name[0] <= '9' {
+		name = "dashboard_" + name
+	}
+	if fileName == "" {
+		fileName = filepath.Join(dashboardDirName, name+".json")
+	}
+
+	content, err := json.MarshalIndent(dashboard, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(fileName), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(fileName, append(content, '\n'), 0644); err != nil {
+		return err
+	}
+	fmt.Printf("Wrote dashboard %q (%s) to %s.\n", title, id, fileName)
+
+	address, err := dashboardResourceFor(fileName)
+	if err != nil {
+		return err
+	}
+	if address != "" {
+		fmt.Printf("%s references %s; preview with -dashboard-preview and apply with -dashboard-push.\n", address, fileName)
+		recordAudit("dashboard-pull", nil)
+		return nil
+	}
+
+	address = "dynatrace_json_dashboard." + name
+	declared, err := declaredResources()
+	if err != nil {
+		return err
+	}
+	if declared[address] {
+		return fmt.Errorf("%s is already declared but does not reference %s; set its contents to file(%s) or choose another -dashboard-file",
+			address, fileName, hclString(filepath.ToSlash(fileName)))
+	}
+	block := fmt.Sprintf("# Dashboard %s\nresource \"dynatrace_json_dashboard\" %q {\n  contents = file(%s)\n}\n",
+		id, name, hclString(filepath.ToSlash(fileName)))
+	if err := appendFile(dashboardResourceFileName, block); err != nil {
+		return err
+	}
+	fmt.Printf("Declared %s in %s.\n", address, dashboardResourceFileName)
+	err = importResources(terraformPath, logFile, []importItem{{address, id}})
+	recordAudit("dashboard-pull", err)
+	return err
+}
+
+// Show a local dashboard file side by side with the live dashboard of the
+// resource referencing it; returns 0 when in sync, 2 when they differ and 1 on error
+func previewDashboard(terraformPath string, logFile *os.File, fileName string) int {
+	address, err := dashboardResourceFor(fileName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read the configuration: %v\n", err)
+		return exitFailure
+	}
+	if address == "" {
+		fmt.Fprintf(os.Stderr, "No dynatrace_json_dashboard references %s; pull the dashboard with -dashboard-pull first.\n", fileName)
+		return exitFailure
+	}
+	local, err := readDashboardFile(fileName)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailure
+	}
+	instances, err := stateInstances(terraformPath, logFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read state: %v\n", err)
+		return exitFailure
+	}
+	id := ""
+	for _, instance := range instances {
+		if instance.Address == address {
+			id = instance.ID
+		}
+	}
+	if id == "" {
+		fmt.Printf("%s is not created yet; -dashboard-push creates it from %s.\n", address, fileName)
+		return exitChanges
+	}
+
+	live, err := fetchDashboard(id)
+	var apiErr *apiError
+	switch {
+	case errors.As(err, &apiErr) && apiErr.StatusCode == 404:
+		fmt.Printf("Dashboard %s of %s no longer exists in the environment; -dashboard-push recreates it.\n", id, address)
+		return exitChanges
+	case err != nil:
+		fmt.Fprintf(os.Stderr, "Failed to fetch dashboard %s: %v\n", id, err)
+		return exitFailure
+	}
+
+	lines := sideBySide(jsonLines(live), jsonLines(local))
+	changed := false
+	for _, line := range lines {
+		changed = changed || line.Kind != ' '
+	}
+	if !changed {
+		fmt.Printf("%s (%s) is in sync with %s.\n", address, id, fileName)
+		return exitOK
+	}
+	width := 160
+	if columns, _, err := term.GetSize(int(os.Stdout.Fd())); err == nil && columns > 40 {
+		width = columns
+	}
+	fmt.Printf("%s (%s) differs from %s:\n", address, id, fileName)
+	printSideBySide(lines, width)
+	return exitChanges
+}
+
+// Apply a local dashboard file by applying only the resource referencing it
+func pushDashboard(terraformPath string, logFile *os.File, fileName string) error {
+	address, err := dashboardResourceFor(fileName)
+	if err != nil {
+		return err
+	}
+	if address == "" {
+		return fmt.Errorf("no dynatrace_json_dashboard references %s; pull the dashboard with -dashboard-pull first", fileName)
+	}
+	if _, err := readDashboardFile(fileName); err != nil {
+		return err
+	}
+	selectedTargets = []string{address}
+	fmt.Printf("Applying %s from %s...\n", address, fileName)
+	return publishConfiguration(terraformPath, logFile)
+}
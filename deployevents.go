@@ -0,0 +1,116 @@
+/**
+* @license
+* Copyright 2020 Dynatrace LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Set by deployment_events = true to announce applies and destroys on the environment
+var deploymentEvents bool
+
+// Entity selector deployment events are attached to; empty attaches them to the environment
+var deploymentEventSelector string
+
+// ============================================================
+// Deployment events
+// ============================================================
+
+// Enable deployment events for API token runs when deployment_events = true
+func setupDeploymentEvents(config map[string]string) {
+	deploymentEvents = getEnv("DT_API_TOKEN") != "" && config["deployment_events"] == "true"
+	deploymentEventSelector = config["deployment_event_selector"]
+}
+
+// Name and version of the bundle from its manifest, falling back to the
+// directory name for bundles without one
+func bundleIdentity() (string, string) {
+	dir := bundleDir
+	if dir == "" {
+		dir = "."
+	}
+	manifest, _ := readManifest(os.DirFS(dir), manifestFileName)
+	name := manifest["name"]
+	if name == "" {
+		if abs, err := filepath.Abs(dir); err == nil {
+			name = filepath.Base(abs)
+		}
+	}
+	return name, manifest["version"]
+}
+
+// Terraform-style summary of completed operations
+func operationSummary(completed []string) string {
+	var added, changed, destroyed int
+	for _, operation := range completed {
+		switch {
+		case strings.HasSuffix(operation, "(creation)"):
+			added++
+		case strings.HasSuffix(operation, "(modifications)"):
+			changed++
+		case strings.HasSuffix(operation, "(destruction)"):
+			destroyed++
+		}
+	}
+	return fmt.Sprintf("%d added, %d changed, %d destroyed", added, changed, destroyed)
+}
+
+// Post a deployment event for an apply, or a configuration change event for a
+// destroy, to Events API v2; failures only warn since the change itself is done
+func reportDeployment(kind string, completed []string, runErr error) {
+	if !deploymentEvents {
+		return
+	}
+	name, version := bundleIdentity()
+	eventType, title := "CUSTOM_DEPLOYMENT", fmt.Sprintf("Terraform %s of %s", kind, name)
+	if kind == "destroy" {
+		eventType = "CUSTOM_CONFIGURATION"
+	}
+	result := "success"
+	if runErr != nil {
+		result = "failed"
+	}
+	properties := map[string]string{
+		"dt.event.deployment.name":    title,
+		"dt.event.deployment.project": name,
+		"dt.event.deployment.version": version,
+		"summary":                     operationSummary(completed),
+		"operator":                    osUserName(),
+		"result":                      result,
+		"workspace":                   currentWorkspace(),
+		"tool":                        "dynatrace-terraform-wrapper",
+	}
+	if version == "" {
+		delete(properties, "dt.event.deployment.version")
+	}
+	if identity := credentialIdentity(); identity != "" {
+		properties["identity"] = identity
+	}
+	event := map[string]any{"eventType": eventType, "title": title, "properties": properties}
+	if deploymentEventSelector != "" {
+		event["entitySelector"] = deploymentEventSelector
+	}
+	if err := dynatracePost("/api/v2/events/ingest", event, nil); err != nil {
+		fmt.Printf("Warning: failed to post %s event: %v\n", strings.ToLower(strings.TrimPrefix(eventType, "CUSTOM_")), err)
+		return
+	}
+	fmt.Printf("Posted %s event for %s %s.\n", strings.ToLower(strings.TrimPrefix(eventType, "CUSTOM_")), kind, name)
+}
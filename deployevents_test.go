@@ -0,0 +1,69 @@
+/**
+* @license
+* Copyright 2020 Dynatrace LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package main
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestReportDeployment(t *testing.T) {
+	server := newTestServer(t)
+	useTestEnvironment(t, server, "events.ingest")
+	t.Chdir(t.TempDir())
+	t.Setenv("TF_WORKSPACE", "prod")
+	if err := os.WriteFile(manifestFileName, []byte("name = alerting\nversion = 1.2.0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	deploymentEvents = true
+	t.Cleanup(func() { deploymentEvents = false })
+
+	reportDeployment("apply", []string{"dynatrace_alerting.a (creation)", "dynatrace_alerting.b (modifications)"}, nil)
+	reportDeployment("destroy", nil, errors.New("destroy failed"))
+
+	events := server.Events()
+	if len(events) != 2 {
+		t.Fatalf("got %d events, want 2", len(events))
+	}
+	apply, destroy := events[0], events[1]
+	if apply.EventType != "CUSTOM_DEPLOYMENT" || apply.Title != "Terraform apply of alerting" {
+		t.Errorf("apply event = %s %q", apply.EventType, apply.Title)
+	}
+	for key, want := range map[string]string{
+		"dt.event.deployment.version": "1.2.0",
+		"summary":                     "1 added, 1 changed, 0 destroyed",
+		"result":                      "success",
+		"workspace":                   "prod",
+		"identity":                    "dt0c01.TEST",
+	} {
+		if got := apply.Properties[key]; got != want {
+			t.Errorf("apply event %s = %q, want %q", key, got, want)
+		}
+	}
+	if destroy.EventType != "CUSTOM_CONFIGURATION" || destroy.Properties["result"] != "failed" {
+		t.Errorf("destroy event = %s with result %q", destroy.EventType, destroy.Properties["result"])
+	}
+
+	// A rejected event only warns
+	server.Fail("/api/v2/events/ingest", 500, "internal error", 1)
+	reportDeployment("apply", nil, nil)
+	if got := len(server.Events()); got != 2 {
+		t.Errorf("got %d events after a failed post, want 2", got)
+	}
+}
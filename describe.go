@@ -0,0 +1,260 @@
+/**
+* @license
+* Copyright 2020 Dynatrace LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// ============================================================
+// Describe what the package would configure
+// ============================================================
+
+// Description of the bundle derived from its .tf files and provider schemas
+type bundleDescription struct {
+	Resources []resourceDescription `json:"resources"`
+	Modules   []moduleDescription   `json:"modules,omitempty"`
+	Variables []variableDescription `json:"variables"`
+}
+
+type resourceDescription struct {
+	Address     string            `json:"address"`
+	Type        string            `json:"type"`
+	Description string            `json:"description,omitempty"`
+	Location    string            `json:"location"`
+	Settings    map[string]string `json:"settings"`
+}
+
+type moduleDescription struct {
+	Name   string `json:"name"`
+	Source string `json:"source"`
+}
+
+type variableDescription struct {
+	Name        string `json:"name"`
+	Type        string `json:"type,omitempty"`
+	Description string `json:"description,omitempty"`
+	Default     string `json:"default,omitempty"`
+	Required    bool   `json:"required"`
+	Sensitive   bool   `json:"sensitive"`
+}
+
+// Subset of `terraform providers schema -json` used for descriptions
+type providerSchemas struct {
+	ProviderSchemas map[string]struct {
+		ResourceSchemas map[string]schemaEntry `json:"resource_schemas"`
+	} `json:"provider_schemas"`
+}
+
+type schemaEntry struct {
+	Block schemaBlock `json:"block"`
+}
+
+type schemaBlock struct {
+	Description string                     `json:"description"`
+	Attributes  map[string]schemaAttribute `json:"attributes"`
+	BlockTypes  map[string]struct {
+		Block schemaBlock `json:"block"`
+	} `json:"block_types"`
+}
+
+type schemaAttribute struct {
+	Description string `json:"description"`
+	Sensitive   bool   `json:"sensitive"`
+}
+
+// Load resource schemas from the initialized providers, keyed by resource type
+func loadResourceSchemas(terraformPath string, logFile *os.File) (map[string]schemaEntry, error) {
+	out, err := outputTerraformCommand(terraformPath, logFile, "providers", "schema", "-json")
+	if err != nil {
+		return nil, err
+	}
+
+	var schemas providerSchemas
+	if err := json.Unmarshal(out, &schemas); err != nil {
+		return nil, err
+	}
+	resources := make(map[string]schemaEntry)
+	for _, provider := range schemas.ProviderSchemas {
+		for resourceType, entry := range provider.ResourceSchemas {
+			resources[resourceType] = entry
+		}
+	}
+	return resources, nil
+}
+
+// Flatten a block's attributes into dotted setting names, masking sensitive values
+func collectSettings(block *hclBlock, schema *schemaBlock, prefix string, settings map[string]string) {
+	for name, expr := range block.Attributes {
+		if name == "count" || name == "for_each" || name == "depends_on" || name == "provider" {
+			continue
+		}
+		value := expr
+		if schema != nil {
+			if attribute, found := schema.Attributes[name]; found && attribute.Sensitive {
+				value = maskValue(value)
+			}
+		}
+		settings[prefix+name] = value
+	}
+	for _, nested := range block.Blocks {
+		if nested.Type == "lifecycle" {
+			continue
+		}
+		var nestedSchema *schemaBlock
+		if schema != nil {
+			if blockType, found := schema.BlockTypes[nested.Type]; found {
+				nestedSchema = &blockType.Block
+			}
+		}
+		collectSettings(nested, nestedSchema, prefix+nested.Type+".", settings)
+	}
+}
+
+// Build the bundle description from parsed blocks and optional schemas
+func describeBundle(blocks []*hclBlock, schemas map[string]schemaEntry) bundleDescription {
+	description := bundleDescription{Resources: []resourceDescription{}, Variables: []variableDescription{}}
+	for _, block := range blocks {
+		switch {
+		case block.Type == "resource" && len(block.Labels) == 2:
+			resource := resourceDescription{
+				Address:  block.Labels[0] + "." + block.Labels[1],
+				Type:     block.Labels[0],
+				Location: fmt.Sprintf("%s:%d", block.File, block.Line),
+				Settings: make(map[string]string),
+			}
+			var schema *schemaBlock
+			if entry, found := schemas[resource.Type]; found {
+				schema = &entry.Block
+				resource.Description = strings.TrimSpace(entry.Block.Description)
+			}
+			collectSettings(block, schema, "", resource.Settings)
+			description.Resources = append(description.Resources, resource)
+		case block.Type == "module" && len(block.Labels) == 1:
+			source, _ := stringLiteral(block.Attributes["source"])
+			description.Modules = append(description.Modules, moduleDescription{Name: block.Labels[0], Source: source})
+		case block.Type == "variable" && len(block.Labels) == 1:
+			variable := variableDescription{Name: block.Labels[0], Type: block.Attributes["type"]}
+			variable.Description, _ = stringLiteral(block.Attributes["description"])
+			defaultValue, hasDefault := block.Attributes["default"]
+			variable.Required = !hasDefault
+			variable.Sensitive = block.Attributes["sensitive"] == "true"
+			if hasDefault && !variable.Sensitive {
+				variable.Default = defaultValue
+			}
+			description.Variables = append(description.Variables, variable)
+		}
+	}
+
+	sort.Slice(description.Resources, func(i, j int) bool { return description.Resources[i].Address < description.Resources[j].Address })
+	sort.Slice(description.Variables, func(i, j int) bool { return description.Variables[i].Name < description.Variables[j].Name })
+	return description
+}
+
+// Write the description as Markdown
+func writeDescriptionMarkdown(w io.Writer, description bundleDescription) {
+	fmt.Fprintln(w, "# Package description")
+	fmt.Fprintf(w, "\n## Resources (%d)\n", len(description.Resources))
+	for _, resource := range description.Resources {
+		fmt.Fprintf(w, "\n### `%s`\n\n", resource.Address)
+		if resource.Description != "" {
+			fmt.Fprintf(w, "%s\n\n", resource.Description)
+		}
+		fmt.Fprintf(w, "Defined in `%s`.\n\n", resource.Location)
+		if len(resource.Settings) == 0 {
+			continue
+		}
+		fmt.Fprintln(w, "| Setting | Value |")
+		fmt.Fprintln(w, "|---|---|")
+		names := make([]string, 0, len(resource.Settings))
+		for name := range resource.Settings {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			value := strings.ReplaceAll(strings.ReplaceAll(resource.Settings[name], "\n", " "), "|", "\\|")
+			fmt.Fprintf(w, "| `%s` | `%s` |\n", name, value)
+		}
+	}
+
+	if len(description.Modules) > 0 {
+		fmt.Fprintf(w, "\n## Modules (%d)\n\n", len(description.Modules))
+		for _, module := range description.Modules {
+			fmt.Fprintf(w, "- `%s` from `%s`\n", module.Name, module.Source)
+		}
+	}
+
+	fmt.Fprintf(w, "\n## Variables (%d)\n\n", len(description.Variables))
+	if len(description.Variables) == 0 {
+		return
+	}
+	fmt.Fprintln(w, "| Name | Required | Description | Default |")
+	fmt.Fprintln(w, "|---|---|---|---|")
+	for _, variable := range description.Variables {
+		defaultValue := variable.Default
+		if variable.Sensitive {
+			defaultValue = "(sensitive)"
+		}
+		fmt.Fprintf(w, "| `%s` | %t | %s | %s |\n", variable.Name, variable.Required, variable.Description, strings.ReplaceAll(defaultValue, "\n", " "))
+	}
+}
+
+// Describe the package in the requested format without contacting the tenant,
+// writing to outputPath or stdout when empty
+func runDescribe(terraformPath string, logFile *os.File, format, outputPath string) error {
+	blocks, err := parseTerraformFiles(".")
+	if err != nil {
+		return err
+	}
+
+	schemas, err := loadResourceSchemas(terraformPath, logFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: provider schemas unavailable, descriptions omitted: %v\n", err)
+	}
+	description := describeBundle(blocks, schemas)
+
+	var out io.Writer = os.Stdout
+	if outputPath != "" {
+		file, err := os.Create(outputPath)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		out = file
+	}
+
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(description)
+	case "markdown", "md":
+		writeDescriptionMarkdown(out, description)
+	default:
+		return fmt.Errorf("unknown format %q (expected json or markdown)", format)
+	}
+	if err == nil && outputPath != "" {
+		fmt.Printf("Package description written to %s.\n", outputPath)
+	}
+	return err
+}
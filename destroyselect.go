@@ -0,0 +1,208 @@
+/**
+* @license
+* Copyright 2020 Dynatrace LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Managed resource in state with the resources it depends on
+type stateResource struct {
+	Address      string
+	Type         string
+	Dependencies []string
+}
+
+// ============================================================
+// Selective destroy
+// ============================================================
+
+// Managed resources in state with the dependencies recorded for their instances
+func managedStateResources(terraformPath string, logFile *os.File) ([]stateResource, error) {
+	out, err := outputTerraformCommand(terraformPath, logFile, "state", "pull")
+	if err != nil {
+		return nil, err
+	}
+	var state struct {
+		Resources []struct {
+			Module    string `json:"module"`
+			Mode      string `json:"mode"`
+			Type      string `json:"type"`
+			Name      string `json:"name"`
+			Instances []struct {
+				Dependencies []string `json:"dependencies"`
+			} `json:"instances"`
+		} `json:"resources"`
+	}
+	if len(strings.TrimSpace(string(out))) == 0 {
+		return nil, nil
+	}
+	if err := json.Unmarshal(out, &state); err != nil {
+		return nil, fmt.Errorf("failed to parse state: %w", err)
+	}
+
+	var resources []stateResource
+	for _, resource := range state.Resources {
+		if resource.Mode != "managed" {
+			continue
+		}
+		address := resource.Type + "." + resource.Name
+		if resource.Module != "" {
+			address = resource.Module + "." + address
+		}
+		seen := make(map[string]bool)
+		var dependencies []string
+		for _, instance := range resource.Instances {
+			for _, dependency := range instance.Dependencies {
+				if !seen[dependency] {
+					seen[dependency] = true
+					dependencies = append(dependencies, dependency)
+				}
+			}
+		}
+		resources = append(resources, stateResource{address, resource.Type, dependencies})
+	}
+	sort.Slice(resources, func(i, j int) bool {
+		if resources[i].Type != resources[j].Type {
+			return resources[i].Type < resources[j].Type
+		}
+		return resources[i].Address < resources[j].Address
+	})
+	return resources, nil
+}
+
+// Selected addresses plus every resource depending on them, directly or not,
+// since those have to go first
+func destroyClosure(selected []string, resources []stateResource) []string {
+	dependents := make(map[string][]string)
+	for _, resource := range resources {
+		for _, dependency := range resource.Dependencies {
+			dependents[dependency] = append(dependents[dependency], resource.Address)
+		}
+	}
+
+	included := make(map[string]bool)
+	queue := append([]string(nil), selected...)
+	for len(queue) > 0 {
+		address := queue[0]
+		queue = queue[1:]
+		if included[address] {
+			continue
+		}
+		included[address] = true
+		queue = append(queue, dependents[address]...)
+	}
+
+	closure := make([]string, 0, len(included))
+	for address := range included {
+		closure = append(closure, address)
+	}
+	sort.Strings(closure)
+	return closure
+}
+
+// Let the user pick resources grouped by type and destroy them together with
+// the resources depending on them
+func selectiveDestroy(terraformPath string, logFile *os.File) error {
+	if nonInteractive {
+		return fmt.Errorf("selective destroy is unavailable in non-interactive mode; use -destroy with -target")
+	}
+	if err := ensureWorkspace(terraformPath, logFile); err != nil {
+		return err
+	}
+	if err := checkStateTarget(terraformPath, logFile); err != nil {
+		return err
+	}
+	if err := checkChangeFreeze("destroy"); err != nil {
+		recordAudit("destroy", err)
+		return err
+	}
+	resources, err := managedStateResources(terraformPath, logFile)
+	if err != nil {
+		return fmt.Errorf("failed to read state: %w", err)
+	}
+	if len(resources) == 0 {
+		fmt.Println("No managed resources in state.")
+		return nil
+	}
+
+	for i, resource := range resources {
+		if i == 0 || resource.Type != resources[i-1].Type {
+			fmt.Printf("\n%s\n", resource.Type)
+		}
+		fmt.Printf("%3d. %s\n", i+1, resource.Address)
+	}
+	reader := bufio.NewReader(os.Stdin)
+	var selected []string
+	for {
+		fmt.Print("\nResources to destroy (e.g. 1,3-5; empty to cancel): ")
+		input, _ := reader.ReadString('\n')
+		indexes, err := parseSelection(input, len(resources))
+		if err != nil {
+			fmt.Println(err)
+			continue
+		}
+		for _, index := range indexes {
+			selected = append(selected, resources[index].Address)
+		}
+		break
+	}
+	if len(selected) == 0 {
+		fmt.Println("Nothing destroyed.")
+		return nil
+	}
+
+	closure := destroyClosure(selected, resources)
+	chosen := make(map[string]bool)
+	for _, address := range selected {
+		chosen[address] = true
+	}
+	fmt.Printf("\nThe following %d resource(s) will be destroyed:\n", len(closure))
+	for _, address := range closure {
+		for _, ex := range excludedResources {
+			if matchesAddress(address, ex) {
+				return fmt.Errorf("%s is excluded by %s; remove the exclusion to destroy it", address, ex)
+			}
+		}
+		if chosen[address] {
+			fmt.Printf("  - %s\n", address)
+		} else {
+			fmt.Printf("  - %s (depends on a selected resource)\n", address)
+		}
+	}
+	fmt.Printf("Destroy these %d resource(s)? (yes/no): ", len(closure))
+	answer, _ := reader.ReadString('\n')
+	if strings.TrimSpace(answer) != "yes" {
+		fmt.Println("Nothing destroyed.")
+		return nil
+	}
+
+	args := append([]string{"destroy", "-auto-approve"}, parallelismArgs()...)
+	for _, address := range closure {
+		args = append(args, "-target="+address)
+	}
+	args = append(args, variableArgs...)
+	err = executeTerraformCommand(terraformPath, logFile, args...)
+	recordAudit("destroy", err)
+	return err
+}
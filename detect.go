@@ -0,0 +1,304 @@
+/**
+* @license
+* Copyright 2020 Dynatrace LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ============================================================
+// Detect configuration from the bundled provider block
+// ============================================================
+
+// Provider attributes and the prompt used when they are supplied through a variable
+var providerAttributePrompts = map[string]string{
+	"dt_env_url":     "Input Dynatrace environment URL (SaaS: https://########.live.dynatrace.com or Managed: https://<dynatrace-host>/e/########):",
+	"dt_api_token":   "Input Dynatrace API token (dt0c01.########.########):",
+	"client_id":      "Input Dynatrace OAuth client ID (dt0s02.########):",
+	"client_secret":  "Input Dynatrace OAuth client secret (dt0s02.########.########):",
+	"account_id":     "Input Dynatrace OAuth account ID (urn:dtaccount:{your-account-UUID}):",
+	"platform_token": "Input Dynatrace platform token (dt0s16.########.########):",
+}
+
+// Resource type prefixes managed through platform APIs, which need a platform token
+var platformResourcePrefixes = []string{"dynatrace_automation_", "dynatrace_document", "dynatrace_segment", "dynatrace_platform_"}
+
+// Derive wrapper.cfg keys from the dynatrace provider block in the bundled .tf files
+func detectConfig(dir string) (map[string]string, []string, error) {
+	blocks, err := parseTerraformFiles(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	detected := make(map[string]string)
+	var notes []string
+	var provider *hclBlock
+	usesIAM, usesPlatform := false, false
+	for _, block := range blocks {
+		if block.Type == "provider" && len(block.Labels) > 0 && block.Labels[0] == "dynatrace" && provider == nil {
+			provider = block
+		}
+		if block.Type == "resource" && len(block.Labels) > 0 && isIAMResourceType(block.Labels[0]) {
+			usesIAM = true
+		}
+		if block.Type == "resource" && len(block.Labels) > 0 {
+			for _, prefix := range platformResourcePrefixes {
+				usesPlatform = usesPlatform || strings.HasPrefix(block.Labels[0], prefix)
+			}
+		}
+	}
+
+	if provider == nil {
+		notes = append(notes, "No dynatrace provider block found; assuming credentials from DT_* environment variables.")
+		detected["api_token"] = "true"
+		if usesIAM {
+			detected["oauth_client"] = "true"
+		}
+		if usesPlatform {
+			detected["platform_token"] = "true"
+		}
+		return detected, notes, nil
+	}
+	notes = append(notes, fmt.Sprintf("Found dynatrace provider block in %s:%d.", provider.File, provider.Line))
+
+	// Credentials set in the provider block are collected through their variables
+	// below; the DT_* prompts are only needed when the provider reads the environment
+	apiAttributes, oauthAttributes, platformAttributes := false, false, false
+	for attribute := range provider.Attributes {
+		switch attribute {
+		case "dt_env_url", "dt_api_token":
+			apiAttributes = true
+		case "client_id", "client_secret", "account_id":
+			oauthAttributes = true
+		case "platform_token":
+			platformAttributes = true
+		}
+	}
+	detected["api_token"] = fmt.Sprint(!apiAttributes && !oauthAttributes && !platformAttributes)
+	detected["oauth_client"] = fmt.Sprint(!oauthAttributes && usesIAM)
+	if usesPlatform && !platformAttributes {
+		detected["platform_token"] = "true"
+	}
+
+	attributes := make([]string, 0, len(provider.Attributes))
+	for attribute := range provider.Attributes {
+		attributes = append(attributes, attribute)
+	}
+	sort.Strings(attributes)
+
+	for _, attribute := range attributes {
+		expr := provider.Attributes[attribute]
+		prompt, known := providerAttributePrompts[attribute]
+		if !known {
+			continue
+		}
+		if name, ok := variableReference(expr); ok {
+			envKey := "TF_VAR_" + name
+			detected[envKey+".prompt"] = prompt
+			detected[envKey+".required"] = "true"
+			notes = append(notes, fmt.Sprintf("%s is read from variable %q; prompting for %s.", attribute, name, envKey))
+			continue
+		}
+		if _, ok := stringLiteral(expr); ok {
+			notes = append(notes, fmt.Sprintf("%s is hard-coded in the provider block.", attribute))
+		}
+	}
+
+	return detected, notes, nil
+}
+
+// Keys already set in a wrapper.cfg or wrapper.toml file, empty if it does not exist
+func configFileKeys(fileName string) (map[string]bool, error) {
+	existing := make(map[string]bool)
+	if strings.HasSuffix(fileName, ".toml") {
+		flat, err := decodeTOMLConfig(fileName)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		for key := range flat {
+			existing[key] = true
+		}
+		return existing, nil
+	}
+
+	file, err := os.Open(fileName)
+	if os.IsNotExist(err) {
+		return existing, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if key, _, ok := parseConfigLine(scanner.Text()); ok {
+			existing[key] = true
+		}
+	}
+	return existing, scanner.Err()
+}
+
+// TOML assignment of a wrapper.cfg key and value, typed like -convert-config does
+func tomlAssignment(key, value string) (string, error) {
+	typed, err := typedTOMLValue(key, value)
+	if err != nil {
+		return "", err
+	}
+	switch v := typed.(type) {
+	case string:
+		return fmt.Sprintf("%s = %q", key, v), nil
+	case []string:
+		items := make([]string, len(v))
+		for i, item := range v {
+			items[i] = strconv.Quote(item)
+		}
+		return fmt.Sprintf("%s = [%s]", key, strings.Join(items, ", ")), nil
+	}
+	return fmt.Sprintf("%s = %v", key, typed), nil
+}
+
+// Insert lines into a TOML file before its first table header, where they are
+// top-level keys, and check the result still decodes
+func insertTOMLLines(fileName string, lines []string) error {
+	original, err := os.ReadFile(fileName)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	existing := strings.Split(strings.TrimRight(string(original), "\n"), "\n")
+	if len(original) == 0 {
+		existing = nil
+	}
+	at := len(existing)
+	for i, line := range existing {
+		if strings.HasPrefix(strings.TrimSpace(line), "[") {
+			at = i
+			break
+		}
+	}
+	if at > 0 && strings.TrimSpace(existing[at-1]) != "" {
+		lines = append([]string{""}, lines...)
+	}
+	if at < len(existing) {
+		lines = append(lines, "")
+	}
+	updated := append(append(append([]string{}, existing[:at]...), lines...), existing[at:]...)
+	if err := os.WriteFile(fileName, []byte(strings.Join(updated, "\n")+"\n"), 0644); err != nil {
+		return err
+	}
+
+	if _, err := decodeTOMLConfig(fileName); err != nil {
+		if original == nil {
+			os.Remove(fileName)
+		} else {
+			os.WriteFile(fileName, original, 0644)
+		}
+		return fmt.Errorf("detected keys conflict with the existing ones: %w", err)
+	}
+	return nil
+}
+
+// Add detected keys that are not already present in the configuration file, in
+// TOML syntax for wrapper.toml
+func writeDetectedConfig(fileName string, detected map[string]string, source string) ([]string, error) {
+	existing, err := configFileKeys(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	var added []string
+	for key := range detected {
+		if !existing[key] {
+			added = append(added, key)
+		}
+	}
+	if len(added) == 0 {
+		return nil, nil
+	}
+	sort.Strings(added)
+
+	lines := []string{fmt.Sprintf("# Detected from %s", source)}
+	if strings.HasSuffix(fileName, ".toml") {
+		for _, key := range added {
+			line, err := tomlAssignment(key, detected[key])
+			if err != nil {
+				return nil, err
+			}
+			lines = append(lines, line)
+		}
+		return added, insertTOMLLines(fileName, lines)
+	}
+
+	file, err := os.OpenFile(fileName, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	if len(existing) > 0 {
+		lines = append([]string{""}, lines...)
+	}
+	for _, key := range added {
+		lines = append(lines, fmt.Sprintf("%s = %s", key, formatConfigValue(detected[key])))
+	}
+	if _, err := file.WriteString(strings.Join(lines, "\n") + "\n"); err != nil {
+		return nil, err
+	}
+	return added, nil
+}
+
+// Detect provider settings and pre-populate the configuration file
+func runDetect(fileName string) error {
+	detected, notes, err := detectConfig(".")
+	if err != nil {
+		return err
+	}
+	for _, note := range notes {
+		fmt.Println(note)
+	}
+
+	if strings.HasSuffix(fileName, ".tmpl") {
+		fmt.Printf("Add the detected keys to %s by hand:\n", fileName)
+		keys := make([]string, 0, len(detected))
+		for key := range detected {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			fmt.Printf("  %s = %s\n", key, detected[key])
+		}
+		return fmt.Errorf("cannot update the rendered template %s", fileName)
+	}
+
+	added, err := writeDetectedConfig(fileName, detected, "the dynatrace provider block")
+	if err != nil {
+		return fmt.Errorf("failed to update %s: %w", fileName, err)
+	}
+	if len(added) == 0 {
+		fmt.Printf("%s already contains all detected keys.\n", fileName)
+		return nil
+	}
+	fmt.Printf("Added to %s:\n", fileName)
+	for _, key := range added {
+		fmt.Printf("  %s = %s\n", key, detected[key])
+	}
+	return nil
+}
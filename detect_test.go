@@ -0,0 +1,107 @@
+/**
+* @license
+* Copyright 2020 Dynatrace LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteDetectedConfig(t *testing.T) {
+	detected := map[string]string{
+		"api_token":                    "true",
+		"oauth_client":                 "false",
+		"TF_VAR_dt_api_token.prompt":   "Input Dynatrace API token (dt0c01.########.########):",
+		"TF_VAR_dt_api_token.required": "true",
+	}
+	tests := []struct {
+		name     string
+		fileName string
+		existing string
+		want     []string
+	}{
+		{
+			"new wrapper.cfg", "wrapper.cfg", "",
+			[]string{"api_token = true", `TF_VAR_dt_api_token.prompt = "Input Dynatrace API token (dt0c01.########.########):"`},
+		},
+		{
+			"wrapper.cfg with keys", "wrapper.cfg", "api_token = false\n",
+			[]string{"api_token = false\n\n# Detected from", "oauth_client = false"},
+		},
+		{
+			"wrapper.toml with a table", "wrapper.toml", "parallelism = 5\n\n[workspace]\nprod = \"https://abc12345.live.dynatrace.com\"\n",
+			[]string{
+				"parallelism = 5\n\n# Detected from",
+				"api_token = true\n",
+				`TF_VAR_dt_api_token.prompt = "Input Dynatrace API token (dt0c01.########.########):"`,
+				"oauth_client = false\n\n[workspace]",
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fileName := filepath.Join(t.TempDir(), test.fileName)
+			if test.existing != "" {
+				if err := os.WriteFile(fileName, []byte(test.existing), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if _, err := writeDetectedConfig(fileName, detected, "the dynatrace provider block"); err != nil {
+				t.Fatalf("writeDetectedConfig: %v", err)
+			}
+			data, err := os.ReadFile(fileName)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range test.want {
+				if !strings.Contains(string(data), want) {
+					t.Errorf("missing %q in:\n%s", want, data)
+				}
+			}
+
+			config := make(map[string]string)
+			if err := readConfigFile(fileName, config, make(map[string]bool)); err != nil {
+				t.Fatalf("reading the updated file: %v", err)
+			}
+			if config["TF_VAR_dt_api_token.required"] != "true" || config["TF_VAR_dt_api_token.prompt"] != detected["TF_VAR_dt_api_token.prompt"] {
+				t.Errorf("updated file reads back as %v", config)
+			}
+		})
+	}
+}
+
+func TestRunDetectRefusesTemplate(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+	template := `api_token = {{ .api_token }}` + "\n"
+	if err := os.WriteFile(templateConfigFileName, []byte(template), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile("main.tf", []byte(`provider "dynatrace" {}`+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := runDetect(templateConfigFileName); err == nil {
+		t.Error("runDetect updated a configuration template")
+	}
+	if data, _ := os.ReadFile(templateConfigFileName); string(data) != template {
+		t.Errorf("template changed to:\n%s", data)
+	}
+}
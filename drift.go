@@ -0,0 +1,100 @@
+/**
+* @license
+* Copyright 2020 Dynatrace LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Refresh-only plan the drift report is read from
+const driftPlanFileName = "drift.tfplan"
+
+// Exit codes of -drift, matching terraform plan -detailed-exitcode
+const (
+	driftExitNone    = 0
+	driftExitError   = 1
+	driftExitDrifted = 2
+)
+
+// ============================================================
+// Drift detection
+// ============================================================
+
+// Resources whose live configuration differs from state, from terraform show -json
+type driftReport struct {
+	ResourceDrift []struct {
+		Address string `json:"address"`
+		Change  struct {
+			Actions []string `json:"actions"`
+		} `json:"change"`
+	} `json:"resource_drift"`
+}
+
+// Run a refresh-only plan, list the resources changed outside Terraform and
+// return the exit code for scheduled runs: 0 no drift, 2 drift, 1 error
+func detectDrift(terraformPath string, logFile *os.File) int {
+	if err := ensureWorkspace(terraformPath, logFile); err != nil {
+		fmt.Fprintf(os.Stderr, "Drift check failed: %v\n", err)
+		return driftExitError
+	}
+	defer os.Remove(driftPlanFileName)
+
+	args := append([]string{"plan", "-refresh-only", "-detailed-exitcode", "-input=false", "-out=" + driftPlanFileName}, targetArgs()...)
+	err := executeTerraformCommand(terraformPath, logFile, append(args, variableArgs...)...)
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		fmt.Println("No drift: the live configuration matches the state.")
+		recordAudit("drift", nil)
+		return driftExitNone
+	case !errors.As(err, &exitErr) || exitErr.ExitCode() != driftExitDrifted:
+		explainTerraformError(err)
+		fmt.Fprintf(os.Stderr, "Drift check failed: %v\n", err)
+		recordAudit("drift", err)
+		return driftExitError
+	}
+
+	out, err := outputTerraformCommand(terraformPath, logFile, "show", "-json", driftPlanFileName)
+	var report driftReport
+	if err == nil {
+		err = json.Unmarshal(out, &report)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read drift plan: %v\n", err)
+		recordAudit("drift", err)
+		return driftExitError
+	}
+
+	fmt.Printf("Drift detected in %d resource(s):\n", len(report.ResourceDrift))
+	for _, drift := range report.ResourceDrift {
+		switch strings.Join(drift.Change.Actions, ",") {
+		case "delete":
+			fmt.Printf("  - %s (deleted outside Terraform)\n", drift.Address)
+		default:
+			fmt.Printf("  ~ %s (changed outside Terraform)\n", drift.Address)
+		}
+	}
+	publishf("drift", "warning", "%d resource(s) drifted", len(report.ResourceDrift))
+	recordAudit("drift", fmt.Errorf("%d resource(s) drifted", len(report.ResourceDrift)))
+	return driftExitDrifted
+}
@@ -0,0 +1,199 @@
+/**
+* @license
+* Copyright 2020 Dynatrace LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Dynatrace SSO token endpoint; a variable so tests can point it at internal/dttest
+var ssoTokenURL = "https://sso.dynatrace.com/sso/oauth2/token"
+
+// Dynatrace SSO device authorization endpoint
+var ssoDeviceURL = "https://sso.dynatrace.com/sso/oauth2/device"
+
+var httpClient = &http.Client{Timeout: 30 * time.Second}
+
+// ============================================================
+// Dynatrace API helpers
+// ============================================================
+
+// API token metadata returned by the token lookup endpoint
+type apiTokenInfo struct {
+	ID             string   `json:"id"`
+	Name           string   `json:"name"`
+	Enabled        bool     `json:"enabled"`
+	Owner          string   `json:"owner"`
+	CreationDate   string   `json:"creationDate"`
+	ExpirationDate string   `json:"expirationDate"`
+	Scopes         []string `json:"scopes"`
+	TenantID       string   `json:"tenantId"`
+}
+
+// OAuth token response from Dynatrace SSO
+type oauthToken struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	Scope        string `json:"scope"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// Error returned for non-2xx API responses
+type apiError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("HTTP %d: %s", e.StatusCode, strings.TrimSpace(e.Body))
+}
+
+// Read response body, returning an apiError for unsuccessful status codes
+func readAPIResponse(resp *http.Response) ([]byte, error) {
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, &apiError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+	return body, nil
+}
+
+// Look up metadata (scopes, expiry) for an API token
+func lookupAPIToken(envURL, token string) (*apiTokenInfo, error) {
+	payload, _ := json.Marshal(map[string]string{"token": token})
+	req, err := http.NewRequest(http.MethodPost, strings.TrimRight(envURL, "/")+"/api/v2/apiTokens/lookup", bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Api-Token "+token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := readAPIResponse(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	var info apiTokenInfo
+	if err := json.Unmarshal(body, &info); err != nil {
+		return nil, fmt.Errorf("unexpected token lookup response: %w", err)
+	}
+	return &info, nil
+}
+
+// Request an OAuth access token using the client credentials grant
+func requestOAuthToken(clientID, clientSecret, accountID, scope string) (*oauthToken, error) {
+	form := url.Values{}
+	form.Set("grant_type", "client_credentials")
+	form.Set("client_id", clientID)
+	form.Set("client_secret", clientSecret)
+	if accountID != "" {
+		form.Set("resource", accountID)
+	}
+	if scope != "" {
+		form.Set("scope", scope)
+	}
+
+	resp, err := httpClient.PostForm(ssoTokenURL, form)
+	if err != nil {
+		return nil, err
+	}
+	body, err := readAPIResponse(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	var token oauthToken
+	if err := json.Unmarshal(body, &token); err != nil {
+		return nil, fmt.Errorf("unexpected token response: %w", err)
+	}
+	return &token, nil
+}
+
+// GET a Dynatrace environment API path with DT_API_TOKEN and decode the JSON
+// response into result
+func dynatraceGet(path string, result any) error {
+	return dynatraceRequest(http.MethodGet, path, nil, result)
+}
+
+// POST payload as JSON to a Dynatrace environment API path with DT_API_TOKEN
+// and decode the JSON response into result unless that is nil
+func dynatracePost(path string, payload, result any) error {
+	return dynatraceRequest(http.MethodPost, path, payload, result)
+}
+
+func dynatraceRequest(method, path string, payload, result any) error {
+	envURL, token := getEnv("DT_ENV_URL"), getEnv("DT_API_TOKEN")
+	if envURL == "" || token == "" {
+		return fmt.Errorf("DT_ENV_URL and DT_API_TOKEN are required")
+	}
+	var data []byte
+	if payload != nil {
+		var err error
+		if data, err = json.Marshal(payload); err != nil {
+			return err
+		}
+	}
+
+	for attempt := 1; ; attempt++ {
+		var body io.Reader
+		if payload != nil {
+			body = bytes.NewReader(data)
+		}
+		req, err := http.NewRequest(method, strings.TrimRight(envURL, "/")+path, body)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Api-Token "+token)
+		req.Header.Set("Accept", "application/json")
+		if payload != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+
+		resp, err := httpClient.Do(req)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode == http.StatusTooManyRequests && attempt < apiRateLimitAttempts {
+			resp.Body.Close()
+			delay := retryAfterDelay(resp.Header.Get("Retry-After"), attempt)
+			fmt.Printf("Dynatrace API rate limit reached; retrying %s in %s...\n", path, delay)
+			time.Sleep(delay)
+			continue
+		}
+		response, err := readAPIResponse(resp)
+		if err != nil || result == nil {
+			return err
+		}
+		return json.Unmarshal(response, result)
+	}
+}
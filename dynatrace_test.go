@@ -0,0 +1,147 @@
+/**
+* @license
+* Copyright 2020 Dynatrace LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"dynatrace-terraform-wrapper/internal/dttest"
+)
+
+// Start a fake Dynatrace API and point the SSO and Account Management URLs at it
+func newTestServer(t *testing.T) *dttest.Server {
+	t.Helper()
+	server := dttest.NewServer()
+	savedSSO, savedAccount := ssoTokenURL, accountAPIURL
+	ssoTokenURL, accountAPIURL = server.TokenURL(), server.URL
+	t.Cleanup(func() {
+		ssoTokenURL, accountAPIURL = savedSSO, savedAccount
+		server.Close()
+	})
+	return server
+}
+
+func TestLookupAPIToken(t *testing.T) {
+	server := newTestServer(t)
+	server.AddToken("dt0c01.ABC.SECRET", dttest.TokenInfo{Name: "ci", Scopes: []string{"settings.read", "settings.write"}})
+
+	info, err := lookupAPIToken(server.URL, "dt0c01.ABC.SECRET")
+	if err != nil {
+		t.Fatalf("lookupAPIToken: %v", err)
+	}
+	if info.ID != "dt0c01.ABC" || info.Name != "ci" || !info.Enabled || len(info.Scopes) != 2 {
+		t.Errorf("lookupAPIToken = %+v", info)
+	}
+
+	_, err = lookupAPIToken(server.URL, "dt0c01.XYZ.UNKNOWN")
+	var apiErr *apiError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != 401 {
+		t.Errorf("lookup of an unknown token: got %v, want HTTP 401", err)
+	}
+}
+
+func TestRequestOAuthToken(t *testing.T) {
+	server := newTestServer(t)
+	const accountID = "urn:dtaccount:11111111-2222-3333-4444-555555555555"
+	server.AddOAuthClient("dt0s02.CLIENT", dttest.OAuthClient{
+		Secret:    "dt0s02.CLIENT.SECRET",
+		AccountID: accountID,
+		Scopes:    []string{"settings.read", "account-env-read"},
+	})
+
+	tests := []struct {
+		name       string
+		secret     string
+		accountID  string
+		scope      string
+		wantStatus int
+	}{
+		{"granted", "dt0s02.CLIENT.SECRET", accountID, "settings.read", 0},
+		{"all scopes", "dt0s02.CLIENT.SECRET", accountID, "", 0},
+		{"wrong secret", "dt0s02.CLIENT.WRONG", accountID, "settings.read", 401},
+		{"scope not granted", "dt0s02.CLIENT.SECRET", accountID, "settings.write", 400},
+		{"other account", "dt0s02.CLIENT.SECRET", "urn:dtaccount:other", "settings.read", 400},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			token, err := requestOAuthToken("dt0s02.CLIENT", test.secret, test.accountID, test.scope)
+			if test.wantStatus == 0 {
+				if err != nil {
+					t.Fatalf("requestOAuthToken: %v", err)
+				}
+				if token.AccessToken == "" || token.TokenType != "Bearer" {
+					t.Errorf("requestOAuthToken = %+v", token)
+				}
+				return
+			}
+			var apiErr *apiError
+			if !errors.As(err, &apiErr) || apiErr.StatusCode != test.wantStatus {
+				t.Errorf("got %v, want HTTP %d", err, test.wantStatus)
+			}
+		})
+	}
+}
+
+// Point the environment API calls at the fake server with an API token of scopes
+func useTestEnvironment(t *testing.T, server *dttest.Server, scopes ...string) {
+	t.Helper()
+	const token = "dt0c01.TEST.SECRET"
+	server.AddToken(token, dttest.TokenInfo{Name: "test", Scopes: scopes})
+	t.Setenv("DT_ENV_URL", server.URL)
+	t.Setenv("DT_API_TOKEN", token)
+}
+
+func TestDynatraceRequestRetriesRateLimit(t *testing.T) {
+	server := newTestServer(t)
+	useTestEnvironment(t, server)
+	server.RateLimitEvery(2)
+
+	for i := 0; i < 2; i++ {
+		var version struct {
+			Version string `json:"version"`
+		}
+		if err := dynatraceGet("/api/v1/config/clusterversion", &version); err != nil {
+			t.Fatalf("request %d: %v", i+1, err)
+		}
+		if version.Version == "" {
+			t.Errorf("request %d: no version in the response", i+1)
+		}
+	}
+	if got := server.RateLimited(); got != 1 {
+		t.Errorf("rate limited %d requests, want 1", got)
+	}
+	if got := len(server.Requests()); got != 3 {
+		t.Errorf("server received %d requests, want 3 with the retry", got)
+	}
+}
+
+func TestDynatraceRequestGivesUpAfterRateLimitAttempts(t *testing.T) {
+	server := newTestServer(t)
+	useTestEnvironment(t, server)
+	server.RateLimitEvery(1)
+
+	err := dynatraceGet("/api/v1/config/clusterversion", nil)
+	var apiErr *apiError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != 429 {
+		t.Errorf("got %v, want HTTP 429", err)
+	}
+	if got := len(server.Requests()); got != apiRateLimitAttempts {
+		t.Errorf("server received %d requests, want %d", got, apiRateLimitAttempts)
+	}
+}
@@ -0,0 +1,103 @@
+/**
+* @license
+* Copyright 2020 Dynatrace LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package main
+
+import (
+	"bufio"
+	_ "embed"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ============================================================
+// Map Terraform errors to documentation
+// ============================================================
+
+//go:embed errordocs.cfg
+var errorDocsData string
+
+// Documentation entry for an error signature
+type errorDoc struct {
+	signature      string
+	classification string
+	links          []string
+}
+
+// Parse the embedded error documentation mapping
+func loadErrorDocs() []errorDoc {
+	var docs []errorDoc
+	scanner := bufio.NewScanner(strings.NewReader(errorDocsData))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, "|")
+		if len(fields) < 3 {
+			continue
+		}
+		doc := errorDoc{signature: strings.TrimSpace(fields[0]), classification: strings.TrimSpace(fields[1])}
+		for _, link := range fields[2:] {
+			doc.links = append(doc.links, strings.TrimSpace(link))
+		}
+		docs = append(docs, doc)
+	}
+	return docs
+}
+
+// Classify Terraform error output and collect up to two documentation links
+func classifyTerraformError(output string) (string, []string) {
+	lowerOutput := strings.ToLower(output)
+	classification := ""
+	var links []string
+	seen := make(map[string]bool)
+
+	for _, doc := range loadErrorDocs() {
+		if !strings.Contains(lowerOutput, strings.ToLower(doc.signature)) {
+			continue
+		}
+		if classification == "" {
+			classification = doc.classification
+		}
+		for _, link := range doc.links {
+			if len(links) < 2 && !seen[link] {
+				seen[link] = true
+				links = append(links, link)
+			}
+		}
+	}
+	return classification, links
+}
+
+// Print classification and documentation links for a failed Terraform command
+func explainTerraformError(err error) {
+	var cmdErr *terraformCommandError
+	if !errors.As(err, &cmdErr) {
+		return
+	}
+
+	classification, links := classifyTerraformError(cmdErr.output)
+	if classification == "" {
+		return
+	}
+	fmt.Printf("Error classification: %s\n", classification)
+	for _, link := range links {
+		fmt.Printf("  See: %s\n", link)
+	}
+}
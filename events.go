@@ -0,0 +1,311 @@
+/**
+* @license
+* Copyright 2020 Dynatrace LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ============================================================
+// Progress and diagnostics event bus
+// ============================================================
+
+// Event published by a subsystem; Current/Total are set for progress events
+type busEvent struct {
+	Time    time.Time         `json:"time"`
+	Source  string            `json:"source"`
+	Kind    string            `json:"kind"` // start, progress, done, info, warning or error
+	Message string            `json:"message"`
+	Current int64             `json:"current,omitempty"`
+	Total   int64             `json:"total,omitempty"`
+	Fields  map[string]string `json:"fields,omitempty"`
+}
+
+// Frontend receiving every published event
+type eventRenderer interface {
+	Render(e busEvent)
+	Close() error
+}
+
+// Fan-out of events to the configured renderers
+type eventBus struct {
+	mu        sync.Mutex
+	renderers []eventRenderer
+}
+
+var events = &eventBus{}
+
+// Deliver an event to every renderer with secrets scrubbed from its message and fields
+func (b *eventBus) Publish(e busEvent) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	e.Message = scrubSecrets(e.Message)
+	if e.Fields != nil {
+		fields := make(map[string]string, len(e.Fields))
+		for key, value := range e.Fields {
+			fields[key] = scrubSecrets(value)
+		}
+		e.Fields = fields
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, r := range b.renderers {
+		r.Render(e)
+	}
+}
+
+// Close all renderers
+func (b *eventBus) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, r := range b.renderers {
+		r.Close()
+	}
+	b.renderers = nil
+}
+
+// Publish a formatted event
+func publishf(source, kind, format string, args ...interface{}) {
+	events.Publish(busEvent{Source: source, Kind: kind, Message: fmt.Sprintf(format, args...)})
+}
+
+// Set up the renderers named in a comma-separated list (console, tui, jsonl, sse)
+func configureEventRenderers(names, jsonlPath, sseAddr string) error {
+	for _, name := range strings.Split(names, ",") {
+		var renderer eventRenderer
+		switch strings.TrimSpace(name) {
+		case "":
+			continue
+		case "console":
+			renderer = &consoleRenderer{out: os.Stdout}
+		case "tui":
+			renderer = &tuiRenderer{out: os.Stdout}
+		case "jsonl":
+			file, err := os.OpenFile(jsonlPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+			if err != nil {
+				return err
+			}
+			renderer = &jsonlRenderer{file: file, encoder: json.NewEncoder(file)}
+		case "sse":
+			sse, err := startSSERenderer(sseAddr)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Streaming events at http://%s/events\n", sse.addr)
+			renderer = sse
+		default:
+			return fmt.Errorf("unknown event renderer %q (expected console, tui, jsonl or sse)", name)
+		}
+		events.renderers = append(events.renderers, renderer)
+	}
+	return nil
+}
+
+// ============================================================
+// Progress reporting for readers
+// ============================================================
+
+// Reader publishing progress events as it is consumed, at most every 250ms
+type progressReader struct {
+	reader   io.Reader
+	source   string
+	message  string
+	current  int64
+	total    int64
+	lastSent time.Time
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.reader.Read(b)
+	p.current += int64(n)
+	if err == io.EOF || time.Since(p.lastSent) >= 250*time.Millisecond {
+		p.lastSent = time.Now()
+		events.Publish(busEvent{Source: p.source, Kind: "progress", Message: p.message, Current: p.current, Total: p.total})
+	}
+	return n, err
+}
+
+// ============================================================
+// Renderers
+// ============================================================
+
+// Plain line-per-event console output
+type consoleRenderer struct {
+	out io.Writer
+}
+
+func (r *consoleRenderer) Render(e busEvent) {
+	message := e.Message
+	if e.Kind == "progress" && e.Total > 0 {
+		message = fmt.Sprintf("%s (%d%%)", message, e.Current*100/e.Total)
+	}
+	if e.Kind == "warning" || e.Kind == "error" {
+		message = strings.ToUpper(e.Kind) + ": " + message
+	}
+	fmt.Fprintf(r.out, "[%s] %s\n", e.Source, message)
+}
+
+func (r *consoleRenderer) Close() error { return nil }
+
+// Terminal renderer redrawing a single status line for progress events
+type tuiRenderer struct {
+	out        io.Writer
+	statusLine bool
+}
+
+func (r *tuiRenderer) Render(e busEvent) {
+	if e.Kind == "progress" {
+		status := fmt.Sprintf("%-10s %s", e.Source, e.Message)
+		if e.Total > 0 {
+			width := 30
+			filled := int(e.Current * int64(width) / e.Total)
+			status = fmt.Sprintf("%s [%s%s] %3d%%", status, strings.Repeat("#", filled), strings.Repeat(".", width-filled), e.Current*100/e.Total)
+		} else {
+			status = fmt.Sprintf("%s %d bytes", status, e.Current)
+		}
+		fmt.Fprintf(r.out, "\r\033[K%s", status)
+		r.statusLine = true
+		return
+	}
+
+	if r.statusLine {
+		fmt.Fprint(r.out, "\r\033[K")
+		r.statusLine = false
+	}
+	marker := map[string]string{"start": ">", "done": "+", "warning": "!", "error": "x"}[e.Kind]
+	if marker == "" {
+		marker = "-"
+	}
+	fmt.Fprintf(r.out, "%s %-10s %s\n", marker, e.Source, e.Message)
+}
+
+func (r *tuiRenderer) Close() error {
+	if r.statusLine {
+		fmt.Fprintln(r.out)
+	}
+	return nil
+}
+
+// Machine-readable JSON Lines output
+type jsonlRenderer struct {
+	file    *os.File
+	encoder *json.Encoder
+}
+
+func (r *jsonlRenderer) Render(e busEvent) { r.encoder.Encode(e) }
+
+func (r *jsonlRenderer) Close() error { return r.file.Close() }
+
+// Server-sent events stream replaying recent events to newly connected clients
+type sseRenderer struct {
+	addr     string
+	server   *http.Server
+	mu       sync.Mutex
+	clients  map[chan []byte]bool
+	recent   [][]byte
+	maxCache int
+}
+
+func startSSERenderer(addr string) (*sseRenderer, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	r := &sseRenderer{addr: listener.Addr().String(), clients: make(map[chan []byte]bool), maxCache: 100}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/events", r.serveEvents)
+	r.server = &http.Server{Handler: mux}
+	go r.server.Serve(listener)
+	return r, nil
+}
+
+func (r *sseRenderer) serveEvents(w http.ResponseWriter, req *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+
+	client := make(chan []byte, 64)
+	r.mu.Lock()
+	for _, data := range r.recent {
+		fmt.Fprintf(w, "data: %s\n\n", data)
+	}
+	r.clients[client] = true
+	r.mu.Unlock()
+	flusher.Flush()
+
+	defer func() {
+		r.mu.Lock()
+		delete(r.clients, client)
+		r.mu.Unlock()
+	}()
+	for {
+		select {
+		case data, open := <-client:
+			if !open {
+				return
+			}
+			fmt.Fprintf(w, "data: %s\n\n", data)
+			flusher.Flush()
+		case <-req.Context().Done():
+			return
+		}
+	}
+}
+
+func (r *sseRenderer) Render(e busEvent) {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.recent = append(r.recent, data)
+	if len(r.recent) > r.maxCache {
+		r.recent = r.recent[1:]
+	}
+	for client := range r.clients {
+		select {
+		case client <- data:
+		default:
+			// Drop events for clients that cannot keep up rather than block the run
+		}
+	}
+}
+
+func (r *sseRenderer) Close() error {
+	r.mu.Lock()
+	for client := range r.clients {
+		close(client)
+		delete(r.clients, client)
+	}
+	r.mu.Unlock()
+	return r.server.Close()
+}
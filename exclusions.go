@@ -0,0 +1,214 @@
+/**
+* @license
+* Copyright 2020 Dynatrace LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Plan file used to apply exactly the plan whose exclusions were verified
+const exclusionPlanFileName = "exclusions.tfplan"
+
+// Addresses listed in exclude, and the -target arguments limiting runs to everything else
+var (
+	excludedResources []string
+	exclusionTargets  []string
+)
+
+// ============================================================
+// Exclude resources and modules from deployment
+// ============================================================
+
+// Addresses listed in the comma-separated exclude key
+func excludedAddresses(config map[string]string) []string {
+	var excluded []string
+	for _, address := range strings.Split(config["exclude"], ",") {
+		if address = strings.TrimSpace(address); address != "" {
+			excluded = append(excluded, address)
+		}
+	}
+	return excluded
+}
+
+// Collect -target addresses covering everything declared in dir except the
+// excluded addresses, descending into local modules that contain exclusions
+func collectTargets(dir, prefix string, excluded []string, matched map[string]bool) ([]string, error) {
+	blocks, err := parseTerraformFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var targets []string
+	for _, block := range blocks {
+		var address string
+		switch {
+		case block.Type == "resource" && len(block.Labels) == 2:
+			address = prefix + block.Labels[0] + "." + block.Labels[1]
+		case block.Type == "module" && len(block.Labels) == 1:
+			address = prefix + "module." + block.Labels[0]
+		default:
+			continue
+		}
+
+		excludedWhole, excludedBelow := false, false
+		for _, ex := range excluded {
+			switch {
+			case matchesAddress(address, ex):
+				excludedWhole = true
+				matched[ex] = true
+			case matchesAddress(ex, address):
+				excludedBelow = true
+			}
+		}
+		if excludedWhole {
+			continue
+		}
+		if !excludedBelow {
+			targets = append(targets, address)
+			continue
+		}
+
+		// Only part of this block is excluded: target the remainder of a local module
+		source, _ := stringLiteral(block.Attributes["source"])
+		if block.Type != "module" || !(strings.HasPrefix(source, "./") || strings.HasPrefix(source, "../")) {
+			return nil, fmt.Errorf("cannot exclude part of %s; exclude the whole %s instead", address, address)
+		}
+		nested, err := collectTargets(filepath.Join(dir, source), address+".", excluded, matched)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, nested...)
+	}
+	return targets, nil
+}
+
+// Compute the -target arguments for the configured exclusions and expose them to
+// the bundle as TF_VAR_excluded_resources when it declares that variable
+func setupExclusions(config map[string]string) error {
+	excludedResources, exclusionTargets = nil, nil
+	excluded := excludedAddresses(config)
+	if len(excluded) == 0 {
+		return nil
+	}
+
+	matched := make(map[string]bool)
+	targets, err := collectTargets(".", "", excluded, matched)
+	if err != nil {
+		return err
+	}
+	for _, ex := range excluded {
+		if !matched[ex] {
+			return fmt.Errorf("exclusion %s does not match any resource or module", ex)
+		}
+	}
+	if len(targets) == 0 {
+		return fmt.Errorf("exclusions leave no resources to deploy")
+	}
+
+	excludedResources = excluded
+	for _, target := range targets {
+		exclusionTargets = append(exclusionTargets, "-target="+target)
+	}
+	fmt.Printf("Excluding %s from deployment.\n", strings.Join(excluded, ", "))
+
+	blocks, err := parseTerraformFiles(".")
+	if err != nil {
+		return err
+	}
+	for _, block := range blocks {
+		if block.Type == "variable" && len(block.Labels) == 1 && block.Labels[0] == "excluded_resources" {
+			encoded, _ := json.Marshal(excluded)
+			exportEnv("TF_VAR_excluded_resources", string(encoded))
+		}
+	}
+	return nil
+}
+
+// Resource changes of a saved plan as reported by terraform show -json
+type planChanges struct {
+	ResourceChanges []struct {
+		Address string `json:"address"`
+		Type    string `json:"type"`
+		Change  struct {
+			Actions []string `json:"actions"`
+			After   any      `json:"after"`
+		} `json:"change"`
+	} `json:"resource_changes"`
+}
+
+// Create a plan honouring the exclusions and verify it changes none of the excluded
+// addresses, the API token has the scopes its changes need, settings values
+// match their schemas and the environment meets their prerequisites; planned
+// SLOs are previewed against current data. Returns the plan file to apply
+func planWithExclusions(terraformPath string, logFile *os.File) (string, error) {
+	args := append([]string{"plan", "-out=" + exclusionPlanFileName}, parallelismArgs()...)
+	args = append(args, targetArgs()...)
+	args = append(args, replaceArgs()...)
+	args = append(args, variableArgs...)
+	if err := executeTerraformCommand(terraformPath, logFile, args...); err != nil {
+		return "", err
+	}
+
+	out, err := outputTerraformCommand(terraformPath, logFile, "show", "-json", exclusionPlanFileName)
+	if err != nil {
+		os.Remove(exclusionPlanFileName)
+		return "", fmt.Errorf("failed to read plan: %w", err)
+	}
+	var plan planChanges
+	if err := json.Unmarshal(out, &plan); err != nil {
+		os.Remove(exclusionPlanFileName)
+		return "", fmt.Errorf("failed to parse plan: %w", err)
+	}
+
+	var violations []string
+	for _, change := range plan.ResourceChanges {
+		if len(change.Change.Actions) == 1 && change.Change.Actions[0] == "no-op" {
+			continue
+		}
+		for _, ex := range excludedResources {
+			if matchesAddress(change.Address, ex) {
+				violations = append(violations, fmt.Sprintf("%s (%s)", change.Address, strings.Join(change.Change.Actions, ", ")))
+			}
+		}
+	}
+	if len(violations) > 0 {
+		os.Remove(exclusionPlanFileName)
+		return "", fmt.Errorf("plan changes excluded resources:\n  %s", strings.Join(violations, "\n  "))
+	}
+	if len(excludedResources) > 0 {
+		publishf("guard", "info", "Verified plan leaves %d excluded address(es) untouched", len(excludedResources))
+	}
+	if err := checkPlanScopes(plan); err != nil {
+		os.Remove(exclusionPlanFileName)
+		return "", err
+	}
+	if err := checkPlanSchemas(plan); err != nil {
+		os.Remove(exclusionPlanFileName)
+		return "", err
+	}
+	if err := checkPlanReadiness(plan); err != nil {
+		os.Remove(exclusionPlanFileName)
+		return "", err
+	}
+	previewPlannedSLOs(plan)
+	return exclusionPlanFileName, nil
+}
@@ -0,0 +1,84 @@
+/**
+* @license
+* Copyright 2020 Dynatrace LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+)
+
+// Exit codes automation can branch on; 3 to 6 belong to the failing stages of
+// -ci-local and 2 matches terraform plan -detailed-exitcode
+const (
+	exitOK             = 0
+	exitFailure        = 1
+	exitChanges        = 2
+	exitAuthFailure    = 10
+	exitInitFailure    = 11
+	exitPlanFailure    = 12
+	exitApplyFailure   = 13
+	exitDestroyFailure = 14
+)
+
+// ============================================================
+// Exit codes
+// ============================================================
+
+// Log like log.Fatalf but exit with the given code
+func exitf(code int, format string, args ...any) {
+	log.Output(2, fmt.Sprintf(format, args...))
+	os.Exit(code)
+}
+
+// Whether a plan file changes anything
+func planHasChanges(terraformPath string, logFile *os.File, planFileName string) (bool, error) {
+	out, err := outputTerraformCommand(terraformPath, logFile, "show", "-json", planFileName)
+	if err != nil {
+		return false, fmt.Errorf("failed to read plan: %w", err)
+	}
+	var plan planChanges
+	if err := json.Unmarshal(out, &plan); err != nil {
+		return false, fmt.Errorf("failed to parse plan: %w", err)
+	}
+	for _, change := range plan.ResourceChanges {
+		if planActionKind(change.Change.Actions) != "" {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Plan and save the changes, returning exitChanges when there are any
+func planExitCode(terraformPath string, logFile *os.File) int {
+	if err := previewConfiguration(terraformPath, logFile); err != nil {
+		explainTerraformError(err)
+		log.Printf("Failed to preview configuration: %v", err)
+		return exitPlanFailure
+	}
+	changes, err := planHasChanges(terraformPath, logFile, savedPlanFile())
+	if err != nil {
+		log.Printf("Failed to preview configuration: %v", err)
+		return exitPlanFailure
+	}
+	if changes {
+		return exitChanges
+	}
+	return exitOK
+}
@@ -0,0 +1,281 @@
+/**
+* @license
+* Copyright 2020 Dynatrace LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// Provider binaries installed by terraform init
+const providerBinaryGlob = ".terraform/providers/registry.terraform.io/dynatrace-oss/dynatrace/*/%s_%s/terraform-provider-dynatrace*"
+
+var (
+	resourceBlockPattern = regexp.MustCompile(`^resource\s+"([^"]+)"\s+"([^"]+)"`)
+	exportIDPattern      = regexp.MustCompile(`^\s*#\s*ID\s+(\S+)`)
+	heredocPattern       = regexp.MustCompile(`<<-?([A-Za-z_][A-Za-z0-9_]*)\s*$`)
+)
+
+// Resource block written by the provider's export
+type exportedResource struct {
+	Type  string
+	Name  string
+	ID    string
+	Block string
+}
+
+func (r exportedResource) Address() string {
+	return r.Type + "." + r.Name
+}
+
+// ============================================================
+// Export existing configuration from the environment
+// ============================================================
+
+// Path of the Dynatrace provider binary installed by terraform init, preferring
+// the newest version
+func providerBinary() (string, error) {
+	matches, err := filepath.Glob(fmt.Sprintf(providerBinaryGlob, runtime.GOOS, runtime.GOARCH))
+	if err != nil {
+		return "", err
+	}
+	if len(matches) == 0 {
+		return "", fmt.Errorf("the Dynatrace provider is not installed; run terraform init with a configuration requiring dynatrace-oss/dynatrace")
+	}
+	sort.Strings(matches)
+	return filepath.Abs(matches[len(matches)-1])
+}
+
+// Resource types from a comma-separated list, accepting names with or without
+// the dynatrace_ prefix
+func exportTypes(list string) []string {
+	var types []string
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if !strings.HasPrefix(name, "dynatrace_") {
+			name = "dynatrace_" + name
+		}
+		types = append(types, name)
+	}
+	return types
+}
+
+// Split HCL into its resource blocks with the object IDs the export noted in
+// "# ID" comments; heredocs (dashboard JSON) are skipped when matching braces
+func parseResourceBlocks(content string) []exportedResource {
+	var resources []exportedResource
+	var current *exportedResource
+	var block strings.Builder
+	depth, pendingID, heredoc := 0, "", ""
+
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	scanner.Buffer(make([]byte, 1024*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if current == nil {
+			if match := exportIDPattern.FindStringSubmatch(line); match != nil {
+				pendingID = match[1]
+				continue
+			}
+			match := resourceBlockPattern.FindStringSubmatch(line)
+			if match == nil {
+				continue
+			}
+			current = &exportedResource{Type: match[1], Name: match[2], ID: pendingID}
+			block.Reset()
+			depth, pendingID = 0, ""
+		}
+
+		block.WriteString(line + "\n")
+		switch {
+		case heredoc != "":
+			if strings.TrimSpace(line) == heredoc {
+				heredoc = ""
+			}
+			continue
+		case current.ID == "":
+			if match := exportIDPattern.FindStringSubmatch(line); match != nil {
+				current.ID = match[1]
+			}
+		}
+		depth += strings.Count(line, "{") - strings.Count(line, "}")
+		if match := heredocPattern.FindStringSubmatch(line); match != nil {
+			heredoc = match[1]
+			continue
+		}
+		if depth <= 0 {
+			current.Block = block.String()
+			resources = append(resources, *current)
+			current = nil
+		}
+	}
+	return resources
+}
+
+// Run the provider's export for the given resource types into dir, with env as
+// the credentials of the environment to export from and extra export flags
+// (such as -ref), and return the resource blocks it wrote
+func exportConfiguration(types []string, dir string, env []string, flags ...string) ([]exportedResource, error) {
+	provider, err := providerBinary()
+	if err != nil {
+		return nil, err
+	}
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(types) == 0 {
+		fmt.Println("Exporting all resource types...")
+	} else {
+		fmt.Printf("Exporting %s...\n", strings.Join(types, ", "))
+	}
+	args := append(append([]string{"-export", "-flat", "-id"}, flags...), types...)
+	cmd := exec.Command(provider, args...)
+	cmd.Env = append(env, "DYNATRACE_TARGET_FOLDER="+absDir)
+	cmd.Dir = absDir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("export failed: %w\n%s", err, scrubSecrets(strings.TrimSpace(string(out))))
+	}
+
+	var resources []exportedResource
+	err = filepath.WalkDir(absDir, func(path string, entry os.DirEntry, err error) error {
+		if err != nil || entry.IsDir() || filepath.Ext(path) != ".tf" {
+			return err
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		for _, resource := range parseResourceBlocks(string(content)) {
+			if resource.ID == "" {
+				fmt.Fprintf(os.Stderr, "Warning: the export did not record an ID for %s; skipped\n", resource.Address())
+				continue
+			}
+			resources = append(resources, resource)
+		}
+		return nil
+	})
+	sort.Slice(resources, func(i, j int) bool { return resources[i].Address() < resources[j].Address() })
+	return resources, err
+}
+
+// Addresses of the resources declared by the .tf files in the working directory
+func declaredResources() (map[string]bool, error) {
+	files, err := filepath.Glob("*.tf")
+	if err != nil {
+		return nil, err
+	}
+	declared := make(map[string]bool)
+	for _, fileName := range files {
+		content, err := os.ReadFile(fileName)
+		if err != nil {
+			return nil, err
+		}
+		for _, line := range strings.Split(string(content), "\n") {
+			if match := resourceBlockPattern.FindStringSubmatch(line); match != nil {
+				declared[match[1]+"."+match[2]] = true
+			}
+		}
+	}
+	return declared, nil
+}
+
+// Append text to a file in the working directory, creating it when missing
+func appendFile(fileName, text string) error {
+	file, err := os.OpenFile(fileName, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.WriteString(text); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// Export the given resource types from the environment into the bundle: write
+// their blocks to export_<type>.tf with import blocks in export_imports.tf, then
+// import them into state; filter (nil for none) selects the objects to adopt
+func runExport(terraformPath string, logFile *os.File, typeList string, filter *exportFilter) error {
+	types := exportTypes(typeList)
+	if len(types) == 0 {
+		return fmt.Errorf("no resource types given")
+	}
+	dir, err := os.MkdirTemp(".", ".export-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	resources, err := exportConfiguration(types, dir, terraformEnv())
+	if err != nil {
+		recordAudit("export", err)
+		return err
+	}
+	resources = filterExported(resources, filter)
+	declared, err := declaredResources()
+	if err != nil {
+		return err
+	}
+
+	var items []importItem
+	blocks := make(map[string][]string)
+	var imports strings.Builder
+	for _, resource := range resources {
+		if declared[resource.Address()] {
+			fmt.Printf("%s is already declared in the bundle; skipped\n", resource.Address())
+			continue
+		}
+		blocks[resource.Type] = append(blocks[resource.Type], resource.Block)
+		fmt.Fprintf(&imports, "import {\n  to = %s\n  id = %q\n}\n\n", resource.Address(), resource.ID)
+		items = append(items, importItem{resource.Address(), resource.ID})
+	}
+	if len(items) == 0 {
+		fmt.Println("Nothing new to export.")
+		recordAudit("export", nil)
+		return nil
+	}
+
+	written := make([]string, 0, len(blocks)+1)
+	for resourceType, typeBlocks := range blocks {
+		fileName := "export_" + strings.TrimPrefix(resourceType, "dynatrace_") + ".tf"
+		if err := appendFile(fileName, strings.Join(typeBlocks, "\n")+"\n"); err != nil {
+			return err
+		}
+		written = append(written, fileName)
+	}
+	if err := appendFile("export_imports.tf", imports.String()); err != nil {
+		return err
+	}
+	sort.Strings(written)
+	fmt.Printf("Wrote %d resource(s) to %s and export_imports.tf.\n", len(items), strings.Join(written, ", "))
+	recordAudit("export", nil)
+
+	return importResources(terraformPath, logFile, items)
+}
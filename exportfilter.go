@@ -0,0 +1,133 @@
+/**
+* @license
+* Copyright 2020 Dynatrace LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Attribute holding an exported object's display name, in HCL or dashboard JSON
+var displayNamePattern = regexp.MustCompile(`(?m)(?:^|[\s{,])"?(?:name|title|display_name|summary)"?\s*[=:]\s*"((?:[^"\\]|\\.)*)"`)
+
+// Criteria an exported object must meet to be adopted; empty criteria match everything
+type exportFilter struct {
+	zoneName    string
+	zoneIDs     []string
+	owner       *regexp.Regexp
+	ownerTag    string
+	namePattern *regexp.Regexp
+}
+
+// ============================================================
+// Export filters
+// ============================================================
+
+// Build the filter for -export-zone, -export-owner and -export-name; nil when
+// none is set. The zone is given by name and also matched by its IDs
+func newExportFilter(zone, owner, namePattern string) (*exportFilter, error) {
+	if zone == "" && owner == "" && namePattern == "" {
+		return nil, nil
+	}
+	filter := &exportFilter{zoneName: zone}
+	if zone != "" {
+		var zones struct {
+			Values []struct {
+				ID   string `json:"id"`
+				Name string `json:"name"`
+			} `json:"values"`
+		}
+		if err := dynatraceGet("/api/config/v1/managementZones", &zones); err != nil {
+			return nil, fmt.Errorf("failed to look up management zone %q: %w", zone, err)
+		}
+		for _, candidate := range zones.Values {
+			if candidate.Name == zone {
+				filter.zoneIDs = append(filter.zoneIDs, candidate.ID)
+			}
+		}
+		if len(filter.zoneIDs) == 0 {
+			return nil, fmt.Errorf("management zone %q does not exist", zone)
+		}
+		objects, err := listSettingsObjects("builtin:management-zones")
+		if err != nil {
+			return nil, fmt.Errorf("failed to look up management zone %q: %w", zone, err)
+		}
+		for _, object := range objects {
+			if object.Value["name"] == zone {
+				filter.zoneIDs = append(filter.zoneIDs, object.ObjectID)
+			}
+		}
+	}
+	if owner != "" {
+		filter.owner = regexp.MustCompile(`\bowner"?\s*[=:]\s*"` + regexp.QuoteMeta(owner) + `"`)
+		filter.ownerTag = "owner:" + owner
+	}
+	if namePattern != "" {
+		pattern, err := regexp.Compile(namePattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -export-name pattern: %w", err)
+		}
+		filter.namePattern = pattern
+	}
+	return filter, nil
+}
+
+// Display name of an exported object, falling back to its resource name
+func exportedDisplayName(resource exportedResource) string {
+	if match := displayNamePattern.FindStringSubmatch(resource.Block); match != nil {
+		return strings.ReplaceAll(match[1], `\"`, `"`)
+	}
+	return resource.Name
+}
+
+// Whether an exported object references the zone, is owned by the owner (as
+// the owner attribute or an owner:<name> tag) and has a matching name
+func (f *exportFilter) matches(resource exportedResource) bool {
+	if f == nil {
+		return true
+	}
+	if f.zoneName != "" {
+		inZone := strings.Contains(resource.Block, `"`+f.zoneName+`"`) || strings.Contains(resource.Block, `\"`+f.zoneName+`\"`)
+		for _, id := range f.zoneIDs {
+			inZone = inZone || strings.Contains(resource.Block, id)
+		}
+		if !inZone {
+			return false
+		}
+	}
+	if f.owner != nil && !f.owner.MatchString(resource.Block) && !strings.Contains(resource.Block, f.ownerTag) {
+		return false
+	}
+	return f.namePattern == nil || f.namePattern.MatchString(exportedDisplayName(resource))
+}
+
+// Keep the exported objects matching the filter
+func filterExported(resources []exportedResource, filter *exportFilter) []exportedResource {
+	if filter == nil {
+		return resources
+	}
+	var kept []exportedResource
+	for _, resource := range resources {
+		if filter.matches(resource) {
+			kept = append(kept, resource)
+		}
+	}
+	fmt.Printf("%d of %d exported object(s) match the export filters.\n", len(kept), len(resources))
+	return kept
+}
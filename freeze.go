@@ -0,0 +1,276 @@
+/**
+* @license
+* Copyright 2020 Dynatrace LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	_ "time/tzdata" // maintenance windows name IANA time zones, which Windows lacks
+)
+
+// Settings schema of Dynatrace maintenance windows
+const maintenanceWindowSchema = "builtin:alerting.maintenance-window"
+
+// Set from change_freeze (check the tenant's maintenance windows), change_freeze_name
+// (only windows whose name matches count as freezes) and change_freeze_calendar
+var (
+	changeFreezeWindows  bool
+	changeFreezeName     *regexp.Regexp
+	changeFreezeCalendar string
+)
+
+// Freeze in effect right now
+type activeFreeze struct {
+	Name   string
+	Source string
+	End    time.Time
+}
+
+// ============================================================
+// Refuse changes during a change freeze
+// ============================================================
+
+// Read change_freeze, change_freeze_name and change_freeze_calendar
+func setupChangeFreeze(config map[string]string) error {
+	changeFreezeWindows = config["change_freeze"] == "true"
+	changeFreezeName = nil
+	if pattern := config["change_freeze_name"]; pattern != "" {
+		compiled, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("invalid change_freeze_name: %w", err)
+		}
+		changeFreezeName = compiled
+	}
+	changeFreezeCalendar = config["change_freeze_calendar"]
+	return nil
+}
+
+// Parse a calendar bound given as RFC 3339 or as a local date; a date that ends
+// a freeze includes the whole day
+func parseFreezeTime(value string, end bool) (time.Time, error) {
+	if parsed, err := time.Parse(time.RFC3339, value); err == nil {
+		return parsed, nil
+	}
+	day, err := time.ParseInLocation(time.DateOnly, value, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q must be RFC 3339 or YYYY-MM-DD", value)
+	}
+	if end {
+		day = day.AddDate(0, 0, 1)
+	}
+	return day, nil
+}
+
+// Freezes of a calendar file with lines such as "Year end = 2026-12-20 / 2027-01-03"
+// that are active at now
+func calendarFreezes(fileName string, now time.Time) ([]activeFreeze, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var active []activeFreeze
+	scanner := bufio.NewScanner(file)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		name, value, ok := parseConfigLine(scanner.Text())
+		if !ok {
+			continue
+		}
+		startValue, endValue, found := strings.Cut(value, "/")
+		if !found {
+			return nil, fmt.Errorf("%s:%d: expected <name> = <start> / <end>", fileName, lineNumber)
+		}
+		start, err := parseFreezeTime(strings.TrimSpace(startValue), false)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", fileName, lineNumber, err)
+		}
+		end, err := parseFreezeTime(strings.TrimSpace(endValue), true)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", fileName, lineNumber, err)
+		}
+		if !now.Before(start) && now.Before(end) {
+			active = append(active, activeFreeze{Name: name, Source: fileName, End: end})
+		}
+	}
+	return active, scanner.Err()
+}
+
+// Nested object of a settings value, empty when absent
+func settingsMap(value map[string]any, key string) map[string]any {
+	nested, _ := value[key].(map[string]any)
+	return nested
+}
+
+// Location of a maintenance window time zone, UTC when unknown
+func maintenanceLocation(name any) *time.Location {
+	if zone, ok := name.(string); ok && zone != "" {
+		if location, err := time.LoadLocation(zone); err == nil {
+			return location
+		}
+	}
+	return time.UTC
+}
+
+// End of the occurrence of a recurring time window that started on day and is
+// active at now, or zero when it is not active
+func recurringWindowEnd(window map[string]any, day, now time.Time) time.Time {
+	startClock, err1 := time.Parse(time.TimeOnly, fmt.Sprint(window["startTime"]))
+	endClock, err2 := time.Parse(time.TimeOnly, fmt.Sprint(window["endTime"]))
+	if err1 != nil || err2 != nil {
+		return time.Time{}
+	}
+	at := func(clock time.Time) time.Time {
+		return time.Date(day.Year(), day.Month(), day.Day(), clock.Hour(), clock.Minute(), clock.Second(), 0, day.Location())
+	}
+	start, end := at(startClock), at(endClock)
+	if !end.After(start) {
+		// Windows such as 22:00-02:00 end on the following day
+		end = end.AddDate(0, 0, 1)
+	}
+	if now.Before(start) || !now.Before(end) {
+		return time.Time{}
+	}
+	return end
+}
+
+// Whether a recurrence occurs on day: the day of the week or month the schedule
+// names, within its recurrence range
+func recursOn(schedule map[string]any, day time.Time) bool {
+	recurrenceRange := settingsMap(schedule, "recurrenceRange")
+	date := day.Format(time.DateOnly)
+	if first, ok := recurrenceRange["scheduleStartDate"].(string); ok && date < first {
+		return false
+	}
+	if last, ok := recurrenceRange["scheduleEndDate"].(string); ok && date > last {
+		return false
+	}
+	if weekday, ok := schedule["dayOfWeek"].(string); ok {
+		return strings.EqualFold(weekday, day.Weekday().String())
+	}
+	if dayOfMonth, ok := schedule["dayOfMonth"].(float64); ok {
+		// Days beyond the end of a month fall on its last day
+		lastDay := time.Date(day.Year(), day.Month()+1, 0, 0, 0, 0, 0, day.Location()).Day()
+		return day.Day() == min(int(dayOfMonth), lastDay)
+	}
+	return true
+}
+
+// End of a maintenance window's occurrence that is active at now, or zero when
+// none is
+func maintenanceWindowEnd(value map[string]any, now time.Time) time.Time {
+	schedule := settingsMap(value, "schedule")
+	var recurrence map[string]any
+	switch schedule["scheduleType"] {
+	case "ONCE":
+		once := settingsMap(schedule, "onceRecurrence")
+		location := maintenanceLocation(once["timeZone"])
+		start, err1 := time.ParseInLocation("2006-01-02T15:04:05", fmt.Sprint(once["startTime"]), location)
+		end, err2 := time.ParseInLocation("2006-01-02T15:04:05", fmt.Sprint(once["endTime"]), location)
+		if err1 != nil || err2 != nil || now.Before(start) || !now.Before(end) {
+			return time.Time{}
+		}
+		return end
+	case "DAILY":
+		recurrence = settingsMap(schedule, "dailyRecurrence")
+	case "WEEKLY":
+		recurrence = settingsMap(schedule, "weeklyRecurrence")
+	case "MONTHLY":
+		recurrence = settingsMap(schedule, "monthlyRecurrence")
+	default:
+		return time.Time{}
+	}
+
+	window := settingsMap(recurrence, "timeWindow")
+	local := now.In(maintenanceLocation(window["timeZone"]))
+	// An occurrence that started yesterday may still be running
+	for _, day := range []time.Time{local, local.AddDate(0, 0, -1)} {
+		if !recursOn(recurrence, day) {
+			continue
+		}
+		if end := recurringWindowEnd(window, day, local); !end.IsZero() {
+			return end
+		}
+	}
+	return time.Time{}
+}
+
+// Maintenance windows of the tenant that are active at now and count as freezes
+func maintenanceFreezes(now time.Time) ([]activeFreeze, error) {
+	objects, err := listSettingsObjects(maintenanceWindowSchema)
+	if err != nil {
+		return nil, err
+	}
+	var active []activeFreeze
+	for _, object := range objects {
+		if enabled, ok := object.Value["enabled"].(bool); ok && !enabled {
+			continue
+		}
+		name, _ := settingsMap(object.Value, "generalProperties")["name"].(string)
+		if changeFreezeName != nil && !changeFreezeName.MatchString(name) {
+			continue
+		}
+		if end := maintenanceWindowEnd(object.Value, now); !end.IsZero() {
+			active = append(active, activeFreeze{Name: name, Source: "maintenance window " + strconv.Quote(object.ObjectID), End: end})
+		}
+	}
+	return active, nil
+}
+
+// Refuse an operation changing the environment (apply, destroy, taint, a
+// migration or a remote run) while a maintenance window or calendar freeze is
+// active, unless -force is given
+func checkChangeFreeze(operation string) error {
+	if !changeFreezeWindows && changeFreezeCalendar == "" {
+		return nil
+	}
+	now := time.Now()
+	var active []activeFreeze
+	if changeFreezeCalendar != "" {
+		freezes, err := calendarFreezes(changeFreezeCalendar, now)
+		if err != nil {
+			return fmt.Errorf("failed to read change freeze calendar: %w", err)
+		}
+		active = append(active, freezes...)
+	}
+	if changeFreezeWindows {
+		freezes, err := maintenanceFreezes(now)
+		if err != nil {
+			return fmt.Errorf("failed to check maintenance windows: %w", err)
+		}
+		active = append(active, freezes...)
+	}
+	if len(active) == 0 {
+		return nil
+	}
+
+	freeze := active[0]
+	if forceGuards {
+		publishf("guard", "warning", "Change freeze %q is active; continuing %s because of -force", freeze.Name, operation)
+		fmt.Printf("Warning: change freeze %q (%s) is active until %s; continuing %s because of -force.\n",
+			freeze.Name, freeze.Source, freeze.End.Format(time.RFC3339), operation)
+		return nil
+	}
+	return fmt.Errorf("change freeze %q (%s) is active until %s; not starting %s, rerun with -force to override",
+		freeze.Name, freeze.Source, freeze.End.Format(time.RFC3339), operation)
+}
@@ -0,0 +1,224 @@
+/**
+* @license
+* Copyright 2020 Dynatrace LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"dynatrace-terraform-wrapper/internal/dttest"
+)
+
+// Settings value decoded the way the settings API response is
+func settingsValue(t *testing.T, text string) map[string]any {
+	t.Helper()
+	var value map[string]any
+	if err := json.Unmarshal([]byte(text), &value); err != nil {
+		t.Fatalf("invalid settings value: %v", err)
+	}
+	return value
+}
+
+func TestMaintenanceWindowEnd(t *testing.T) {
+	const overnight = `{"schedule": {"scheduleType": "DAILY", "dailyRecurrence": {
+		"timeWindow": {"startTime": "22:00:00", "endTime": "02:00:00", "timeZone": "UTC"},
+		"recurrenceRange": {"scheduleStartDate": "2026-01-01", "scheduleEndDate": "2026-06-30"}}}}`
+	const monthEnd = `{"schedule": {"scheduleType": "MONTHLY", "monthlyRecurrence": {"dayOfMonth": 31,
+		"timeWindow": {"startTime": "10:00:00", "endTime": "12:00:00", "timeZone": "UTC"}}}}`
+	const weekly = `{"schedule": {"scheduleType": "WEEKLY", "weeklyRecurrence": {"dayOfWeek": "MONDAY",
+		"timeWindow": {"startTime": "09:00:00", "endTime": "10:00:00", "timeZone": "Europe/Vienna"}}}}`
+	const dst = `{"schedule": {"scheduleType": "DAILY", "dailyRecurrence": {
+		"timeWindow": {"startTime": "01:00:00", "endTime": "04:00:00", "timeZone": "Europe/Vienna"}}}}`
+	const once = `{"schedule": {"scheduleType": "ONCE", "onceRecurrence": {
+		"startTime": "2026-12-24T00:00:00", "endTime": "2026-12-27T00:00:00", "timeZone": "America/New_York"}}}`
+
+	tests := []struct {
+		name   string
+		window string
+		now    string
+		want   string
+	}{
+		{"overnight before midnight", overnight, "2026-03-10T23:30:00Z", "2026-03-11T02:00:00Z"},
+		{"overnight after midnight", overnight, "2026-03-11T01:30:00Z", "2026-03-11T02:00:00Z"},
+		{"overnight ended", overnight, "2026-03-11T02:00:00Z", ""},
+		{"overnight before start", overnight, "2026-03-11T21:59:59Z", ""},
+		{"overnight after the last scheduled night", overnight, "2026-07-01T23:00:00Z", ""},
+		{"overnight from the last scheduled night", overnight, "2026-07-01T01:00:00Z", "2026-07-01T02:00:00Z"},
+		{"day 31 in February", monthEnd, "2026-02-28T11:00:00Z", "2026-02-28T12:00:00Z"},
+		{"day 31 in a leap year", monthEnd, "2028-02-29T11:00:00Z", "2028-02-29T12:00:00Z"},
+		{"day 31 not before month end", monthEnd, "2026-02-27T11:00:00Z", ""},
+		{"day 31 in April", monthEnd, "2026-04-30T10:00:00Z", "2026-04-30T12:00:00Z"},
+		{"day 31 in May", monthEnd, "2026-05-31T11:59:59Z", "2026-05-31T12:00:00Z"},
+		{"weekly in winter time", weekly, "2026-01-05T08:30:00Z", "2026-01-05T09:00:00Z"},
+		{"weekly in summer time", weekly, "2026-07-06T07:30:00Z", "2026-07-06T08:00:00Z"},
+		{"weekly on another day", weekly, "2026-07-07T07:30:00Z", ""},
+		{"spring forward", dst, "2026-03-29T01:30:00Z", "2026-03-29T02:00:00Z"},
+		{"spring forward ended", dst, "2026-03-29T02:00:00Z", ""},
+		{"fall back", dst, "2026-10-25T02:30:00Z", "2026-10-25T03:00:00Z"},
+		{"fall back before start", dst, "2026-10-24T22:59:00Z", ""},
+		{"once before start in its zone", once, "2026-12-24T04:59:59Z", ""},
+		{"once at start in its zone", once, "2026-12-24T05:00:00Z", "2026-12-27T05:00:00Z"},
+		{"once ended", once, "2026-12-27T05:00:00Z", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			now, err := time.Parse(time.RFC3339, test.now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := maintenanceWindowEnd(settingsValue(t, test.window), now)
+			switch {
+			case test.want == "" && !got.IsZero():
+				t.Errorf("got end %v, want no active window", got)
+			case test.want != "" && got.IsZero():
+				t.Errorf("got no active window, want end %s", test.want)
+			case test.want != "" && got.UTC().Format(time.RFC3339) != test.want:
+				t.Errorf("got end %s, want %s", got.UTC().Format(time.RFC3339), test.want)
+			}
+		})
+	}
+}
+
+func TestRecursOn(t *testing.T) {
+	tests := []struct {
+		schedule string
+		day      string
+		want     bool
+	}{
+		{`{"dayOfWeek": "FRIDAY"}`, "2026-10-16", true},
+		{`{"dayOfWeek": "friday"}`, "2026-10-16", true},
+		{`{"dayOfWeek": "MONDAY"}`, "2026-10-16", false},
+		{`{"dayOfMonth": 16}`, "2026-10-16", true},
+		{`{"dayOfMonth": 30}`, "2026-02-28", true},
+		{`{"dayOfMonth": 29}`, "2028-02-29", true},
+		{`{"dayOfMonth": 29}`, "2026-02-28", true},
+		{`{"dayOfMonth": 28}`, "2026-02-27", false},
+		{`{"dayOfMonth": 31}`, "2026-10-30", false},
+		{`{"recurrenceRange": {"scheduleStartDate": "2026-10-17"}}`, "2026-10-16", false},
+		{`{"recurrenceRange": {"scheduleStartDate": "2026-10-16", "scheduleEndDate": "2026-10-16"}}`, "2026-10-16", true},
+		{`{"recurrenceRange": {"scheduleEndDate": "2026-10-15"}}`, "2026-10-16", false},
+	}
+	for _, test := range tests {
+		day, err := time.Parse(time.DateOnly, test.day)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := recursOn(settingsValue(t, test.schedule), day); got != test.want {
+			t.Errorf("recursOn(%s, %s) = %v, want %v", test.schedule, test.day, got, test.want)
+		}
+	}
+}
+
+func TestCalendarFreezes(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "freezes.cfg")
+	content := strings.Join([]string{
+		"# Freezes of the platform team",
+		"Year end = 2026-12-20 / 2027-01-03 # both days included",
+		"Release = 2026-10-16T08:00:00Z / 2026-10-16T12:00:00Z",
+		"; Past = 2026-01-01 / 2026-01-02",
+		"",
+	}, "\n")
+	if err := os.WriteFile(fileName, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		now  time.Time
+		want []string
+	}{
+		{time.Date(2026, 12, 19, 23, 59, 0, 0, time.Local), nil},
+		{time.Date(2026, 12, 20, 0, 0, 0, 0, time.Local), []string{"Year end"}},
+		{time.Date(2027, 1, 3, 23, 59, 0, 0, time.Local), []string{"Year end"}},
+		{time.Date(2027, 1, 4, 0, 0, 0, 0, time.Local), nil},
+		{time.Date(2026, 10, 16, 8, 0, 0, 0, time.UTC), []string{"Release"}},
+		{time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC), nil},
+		{time.Date(2026, 1, 1, 12, 0, 0, 0, time.Local), nil},
+	}
+	for _, test := range tests {
+		active, err := calendarFreezes(fileName, test.now)
+		if err != nil {
+			t.Fatalf("calendarFreezes: %v", err)
+		}
+		var names []string
+		for _, freeze := range active {
+			names = append(names, freeze.Name)
+		}
+		if strings.Join(names, ",") != strings.Join(test.want, ",") {
+			t.Errorf("at %v: got %v, want %v", test.now, names, test.want)
+		}
+	}
+
+	if err := os.WriteFile(fileName, []byte("Broken = 2026-12-20\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := calendarFreezes(fileName, time.Now()); err == nil || !strings.Contains(err.Error(), ":1: expected") {
+		t.Errorf("line without an end: got %v", err)
+	}
+}
+
+func TestMaintenanceFreezes(t *testing.T) {
+	server := newTestServer(t)
+	useTestEnvironment(t, server, "settings.read")
+	t.Cleanup(func() { changeFreezeName = nil })
+
+	window := func(name string, enabled bool) json.RawMessage {
+		return json.RawMessage(fmt.Sprintf(`{"enabled": %t, "generalProperties": {"name": %q},
+			"schedule": {"scheduleType": "ONCE", "onceRecurrence": {
+			"startTime": "2026-12-24T00:00:00", "endTime": "2026-12-27T00:00:00", "timeZone": "UTC"}}}`, enabled, name))
+	}
+	server.AddSettingsObject(dttest.SettingsObject{ObjectID: "obj-1", SchemaID: maintenanceWindowSchema, Value: window("Freeze: holidays", true)})
+	server.AddSettingsObject(dttest.SettingsObject{ObjectID: "obj-2", SchemaID: maintenanceWindowSchema, Value: window("Patching", true)})
+	server.AddSettingsObject(dttest.SettingsObject{ObjectID: "obj-3", SchemaID: maintenanceWindowSchema, Value: window("Freeze: disabled", false)})
+	server.AddSettingsObject(dttest.SettingsObject{ObjectID: "obj-4", SchemaID: "builtin:alerting.profile", Value: window("Freeze: not a window", true)})
+
+	names := func(now time.Time) string {
+		t.Helper()
+		active, err := maintenanceFreezes(now)
+		if err != nil {
+			t.Fatalf("maintenanceFreezes: %v", err)
+		}
+		var names []string
+		for _, freeze := range active {
+			names = append(names, freeze.Name)
+		}
+		return strings.Join(names, ",")
+	}
+
+	during := time.Date(2026, 12, 25, 12, 0, 0, 0, time.UTC)
+	if got := names(during); got != "Freeze: holidays,Patching" {
+		t.Errorf("during the windows: got %q", got)
+	}
+	changeFreezeName = regexp.MustCompile(`^Freeze:`)
+	if got := names(during); got != "Freeze: holidays" {
+		t.Errorf("with change_freeze_name: got %q", got)
+	}
+	if got := names(during.AddDate(0, 0, 3)); got != "" {
+		t.Errorf("after the windows: got %q", got)
+	}
+
+	server.Fail("/api/v2/settings/objects", 500, "internal error", 1)
+	if _, err := maintenanceFreezes(during); err == nil {
+		t.Error("maintenanceFreezes succeeded although listing the windows failed")
+	}
+}
@@ -0,0 +1,311 @@
+/**
+* @license
+* Copyright 2020 Dynatrace LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Manifest describing a package's name, version and purpose
+const manifestFileName = "manifest.cfg"
+
+//go:embed templates
+var embeddedTemplates embed.FS
+
+// ============================================================
+// Starter package gallery
+// ============================================================
+
+// Template available from the embedded or a remote gallery; remote templates
+// are zip archives optionally pinned by SHA-256
+type galleryTemplate struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	URL         string `json:"url,omitempty"`
+	SHA256      string `json:"sha256,omitempty"`
+}
+
+// Index served at the template_gallery URL
+type galleryIndex struct {
+	Templates []galleryTemplate `json:"templates"`
+}
+
+// Read a package manifest's key = value entries
+func readManifest(fsys fs.FS, name string) (map[string]string, error) {
+	data, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	manifest := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		if key, value, ok := parseConfigLine(scanner.Text()); ok {
+			manifest[key] = value
+		}
+	}
+	return manifest, scanner.Err()
+}
+
+// List the templates embedded in the wrapper
+func embeddedGallery() ([]galleryTemplate, error) {
+	entries, err := fs.ReadDir(embeddedTemplates, "templates")
+	if err != nil {
+		return nil, err
+	}
+	var templates []galleryTemplate
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		manifest, err := readManifest(embeddedTemplates, path.Join("templates", entry.Name(), manifestFileName))
+		if err != nil {
+			return nil, fmt.Errorf("template %s: %w", entry.Name(), err)
+		}
+		templates = append(templates, galleryTemplate{Name: entry.Name(), Description: manifest["description"]})
+	}
+	return templates, nil
+}
+
+// Fetch the index of a remote gallery
+func remoteGallery(indexURL string) ([]galleryTemplate, error) {
+	data, err := downloadBytes(indexURL)
+	if err != nil {
+		return nil, err
+	}
+	var index galleryIndex
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, fmt.Errorf("invalid gallery index %s: %w", indexURL, err)
+	}
+	return index.Templates, nil
+}
+
+// Combine embedded templates with those of the remote gallery, if configured;
+// remote templates take precedence over embedded ones of the same name
+func templateGallery(indexURL string) ([]galleryTemplate, error) {
+	templates, err := embeddedGallery()
+	if err != nil {
+		return nil, err
+	}
+	if indexURL == "" {
+		return templates, nil
+	}
+
+	remote, err := remoteGallery(indexURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load template gallery: %w", err)
+	}
+	byName := make(map[string]galleryTemplate)
+	for _, t := range append(templates, remote...) {
+		byName[t.Name] = t
+	}
+	templates = templates[:0]
+	for _, t := range byName {
+		templates = append(templates, t)
+	}
+	sort.Slice(templates, func(i, j int) bool { return templates[i].Name < templates[j].Name })
+	return templates, nil
+}
+
+// Open a template's files, downloading remote templates
+func openTemplate(t galleryTemplate) (fs.FS, error) {
+	if t.URL == "" {
+		return fs.Sub(embeddedTemplates, path.Join("templates", t.Name))
+	}
+
+	data, err := downloadBytes(t.URL)
+	if err != nil {
+		return nil, err
+	}
+	if t.SHA256 != "" {
+		if err := verifyChecksum(data, t.SHA256); err != nil {
+			return nil, fmt.Errorf("template %s: %w", t.Name, err)
+		}
+	}
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("template %s: %w", t.Name, err)
+	}
+
+	// Archives created from a directory hold a single top-level folder
+	entries, err := fs.ReadDir(archive, ".")
+	if err == nil && len(entries) == 1 && entries[0].IsDir() {
+		return fs.Sub(archive, entries[0].Name())
+	}
+	return archive, nil
+}
+
+// Copy a template's files into dir without overwriting existing files
+func scaffoldTemplate(fsys fs.FS, dir string) ([]string, error) {
+	var written []string
+	err := fs.WalkDir(fsys, ".", func(name string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dir, filepath.FromSlash(name))
+		if entry.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+		file, err := os.OpenFile(target, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		if _, err := file.Write(data); err != nil {
+			return err
+		}
+		written = append(written, target)
+		return nil
+	})
+	return written, err
+}
+
+// Ask for the template variables declared with TF_VAR_<name>.prompt or .default
+// in a scaffolded wrapper.cfg and record the answers there, so the package runs
+// without prompting; empty answers leave the default or the prompt in place
+func promptTemplateVariables(fileName string) error {
+	data, err := os.ReadFile(fileName)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	lines := strings.Split(string(data), "\n")
+	config := make(map[string]string)
+	for _, line := range lines {
+		if key, value, ok := parseConfigLine(line); ok {
+			config[key] = value
+		}
+	}
+
+	reader := bufio.NewReader(os.Stdin)
+	var updated []string
+	answered := 0
+	for _, line := range lines {
+		updated = append(updated, line)
+		key, _, ok := parseConfigLine(line)
+		name, isPrompt := strings.CutSuffix(key, ".prompt")
+		if !isPrompt {
+			name, _ = strings.CutSuffix(key, ".default")
+		}
+		if !ok || name == key || !strings.HasPrefix(name, "TF_VAR_") {
+			continue
+		}
+		if _, set := config[name]; set {
+			continue
+		}
+		// Mark the variable as handled for its other key
+		config[name] = ""
+		prompt := config[name+".prompt"]
+		if prompt == "" {
+			prompt = fmt.Sprintf("Input %s:", strings.TrimPrefix(name, "TF_VAR_"))
+		}
+		if fallback := config[name+".default"]; fallback != "" {
+			prompt += " [" + fallback + "]"
+		}
+		fmt.Print(prompt + " ")
+		answer, _ := reader.ReadString('\n')
+		if answer = strings.TrimSpace(answer); answer != "" {
+			updated = append(updated, name+" = "+answer)
+			answered++
+		}
+	}
+	if answered == 0 {
+		return nil
+	}
+	return os.WriteFile(fileName, []byte(strings.Join(updated, "\n")), 0600)
+}
+
+// Print the available templates
+func listTemplates(indexURL string) error {
+	templates, err := templateGallery(indexURL)
+	if err != nil {
+		return err
+	}
+	fmt.Println("Available templates:")
+	for _, t := range templates {
+		source := "embedded"
+		if t.URL != "" {
+			source = "remote"
+		}
+		fmt.Printf("  %-28s %s (%s)\n", t.Name, t.Description, source)
+	}
+	return nil
+}
+
+// Scaffold a new package from a gallery template into dir (default: the template name)
+func newPackage(name, dir, indexURL string) error {
+	if name == "list" {
+		return listTemplates(indexURL)
+	}
+
+	templates, err := templateGallery(indexURL)
+	if err != nil {
+		return err
+	}
+	var selected *galleryTemplate
+	for i := range templates {
+		if templates[i].Name == name {
+			selected = &templates[i]
+		}
+	}
+	if selected == nil {
+		return fmt.Errorf("unknown template %q; run with -new list to see the available templates", name)
+	}
+
+	fsys, err := openTemplate(*selected)
+	if err != nil {
+		return err
+	}
+	if _, err := fs.Stat(fsys, manifestFileName); err != nil {
+		return fmt.Errorf("template %s has no %s", name, manifestFileName)
+	}
+
+	if dir == "" {
+		dir = name
+	}
+	written, err := scaffoldTemplate(fsys, dir)
+	if err != nil {
+		return fmt.Errorf("failed to scaffold %s: %w", dir, err)
+	}
+	for _, file := range written {
+		fmt.Printf("  created %s\n", file)
+	}
+	if !nonInteractive {
+		if err := promptTemplateVariables(filepath.Join(dir, configFileName)); err != nil {
+			return fmt.Errorf("failed to record template variables: %w", err)
+		}
+	}
+	fmt.Printf("Scaffolded %s from template %s. Copy the wrapper executable into %s and run it there.\n", dir, name, dir)
+	return nil
+}
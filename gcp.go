@@ -0,0 +1,106 @@
+/**
+* @license
+* Copyright 2020 Dynatrace LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2/google"
+)
+
+// Secret Manager REST endpoint
+var secretManagerURL = "https://secretmanager.googleapis.com/v1/"
+
+// ============================================================
+// Google Secret Manager references
+// ============================================================
+
+// Application Default Credentials client shared by all references in a run
+var googleClient struct {
+	once   sync.Once
+	client *http.Client
+	err    error
+}
+
+// Resolve "gsm:projects/<project>/secrets/<secret>[/versions/<version>]" using
+// Application Default Credentials (GOOGLE_APPLICATION_CREDENTIALS, gcloud
+// user credentials, workload identity or the metadata server); the latest
+// version is read unless one is given
+func resolveGoogleSecret(ref string) (string, error) {
+	parts := strings.Split(ref, "/")
+	if (len(parts) != 4 && len(parts) != 6) || parts[0] != "projects" || parts[1] == "" ||
+		parts[2] != "secrets" || parts[3] == "" || (len(parts) == 6 && (parts[4] != "versions" || parts[5] == "")) {
+		return "", fmt.Errorf("gsm reference must be of the form gsm:projects/<project>/secrets/<secret>[/versions/<version>]")
+	}
+	name := ref
+	if len(parts) == 4 {
+		name += "/versions/latest"
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	googleClient.once.Do(func() {
+		googleClient.client, googleClient.err = google.DefaultClient(context.Background(), "https://www.googleapis.com/auth/cloud-platform")
+	})
+	if googleClient.err != nil {
+		return "", fmt.Errorf("failed to find Google application default credentials: %w", googleClient.err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, secretManagerURL+name+":access", nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := googleClient.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to read Google secret %s: %w", ref, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return "", fmt.Errorf("Google secret %s: %w", ref, errSecretNotFound)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to read Google secret %s: %s: %s", ref, resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	var result struct {
+		Payload struct {
+			Data string `json:"data"`
+		} `json:"payload"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return "", fmt.Errorf("failed to parse Google secret %s: %w", ref, err)
+	}
+	value, err := base64.StdEncoding.DecodeString(result.Payload.Data)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode Google secret %s: %w", ref, err)
+	}
+	return string(value), nil
+}
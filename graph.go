@@ -0,0 +1,157 @@
+/**
+* @license
+* Copyright 2020 Dynatrace LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// Files the dependency graph is written to
+const (
+	graphDOTFileName = "graph.dot"
+	graphSVGFileName = "graph.svg"
+)
+
+var graphEdgePattern = regexp.MustCompile(`"([^"]+)"\s*->\s*"([^"]+)"`)
+
+// ============================================================
+// Resource dependency graph
+// ============================================================
+
+// Resource address of a graph node, or "" for providers, variables and other
+// non-resource nodes
+func graphResource(node string) string {
+	node = strings.TrimPrefix(node, "[root] ")
+	if i := strings.Index(node, " ("); i >= 0 {
+		node = node[:i]
+	}
+	for _, prefix := range []string{"provider", "var.", "output.", "local.", "meta.", "root"} {
+		if strings.HasPrefix(node, prefix) {
+			return ""
+		}
+	}
+	if !strings.Contains(node, ".") {
+		return ""
+	}
+	return node
+}
+
+// Dependencies between resources in terraform graph output
+func parseGraphDependencies(dot string) map[string][]string {
+	dependencies := make(map[string][]string)
+	for _, match := range graphEdgePattern.FindAllStringSubmatch(dot, -1) {
+		from, to := graphResource(match[1]), graphResource(match[2])
+		if from == "" {
+			continue
+		}
+		if _, found := dependencies[from]; !found {
+			dependencies[from] = nil
+		}
+		if to != "" && to != from && !strings.Contains(strings.Join(dependencies[from], "\n")+"\n", to+"\n") {
+			dependencies[from] = append(dependencies[from], to)
+		}
+	}
+	return dependencies
+}
+
+// Print resources nobody depends on with their dependencies indented below them
+func printDependencyTree(dependencies map[string][]string) {
+	dependedOn := make(map[string]bool)
+	for _, targets := range dependencies {
+		for _, target := range targets {
+			dependedOn[target] = true
+		}
+	}
+	var roots []string
+	for resource := range dependencies {
+		if !dependedOn[resource] {
+			roots = append(roots, resource)
+		}
+	}
+	sort.Strings(roots)
+
+	var walk func(resource, indent string, path map[string]bool)
+	walk = func(resource, indent string, path map[string]bool) {
+		if path[resource] {
+			fmt.Printf("%s%s (cycle)\n", indent, resource)
+			return
+		}
+		fmt.Printf("%s%s\n", indent, resource)
+		path[resource] = true
+		targets := append([]string(nil), dependencies[resource]...)
+		sort.Strings(targets)
+		for _, target := range targets {
+			walk(target, indent+"  └─ ", path)
+		}
+		delete(path, resource)
+	}
+	for _, root := range roots {
+		walk(root, "", make(map[string]bool))
+	}
+}
+
+// Open a file with the desktop's default application
+func openFile(path string) error {
+	switch runtime.GOOS {
+	case "windows":
+		return exec.Command("rundll32", "url.dll,FileProtocolHandler", path).Start()
+	case "darwin":
+		return exec.Command("open", path).Start()
+	default:
+		return exec.Command("xdg-open", path).Start()
+	}
+}
+
+// Write the dependency graph as DOT and, when Graphviz is installed, render and
+// open it as SVG; otherwise print it as a tree
+func showDependencyGraph(terraformPath string, logFile *os.File) error {
+	out, err := outputTerraformCommand(terraformPath, logFile, "graph")
+	if err != nil {
+		return fmt.Errorf("terraform graph failed: %w", err)
+	}
+	if err := os.WriteFile(graphDOTFileName, out, 0644); err != nil {
+		return err
+	}
+
+	if dotPath, err := exec.LookPath("dot"); err == nil {
+		if err := exec.Command(dotPath, "-Tsvg", "-o", graphSVGFileName, graphDOTFileName).Run(); err != nil {
+			return fmt.Errorf("failed to render %s: %w", graphSVGFileName, err)
+		}
+		fmt.Printf("Dependency graph written to %s.\n", graphSVGFileName)
+		if err := openFile(graphSVGFileName); err != nil {
+			fmt.Printf("Open %s to view it (%v).\n", graphSVGFileName, err)
+		}
+		return nil
+	}
+
+	dependencies := parseGraphDependencies(string(out))
+	if len(dependencies) == 0 {
+		fmt.Println("The bundle declares no resources.")
+		return nil
+	}
+	fmt.Println("\nResources and the resources they depend on:")
+	printDependencyTree(dependencies)
+	fmt.Printf("\nGraph written to %s; install Graphviz to render it as %s.\n", graphDOTFileName, graphSVGFileName)
+	return nil
+}
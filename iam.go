@@ -0,0 +1,160 @@
+/**
+* @license
+* Copyright 2020 Dynatrace LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// Set when the bundle manages account-level IAM resources through the Account Management API
+var iamMode bool
+
+// OAuth scopes account-management resources need
+var iamOAuthScopes = []string{"account-idm-read", "account-idm-write", "iam-policies-management"}
+
+// Account-level resource types outside the dynatrace_iam_ prefix
+var legacyIAMResourceTypes = map[string]bool{
+	"dynatrace_policy":          true,
+	"dynatrace_policy_bindings": true,
+	"dynatrace_user":            true,
+	"dynatrace_user_group":      true,
+	"dynatrace_mgmz_permission": true,
+}
+
+// ============================================================
+// Account management (IAM) mode
+// ============================================================
+
+// Whether a resource type is managed through the Account Management API
+func isIAMResourceType(resourceType string) bool {
+	return strings.HasPrefix(resourceType, "dynatrace_iam_") || legacyIAMResourceTypes[resourceType]
+}
+
+// Account-level resource types declared in the working directory's .tf files
+func bundleIAMResourceTypes() ([]string, error) {
+	blocks, err := parseTerraformFiles(".")
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	var types []string
+	for _, block := range blocks {
+		if (block.Type == "resource" || block.Type == "data") && len(block.Labels) > 0 && isIAMResourceType(block.Labels[0]) && !seen[block.Labels[0]] {
+			seen[block.Labels[0]] = true
+			types = append(types, block.Labels[0])
+		}
+	}
+	sort.Strings(types)
+	return types, nil
+}
+
+// Enter IAM mode when iam_mode = true, or when the bundle declares account
+// resources unless iam_mode = false; IAM mode needs the OAuth client
+// credentials, so the returned oauthClient is true whenever it is active
+func setupIAMMode(config map[string]string, oauthClient bool) (bool, error) {
+	iamMode = false
+	if config["iam_mode"] == "false" {
+		return oauthClient, nil
+	}
+	types, err := bundleIAMResourceTypes()
+	if err != nil {
+		return oauthClient, fmt.Errorf("failed to scan for account resources: %w", err)
+	}
+	if len(types) == 0 && config["iam_mode"] != "true" {
+		return oauthClient, nil
+	}
+	iamMode = true
+	if len(types) > 0 {
+		fmt.Printf("Bundle manages account resources (%s); using account management mode.\n", strings.Join(types, ", "))
+	}
+	if !oauthClient {
+		fmt.Println("Account resources need an OAuth client; asking for its credentials.")
+	}
+	return true, nil
+}
+
+// Check the OAuth client can manage the account named by the DT_ACCOUNT_ID URN:
+// it must be granted the IAM scopes and reach the account's IAM API; -force
+// downgrades failures to warnings
+func preflightAccount() error {
+	accountID := getEnv("DT_ACCOUNT_ID")
+	clientID, clientSecret := getEnv("DT_CLIENT_ID"), getEnv("DT_CLIENT_SECRET")
+
+	var problems []string
+	switch {
+	case !strings.HasPrefix(accountID, "urn:dtaccount:"):
+		problems = append(problems, fmt.Sprintf("DT_ACCOUNT_ID %q is not an account URN of the form urn:dtaccount:<uuid>", accountID))
+	case clientID == "" || clientSecret == "":
+		problems = append(problems, "DT_CLIENT_ID and DT_CLIENT_SECRET are required for account resources")
+	default:
+		if err := preflightOAuthClient("OAuth client (account)", clientID, clientSecret, accountID, iamOAuthScopes); err != nil {
+			problems = append(problems, err.Error()+"; grant it "+strings.Join(iamOAuthScopes, ", ")+" in Account Management > Identity & access management > OAuth clients")
+		} else if err := checkAccountAccess(clientID, clientSecret, accountID); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+
+	if len(problems) == 0 {
+		publishf("validator", "info", "OAuth client can manage account %s", strings.TrimPrefix(accountID, "urn:dtaccount:"))
+		return nil
+	}
+	if forceGuards {
+		for _, problem := range problems {
+			fmt.Printf("Warning: %s; continuing because of -force.\n", problem)
+			publishf("guard", "warning", "%s (forced)", problem)
+		}
+		return nil
+	}
+	return fmt.Errorf("%s", strings.Join(problems, "\n  "))
+}
+
+// List one group of the account to confirm the client is bound to it; network
+// failures are reported as warnings so offline runs are not blocked
+func checkAccountAccess(clientID, clientSecret, accountID string) error {
+	token, err := requestOAuthToken(clientID, clientSecret, accountID, strings.Join(iamOAuthScopes, " "))
+	if err != nil {
+		fmt.Printf("Warning: could not check account access: %v\n", err)
+		return nil
+	}
+	uuid := strings.TrimPrefix(accountID, "urn:dtaccount:")
+	req, err := http.NewRequest(http.MethodGet, accountAPIURL+"/iam/v1/accounts/"+uuid+"/groups?pageSize=1", nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		fmt.Printf("Warning: could not check account access: %v\n", err)
+		return nil
+	}
+	_, err = readAPIResponse(resp)
+	var apiErr *apiError
+	switch {
+	case err == nil:
+		return nil
+	case errors.As(err, &apiErr) && (apiErr.StatusCode == 401 || apiErr.StatusCode == 403 || apiErr.StatusCode == 404):
+		return fmt.Errorf("OAuth client has no access to the IAM API of account %s (%w); create the client in that account", uuid, err)
+	default:
+		fmt.Printf("Warning: could not check account access: %v\n", err)
+		return nil
+	}
+}
@@ -0,0 +1,245 @@
+/**
+* @license
+* Copyright 2020 Dynatrace LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Set when the plan summary estimates how many entities rule-based changes affect
+var planImpactAnalysis bool
+
+// Entity types counted as the members of a management zone, tag or alerting profile
+var impactEntityTypes = []string{"HOST", "PROCESS_GROUP", "SERVICE", "APPLICATION", "MOBILE_APPLICATION", "SYNTHETIC_TEST", "HTTP_CHECK", "KUBERNETES_CLUSTER", "CLOUD_APPLICATION"}
+
+// Entities matched by one selector before the count is reported as a lower bound
+const maxImpactEntities = 5000
+
+// Estimated entity matches of one planned change
+type impactEstimate struct {
+	Address string
+	Before  int
+	After   int
+	// Set when After is a lower bound, with the reason
+	Partial string
+}
+
+// ============================================================
+// Impact analysis of rule-based changes
+// ============================================================
+
+// Enable impact analysis for API token runs unless impact_analysis = false
+func setupImpactAnalysis(config map[string]string) {
+	planImpactAnalysis = getEnv("DT_API_TOKEN") != "" && config["impact_analysis"] != "false"
+}
+
+// Quote a value for an entity selector, escaping with ~
+func selectorString(value string) string {
+	return `"` + strings.NewReplacer("~", "~~", `"`, `~"`).Replace(value) + `"`
+}
+
+// Number of entities matching an entity selector
+func countEntities(selector string) (int, error) {
+	var response struct {
+		TotalCount int `json:"totalCount"`
+	}
+	err := dynatraceGet("/api/v2/entities?entitySelector="+url.QueryEscape(selector)+"&pageSize=1", &response)
+	return response.TotalCount, err
+}
+
+// Entities matching a condition such as mzName("x") summed over impactEntityTypes;
+// all entities of those types for an empty condition
+func countMembers(condition string) (int, error) {
+	total := 0
+	for _, entityType := range impactEntityTypes {
+		selector := "type(" + selectorString(entityType) + ")"
+		if condition != "" {
+			selector += "," + condition
+		}
+		count, err := countEntities(selector)
+		if err != nil {
+			return 0, err
+		}
+		total += count
+	}
+	return total, nil
+}
+
+// IDs of the entities matching an entity selector, and whether the list was cut
+// off at maxImpactEntities
+func matchEntities(selector string, into map[string]bool) (bool, error) {
+	path := "/api/v2/entities?entitySelector=" + url.QueryEscape(selector) + "&pageSize=500"
+	matched := 0
+	for {
+		var page struct {
+			Entities []struct {
+				EntityID string `json:"entityId"`
+			} `json:"entities"`
+			NextPageKey string `json:"nextPageKey"`
+		}
+		if err := dynatraceGet(path, &page); err != nil {
+			return false, err
+		}
+		for _, entity := range page.Entities {
+			into[entity.EntityID] = true
+		}
+		matched += len(page.Entities)
+		if page.NextPageKey == "" {
+			return false, nil
+		}
+		if matched >= maxImpactEntities {
+			return true, nil
+		}
+		path = "/api/v2/entities?nextPageKey=" + url.QueryEscape(page.NextPageKey)
+	}
+}
+
+// Enabled rules of a planned management zone or auto-tag, found as the nested
+// blocks carrying an entity_selector or attribute_rule
+func plannedRules(value any) []map[string]any {
+	var rules []map[string]any
+	switch value := value.(type) {
+	case map[string]any:
+		_, hasSelector := value["entity_selector"]
+		_, hasAttributes := value["attribute_rule"]
+		if hasSelector || hasAttributes {
+			if enabled, ok := value["enabled"].(bool); !ok || enabled {
+				rules = append(rules, value)
+			}
+			return rules
+		}
+		for _, nested := range value {
+			rules = append(rules, plannedRules(nested)...)
+		}
+	case []any:
+		for _, nested := range value {
+			rules = append(rules, plannedRules(nested)...)
+		}
+	}
+	return rules
+}
+
+// Union of the entities the planned rules match; attribute rules cannot be
+// evaluated outside Dynatrace and make the result a lower bound
+func estimateRuleMatches(after map[string]any) (int, string, error) {
+	entities := make(map[string]bool)
+	attributeRules, truncated := 0, false
+	for _, rule := range plannedRules(after) {
+		selector, _ := rule["entity_selector"].(string)
+		if selector == "" {
+			attributeRules++
+			continue
+		}
+		cut, err := matchEntities(selector, entities)
+		if err != nil {
+			return 0, "", err
+		}
+		truncated = truncated || cut
+	}
+	var partial []string
+	if attributeRules > 0 {
+		partial = append(partial, fmt.Sprintf("%d attribute rule(s) not estimated", attributeRules))
+	}
+	if truncated {
+		partial = append(partial, fmt.Sprintf("selectors matching over %d entities cut off", maxImpactEntities))
+	}
+	return len(entities), strings.Join(partial, ", "), nil
+}
+
+// Estimate the entities a management zone, auto-tag or alerting profile change
+// matches before and after; ok is false for other resource types
+func estimateImpact(resourceType string, before, after map[string]any) (impactEstimate, bool, error) {
+	var estimate impactEstimate
+	var membership func(values map[string]any) string
+	switch resourceType {
+	case "dynatrace_management_zone_v2":
+		membership = func(values map[string]any) string {
+			name, _ := values["name"].(string)
+			return "mzName(" + selectorString(name) + ")"
+		}
+	case "dynatrace_autotag_v2":
+		membership = func(values map[string]any) string {
+			name, _ := values["name"].(string)
+			return "tag(" + selectorString(name) + ")"
+		}
+	case "dynatrace_alerting":
+		// An alerting profile covers its management zone, or the whole environment
+		membership = func(values map[string]any) string {
+			if zone, _ := values["management_zone"].(string); zone != "" {
+				return "mzId(" + selectorString(zone) + ")"
+			}
+			return ""
+		}
+	default:
+		return estimate, false, nil
+	}
+
+	var err error
+	if before != nil {
+		if estimate.Before, err = countMembers(membership(before)); err != nil {
+			return estimate, true, err
+		}
+	}
+	switch {
+	case after == nil:
+	case resourceType == "dynatrace_alerting":
+		estimate.After, err = countMembers(membership(after))
+	default:
+		estimate.After, estimate.Partial, err = estimateRuleMatches(after)
+	}
+	return estimate, true, err
+}
+
+// Print the estimated blast radius of the plan's rule-based changes
+func renderPlanImpact(plan planDiff) {
+	if !planImpactAnalysis {
+		return
+	}
+	var estimates []impactEstimate
+	for _, change := range plan.ResourceChanges {
+		if planActionKind(change.Change.Actions) == "" {
+			continue
+		}
+		before, _ := change.Change.Before.(map[string]any)
+		after, _ := change.Change.After.(map[string]any)
+		estimate, ok, err := estimateImpact(change.Type, before, after)
+		if !ok {
+			continue
+		}
+		if err != nil {
+			fmt.Printf("Warning: could not estimate the impact of %s: %v\n", change.Address, err)
+			continue
+		}
+		estimate.Address = change.Address
+		estimates = append(estimates, estimate)
+	}
+	if len(estimates) == 0 {
+		return
+	}
+
+	fmt.Println("\nImpact on monitored entities (estimated):")
+	for _, estimate := range estimates {
+		if estimate.Partial != "" {
+			fmt.Printf("  %s: %d → at least %d entities (%s)\n", estimate.Address, estimate.Before, estimate.After, estimate.Partial)
+			continue
+		}
+		fmt.Printf("  %s: %d → %d entities\n", estimate.Address, estimate.Before, estimate.After)
+	}
+}
@@ -0,0 +1,110 @@
+/**
+* @license
+* Copyright 2020 Dynatrace LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"dynatrace-terraform-wrapper/internal/dttest"
+)
+
+// Planned attribute values decoded the way terraform show -json output is, nil for ""
+func plannedValues(t *testing.T, text string) map[string]any {
+	t.Helper()
+	if text == "" {
+		return nil
+	}
+	var values map[string]any
+	if err := json.Unmarshal([]byte(text), &values); err != nil {
+		t.Fatalf("invalid planned values: %v", err)
+	}
+	return values
+}
+
+func TestEstimateImpact(t *testing.T) {
+	server := newTestServer(t)
+	useTestEnvironment(t, server, "entities.read")
+
+	prod := dttest.ManagementZone{ID: "mz-1", Name: "Prod"}
+	server.AddEntity(dttest.Entity{Type: "HOST", DisplayName: "web-1", Tags: []string{"prod"}, ManagementZones: []dttest.ManagementZone{prod}})
+	server.AddEntity(dttest.Entity{Type: "HOST", DisplayName: "web-2", ManagementZones: []dttest.ManagementZone{prod}})
+	server.AddEntity(dttest.Entity{Type: "HOST", DisplayName: "batch-1"})
+	server.AddEntity(dttest.Entity{Type: "SERVICE", DisplayName: "checkout", Tags: []string{"prod"}})
+
+	tests := []struct {
+		name         string
+		resourceType string
+		before       string
+		after        string
+		want         impactEstimate
+		wantOK       bool
+	}{
+		{
+			"management zone widened to all hosts", "dynatrace_management_zone_v2",
+			`{"name": "Prod"}`,
+			`{"name": "Prod", "rules": {"rule": [
+				{"enabled": true, "entity_selector": "type(\"HOST\")"},
+				{"enabled": false, "entity_selector": "type(\"SERVICE\")"}]}}`,
+			impactEstimate{Before: 2, After: 3}, true,
+		},
+		{
+			"new auto-tag with an attribute rule", "dynatrace_autotag_v2",
+			``,
+			`{"name": "prod", "rules": {"rule": [
+				{"entity_selector": "tag(\"prod\")"},
+				{"entity_selector": "type(\"HOST\"),entityName(\"batch-1\")"},
+				{"attribute_rule": [{"entity_type": "HOST"}]}]}}`,
+			impactEstimate{Before: 0, After: 3, Partial: "1 attribute rule(s) not estimated"}, true,
+		},
+		{
+			"alerting profile narrowed to a zone", "dynatrace_alerting",
+			`{"name": "Ops"}`,
+			`{"name": "Ops", "management_zone": "mz-1"}`,
+			impactEstimate{Before: 4, After: 2}, true,
+		},
+		{
+			"deleted management zone", "dynatrace_management_zone_v2",
+			`{"name": "Prod"}`,
+			``,
+			impactEstimate{Before: 2, After: 0}, true,
+		},
+		{
+			"not rule-based", "dynatrace_dashboard",
+			`{"name": "Ops"}`,
+			`{"name": "Ops"}`,
+			impactEstimate{}, false,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, ok, err := estimateImpact(test.resourceType, plannedValues(t, test.before), plannedValues(t, test.after))
+			if err != nil {
+				t.Fatalf("estimateImpact: %v", err)
+			}
+			if ok != test.wantOK || got != test.want {
+				t.Errorf("estimateImpact = %+v, %v, want %+v, %v", got, ok, test.want, test.wantOK)
+			}
+		})
+	}
+
+	server.Fail("/api/v2/entities", 500, "internal error", 1)
+	if _, _, err := estimateImpact("dynatrace_autotag_v2", nil, map[string]any{"entity_selector": `type("HOST")`}); err == nil {
+		t.Error("estimateImpact: want the entities API error")
+	}
+}
@@ -0,0 +1,174 @@
+/**
+* @license
+* Copyright 2020 Dynatrace LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+)
+
+// Values of the repeatable -import flag
+var cliImports = &listFlag{}
+
+// ============================================================
+// Import existing Dynatrace configuration into state
+// ============================================================
+
+// Resource address and the Dynatrace entity or settings object ID to import into it
+type importItem struct {
+	Address string
+	ID      string
+}
+
+// Split "address=value" at the first "=" outside the address's index brackets,
+// so for_each keys may contain "="
+func cutAddress(pair string) (string, string, bool) {
+	depth := 0
+	for i, r := range pair {
+		switch r {
+		case '[':
+			depth++
+		case ']':
+			depth--
+		case '=':
+			if depth == 0 {
+				address, value := strings.TrimSpace(pair[:i]), strings.TrimSpace(pair[i+1:])
+				return address, value, address != "" && value != ""
+			}
+		}
+	}
+	return "", "", false
+}
+
+// Parse an "address=id" import pair
+func parseImportPair(pair string) (importItem, error) {
+	address, id, ok := cutAddress(pair)
+	if !ok {
+		return importItem{}, fmt.Errorf("expected address=id, got %q", pair)
+	}
+	return importItem{address, id}, nil
+}
+
+// Read address,id rows from a CSV file; a leading "address,id" header row and
+// lines starting with # are skipped
+func readImportCSV(fileName string) ([]importItem, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = 2
+	reader.TrimLeadingSpace = true
+	var items []importItem
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", fileName, err)
+		}
+		if len(items) == 0 && strings.EqualFold(record[0], "address") {
+			continue
+		}
+		address, id := strings.TrimSpace(record[0]), strings.TrimSpace(record[1])
+		if address == "" || id == "" {
+			line, _ := reader.FieldPos(0)
+			return nil, fmt.Errorf("%s:%d: address and id are required", fileName, line)
+		}
+		items = append(items, importItem{address, id})
+	}
+	return items, nil
+}
+
+// Collect the items given with -import and -import-csv
+func importItems(csvFile string) ([]importItem, error) {
+	var items []importItem
+	for _, pair := range cliImports.values {
+		item, err := parseImportPair(pair)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	if csvFile != "" {
+		csvItems, err := readImportCSV(csvFile)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, csvItems...)
+	}
+	return items, nil
+}
+
+// Import each item, skipping addresses already in state and continuing past
+// failures; returns an error summarizing the items that failed
+func importResources(terraformPath string, logFile *os.File, items []importItem) error {
+	if err := ensureWorkspace(terraformPath, logFile); err != nil {
+		return err
+	}
+	existing, err := listStateResources(terraformPath, logFile)
+	if err != nil {
+		return fmt.Errorf("failed to list state: %w", err)
+	}
+
+	var failed []string
+	imported, skipped := 0, 0
+	for i, item := range items {
+		fmt.Printf("[%d/%d] %s <- %s: ", i+1, len(items), item.Address, item.ID)
+		if slices.Contains(existing, item.Address) {
+			fmt.Println("already in state, skipped")
+			skipped++
+			continue
+		}
+		args := append([]string{"import", "-input=false"}, variableArgs...)
+		err := executeTerraformCommand(terraformPath, logFile, append(args, item.Address, item.ID)...)
+		if err != nil {
+			fmt.Println("failed")
+			var cmdErr *terraformCommandError
+			reason := err.Error()
+			if errors.As(err, &cmdErr) {
+				if classification, _ := classifyTerraformError(cmdErr.output); classification != "" {
+					reason = classification
+				}
+			}
+			failed = append(failed, fmt.Sprintf("%s (%s): %s", item.Address, item.ID, reason))
+			publishf("import", "error", "%s failed: %s", item.Address, reason)
+			continue
+		}
+		fmt.Println("imported")
+		imported++
+		publishf("import", "progress", "Imported %s", item.Address)
+	}
+
+	fmt.Printf("Imported %d, skipped %d, failed %d of %d resource(s).\n", imported, skipped, len(failed), len(items))
+	var runErr error
+	if len(failed) > 0 {
+		runErr = fmt.Errorf("%d import(s) failed:\n  %s", len(failed), strings.Join(failed, "\n  "))
+	}
+	recordAudit("import", runErr)
+	return runErr
+}
@@ -0,0 +1,102 @@
+/**
+* @license
+* Copyright 2020 Dynatrace LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Set by -upgrade, -reconfigure, -migrate-state and -backend-config
+var (
+	cliInitUpgrade    bool
+	cliReconfigure    bool
+	cliMigrateState   bool
+	cliBackendConfigs = &listFlag{}
+)
+
+// Arguments added to every terraform init
+var initArgs []string
+
+// ============================================================
+// Init options
+// ============================================================
+
+// Build the init arguments from init_upgrade, backend_config.<key> and the
+// init flags; -backend-config values come last so they override the config
+func setupInitOptions(config map[string]string) error {
+	if cliReconfigure && cliMigrateState {
+		return fmt.Errorf("-reconfigure and -migrate-state cannot be combined")
+	}
+
+	initArgs = nil
+	if cliInitUpgrade || config["init_upgrade"] == "true" {
+		initArgs = append(initArgs, "-upgrade")
+	}
+	if cliReconfigure {
+		initArgs = append(initArgs, "-reconfigure")
+	}
+	if cliMigrateState {
+		initArgs = append(initArgs, "-migrate-state", "-force-copy")
+	}
+
+	var keys []string
+	for key := range config {
+		if strings.HasPrefix(key, "backend_config.") {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	// The cloud block takes its settings from backend.tf, not -backend-config
+	if config["backend"] == "cloud" {
+		keys = nil
+	}
+	for _, key := range keys {
+		value, err := resolveConfigValue(config[key])
+		if err != nil {
+			return fmt.Errorf("failed to resolve %s: %w", key, err)
+		}
+		initArgs = append(initArgs, "-backend-config="+strings.TrimPrefix(key, "backend_config.")+"="+value)
+	}
+	for _, value := range cliBackendConfigs.values {
+		initArgs = append(initArgs, "-backend-config="+value)
+	}
+	return nil
+}
+
+// Ask before init copies the existing state to a changed backend, since the
+// prompt of terraform itself would go to the log
+func confirmStateMigration() error {
+	if !cliMigrateState {
+		return nil
+	}
+	switch {
+	case nonInteractive && !forceGuards:
+		return fmt.Errorf("-migrate-state needs confirmation; rerun with -force in non-interactive mode")
+	case !nonInteractive:
+		fmt.Print("Copy the existing state to the new backend? (y/n): ")
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		if strings.ToLower(strings.TrimSpace(answer)) != "y" {
+			return fmt.Errorf("state migration cancelled")
+		}
+	}
+	return nil
+}
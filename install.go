@@ -0,0 +1,260 @@
+/**
+* @license
+* Copyright 2020 Dynatrace LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"runtime"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ============================================================
+// Terraform install strategies
+// ============================================================
+
+// Windows error codes raised when antivirus software blocks or quarantines a file
+const (
+	errorSharingViolation = syscall.Errno(32)
+	errorVirusInfected    = syscall.Errno(225)
+	errorVirusDeleted     = syscall.Errno(226)
+)
+
+// Install Terraform using the configured strategy:
+//
+//	zip     download terraform.zip to disk and extract it (default)
+//	memory  download the zip into memory and extract only the executable
+//	binary  download a standalone executable from terraform_binary_url
+//	auto    try binary when terraform_binary_url is set, falling back to memory
+func installTerraform(strategy string, config map[string]string) (string, error) {
+	install := func() (string, error) {
+		switch strategy {
+		case "", "zip":
+			if err := downloadTerraform(); err != nil {
+				return "", fmt.Errorf("failed to download Terraform: %w", err)
+			}
+			return unzipTerraform("terraform.zip")
+		case "memory":
+			return installTerraformFromMemory()
+		case "binary":
+			return installTerraformBinary(config)
+		case "auto":
+			if config["terraform_binary_url"] != "" {
+				path, err := installTerraformBinary(config)
+				if err == nil {
+					return path, nil
+				}
+				fmt.Printf("Standalone binary install failed (%v); falling back to memory.\n", err)
+			}
+			return installTerraformFromMemory()
+		default:
+			return "", fmt.Errorf("unknown install_strategy %q (expected zip, memory, binary or auto)", strategy)
+		}
+	}
+
+	if runtime.GOOS != "windows" {
+		return install()
+	}
+	return retryQuarantined(install)
+}
+
+// Executable file name for the current platform
+func terraformExecutableName() string {
+	if runtime.GOOS == "windows" {
+		return "terraform.exe"
+	}
+	return "terraform"
+}
+
+// Download a URL into memory
+func downloadBytes(url string) ([]byte, error) {
+	resp, err := http.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("download failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("download of %s failed: %s", url, resp.Status)
+	}
+	publishf("download", "start", "Downloading %s", url)
+	data, err := io.ReadAll(&progressReader{reader: resp.Body, source: "download", message: path.Base(url), total: resp.ContentLength})
+	if err != nil {
+		publishf("download", "error", "Download of %s failed: %v", url, err)
+		return nil, err
+	}
+	publishf("download", "done", "Downloaded %s", url)
+	return data, nil
+}
+
+// Verify data against a hex encoded SHA256 checksum
+func verifyChecksum(data []byte, expected string) error {
+	sum := sha256.Sum256(data)
+	actual := hex.EncodeToString(sum[:])
+	if !strings.EqualFold(actual, strings.TrimSpace(expected)) {
+		return fmt.Errorf("checksum mismatch: expected %s, got %s", expected, actual)
+	}
+	return nil
+}
+
+// Look up a file's checksum in HashiCorp's SHA256SUMS file
+func releaseChecksum(fileName string) (string, error) {
+	url := fmt.Sprintf("https://releases.hashicorp.com/terraform/%s/terraform_%s_SHA256SUMS", terraformVersion, terraformVersion)
+	sums, err := downloadBytes(url)
+	if err != nil {
+		return "", err
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(sums))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && fields[1] == fileName {
+			return fields[0], nil
+		}
+	}
+	return "", fmt.Errorf("no checksum published for %s", fileName)
+}
+
+// Download the release zip for this platform and verify it against SHA256SUMS,
+// returning its contents and file name
+func downloadReleaseZip() ([]byte, string, error) {
+	fileName := fmt.Sprintf("terraform_%s_%s_%s.zip", terraformVersion, runtime.GOOS, runtime.GOARCH)
+	data, err := downloadBytes(fmt.Sprintf("https://releases.hashicorp.com/terraform/%s/%s", terraformVersion, fileName))
+	if err != nil {
+		return nil, "", err
+	}
+
+	checksum, err := releaseChecksum(fileName)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to fetch checksum: %w", err)
+	}
+	if err := verifyChecksum(data, checksum); err != nil {
+		return nil, "", err
+	}
+	return data, fileName, nil
+}
+
+// Download and verify the release zip, extracting the executable without writing the archive to disk
+func installTerraformFromMemory() (string, error) {
+	data, fileName, err := downloadReleaseZip()
+	if err != nil {
+		return "", err
+	}
+
+	r, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "", err
+	}
+	for _, f := range r.File {
+		if f.Name != terraformExecutableName() {
+			continue
+		}
+		if err := extractFile(f, f.Name); err != nil {
+			return "", err
+		}
+		return finalizeExecutable(f.Name)
+	}
+	return "", fmt.Errorf("%s not found in %s", terraformExecutableName(), fileName)
+}
+
+// Download and verify a standalone Terraform executable; terraform_binary_url may
+// contain {version}, {os} and {arch} placeholders, and the checksum comes from
+// terraform_binary_sha256 or a "<url>.sha256" file published next to the binary
+func installTerraformBinary(config map[string]string) (string, error) {
+	urlTemplate := config["terraform_binary_url"]
+	if urlTemplate == "" {
+		return "", errors.New("terraform_binary_url is not configured")
+	}
+	url := strings.NewReplacer("{version}", terraformVersion, "{os}", runtime.GOOS, "{arch}", runtime.GOARCH).Replace(urlTemplate)
+
+	data, err := downloadBytes(url)
+	if err != nil {
+		return "", err
+	}
+
+	checksum := config["terraform_binary_sha256"]
+	if checksum == "" {
+		sum, err := downloadBytes(url + ".sha256")
+		if err != nil {
+			return "", fmt.Errorf("no checksum available to verify %s: %w", url, err)
+		}
+		if fields := strings.Fields(string(sum)); len(fields) > 0 {
+			checksum = fields[0]
+		}
+	}
+	if err := verifyChecksum(data, checksum); err != nil {
+		return "", err
+	}
+
+	execPath := terraformExecutableName()
+	if err := os.WriteFile(execPath, data, 0755); err != nil {
+		return "", err
+	}
+	return finalizeExecutable(execPath)
+}
+
+// Make the extracted executable runnable and return the path to invoke it with
+func finalizeExecutable(execPath string) (string, error) {
+	if runtime.GOOS == "windows" {
+		return execPath, nil
+	}
+	if err := os.Chmod(execPath, 0755); err != nil {
+		return "", err
+	}
+	return "./" + execPath, nil // Prepend './' for Unix
+}
+
+// Check whether an install error looks like antivirus interference
+func isQuarantineError(err error) bool {
+	return errors.Is(err, errorSharingViolation) || errors.Is(err, errorVirusInfected) ||
+		errors.Is(err, errorVirusDeleted) || errors.Is(err, os.ErrPermission)
+}
+
+// Retry an install when Windows Defender (or similar) locks or removes the
+// executable shortly after it is written
+func retryQuarantined(install func() (string, error)) (string, error) {
+	delay := 5 * time.Second
+	for attempt := 1; ; attempt++ {
+		path, err := install()
+		if err == nil {
+			if _, statErr := os.Stat(path); statErr == nil {
+				return path, nil
+			}
+			err = fmt.Errorf("%s disappeared after install", path)
+		} else if !isQuarantineError(err) {
+			return "", err
+		}
+
+		if attempt == 3 {
+			return "", fmt.Errorf("%w; the executable may have been quarantined by antivirus software, consider adding an exclusion for this directory", err)
+		}
+		fmt.Printf("Terraform install was blocked (%v); retrying in %s...\n", err, delay)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
@@ -0,0 +1,971 @@
+/**
+* @license
+* Copyright 2020 Dynatrace LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+// Package dttest provides a configurable fake Dynatrace API for exercising wrapper
+// features that call a tenant without live credentials.
+//
+// A Server serves the token lookup and creation, OAuth token, cluster version,
+// settings objects, settings schemas, entities, metrics query, problems, events
+// and synthetic monitor and location endpoints and the Account Management
+// environment list from in-memory state. Tokens, settings objects, schemas,
+// entities, metric data, problems, synthetic monitors and locations and account
+// environments are seeded through the Server's methods; failures and rate limiting can be
+// injected per path. Every request is recorded for later inspection.
+package dttest
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Metadata returned for an API token by the token lookup endpoint
+type TokenInfo struct {
+	ID             string   `json:"id"`
+	Name           string   `json:"name"`
+	Enabled        bool     `json:"enabled"`
+	Owner          string   `json:"owner"`
+	CreationDate   string   `json:"creationDate"`
+	ExpirationDate string   `json:"expirationDate,omitempty"`
+	Scopes         []string `json:"scopes"`
+	TenantID       string   `json:"tenantId,omitempty"`
+}
+
+// OAuth client accepted by the SSO token endpoint
+type OAuthClient struct {
+	Secret    string
+	AccountID string
+	Scopes    []string
+}
+
+// Settings 2.0 object
+type SettingsObject struct {
+	ObjectID      string          `json:"objectId"`
+	SchemaID      string          `json:"schemaId"`
+	SchemaVersion string          `json:"schemaVersion,omitempty"`
+	Scope         string          `json:"scope"`
+	Value         json.RawMessage `json:"value"`
+}
+
+// Event ingested through the events API
+type Event struct {
+	EventType  string            `json:"eventType"`
+	Title      string            `json:"title"`
+	StartTime  int64             `json:"startTime,omitempty"`
+	EndTime    int64             `json:"endTime,omitempty"`
+	Properties map[string]string `json:"properties,omitempty"`
+}
+
+// Problem returned by the problems API
+type Problem struct {
+	ProblemID     string `json:"problemId"`
+	DisplayID     string `json:"displayId"`
+	Title         string `json:"title"`
+	Status        string `json:"status"`
+	SeverityLevel string `json:"severityLevel"`
+	StartTime     int64  `json:"startTime"`
+	EndTime       int64  `json:"endTime"`
+}
+
+// Monitored entity returned by the entities API
+type Entity struct {
+	EntityID        string           `json:"entityId"`
+	Type            string           `json:"type"`
+	DisplayName     string           `json:"displayName"`
+	Tags            []string         `json:"-"`
+	ManagementZones []ManagementZone `json:"-"`
+}
+
+// Management zone an entity belongs to
+type ManagementZone struct {
+	ID   string
+	Name string
+}
+
+// Synthetic location listed by the synthetic API
+type SyntheticLocation struct {
+	EntityID string `json:"entityId"`
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Status   string `json:"status"`
+}
+
+// Synthetic monitor listed by the synthetic API
+type SyntheticMonitor struct {
+	EntityID string `json:"entityId"`
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Enabled  bool   `json:"enabled"`
+}
+
+// Environment of an account listed by the Account Management API
+type Environment struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Active bool   `json:"active"`
+	URL    string `json:"url"`
+	Tags   []Tag  `json:"tags,omitempty"`
+}
+
+// Tag of an account environment
+type Tag struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// Account and scopes an issued OAuth access token was granted for
+type grant struct {
+	accountID string
+	scopes    []string
+}
+
+// Request received by the server
+type Request struct {
+	Method string
+	Path   string
+	Query  string
+	Body   string
+}
+
+// Settings schema version and definition
+type schema struct {
+	version    string
+	definition map[string]json.RawMessage
+}
+
+// Injected response for requests to a path
+type failure struct {
+	status    int
+	body      string
+	remaining int
+}
+
+// Fake Dynatrace tenant and SSO endpoint
+type Server struct {
+	*httptest.Server
+
+	mu          sync.Mutex
+	version     string
+	tokens      map[string]TokenInfo
+	clients     map[string]OAuthClient
+	grants      map[string]grant
+	accounts    map[string][]Environment
+	settings    map[string]SettingsObject
+	schemas     map[string]schema
+	events      []Event
+	problems    []Problem
+	entities    []Entity
+	metrics     map[string][]float64
+	locations   []SyntheticLocation
+	monitors    []SyntheticMonitor
+	requests    []Request
+	failures    map[string]*failure
+	rateLimitN  int
+	rateLimited int
+	nextID      int
+}
+
+// Start a fake API server; callers must Close it
+func NewServer() *Server {
+	s := &Server{
+		version:  "1.300.0.20240101-000000",
+		tokens:   make(map[string]TokenInfo),
+		clients:  make(map[string]OAuthClient),
+		grants:   make(map[string]grant),
+		accounts: make(map[string][]Environment),
+		settings: make(map[string]SettingsObject),
+		schemas:  make(map[string]schema),
+		metrics:  make(map[string][]float64),
+		failures: make(map[string]*failure),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v2/apiTokens", s.handleCreateToken)
+	mux.HandleFunc("/api/v2/apiTokens/", s.handleDeleteToken)
+	mux.HandleFunc("/api/v2/apiTokens/lookup", s.handleTokenLookup)
+	mux.HandleFunc("/sso/oauth2/token", s.handleOAuthToken)
+	mux.HandleFunc("/api/v1/config/clusterversion", s.handleClusterVersion)
+	mux.HandleFunc("/api/v2/settings/objects", s.handleSettingsObjects)
+	mux.HandleFunc("/api/v2/settings/objects/", s.handleSettingsObject)
+	mux.HandleFunc("/api/v2/settings/schemas/", s.handleSettingsSchema)
+	mux.HandleFunc("/api/v2/entities", s.handleEntities)
+	mux.HandleFunc("/api/v2/metrics/query", s.handleMetricsQuery)
+	mux.HandleFunc("/api/v2/problems", s.handleProblems)
+	mux.HandleFunc("/api/v2/events/ingest", s.handleEventIngest)
+	mux.HandleFunc("/api/v1/synthetic/locations", s.handleSyntheticLocations)
+	mux.HandleFunc("/api/v1/synthetic/monitors", s.handleSyntheticMonitors)
+	mux.HandleFunc("/api/v1/synthetic/monitors/", s.handleSyntheticMonitor)
+	mux.HandleFunc("/env/v1/accounts/", s.handleAccountEnvironments)
+	s.Server = httptest.NewServer(s.intercept(mux))
+	return s
+}
+
+// URL of the OAuth token endpoint, for use in place of the Dynatrace SSO URL
+func (s *Server) TokenURL() string {
+	return s.URL + "/sso/oauth2/token"
+}
+
+// Register an enabled API token; ID, Name and CreationDate get defaults unless set
+func (s *Server) AddToken(token string, info TokenInfo) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if info.ID == "" {
+		info.ID = token
+		if parts := strings.SplitN(token, ".", 3); len(parts) == 3 {
+			info.ID = parts[0] + "." + parts[1]
+		}
+	}
+	if info.Name == "" {
+		info.Name = "dttest"
+	}
+	if info.CreationDate == "" {
+		info.CreationDate = time.Now().UTC().Format(time.RFC3339)
+	}
+	info.Enabled = true
+	s.tokens[token] = info
+}
+
+// Disable an API token; lookups still describe it but authenticated calls fail with 401
+func (s *Server) DisableToken(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if info, found := s.tokens[token]; found {
+		info.Enabled = false
+		s.tokens[token] = info
+	}
+}
+
+// Revoke an API token so lookups and authenticated calls fail with 401
+func (s *Server) RevokeToken(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.tokens, token)
+}
+
+// Register an OAuth client
+func (s *Server) AddOAuthClient(clientID string, client OAuthClient) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.clients[clientID] = client
+}
+
+// Add an environment to an account, given as urn:dtaccount:<uuid> or the bare UUID
+func (s *Server) AddEnvironment(accountID string, env Environment) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	uuid := strings.TrimPrefix(accountID, "urn:dtaccount:")
+	s.accounts[uuid] = append(s.accounts[uuid], env)
+}
+
+// Register a settings schema version, which is reported for objects of the
+// schema. definition is a JSON object with the schema's properties, types and
+// enums, or empty for a schema without any
+func (s *Server) AddSchema(schemaID, version, definition string) {
+	var fields map[string]json.RawMessage
+	if definition != "" {
+		if err := json.Unmarshal([]byte(definition), &fields); err != nil {
+			panic(fmt.Sprintf("dttest: invalid definition of schema %s: %v", schemaID, err))
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.schemas[schemaID] = schema{version: version, definition: fields}
+}
+
+// Store a settings object, returning its object ID
+func (s *Server) AddSettingsObject(obj SettingsObject) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if obj.ObjectID == "" {
+		obj.ObjectID = s.newID("obj")
+	}
+	if obj.Scope == "" {
+		obj.Scope = "environment"
+	}
+	if obj.SchemaVersion == "" {
+		obj.SchemaVersion = s.schemas[obj.SchemaID].version
+	}
+	s.settings[obj.ObjectID] = obj
+	return obj.ObjectID
+}
+
+// Settings objects currently stored, ordered by object ID
+func (s *Server) SettingsObjects() []SettingsObject {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	objects := make([]SettingsObject, 0, len(s.settings))
+	for _, obj := range s.settings {
+		objects = append(objects, obj)
+	}
+	sort.Slice(objects, func(i, j int) bool { return objects[i].ObjectID < objects[j].ObjectID })
+	return objects
+}
+
+// Add a problem; ProblemID and Status default to a generated ID and OPEN
+func (s *Server) AddProblem(problem Problem) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if problem.ProblemID == "" {
+		problem.ProblemID = s.newID("problem")
+	}
+	if problem.Status == "" {
+		problem.Status = "OPEN"
+	}
+	s.problems = append(s.problems, problem)
+}
+
+// Add a monitored entity, returning its entity ID
+func (s *Server) AddEntity(entity Entity) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if entity.EntityID == "" {
+		entity.EntityID = s.newID(entity.Type)
+	}
+	s.entities = append(s.entities, entity)
+	return entity.EntityID
+}
+
+// Set the data points the metrics query returns for a metric selector; a selector
+// set without values has no data, and queries of unknown selectors fail with 404
+func (s *Server) AddMetricData(metricSelector string, values ...float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.metrics[metricSelector] = values
+}
+
+// Add a synthetic location; Status defaults to ENABLED
+func (s *Server) AddSyntheticLocation(location SyntheticLocation) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if location.Status == "" {
+		location.Status = "ENABLED"
+	}
+	s.locations = append(s.locations, location)
+}
+
+// Add a synthetic monitor, returning its entity ID
+func (s *Server) AddSyntheticMonitor(monitor SyntheticMonitor) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if monitor.EntityID == "" {
+		monitor.EntityID = s.newID("SYNTHETIC_TEST")
+	}
+	s.monitors = append(s.monitors, monitor)
+	return monitor.EntityID
+}
+
+// Events ingested so far
+func (s *Server) Events() []Event {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Event(nil), s.events...)
+}
+
+// Requests received so far
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+// Answer the next count requests to path with status and body; count < 0 fails indefinitely
+func (s *Server) Fail(path string, status int, body string, count int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures[path] = &failure{status: status, body: body, remaining: count}
+}
+
+// Answer every nth API request with 429 Too Many Requests; 0 disables rate limiting
+func (s *Server) RateLimitEvery(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rateLimitN = n
+}
+
+// Number of requests answered with 429 by RateLimitEvery
+func (s *Server) RateLimited() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.rateLimited
+}
+
+func (s *Server) newID(prefix string) string {
+	s.nextID++
+	return fmt.Sprintf("%s-%d", prefix, s.nextID)
+}
+
+// Record requests and apply injected failures before dispatching
+func (s *Server) intercept(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		r.Body = io.NopCloser(strings.NewReader(string(body)))
+
+		s.mu.Lock()
+		s.requests = append(s.requests, Request{Method: r.Method, Path: r.URL.Path, Query: r.URL.RawQuery, Body: string(body)})
+		if f := s.failures[r.URL.Path]; f != nil && f.remaining != 0 {
+			f.remaining--
+			s.mu.Unlock()
+			writeError(w, f.status, f.body)
+			return
+		}
+		if s.rateLimitN > 0 && len(s.requests)%s.rateLimitN == 0 {
+			s.rateLimited++
+			s.mu.Unlock()
+			w.Header().Set("Retry-After", "1")
+			writeError(w, http.StatusTooManyRequests, "Too Many Requests")
+			return
+		}
+		s.mu.Unlock()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Check the Api-Token authorization header names a known, enabled token with scope
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request, scope string) bool {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Api-Token ")
+	s.mu.Lock()
+	info, found := s.tokens[token]
+	s.mu.Unlock()
+	if !found || !info.Enabled {
+		writeError(w, http.StatusUnauthorized, "Token Authentication failed")
+		return false
+	}
+	if scope != "" && !contains(info.Scopes, scope) {
+		writeError(w, http.StatusForbidden, "Token is missing required scope. Use one of: "+scope)
+		return false
+	}
+	return true
+}
+
+func (s *Server) handleCreateToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if !s.authorize(w, r, "apiTokens.write") {
+		return
+	}
+	var req struct {
+		Name           string   `json:"name"`
+		Scopes         []string `json:"scopes"`
+		ExpirationDate string   `json:"expirationDate"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Name == "" || len(req.Scopes) == 0 {
+		writeError(w, http.StatusBadRequest, "name and scopes are required")
+		return
+	}
+	expiration := req.ExpirationDate
+	if days, found := strings.CutPrefix(expiration, "now+"); found {
+		n, err := strconv.Atoi(strings.TrimSuffix(days, "d"))
+		if err != nil || !strings.HasSuffix(days, "d") {
+			writeError(w, http.StatusBadRequest, "invalid expirationDate "+expiration)
+			return
+		}
+		expiration = time.Now().UTC().AddDate(0, 0, n).Format(time.RFC3339)
+	}
+
+	s.mu.Lock()
+	s.nextID++
+	id := fmt.Sprintf("dt0c01.DTTEST%d", s.nextID)
+	token := id + ".SECRET"
+	s.tokens[token] = TokenInfo{
+		ID:             id,
+		Name:           req.Name,
+		Enabled:        true,
+		CreationDate:   time.Now().UTC().Format(time.RFC3339),
+		ExpirationDate: expiration,
+		Scopes:         req.Scopes,
+	}
+	s.mu.Unlock()
+	writeJSON(w, http.StatusCreated, map[string]string{"id": id, "token": token, "expirationDate": expiration})
+}
+
+func (s *Server) handleDeleteToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if !s.authorize(w, r, "apiTokens.write") {
+		return
+	}
+	id := strings.TrimPrefix(r.URL.Path, "/api/v2/apiTokens/")
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for token, info := range s.tokens {
+		if info.ID == id {
+			delete(s.tokens, token)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+	}
+	writeError(w, http.StatusNotFound, "token not found")
+}
+
+func (s *Server) handleTokenLookup(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	var req struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !s.authorize(w, r, "") {
+		return
+	}
+	s.mu.Lock()
+	info, found := s.tokens[req.Token]
+	s.mu.Unlock()
+	if !found {
+		writeError(w, http.StatusNotFound, "token not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, info)
+}
+
+func (s *Server) handleOAuthToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil || r.Form.Get("grant_type") != "client_credentials" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "unsupported_grant_type"})
+		return
+	}
+	s.mu.Lock()
+	client, found := s.clients[r.Form.Get("client_id")]
+	s.mu.Unlock()
+	if !found || client.Secret != r.Form.Get("client_secret") {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+	if resource := r.Form.Get("resource"); resource != "" && resource != client.AccountID {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_resource"})
+		return
+	}
+	scopes := strings.Fields(r.Form.Get("scope"))
+	for _, scope := range scopes {
+		if !contains(client.Scopes, scope) {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_scope"})
+			return
+		}
+	}
+	if len(scopes) == 0 {
+		scopes = client.Scopes
+	}
+	s.mu.Lock()
+	accessToken := s.newID("dttest-access")
+	s.grants[accessToken] = grant{accountID: client.AccountID, scopes: scopes}
+	s.mu.Unlock()
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": accessToken,
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"scope":        strings.Join(scopes, " "),
+	})
+}
+
+func (s *Server) handleClusterVersion(w http.ResponseWriter, r *http.Request) {
+	if !s.authorize(w, r, "") {
+		return
+	}
+	s.mu.Lock()
+	version := s.version
+	s.mu.Unlock()
+	writeJSON(w, http.StatusOK, map[string]string{"version": version})
+}
+
+func (s *Server) handleSettingsObjects(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		if !s.authorize(w, r, "settings.read") {
+			return
+		}
+		schemaIDs := strings.Split(r.URL.Query().Get("schemaIds"), ",")
+		scopes := strings.Split(r.URL.Query().Get("scopes"), ",")
+		var items []SettingsObject
+		for _, obj := range s.SettingsObjects() {
+			if (schemaIDs[0] == "" || contains(schemaIDs, obj.SchemaID)) && (scopes[0] == "" || contains(scopes, obj.Scope)) {
+				items = append(items, obj)
+			}
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"items": items, "totalCount": len(items), "pageSize": len(items)})
+	case http.MethodPost:
+		if !s.authorize(w, r, "settings.write") {
+			return
+		}
+		var objects []SettingsObject
+		if err := json.NewDecoder(r.Body).Decode(&objects); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		var results []map[string]interface{}
+		for _, obj := range objects {
+			obj.ObjectID = ""
+			results = append(results, map[string]interface{}{"code": http.StatusOK, "objectId": s.AddSettingsObject(obj)})
+		}
+		writeJSON(w, http.StatusOK, results)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func (s *Server) handleSettingsObject(w http.ResponseWriter, r *http.Request) {
+	objectID := strings.TrimPrefix(r.URL.Path, "/api/v2/settings/objects/")
+	scope := "settings.read"
+	if r.Method != http.MethodGet {
+		scope = "settings.write"
+	}
+	if !s.authorize(w, r, scope) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	obj, found := s.settings[objectID]
+	if !found {
+		writeError(w, http.StatusNotFound, "Settings not found")
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, obj)
+	case http.MethodPut:
+		var update SettingsObject
+		if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		obj.Value = update.Value
+		s.settings[objectID] = obj
+		writeJSON(w, http.StatusOK, map[string]string{"code": "200", "objectId": objectID})
+	case http.MethodDelete:
+		delete(s.settings, objectID)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func (s *Server) handleSettingsSchema(w http.ResponseWriter, r *http.Request) {
+	if !s.authorize(w, r, "settings.read") {
+		return
+	}
+	schemaID := strings.TrimPrefix(r.URL.Path, "/api/v2/settings/schemas/")
+	s.mu.Lock()
+	found, ok := s.schemas[schemaID]
+	s.mu.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, "Schema not found")
+		return
+	}
+	document := map[string]interface{}{"schemaId": schemaID, "version": found.version}
+	for key, value := range found.definition {
+		document[key] = value
+	}
+	writeJSON(w, http.StatusOK, document)
+}
+
+func (s *Server) handleEntities(w http.ResponseWriter, r *http.Request) {
+	if !s.authorize(w, r, "entities.read") {
+		return
+	}
+	query := r.URL.Query()
+	selector, offset, pageSize := query.Get("entitySelector"), 0, 50
+	if key := query.Get("nextPageKey"); key != "" {
+		var ok bool
+		if selector, offset, pageSize, ok = decodePageKey(key); !ok {
+			writeError(w, http.StatusBadRequest, "invalid nextPageKey")
+			return
+		}
+	} else if size := query.Get("pageSize"); size != "" {
+		var err error
+		if pageSize, err = strconv.Atoi(size); err != nil || pageSize < 1 {
+			writeError(w, http.StatusBadRequest, "invalid pageSize "+size)
+			return
+		}
+	}
+	predicates, err := parseEntitySelector(selector)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	var matched []Entity
+	for _, entity := range s.entities {
+		if matchesEntity(entity, predicates) {
+			matched = append(matched, entity)
+		}
+	}
+	s.mu.Unlock()
+
+	response := map[string]interface{}{"totalCount": len(matched), "pageSize": pageSize}
+	end := min(offset+pageSize, len(matched))
+	if end < len(matched) {
+		response["nextPageKey"] = encodePageKey(selector, end, pageSize)
+	}
+	response["entities"] = matched[min(offset, end):end]
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (s *Server) handleMetricsQuery(w http.ResponseWriter, r *http.Request) {
+	if !s.authorize(w, r, "metrics.read") {
+		return
+	}
+	selector := r.URL.Query().Get("metricSelector")
+	s.mu.Lock()
+	values, found := s.metrics[selector]
+	s.mu.Unlock()
+	if !found {
+		writeError(w, http.StatusNotFound, "Metric not found: "+selector)
+		return
+	}
+	data := []map[string]interface{}{}
+	if len(values) > 0 {
+		timestamps := make([]int64, len(values))
+		for i := range timestamps {
+			timestamps[i] = time.Now().UnixMilli()
+		}
+		data = append(data, map[string]interface{}{"dimensions": []string{}, "timestamps": timestamps, "values": values})
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"totalCount": 1,
+		"resolution": r.URL.Query().Get("resolution"),
+		"result":     []map[string]interface{}{{"metricId": selector, "data": data}},
+	})
+}
+
+func (s *Server) handleProblems(w http.ResponseWriter, r *http.Request) {
+	if !s.authorize(w, r, "problems.read") {
+		return
+	}
+	s.mu.Lock()
+	problems := append([]Problem(nil), s.problems...)
+	s.mu.Unlock()
+
+	if selector := r.URL.Query().Get("problemSelector"); strings.Contains(selector, `status("open")`) {
+		open := problems[:0]
+		for _, problem := range problems {
+			if problem.Status == "OPEN" {
+				open = append(open, problem)
+			}
+		}
+		problems = open
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"problems": problems, "totalCount": len(problems)})
+}
+
+func (s *Server) handleSyntheticLocations(w http.ResponseWriter, r *http.Request) {
+	if !s.authorize(w, r, "ReadSyntheticData") {
+		return
+	}
+	s.mu.Lock()
+	locations := append([]SyntheticLocation{}, s.locations...)
+	s.mu.Unlock()
+	writeJSON(w, http.StatusOK, map[string]interface{}{"locations": locations})
+}
+
+func (s *Server) handleSyntheticMonitors(w http.ResponseWriter, r *http.Request) {
+	if !s.authorize(w, r, "ReadSyntheticData") {
+		return
+	}
+	monitorType := r.URL.Query().Get("type")
+	s.mu.Lock()
+	monitors := []SyntheticMonitor{}
+	for _, monitor := range s.monitors {
+		if monitorType == "" || monitor.Type == monitorType {
+			monitors = append(monitors, monitor)
+		}
+	}
+	s.mu.Unlock()
+	writeJSON(w, http.StatusOK, map[string]interface{}{"monitors": monitors})
+}
+
+func (s *Server) handleSyntheticMonitor(w http.ResponseWriter, r *http.Request) {
+	if !s.authorize(w, r, "ReadSyntheticData") {
+		return
+	}
+	id := strings.TrimPrefix(r.URL.Path, "/api/v1/synthetic/monitors/")
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, monitor := range s.monitors {
+		if monitor.EntityID == id {
+			writeJSON(w, http.StatusOK, monitor)
+			return
+		}
+	}
+	writeError(w, http.StatusNotFound, "Synthetic monitor "+id+" not found")
+}
+
+func (s *Server) handleEventIngest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if !s.authorize(w, r, "events.ingest") {
+		return
+	}
+	var event Event
+	if err := json.NewDecoder(r.Body).Decode(&event); err != nil || event.EventType == "" || event.Title == "" {
+		writeError(w, http.StatusBadRequest, "eventType and title are required")
+		return
+	}
+	s.mu.Lock()
+	s.events = append(s.events, event)
+	count := len(s.events)
+	s.mu.Unlock()
+	writeJSON(w, http.StatusCreated, map[string]interface{}{
+		"reportCount":        1,
+		"eventIngestResults": []map[string]string{{"correlationId": fmt.Sprintf("dttest-%d", count), "status": "OK"}},
+	})
+}
+
+func (s *Server) handleAccountEnvironments(w http.ResponseWriter, r *http.Request) {
+	uuid, found := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/env/v1/accounts/"), "/environments")
+	if !found || strings.Contains(uuid, "/") {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	s.mu.Lock()
+	granted, known := s.grants[strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")]
+	environments := append([]Environment(nil), s.accounts[uuid]...)
+	s.mu.Unlock()
+	switch {
+	case !known:
+		writeError(w, http.StatusUnauthorized, "invalid bearer token")
+		return
+	case strings.TrimPrefix(granted.accountID, "urn:dtaccount:") != uuid || !contains(granted.scopes, "account-env-read"):
+		writeError(w, http.StatusForbidden, "token is not authorized for this account")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"data": environments})
+}
+
+// Predicate of an entity selector such as type("HOST")
+type predicate struct {
+	name  string
+	value string
+}
+
+// Parse an entity selector of comma-separated type, entityId, entityName, tag,
+// mzName and mzId predicates, unescaping ~ in their quoted values
+func parseEntitySelector(selector string) ([]predicate, error) {
+	if selector == "" {
+		return nil, fmt.Errorf("entitySelector must be set")
+	}
+	var predicates []predicate
+	rest := selector
+	for rest != "" {
+		name, value, found := strings.Cut(rest, `("`)
+		if !found || !contains([]string{"type", "entityId", "entityName", "tag", "mzName", "mzId"}, name) {
+			return nil, fmt.Errorf("unsupported entity selector %s", selector)
+		}
+		var unescaped strings.Builder
+		closed := false
+		for i := 0; i < len(value); i++ {
+			switch c := value[i]; {
+			case c == '~' && i+1 < len(value):
+				i++
+				unescaped.WriteByte(value[i])
+			case c == '"':
+				rest, closed = value[i+1:], true
+			default:
+				unescaped.WriteByte(c)
+			}
+			if closed {
+				break
+			}
+		}
+		if !closed || !strings.HasPrefix(rest, ")") {
+			return nil, fmt.Errorf("invalid entity selector %s", selector)
+		}
+		predicates = append(predicates, predicate{name, unescaped.String()})
+		rest = strings.TrimPrefix(rest[1:], ",")
+	}
+	return predicates, nil
+}
+
+func matchesEntity(entity Entity, predicates []predicate) bool {
+	for _, p := range predicates {
+		var matched bool
+		switch p.name {
+		case "type":
+			matched = entity.Type == p.value
+		case "entityId":
+			matched = entity.EntityID == p.value
+		case "entityName":
+			matched = entity.DisplayName == p.value
+		case "tag":
+			matched = contains(entity.Tags, p.value)
+		case "mzName", "mzId":
+			for _, zone := range entity.ManagementZones {
+				matched = matched || (p.name == "mzName" && zone.Name == p.value) || (p.name == "mzId" && zone.ID == p.value)
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+// Opaque key of the page of a selector's results starting at offset
+func encodePageKey(selector string, offset, pageSize int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%d|%d|%s", offset, pageSize, selector)))
+}
+
+func decodePageKey(key string) (string, int, int, bool) {
+	decoded, err := base64.RawURLEncoding.DecodeString(key)
+	if err != nil {
+		return "", 0, 0, false
+	}
+	parts := strings.SplitN(string(decoded), "|", 3)
+	if len(parts) != 3 {
+		return "", 0, 0, false
+	}
+	offset, err1 := strconv.Atoi(parts[0])
+	pageSize, err2 := strconv.Atoi(parts[1])
+	return parts[2], offset, pageSize, err1 == nil && err2 == nil && pageSize > 0
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// Write an error in the Dynatrace API's error envelope
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]interface{}{"error": map[string]interface{}{"code": status, "message": message}})
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
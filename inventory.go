@@ -0,0 +1,239 @@
+/**
+* @license
+* Copyright 2020 Dynatrace LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"html/template"
+	"io"
+	"net/url"
+	"os"
+	"sort"
+	"time"
+)
+
+// Classic configuration types counted by -inventory, in report order
+var inventoryClassicTypes = []struct {
+	Category string
+	Type     string
+}{
+	{"Dashboards", "dynatrace_dashboard"},
+	{"HTTP monitors", "dynatrace_http_monitor"},
+	{"Browser monitors", "dynatrace_browser_monitor"},
+	{"Calculated service metrics", "dynatrace_calculated_service_metric"},
+	{"Request attributes", "dynatrace_request_attribute"},
+}
+
+// Configuration object found in the environment
+type inventoryObject struct {
+	Category string
+	Type     string
+	ID       string
+	Name     string
+	Managed  bool
+}
+
+// Object counts of one category
+type inventoryCount struct {
+	Category  string
+	Type      string
+	Total     int
+	Managed   int
+	Unmanaged int
+}
+
+var inventoryReportTemplate = template.Must(template.New("inventory").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Configuration inventory</title>
+<style>
+body { font-family: sans-serif; margin: 2em; background: #fafafa; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { border: 1px solid #ddd; padding: 0.3em 0.8em; text-align: left; }
+th { background: #eee; }
+td.number { text-align: right; }
+.managed { color: #6a9955; }
+.unmanaged { color: #ce9178; }
+</style>
+</head>
+<body>
+<h1>Configuration inventory</h1>
+<p>{{.Environment}}, generated {{.Generated}}. Settings cover the environment scope.</p>
+<table>
+<tr><th>Category</th><th>Resource type</th><th>Total</th><th>Managed</th><th>Unmanaged</th></tr>
+{{range .Counts}}<tr><td>{{.Category}}</td><td>{{.Type}}</td><td class="number">{{.Total}}</td><td class="number">{{.Managed}}</td><td class="number">{{.Unmanaged}}</td></tr>
+{{end}}</table>
+<h2>Objects</h2>
+<table>
+<tr><th>Category</th><th>Name</th><th>ID</th><th>State</th></tr>
+{{range .Objects}}<tr><td>{{.Category}}</td><td>{{.Name}}</td><td>{{.ID}}</td>{{if .Managed}}<td class="managed">managed</td>{{else}}<td class="unmanaged">unmanaged</td>{{end}}</tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// ============================================================
+// Configuration inventory
+// ============================================================
+
+// Environment-scope settings objects of all schemas, following the result pages
+func listEnvironmentSettings() ([]inventoryObject, error) {
+	resourceTypes := make(map[string]string)
+	for resourceType, schemaID := range settingsSchemas {
+		resourceTypes[schemaID] = resourceType
+	}
+	var objects []inventoryObject
+	path := "/api/v2/settings/objects?scopes=environment&fields=objectId,schemaId,value&pageSize=500"
+	for path != "" {
+		var page struct {
+			Items []struct {
+				ObjectID string         `json:"objectId"`
+				SchemaID string         `json:"schemaId"`
+				Value    map[string]any `json:"value"`
+			} `json:"items"`
+			NextPageKey string `json:"nextPageKey"`
+		}
+		if err := dynatraceGet(path, &page); err != nil {
+			return nil, err
+		}
+		for _, item := range page.Items {
+			resourceType := resourceTypes[item.SchemaID]
+			if resourceType == "" {
+				resourceType = "dynatrace_generic_setting"
+			}
+			objects = append(objects, inventoryObject{item.SchemaID, resourceType, item.ObjectID, settingsObjectName(item.Value), false})
+		}
+		path = ""
+		if page.NextPageKey != "" {
+			path = "/api/v2/settings/objects?nextPageKey=" + url.QueryEscape(page.NextPageKey)
+		}
+	}
+	sort.SliceStable(objects, func(i, j int) bool { return objects[i].Category < objects[j].Category })
+	return objects, nil
+}
+
+// List the environment's configuration objects and mark those in the state
+func collectInventory(terraformPath string, logFile *os.File) ([]inventoryObject, error) {
+	instances, err := stateInstances(terraformPath, logFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state: %w", err)
+	}
+	managed := make(map[string]bool, len(instances))
+	for _, instance := range instances {
+		managed[instance.ID] = true
+	}
+
+	var objects []inventoryObject
+	for _, classic := range inventoryClassicTypes {
+		live, err := listLiveObjects(classic.Type)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list %s: %w", classic.Category, err)
+		}
+		for _, object := range live {
+			objects = append(objects, inventoryObject{classic.Category, classic.Type, object.ID, object.Name, false})
+		}
+	}
+	settings, err := listEnvironmentSettings()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list settings: %w", err)
+	}
+	objects = append(objects, settings...)
+	for i := range objects {
+		objects[i].Managed = managed[objects[i].ID]
+	}
+	return objects, nil
+}
+
+// Object counts per category, in the order the categories first appear
+func countInventory(objects []inventoryObject) []inventoryCount {
+	var counts []inventoryCount
+	index := make(map[string]int)
+	for _, object := range objects {
+		i, found := index[object.Category]
+		if !found {
+			i = len(counts)
+			index[object.Category] = i
+			counts = append(counts, inventoryCount{Category: object.Category, Type: object.Type})
+		}
+		counts[i].Total++
+		if object.Managed {
+			counts[i].Managed++
+		} else {
+			counts[i].Unmanaged++
+		}
+	}
+	return counts
+}
+
+// Write one CSV row per object
+func writeInventoryCSV(w io.Writer, objects []inventoryObject) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"category", "resource_type", "id", "name", "managed"})
+	for _, object := range objects {
+		writer.Write([]string{object.Category, object.Type, object.ID, object.Name, fmt.Sprint(object.Managed)})
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// Count the environment's configuration objects per type, marking those managed
+// by this bundle's state, and write the inventory as html or csv to outputPath
+// (stdout when empty); a summary table is printed either way
+func runInventory(terraformPath string, logFile *os.File, format, outputPath string) error {
+	if format != "html" && format != "csv" {
+		return fmt.Errorf("unknown format %q (expected html or csv)", format)
+	}
+	objects, err := collectInventory(terraformPath, logFile)
+	if err != nil {
+		return err
+	}
+	counts := countInventory(objects)
+
+	var out io.Writer = os.Stdout
+	if outputPath != "" {
+		file, err := os.Create(outputPath)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		out = file
+
+		fmt.Printf("%-40s %7s %8s %10s\n", "CATEGORY", "TOTAL", "MANAGED", "UNMANAGED")
+		for _, count := range counts {
+			fmt.Printf("%-40s %7d %8d %10d\n", count.Category, count.Total, count.Managed, count.Unmanaged)
+		}
+	}
+
+	switch format {
+	case "csv":
+		err = writeInventoryCSV(out, objects)
+	case "html":
+		err = inventoryReportTemplate.Execute(out, struct {
+			Environment string
+			Generated   string
+			Counts      []inventoryCount
+			Objects     []inventoryObject
+		}{getEnv("DT_ENV_URL"), time.Now().Format(time.RFC1123), counts, objects})
+	}
+	if err == nil && outputPath != "" {
+		fmt.Printf("Inventory of %d object(s) written to %s.\n", len(objects), outputPath)
+	}
+	return err
+}
@@ -0,0 +1,55 @@
+/**
+* @license
+* Copyright 2020 Dynatrace LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"dynatrace-terraform-wrapper/internal/dttest"
+)
+
+func TestListEnvironmentSettings(t *testing.T) {
+	server := newTestServer(t)
+	useTestEnvironment(t, server, "settings.read")
+
+	server.AddSettingsObject(dttest.SettingsObject{ObjectID: "obj-3", SchemaID: "builtin:management-zones", Value: []byte(`{"name": "Prod"}`)})
+	server.AddSettingsObject(dttest.SettingsObject{ObjectID: "obj-1", SchemaID: "builtin:alerting.profile", Value: []byte(`{"name": "Ops"}`)})
+	server.AddSettingsObject(dttest.SettingsObject{ObjectID: "obj-2", SchemaID: "builtin:alerting.maintenance-window", Value: []byte(`{"generalProperties": {"name": "Patch day"}}`)})
+	server.AddSettingsObject(dttest.SettingsObject{ObjectID: "obj-4", SchemaID: "builtin:rum.web.name", Value: []byte(`{"displayName": "Shop"}`)})
+	server.AddSettingsObject(dttest.SettingsObject{ObjectID: "obj-5", SchemaID: "builtin:alerting.profile", Scope: "HOST-1", Value: []byte(`{"name": "Host only"}`)})
+
+	objects, err := listEnvironmentSettings()
+	if err != nil {
+		t.Fatalf("listEnvironmentSettings: %v", err)
+	}
+	want := []inventoryObject{
+		{"builtin:alerting.maintenance-window", "dynatrace_maintenance", "obj-2", "Patch day", false},
+		{"builtin:alerting.profile", "dynatrace_alerting", "obj-1", "Ops", false},
+		{"builtin:management-zones", "dynatrace_management_zone_v2", "obj-3", "Prod", false},
+		{"builtin:rum.web.name", "dynatrace_generic_setting", "obj-4", "Shop", false},
+	}
+	if !reflect.DeepEqual(objects, want) {
+		t.Errorf("listEnvironmentSettings =\n%+v\nwant\n%+v", objects, want)
+	}
+
+	server.Fail("/api/v2/settings/objects", 403, "Token is missing required scope", 1)
+	if _, err := listEnvironmentSettings(); err == nil {
+		t.Error("listEnvironmentSettings: want the settings API error")
+	}
+}
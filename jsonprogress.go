@@ -0,0 +1,197 @@
+/**
+* @license
+* Copyright 2020 Dynatrace LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Set by -json, which overrides json_progress
+var cliJSONProgress bool
+
+// Whether plan, apply, destroy and refresh run with -json and show a live progress line
+var jsonProgress bool
+
+// Commands whose -json event stream the progress line understands
+var jsonStreamCommands = map[string]bool{"plan": true, "apply": true, "destroy": true, "refresh": true}
+
+// ============================================================
+// JSON progress streaming
+// ============================================================
+
+// Read json_progress
+func setupJSONProgress(config map[string]string) {
+	jsonProgress = cliJSONProgress || config["json_progress"] == "true"
+}
+
+// Whether to run a command with -json; applies answering Terraform's prompt
+// stay plain since -json requires -auto-approve
+func streamsJSON(command string, observer io.Writer) bool {
+	if !jsonProgress || !jsonStreamCommands[command] {
+		return false
+	}
+	_, answersPrompt := observer.(interface{ Stdin() io.Reader })
+	return !answersPrompt
+}
+
+// Event of Terraform's machine-readable output
+type terraformEvent struct {
+	Level   string `json:"@level"`
+	Message string `json:"@message"`
+	Type    string `json:"type"`
+	Hook    struct {
+		Resource struct {
+			Addr string `json:"addr"`
+		} `json:"resource"`
+		Action string `json:"action"`
+	} `json:"hook"`
+	Diagnostic struct {
+		Severity string `json:"severity"`
+		Summary  string `json:"summary"`
+		Detail   string `json:"detail"`
+	} `json:"diagnostic"`
+}
+
+// Turns the -json event stream into a live progress line on the console,
+// passing the human-readable messages on to observer and keeping error
+// diagnostics for error explanations
+type jsonProgressWriter struct {
+	mu          sync.Mutex
+	command     string
+	console     bool
+	observer    io.Writer
+	partial     []byte
+	diagnostics bytes.Buffer
+	created     int
+	changed     int
+	destroyed   int
+	planned     int
+	current     string
+	statusLine  bool
+}
+
+// Progress writer for command; with console set the messages are printed as
+// plain text instead of a progress line since there is no log to hold the events
+func newJSONProgressWriter(command string, console bool, observer io.Writer) *jsonProgressWriter {
+	return &jsonProgressWriter{command: command, console: console, observer: observer}
+}
+
+func (w *jsonProgressWriter) Write(b []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.partial = append(w.partial, b...)
+	for {
+		newline := bytes.IndexByte(w.partial, '\n')
+		if newline < 0 {
+			break
+		}
+		w.handle(w.partial[:newline])
+		w.partial = w.partial[newline+1:]
+	}
+	return len(b), nil
+}
+
+// Process one line of the event stream
+func (w *jsonProgressWriter) handle(line []byte) {
+	var event terraformEvent
+	if err := json.Unmarshal(line, &event); err != nil {
+		w.message(string(line))
+		return
+	}
+
+	switch event.Type {
+	case "apply_start", "refresh_start":
+		w.current = strings.TrimSuffix(event.Message, "...")
+	case "apply_complete":
+		switch event.Hook.Action {
+		case "create":
+			w.created++
+		case "update":
+			w.changed++
+		case "delete":
+			w.destroyed++
+		}
+		w.current = ""
+	case "apply_errored", "refresh_complete":
+		w.current = ""
+	case "planned_change":
+		w.planned++
+	case "diagnostic":
+		if event.Diagnostic.Severity == "error" {
+			fmt.Fprintf(&w.diagnostics, "Error: %s\n\n%s\n", event.Diagnostic.Summary, event.Diagnostic.Detail)
+		}
+		if w.observer != nil && event.Diagnostic.Detail != "" {
+			w.observer.Write([]byte(event.Diagnostic.Detail + "\n"))
+		}
+	}
+	w.message(event.Message)
+	w.render()
+}
+
+// Pass a human-readable message on
+func (w *jsonProgressWriter) message(message string) {
+	if message == "" {
+		return
+	}
+	if w.observer != nil {
+		w.observer.Write([]byte(message + "\n"))
+	}
+	if w.console {
+		fmt.Println(message)
+	}
+}
+
+// Redraw the progress line
+func (w *jsonProgressWriter) render() {
+	if w.console {
+		return
+	}
+	var status string
+	if w.command == "plan" || w.command == "refresh" {
+		status = fmt.Sprintf("terraform %s: %d change(s) planned", w.command, w.planned)
+	} else {
+		status = fmt.Sprintf("terraform %s: %d created, %d changed, %d destroyed", w.command, w.created, w.changed, w.destroyed)
+	}
+	if w.current != "" {
+		status += " | " + w.current
+	}
+	fmt.Fprintf(os.Stdout, "\r\033[K%s", status)
+	w.statusLine = true
+}
+
+// End the progress line and return the error diagnostics seen in the stream
+func (w *jsonProgressWriter) Finish() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.partial) > 0 {
+		w.handle(w.partial)
+		w.partial = nil
+	}
+	if w.statusLine {
+		w.current = ""
+		w.render()
+		fmt.Println()
+	}
+	return w.diagnostics.String()
+}
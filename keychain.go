@@ -0,0 +1,90 @@
+/**
+* @license
+* Copyright 2020 Dynatrace LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+)
+
+// Service name under which credentials are stored in the OS keychain
+const keychainService = "dt-tf-wrapper"
+
+// ============================================================
+// OS keychain credential storage
+// ============================================================
+
+// Keychain account for a secret env key, named after the secret and keyed by the
+// environment URL it belongs to (or the OAuth client ID when no URL is configured);
+// credential sets share entries with the default set for the same environment
+func keychainAccount(envKey string) (string, bool) {
+	for _, secret := range []string{"API_TOKEN", "CLIENT_SECRET", "PLATFORM_TOKEN"} {
+		prefix, found := strings.CutSuffix(envKey, secret)
+		if !found || !strings.HasPrefix(prefix, "DT_") {
+			continue
+		}
+		scope := getEnv(prefix + "ENV_URL")
+		if scope == "" {
+			scope = getEnv(prefix + "CLIENT_ID")
+		}
+		if scope == "" {
+			return "", false
+		}
+		return secret + "@" + strings.TrimRight(scope, "/"), true
+	}
+	return "", false
+}
+
+// Look up a secret saved in the OS keychain, if keychain storage is enabled
+func lookupKeychain(envKey string, config map[string]string) (string, bool) {
+	if config["keychain"] != "true" {
+		return "", false
+	}
+	account, ok := keychainAccount(envKey)
+	if !ok {
+		return "", false
+	}
+	value, err := keychainGet(keychainService, account)
+	if err != nil || value == "" {
+		return "", false
+	}
+	return value, true
+}
+
+// Offer to save a prompted secret to the OS keychain, if keychain storage is enabled
+func offerKeychainSave(envKey, value string, config map[string]string, reader *bufio.Reader) {
+	if config["keychain"] != "true" || value == "" {
+		return
+	}
+	account, ok := keychainAccount(envKey)
+	if !ok {
+		return
+	}
+
+	fmt.Printf("Save %s for %s to the OS keychain? (y/n): ", envKey, strings.SplitN(account, "@", 2)[1])
+	answer, _ := reader.ReadString('\n')
+	if strings.ToLower(strings.TrimSpace(answer)) != "y" {
+		return
+	}
+	if err := keychainSet(keychainService, account, value); err != nil {
+		fmt.Printf("Warning: failed to save %s to the keychain: %v\n", envKey, err)
+		return
+	}
+	fmt.Printf("Saved %s to the keychain.\n", envKey)
+}
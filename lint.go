@@ -0,0 +1,385 @@
+/**
+* @license
+* Copyright 2020 Dynatrace LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ============================================================
+// Lint configuration files
+// ============================================================
+
+// Single lint finding
+type lintIssue struct {
+	File    string
+	Line    int
+	IsError bool
+	Message string
+}
+
+func (i lintIssue) String() string {
+	severity := "warning"
+	if i.IsError {
+		severity = "error"
+	}
+	if i.Line > 0 {
+		return fmt.Sprintf("%s:%d: %s: %s", i.File, i.Line, severity, i.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s", i.File, severity, i.Message)
+}
+
+// Accumulates findings across the configuration and the files it references
+type configLinter struct {
+	issues  []lintIssue
+	visited map[string]bool
+}
+
+func (l *configLinter) errorf(file string, line int, format string, args ...interface{}) {
+	l.issues = append(l.issues, lintIssue{File: file, Line: line, IsError: true, Message: fmt.Sprintf(format, args...)})
+}
+
+func (l *configLinter) warnf(file string, line int, format string, args ...interface{}) {
+	l.issues = append(l.issues, lintIssue{File: file, Line: line, Message: fmt.Sprintf(format, args...)})
+}
+
+// Validate the configuration file and report findings; returns false when errors were found
+func lintConfig(fileName string) bool {
+	l := &configLinter{visited: make(map[string]bool)}
+	l.lintFile(fileName)
+
+	if config, apiToken, oauthClient, err := loadConfig(fileName); err == nil {
+		if !apiToken && !oauthClient && config["platform_token"] != "true" && len(credentialSets(config)) == 0 && len(declaredVars(config)) == 0 {
+			l.warnf(fileName, 0, "none of api_token, oauth_client or platform_token is enabled and no credential sets or variables are declared")
+		}
+		if _, err := parseStacks(config); err != nil {
+			l.errorf(fileName, 0, "stacks: %v", err)
+		}
+	}
+
+	errors := 0
+	for _, issue := range l.issues {
+		fmt.Println(issue)
+		if issue.IsError {
+			errors++
+		}
+	}
+	fmt.Printf("%d error(s), %d warning(s)\n", errors, len(l.issues)-errors)
+	return errors == 0
+}
+
+// Lint a single configuration file and any files it includes
+func (l *configLinter) lintFile(fileName string) {
+	absPath, _ := filepath.Abs(fileName)
+	if l.visited[absPath] {
+		return
+	}
+	l.visited[absPath] = true
+
+	if strings.HasSuffix(fileName, ".toml") {
+		l.lintTOMLFile(fileName)
+		return
+	}
+
+	src, err := readConfigSource(fileName)
+	if err != nil {
+		l.errorf(fileName, 0, "%v", err)
+		return
+	}
+
+	seen := make(map[string]int)
+	scanner := bufio.NewScanner(strings.NewReader(src))
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		raw := strings.TrimSpace(strings.TrimPrefix(scanner.Text(), "\ufeff"))
+		if raw == "" || strings.HasPrefix(raw, "#") || strings.HasPrefix(raw, ";") {
+			continue
+		}
+
+		key, value, ok := parseConfigLine(raw)
+		if !ok {
+			l.errorf(fileName, lineNumber, "expected 'key = value'")
+			continue
+		}
+		rest := strings.TrimSpace(raw[strings.Index(raw, "=")+1:])
+		if (strings.HasPrefix(rest, `"`) || strings.HasPrefix(rest, "'")) && len(rest) > 0 {
+			if _, closed := unquoteConfigValue(rest); !closed {
+				l.errorf(fileName, lineNumber, "unterminated quoted value for %s", key)
+			}
+		}
+
+		if key == "include" {
+			includePath := value
+			if !filepath.IsAbs(includePath) {
+				includePath = filepath.Join(filepath.Dir(fileName), includePath)
+			}
+			if _, err := os.Stat(includePath); err != nil {
+				l.errorf(fileName, lineNumber, "included file %s: %v", value, err)
+				continue
+			}
+			l.lintFile(includePath)
+			continue
+		}
+
+		if previous, duplicate := seen[key]; duplicate {
+			l.warnf(fileName, lineNumber, "%s overrides the value set on line %d", key, previous)
+		}
+		seen[key] = lineNumber
+
+		l.lintValue(fileName, lineNumber, key, value)
+	}
+	if err := scanner.Err(); err != nil {
+		l.errorf(fileName, 0, "%v", err)
+	}
+}
+
+// Lint a TOML configuration file; type errors are reported by the decoder
+func (l *configLinter) lintTOMLFile(fileName string) {
+	flat, err := decodeTOMLConfig(fileName)
+	if err != nil {
+		l.errorf(fileName, 0, "%v", err)
+		return
+	}
+
+	keys := make([]string, 0, len(flat))
+	for key := range flat {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if key == "include" {
+			for _, include := range strings.Split(flat[key], ",") {
+				includePath := strings.TrimSpace(include)
+				if !filepath.IsAbs(includePath) {
+					includePath = filepath.Join(filepath.Dir(fileName), includePath)
+				}
+				if _, err := os.Stat(includePath); err != nil {
+					l.errorf(fileName, 0, "included file %s: %v", include, err)
+					continue
+				}
+				l.lintFile(includePath)
+			}
+			continue
+		}
+		l.lintValue(fileName, 0, key, flat[key])
+	}
+}
+
+// Check an individual key's value
+func (l *configLinter) lintValue(fileName string, line int, key, value string) {
+	if prefix, ref, isRef := secretReference(value); isRef {
+		l.lintSecretReference(fileName, line, key, prefix, ref)
+		return
+	}
+
+	// Credential set keys ("source.DT_ENV_URL") are checked like their base keys
+	baseKey := key
+	if set, base, found := strings.Cut(key, "."); found && set != "workspace" &&
+		(strings.HasPrefix(base, "DT_") || base == "api_token" || base == "oauth_client" || base == "platform_token") {
+		baseKey = base
+	}
+
+	if baseKey == "skip_tls_verify" && value == "true" {
+		l.warnf(fileName, line, "%s disables TLS certificate verification for all API calls", key)
+	}
+
+	// Types are shared with wrapper.toml; the cases below add semantic checks
+	switch tomlKeyType(baseKey) {
+	case "bool":
+		if value != "true" && value != "false" {
+			l.errorf(fileName, line, "%s must be true or false, got %q", key, value)
+		}
+		return
+	case "int":
+		if _, err := strconv.Atoi(value); err != nil {
+			l.errorf(fileName, line, "%s must be an integer, got %q", key, value)
+			return
+		}
+	case "duration":
+		if _, err := time.ParseDuration(value); err != nil {
+			l.errorf(fileName, line, "%s must be a duration such as 30m, got %q", key, value)
+			return
+		}
+	}
+
+	switch {
+	case strings.HasPrefix(baseKey, cloneRewritePrefix):
+		if _, _, err := parseRewriteRule(value); err != nil {
+			l.errorf(fileName, line, "%s: %v", key, err)
+		}
+	case baseKey == "install_strategy":
+		switch value {
+		case "", "zip", "memory", "binary", "auto":
+		default:
+			l.errorf(fileName, line, "install_strategy must be zip, memory, binary or auto, got %q", value)
+		}
+	case baseKey == "DT_ENV_URL" || baseKey == "DT_CLUSTER_URL" || baseKey == "audit_webhook" || strings.HasPrefix(baseKey, "workspace."):
+		l.lintURL(fileName, line, key, value)
+	case baseKey == "client_cert" || baseKey == "client_key" || baseKey == "ca_cert":
+		if _, err := os.Stat(value); err != nil {
+			l.errorf(fileName, line, "%s %s: %v", key, value, err)
+		}
+	case baseKey == "managed_nodes":
+		for _, node := range strings.Split(value, ",") {
+			l.lintURL(fileName, line, key, strings.TrimSpace(node))
+		}
+	case baseKey == "DT_API_TOKEN":
+		if !strings.HasPrefix(value, "dt0c01.") {
+			l.warnf(fileName, line, "%s does not look like an API token (expected dt0c01.*)", key)
+		}
+	case baseKey == "DT_PLATFORM_TOKEN":
+		if !strings.HasPrefix(value, "dt0s16.") {
+			l.warnf(fileName, line, "%s does not look like a platform token (expected dt0s16.*)", key)
+		}
+	case baseKey == "DT_CLIENT_ID" || baseKey == "DT_CLIENT_SECRET":
+		if !strings.HasPrefix(value, "dt0s02.") {
+			l.warnf(fileName, line, "%s does not look like an OAuth credential (expected dt0s02.*)", key)
+		}
+	case baseKey == "DT_ACCOUNT_ID":
+		if !strings.HasPrefix(value, "urn:dtaccount:") {
+			l.warnf(fileName, line, "%s should be of the form urn:dtaccount:<uuid>", key)
+		}
+	case baseKey == "state_backup_keep" || baseKey == "rate_limit_retries":
+		if parsed, _ := strconv.Atoi(value); parsed < 0 {
+			l.errorf(fileName, line, "%s must be a non-negative integer, got %q", key, value)
+		}
+	case baseKey == "change_freeze_name":
+		if _, err := regexp.Compile(value); err != nil {
+			l.errorf(fileName, line, "change_freeze_name is not a valid regular expression: %v", err)
+		}
+	case baseKey == "parallelism":
+		if parsed, _ := strconv.Atoi(value); parsed < 1 {
+			l.errorf(fileName, line, "parallelism must be a positive integer, got %q", value)
+		}
+	case baseKey == "credential_providers":
+		if _, err := credentialChain(map[string]string{"credential_providers": value}); err != nil {
+			l.errorf(fileName, line, "credential_providers: %v", err)
+		}
+	case strings.HasPrefix(baseKey, "credentials."):
+		if _, found := credentialProviders[strings.TrimPrefix(baseKey, "credentials.")]; !found {
+			l.errorf(fileName, line, "%s does not name a credential provider", key)
+		}
+	case baseKey == "tenant_source":
+		if value != "account" && value != "" {
+			l.errorf(fileName, line, "tenant_source must be account, got %q", value)
+		}
+	case baseKey == "output_map":
+		if _, err := os.Stat(value); err != nil {
+			l.errorf(fileName, line, "output_map %s: %v", value, err)
+		}
+	case baseKey == "backend":
+		if _, known := backendRequiredSettings[value]; !known {
+			l.errorf(fileName, line, "backend must be s3, azurerm, gcs, http or cloud, got %q", value)
+		}
+	case baseKey == "working_dir":
+		if info, err := os.Stat(filepath.Join(filepath.Dir(fileName), value)); err != nil || !info.IsDir() {
+			l.errorf(fileName, line, "working_dir %s is not a directory next to %s", value, fileName)
+		}
+	case baseKey == "var_file":
+		for _, varFile := range strings.Split(value, ",") {
+			l.lintVarFile(fileName, line, strings.TrimSpace(varFile))
+		}
+	}
+
+	if isSecretKey(key) && value != "" && value != "true" && value != "false" {
+		l.warnf(fileName, line, "%s is stored in plain text; consider a file: reference", key)
+	}
+}
+
+// Check a secret reference is well-formed without resolving it
+func (l *configLinter) lintSecretReference(fileName string, line int, key, prefix, ref string) {
+	switch prefix {
+	case "file:":
+		if _, err := os.Stat(ref); err != nil {
+			l.errorf(fileName, line, "%s references missing secret file %s", key, ref)
+		}
+	case "vault:":
+		if path, field, found := strings.Cut(ref, "#"); !found || path == "" || field == "" {
+			l.errorf(fileName, line, "%s must reference a vault secret as vault:<path>#<field>", key)
+		}
+		if getEnv("VAULT_ADDR") == "" {
+			l.warnf(fileName, line, "%s references vault but VAULT_ADDR is not set", key)
+		}
+	case "aws-sm:", "aws-ssm:":
+		if name, _, _ := strings.Cut(ref, "#"); name == "" {
+			l.errorf(fileName, line, "%s must name an AWS secret or parameter after %s", key, prefix)
+		}
+	case "azkv:":
+		if vault, secret, found := strings.Cut(ref, "/"); !found || vault == "" || secret == "" {
+			l.errorf(fileName, line, "%s must reference an Azure Key Vault secret as azkv:<vault>/<secret>", key)
+		}
+	case "gsm:":
+		if parts := strings.Split(ref, "/"); len(parts) < 4 || parts[0] != "projects" || parts[2] != "secrets" {
+			l.errorf(fileName, line, "%s must reference a Google secret as gsm:projects/<project>/secrets/<secret>", key)
+		}
+	}
+}
+
+// Check that a value is an absolute https URL
+func (l *configLinter) lintURL(fileName string, line int, key, value string) {
+	parsed, err := url.Parse(value)
+	if err != nil || parsed.Host == "" {
+		l.errorf(fileName, line, "%s is not a valid URL: %q", key, value)
+		return
+	}
+	if parsed.Scheme != "https" {
+		l.warnf(fileName, line, "%s does not use https", key)
+	}
+	if strings.HasSuffix(value, "/") {
+		l.warnf(fileName, line, "%s has a trailing slash", key)
+	}
+}
+
+// Check that a referenced var-file exists and parses
+func (l *configLinter) lintVarFile(fileName string, line int, varFile string) {
+	if varFile == "" {
+		return
+	}
+	src, err := os.ReadFile(varFile)
+	if err != nil {
+		l.errorf(fileName, line, "var_file %s: %v", varFile, err)
+		return
+	}
+
+	if strings.HasSuffix(varFile, ".json") {
+		var values map[string]interface{}
+		if err := json.Unmarshal(src, &values); err != nil {
+			l.errorf(varFile, 0, "invalid JSON: %v", err)
+		}
+		return
+	}
+
+	blocks, err := parseHCL(string(src), varFile)
+	if err != nil {
+		l.errorf(varFile, 0, "%v", err)
+		return
+	}
+	if len(blocks) > 0 {
+		l.errorf(varFile, blocks[0].Line, "unexpected %s block in variable file", blocks[0].Type)
+	}
+}
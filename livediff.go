@@ -0,0 +1,320 @@
+/**
+* @license
+* Copyright 2020 Dynatrace LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/term"
+)
+
+// Plan the desired values of -live-diff are read from
+const liveDiffPlanFileName = "livediff.tfplan"
+
+// Equal lines shown around each difference before the rest is collapsed
+const liveDiffContext = 3
+
+// Line of a side-by-side diff; Kind is ' ' for equal, '|' for changed, '<' for
+// live only and '>' for desired only
+type sideBySideLine struct {
+	Kind        byte
+	Left, Right string
+}
+
+// ============================================================
+// Live settings diff
+// ============================================================
+
+// Shape the Terraform attributes of a typed settings resource like the settings
+// object, following the schema's property names, nested types and lists
+func shapeSettingsObject(schema *settingsSchema, properties map[string]schemaProperty, object map[string]any) map[string]any {
+	shaped := make(map[string]any)
+	for name, property := range properties {
+		if value, present := object[snakeCase(name)]; present && value != nil {
+			shaped[name] = shapeSettingsProperty(schema, property, value)
+		}
+	}
+	return shaped
+}
+
+func shapeSettingsProperty(schema *settingsSchema, property schemaProperty, value any) any {
+	if typeName := schemaRef(property.Type, "types"); typeName != "" {
+		if object, ok := unwrapBlock(value, false).(map[string]any); ok {
+			return shapeSettingsObject(schema, schema.Types[typeName].Properties, object)
+		}
+		return value
+	}
+	if property.Type == "list" || property.Type == "set" {
+		items, ok := unwrapBlock(value, true).([]any)
+		if !ok || property.Items == nil {
+			return value
+		}
+		shaped := make([]any, len(items))
+		for i, item := range items {
+			shaped[i] = shapeSettingsProperty(schema, *property.Items, item)
+		}
+		return shaped
+	}
+	return value
+}
+
+// Drop the properties of live that desired leaves to their defaults, so that
+// typed resources are only compared on what the configuration sets
+func pruneToDesired(live, desired any) any {
+	liveObject, ok := live.(map[string]any)
+	desiredObject, desiredOK := desired.(map[string]any)
+	if !ok || !desiredOK {
+		liveList, ok := live.([]any)
+		desiredList, desiredOK := desired.([]any)
+		if !ok || !desiredOK {
+			return live
+		}
+		pruned := make([]any, len(liveList))
+		for i, item := range liveList {
+			if i < len(desiredList) {
+				item = pruneToDesired(item, desiredList[i])
+			}
+			pruned[i] = item
+		}
+		return pruned
+	}
+	pruned := make(map[string]any)
+	for key, value := range liveObject {
+		if desiredValue, present := desiredObject[key]; present {
+			pruned[key] = pruneToDesired(value, desiredValue)
+		}
+	}
+	return pruned
+}
+
+// Pair the lines of a and b by their longest common subsequence; adjacent
+// removals and additions are shown side by side as changes
+func sideBySide(a, b []string) []sideBySideLine {
+	lengths := make([][]int, len(a)+1)
+	for i := range lengths {
+		lengths[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lengths[i][j] = lengths[i+1][j+1] + 1
+			} else {
+				lengths[i][j] = max(lengths[i+1][j], lengths[i][j+1])
+			}
+		}
+	}
+
+	var lines []sideBySideLine
+	var removed, added []string
+	flush := func() {
+		for len(removed) > 0 || len(added) > 0 {
+			switch {
+			case len(removed) > 0 && len(added) > 0:
+				lines = append(lines, sideBySideLine{'|', removed[0], added[0]})
+				removed, added = removed[1:], added[1:]
+			case len(removed) > 0:
+				lines = append(lines, sideBySideLine{'<', removed[0], ""})
+				removed = removed[1:]
+			default:
+				lines = append(lines, sideBySideLine{'>', "", added[0]})
+				added = added[1:]
+			}
+		}
+	}
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			flush()
+			lines = append(lines, sideBySideLine{' ', a[i], b[j]})
+			i++
+			j++
+		case j < len(b) && (i == len(a) || lengths[i][j+1] >= lengths[i+1][j]):
+			added = append(added, b[j])
+			j++
+		default:
+			removed = append(removed, a[i])
+			i++
+		}
+	}
+	flush()
+	return lines
+}
+
+// Fit a line into a column, padding or cutting it
+func fitColumn(text string, width int) string {
+	if length := utf8.RuneCountInString(text); length <= width {
+		return text + strings.Repeat(" ", width-length)
+	}
+	runes := []rune(text)
+	return string(runes[:width-1]) + "…"
+}
+
+// Print a side-by-side diff, collapsing runs of equal lines away from the changes
+func printSideBySide(lines []sideBySideLine, width int) {
+	column := (width - 3) / 2
+	fmt.Printf("  %s   %s\n", fitColumn("live", column), "desired")
+	near := make([]bool, len(lines))
+	for i, line := range lines {
+		if line.Kind == ' ' {
+			continue
+		}
+		for k := max(0, i-liveDiffContext); k <= min(len(lines)-1, i+liveDiffContext); k++ {
+			near[k] = true
+		}
+	}
+	skipped := 0
+	for i, line := range lines {
+		if !near[i] {
+			skipped++
+			continue
+		}
+		if skipped > 0 {
+			fmt.Printf("  ... %d equal line(s)\n", skipped)
+			skipped = 0
+		}
+		fmt.Printf("  %s %c %s\n", fitColumn(line.Left, column), line.Kind, line.Right)
+	}
+	if skipped > 0 {
+		fmt.Printf("  ... %d equal line(s)\n", skipped)
+	}
+}
+
+// Indented JSON lines of a value; maps are rendered with sorted keys
+func jsonLines(value any) []string {
+	encoded, _ := json.MarshalIndent(value, "", "  ")
+	return strings.Split(string(encoded), "\n")
+}
+
+// Compare every settings resource in the configuration with its live object and
+// print the differences side by side; returns exitChanges when any differ
+func runLiveDiff(terraformPath string, logFile *os.File) int {
+	args := append([]string{"plan", "-refresh=false", "-out=" + liveDiffPlanFileName}, targetArgs()...)
+	args = append(args, variableArgs...)
+	if err := executeTerraformCommand(terraformPath, logFile, args...); err != nil {
+		fmt.Printf("Error planning desired values: %v\n", err)
+		return exitFailure
+	}
+	defer os.Remove(liveDiffPlanFileName)
+	out, err := outputTerraformCommand(terraformPath, logFile, "show", "-json", liveDiffPlanFileName)
+	if err != nil {
+		fmt.Printf("Error reading plan: %v\n", err)
+		return exitFailure
+	}
+	var plan planDiff
+	if err := json.Unmarshal(out, &plan); err != nil {
+		fmt.Printf("Error parsing plan: %v\n", err)
+		return exitFailure
+	}
+
+	width := 160
+	if columns, _, err := term.GetSize(int(os.Stdout.Fd())); err == nil && columns > 40 {
+		width = columns
+	}
+	return diffLiveSettings(plan, width)
+}
+
+// Compare the planned settings resources with their live objects, printing the
+// differences width columns wide
+func diffLiveSettings(plan planDiff, width int) int {
+	schemas := make(map[string]*settingsSchema)
+	compared, differing, failed := 0, 0, 0
+	for _, change := range plan.ResourceChanges {
+		after, _ := change.Change.After.(map[string]any)
+		before, _ := change.Change.Before.(map[string]any)
+		schemaID, desired, terraform := plannedSettingsValue(change.Type, after)
+		if schemaID == "" || desired == nil {
+			continue
+		}
+		objectID, _ := before["id"].(string)
+		if objectID == "" {
+			fmt.Printf("\n%s: not created yet\n", change.Address)
+			compared++
+			differing++
+			continue
+		}
+
+		var live struct {
+			Value map[string]any `json:"value"`
+		}
+		err := dynatraceGet("/api/v2/settings/objects/"+url.PathEscape(objectID), &live)
+		var apiErr *apiError
+		switch {
+		case errors.As(err, &apiErr) && apiErr.StatusCode == 404:
+			fmt.Printf("\n%s: object %s no longer exists in the environment\n", change.Address, objectID)
+			compared++
+			differing++
+			continue
+		case err != nil:
+			fmt.Printf("\nWarning: could not fetch %s (%s): %v\n", change.Address, objectID, err)
+			failed++
+			continue
+		}
+
+		var liveValue any = live.Value
+		var desiredValue any = desired
+		if terraform {
+			schema, fetched := schemas[schemaID]
+			if !fetched {
+				if schema, err = fetchSettingsSchema(schemaID); err != nil {
+					fmt.Printf("\nWarning: could not fetch settings schema %s: %v\n", schemaID, err)
+				}
+				schemas[schemaID] = schema
+			}
+			if schema == nil {
+				failed++
+				continue
+			}
+			desiredValue = shapeSettingsObject(schema, schema.Properties, desired)
+			liveValue = pruneToDesired(liveValue, desiredValue)
+		}
+
+		compared++
+		lines := sideBySide(jsonLines(liveValue), jsonLines(desiredValue))
+		changed := false
+		for _, line := range lines {
+			changed = changed || line.Kind != ' '
+		}
+		if !changed {
+			fmt.Printf("\n%s: in sync\n", change.Address)
+			continue
+		}
+		differing++
+		fmt.Printf("\n%s (%s)\n", change.Address, objectID)
+		printSideBySide(lines, width)
+	}
+
+	fmt.Printf("\nCompared %d settings object(s): %d differ", compared, differing)
+	if failed > 0 {
+		fmt.Printf(", %d could not be compared", failed)
+	}
+	fmt.Println(".")
+	switch {
+	case failed > 0:
+		return exitFailure
+	case differing > 0:
+		return exitChanges
+	}
+	return exitOK
+}
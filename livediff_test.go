@@ -0,0 +1,113 @@
+/**
+* @license
+* Copyright 2020 Dynatrace LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"dynatrace-terraform-wrapper/internal/dttest"
+)
+
+func TestDiffLiveSettings(t *testing.T) {
+	server := newTestServer(t)
+	useTestEnvironment(t, server, "settings.read")
+
+	server.AddSchema("builtin:alerting.profile", "8.1", `{
+		"properties": {
+			"name": {"type": "text"},
+			"severityRules": {"type": "list", "items": {"type": {"$ref": "#/types/SeverityRule"}}}
+		},
+		"types": {"SeverityRule": {"properties": {"severityLevel": {"type": "text"}, "delayInMinutes": {"type": "integer"}}}}
+	}`)
+	server.AddSettingsObject(dttest.SettingsObject{ObjectID: "profile-1", SchemaID: "builtin:alerting.profile", Value: []byte(
+		`{"name": "Ops", "severityRules": [{"severityLevel": "ERROR", "delayInMinutes": 0, "tagFilterIncludeMode": "NONE"}]}`)})
+	server.AddSettingsObject(dttest.SettingsObject{ObjectID: "setting-1", SchemaID: "builtin:anomaly-detection.infrastructure-hosts", Value: []byte(
+		`{"host": {"connectionLostDetection": {"enabled": true}}}`)})
+	server.Fail("/api/v2/settings/objects/broken-1", 500, "internal error", -1)
+
+	tests := []struct {
+		name   string
+		change string
+		want   int
+	}{
+		{
+			"typed resource in sync",
+			`{"address": "dynatrace_alerting.ops", "type": "dynatrace_alerting", "change": {
+				"before": {"id": "profile-1"},
+				"after": {"name": "Ops", "severity_rules": [{"severity_rule": [{"severity_level": "ERROR", "delay_in_minutes": 0}]}]}}}`,
+			exitOK,
+		},
+		{
+			"typed resource differing",
+			`{"address": "dynatrace_alerting.ops", "type": "dynatrace_alerting", "change": {
+				"before": {"id": "profile-1"},
+				"after": {"name": "Ops", "severity_rules": [{"severity_rule": [{"severity_level": "ERROR", "delay_in_minutes": 30}]}]}}}`,
+			exitChanges,
+		},
+		{
+			"generic setting in sync",
+			`{"address": "dynatrace_generic_setting.hosts", "type": "dynatrace_generic_setting", "change": {
+				"before": {"id": "setting-1"},
+				"after": {"schema": "builtin:anomaly-detection.infrastructure-hosts", "value": "{\"host\": {\"connectionLostDetection\": {\"enabled\": true}}}"}}}`,
+			exitOK,
+		},
+		{
+			"generic setting differing",
+			`{"address": "dynatrace_generic_setting.hosts", "type": "dynatrace_generic_setting", "change": {
+				"before": {"id": "setting-1"},
+				"after": {"schema": "builtin:anomaly-detection.infrastructure-hosts", "value": "{\"host\": {\"connectionLostDetection\": {\"enabled\": false}}}"}}}`,
+			exitChanges,
+		},
+		{
+			"not created yet",
+			`{"address": "dynatrace_alerting.new", "type": "dynatrace_alerting", "change": {
+				"before": null, "after": {"name": "New"}}}`,
+			exitChanges,
+		},
+		{
+			"deleted outside Terraform",
+			`{"address": "dynatrace_alerting.gone", "type": "dynatrace_alerting", "change": {
+				"before": {"id": "profile-gone"}, "after": {"name": "Gone"}}}`,
+			exitChanges,
+		},
+		{
+			"live object not readable",
+			`{"address": "dynatrace_alerting.broken", "type": "dynatrace_alerting", "change": {
+				"before": {"id": "broken-1"}, "after": {"name": "Broken"}}}`,
+			exitFailure,
+		},
+		{
+			"not a settings resource",
+			`{"address": "dynatrace_dashboard.ops", "type": "dynatrace_dashboard", "change": {
+				"before": {"id": "dash-1"}, "after": {"name": "Ops"}}}`,
+			exitOK,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var plan planDiff
+			if err := json.Unmarshal([]byte(`{"resource_changes": [`+test.change+`]}`), &plan); err != nil {
+				t.Fatal(err)
+			}
+			if got := diffLiveSettings(plan, 120); got != test.want {
+				t.Errorf("diffLiveSettings = %d, want %d", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,208 @@
+/**
+* @license
+* Copyright 2020 Dynatrace LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Scopes requested by -login unless login_scope says otherwise
+const defaultLoginScope = "openid offline_access"
+
+// A minted access token is replaced when it expires within this margin
+const accessTokenRefreshMargin = 2 * time.Minute
+
+// Login client whose access token is exported as DT_PLATFORM_TOKEN and when
+// that token expires; zero when no token was minted or it does not expire
+var (
+	accessTokenMu     sync.Mutex
+	accessTokenClient string
+	accessTokenExpiry time.Time
+)
+
+// ============================================================
+// Device authorization login
+// ============================================================
+
+// Device authorization response (RFC 8628)
+type deviceAuthorization struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int    `json:"expires_in"`
+	Interval                int    `json:"interval"`
+}
+
+// Keychain account holding the refresh token of a login client
+func loginKeychainAccount(clientID string) string {
+	return "REFRESH_TOKEN@" + clientID
+}
+
+// Post a form to an SSO endpoint and decode the JSON reply into result
+func postSSOForm(endpoint string, form url.Values, result interface{}) error {
+	resp, err := httpClient.PostForm(endpoint, form)
+	if err != nil {
+		return err
+	}
+	body, err := readAPIResponse(resp)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(body, result)
+}
+
+// OAuth error code of a failed SSO request, e.g. authorization_pending
+func ssoErrorCode(err error) string {
+	var apiErr *apiError
+	if !errors.As(err, &apiErr) {
+		return ""
+	}
+	var reply struct {
+		Error string `json:"error"`
+	}
+	json.Unmarshal([]byte(apiErr.Body), &reply)
+	return reply.Error
+}
+
+// Run the device authorization flow for login_client_id and store the refresh
+// token in the OS keychain
+func deviceLogin(config map[string]string) error {
+	clientID := config["login_client_id"]
+	if clientID == "" {
+		return fmt.Errorf("login_client_id is not configured")
+	}
+	scope := config["login_scope"]
+	if scope == "" {
+		scope = defaultLoginScope
+	}
+
+	var device deviceAuthorization
+	if err := postSSOForm(ssoDeviceURL, url.Values{"client_id": {clientID}, "scope": {scope}}, &device); err != nil {
+		return fmt.Errorf("device authorization failed: %w", err)
+	}
+	if device.VerificationURIComplete != "" {
+		fmt.Printf("Open %s in a browser to sign in.\n", device.VerificationURIComplete)
+	} else {
+		fmt.Printf("Open %s in a browser and enter the code %s to sign in.\n", device.VerificationURI, device.UserCode)
+	}
+
+	interval := time.Duration(max(device.Interval, 5)) * time.Second
+	deadline := time.Now().Add(time.Duration(device.ExpiresIn) * time.Second)
+	form := url.Values{
+		"grant_type":  {"urn:ietf:params:oauth:grant-type:device_code"},
+		"device_code": {device.DeviceCode},
+		"client_id":   {clientID},
+	}
+	for time.Now().Before(deadline) {
+		time.Sleep(interval)
+
+		var token oauthToken
+		err := postSSOForm(ssoTokenURL, form, &token)
+		switch ssoErrorCode(err) {
+		case "authorization_pending":
+			continue
+		case "slow_down":
+			interval += 5 * time.Second
+			continue
+		case "access_denied":
+			return fmt.Errorf("sign-in was denied")
+		case "expired_token":
+			return fmt.Errorf("the sign-in code expired; run -login again")
+		}
+		if err != nil {
+			return fmt.Errorf("sign-in failed: %w", err)
+		}
+		if token.RefreshToken == "" {
+			return fmt.Errorf("SSO issued no refresh token; include offline_access in login_scope")
+		}
+		if err := keychainSet(keychainService, loginKeychainAccount(clientID), token.RefreshToken); err != nil {
+			return fmt.Errorf("failed to store the refresh token in the keychain: %w", err)
+		}
+		fmt.Println("Signed in; the refresh token was stored in the OS keychain.")
+		return nil
+	}
+	return fmt.Errorf("the sign-in code expired; run -login again")
+}
+
+// Mint a short-lived access token from the stored refresh token and expose it
+// to the provider as DT_PLATFORM_TOKEN; does nothing until -login was run
+func loginAccessToken(config map[string]string) error {
+	accessTokenMu.Lock()
+	defer accessTokenMu.Unlock()
+	accessTokenClient, accessTokenExpiry = "", time.Time{}
+	clientID := config["login_client_id"]
+	if clientID == "" {
+		return nil
+	}
+	return mintAccessToken(clientID)
+}
+
+// Mint a new access token when the exported one is about to expire, so Terraform
+// runs late in a long menu session do not get an expired token
+func refreshAccessToken() {
+	accessTokenMu.Lock()
+	defer accessTokenMu.Unlock()
+	if accessTokenExpiry.IsZero() || time.Until(accessTokenExpiry) > accessTokenRefreshMargin {
+		return
+	}
+	if err := mintAccessToken(accessTokenClient); err != nil {
+		fmt.Printf("Warning: failed to refresh the access token: %v\n", err)
+	}
+}
+
+// Exchange the stored refresh token of clientID for an access token and export
+// it; the caller holds accessTokenMu
+func mintAccessToken(clientID string) error {
+	refreshToken, err := keychainGet(keychainService, loginKeychainAccount(clientID))
+	if err != nil || refreshToken == "" {
+		return nil
+	}
+
+	var token oauthToken
+	err = postSSOForm(ssoTokenURL, url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {refreshToken},
+		"client_id":     {clientID},
+	}, &token)
+	if code := ssoErrorCode(err); code == "invalid_grant" {
+		return fmt.Errorf("the stored sign-in has expired; run -login again")
+	}
+	if err != nil {
+		return fmt.Errorf("failed to refresh access token: %w", err)
+	}
+
+	// Refresh tokens may rotate with every use
+	if token.RefreshToken != "" && token.RefreshToken != refreshToken {
+		if err := keychainSet(keychainService, loginKeychainAccount(clientID), token.RefreshToken); err != nil {
+			fmt.Printf("Warning: failed to store the rotated refresh token: %v\n", err)
+		}
+	}
+	exportEnv("DT_PLATFORM_TOKEN", token.AccessToken)
+	accessTokenClient, accessTokenExpiry = clientID, time.Time{}
+	if token.ExpiresIn > 0 {
+		accessTokenExpiry = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+	}
+	publishf("validator", "info", "Obtained access token for %s, valid for %ds", clientID, token.ExpiresIn)
+	return nil
+}
@@ -20,32 +20,39 @@ package main
 import (
 	"archive/zip"
 	"bufio"
+	"cmp"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"log"
-	"net/http"
+	"maps"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
 const terraformVersion = "1.9.8"
 const configFileName = "wrapper.cfg"
+const tomlConfigFileName = "wrapper.toml"
+const templateConfigFileName = "wrapper.cfg.tmpl"
 const logFileName = "terraform.log"
+const renameMapFileName = "renames.cfg"
 
 // ============================================================
 // Check for Terraform executable - $PATH or download locally
 // ============================================================
 
 // Check for Terraform executable; download if missing
-func checkTerraformExecutable() (string, error) {
-	executable := "terraform"
-	if runtime.GOOS == "windows" {
-		executable += ".exe"
-	}
+func checkTerraformExecutable(config map[string]string) (string, error) {
+	executable := terraformExecutableName()
 
 	if path, err := exec.LookPath(executable); err == nil {
 		fmt.Println("Terraform found in PATH.")
@@ -61,30 +68,19 @@ func checkTerraformExecutable() (string, error) {
 	}
 
 	fmt.Println("Terraform not found in PATH or current directory. Downloading...")
-	if err := downloadTerraform(); err != nil {
-		return "", fmt.Errorf("failed to download Terraform: %w", err)
-	}
-
-	return unzipTerraform("terraform.zip")
+	return installTerraform(config["install_strategy"], config)
 }
 
-// Download Terraform zip file
+// Download the release zip, verified against its published checksum, to terraform.zip
 func downloadTerraform() error {
-	url := fmt.Sprintf("https://releases.hashicorp.com/terraform/%s/terraform_%s_%s_%s.zip", terraformVersion, terraformVersion, runtime.GOOS, runtime.GOARCH)
-	resp, err := http.Get(url)
+	data, _, err := downloadReleaseZip()
 	if err != nil {
-		return fmt.Errorf("download failed: %w", err)
+		return err
 	}
-	defer resp.Body.Close()
-
-	out, err := os.Create("terraform.zip")
-	if err != nil {
-		return fmt.Errorf("failed to create file for Terraform zip: %w", err)
+	if err := os.WriteFile("terraform.zip", data, 0644); err != nil {
+		return fmt.Errorf("failed to write Terraform zip: %w", err)
 	}
-	defer out.Close()
-
-	_, err = io.Copy(out, resp.Body)
-	return err
+	return nil
 }
 
 // Unzip Terraform and return the executable path
@@ -140,124 +136,853 @@ func extractFile(f *zip.File, dest string) error {
 }
 
 // ============================================================
-// Load prepackaged configuration
+// Execute Terraform commands
 // ============================================================
 
-// Load configuration from file
-func loadConfig(fileName string) (map[string]string, bool, bool, error) {
-	config := make(map[string]string)
-	apiToken := false
-	oauthClient := false
-
-	file, err := os.Open(fileName)
-	if err != nil {
-		return nil, false, false, err
-	}
-	defer file.Close()
-
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		line := scanner.Text()
-		if strings.Contains(line, "=") {
-			parts := strings.SplitN(line, "=", 2)
-			key, value := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
-			config[key] = value
-
-			if key == "api_token" && value == "true" {
-				apiToken = true
-			} else if key == "oauth_client" && value == "true" {
-				oauthClient = true
-			}
-		}
+// Build Terraform command with a current access token, wrapping it with cmd.exe on Windows
+func terraformCommand(terraformPath string, args ...string) *exec.Cmd {
+	var cmd *exec.Cmd
+	if runtime.GOOS != "windows" {
+		cmd = exec.Command(terraformPath, args...)
+	} else {
+		cmd = exec.Command("cmd.exe", "/C", terraformPath)
+		cmd.Args = append(cmd.Args, args...)
 	}
+	refreshAccessToken()
+	cmd.Env = terraformEnv()
+	return cmd
+}
 
-	return config, apiToken, oauthClient, scanner.Err()
+// Error from a failed Terraform command, carrying the tail of its error output
+type terraformCommandError struct {
+	err    error
+	output string
 }
 
-// ============================================================
-// Execute Terraform commands
-// ============================================================
+func (e *terraformCommandError) Error() string { return e.err.Error() }
+func (e *terraformCommandError) Unwrap() error { return e.err }
+
+// Writer that keeps only the last max bytes written to it
+type tailBuffer struct {
+	max  int
+	data []byte
+}
+
+func (t *tailBuffer) Write(p []byte) (int, error) {
+	t.data = append(t.data, p...)
+	if len(t.data) > t.max {
+		t.data = t.data[len(t.data)-t.max:]
+	}
+	return len(p), nil
+}
+
+// Insert -no-color after the subcommand, ahead of positional arguments such as
+// plan files and import addresses that Terraform expects last
+func withNoColor(args []string) []string {
+	at := 1
+	switch args[0] {
+	case "state", "workspace", "providers":
+		if len(args) > 1 && !strings.HasPrefix(args[1], "-") {
+			at = 2
+		}
+	}
+	return slices.Insert(slices.Clone(args), at, "-no-color")
+}
 
 // Execute Terraform command
 func executeTerraformCommand(terraformPath string, logFile *os.File, args ...string) error {
-	if logFile != nil {
-		args = append(args, "-no-color")
+	return executeObservedTerraformCommand(terraformPath, logFile, nil, time.Time{}, args...)
+}
+
+// Execute Terraform command, additionally copying its output to observer when set
+// and interrupting it at deadline unless that is zero
+func executeObservedTerraformCommand(terraformPath string, logFile *os.File, observer io.Writer, deadline time.Time, args ...string) error {
+	err := runTerraformCommand(terraformPath, logFile, observer, deadline, args)
+	if lock, locked := parseStateLock(err); locked && args[0] != "force-unlock" {
+		if recoverStateLock(terraformPath, logFile, lock) {
+			fmt.Printf("Retrying terraform %s...\n", args[0])
+			return runTerraformCommand(terraformPath, logFile, observer, deadline, args)
+		}
 	}
+	return err
+}
 
-	var cmd *exec.Cmd
-	if runtime.GOOS != "windows" {
-		cmd = exec.Command(terraformPath, args...)
-	} else {
-		cmd = exec.Command("cmd.exe", "/C", terraformPath)
-		cmd.Args = append(cmd.Args, args...)
+// Run a Terraform command once with the common arguments added
+func runTerraformCommand(terraformPath string, logFile *os.File, observer io.Writer, deadline time.Time, args []string) error {
+	args = withLockTimeout(args)
+	if logFile != nil {
+		args = withNoColor(args)
 	}
 
+	stderrTail := &tailBuffer{max: 64 * 1024}
+	var stdout, stderr io.Writer = os.Stdout, os.Stderr
 	if logFile != nil {
-		cmd.Stdout = logFile
-		cmd.Stderr = logFile
-	} else {
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
+		stdout, stderr = logFile, logFile
+	}
+	// With -json the log gets the structured events and the stream passes the
+	// human-readable messages on to the observer
+	var stream *jsonProgressWriter
+	if streamsJSON(args[0], observer) {
+		args = slices.Insert(slices.Clone(args), 1, "-json")
+		stream = newJSONProgressWriter(args[0], logFile == nil, observer)
+		if logFile == nil {
+			stdout = io.Discard
+		}
+		stdout = io.MultiWriter(stdout, stream)
+	} else if observer != nil {
+		stdout = io.MultiWriter(stdout, observer)
 	}
+	if observer != nil {
+		stderr = io.MultiWriter(stderr, observer)
+	}
+	scrubbedStdout, scrubbedStderr := newScrubWriter(stdout), newScrubWriter(io.MultiWriter(stderr, stderrTail))
 
-	return cmd.Run()
+	cmd := terraformCommand(terraformPath, args...)
+	cmd.Stdout = scrubbedStdout
+	cmd.Stderr = scrubbedStderr
+	// Observers answering Terraform's prompts supply its input
+	if input, ok := observer.(interface{ Stdin() io.Reader }); ok {
+		cmd.Stdin = input.Stdin()
+	}
+
+	command := "terraform " + args[0]
+	if args[0] == "apply" || args[0] == "destroy" {
+		if err := snapshotLocalState(); err != nil {
+			return err
+		}
+	}
+	release, err := acquireState()
+	if err != nil {
+		return err
+	}
+	defer release()
+	publishf("runner", "start", "Running %s", command)
+	started := time.Now()
+	if err := cmd.Start(); err != nil {
+		publishf("runner", "error", "%s failed to start: %v", command, err)
+		return err
+	}
+	if !deadline.IsZero() {
+		stop := interruptAtDeadline(cmd, deadline)
+		defer stop()
+	}
+	stopTimeout := func() bool { return false }
+	if timeout := commandTimeout(args[0]); timeout > 0 {
+		stopTimeout = enforceTimeout(cmd, timeout)
+	}
+	err = cmd.Wait()
+	scrubbedStdout.Flush()
+	scrubbedStderr.Flush()
+	if stream != nil {
+		stderrTail.Write([]byte(stream.Finish()))
+	}
+	if stopTimeout() {
+		err = fmt.Errorf("%s timed out after %s: %w", command, commandTimeout(args[0]), err)
+	}
+	if err != nil {
+		publishf("runner", "error", "%s failed after %s: %v", command, time.Since(started).Round(time.Second), err)
+		return &terraformCommandError{err: err, output: string(stderrTail.data)}
+	}
+	publishf("runner", "done", "%s completed in %s", command, time.Since(started).Round(time.Second))
+	return nil
+}
+
+// Run Terraform command and return its standard output
+func outputTerraformCommand(terraformPath string, logFile *os.File, args ...string) ([]byte, error) {
+	release, err := acquireState()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	cmd := terraformCommand(terraformPath, args...)
+	var stderr io.Writer = os.Stderr
+	if logFile != nil {
+		stderr = logFile
+	}
+	scrubbedStderr := newScrubWriter(stderr)
+	defer scrubbedStderr.Flush()
+	cmd.Stderr = scrubbedStderr
+	return cmd.Output()
 }
 
 // Initialize the Terraform working directory
 func initTerraform(terraformPath string, logFile *os.File) error {
-	return executeTerraformCommand(terraformPath, logFile, "init")
+	if err := confirmStateMigration(); err != nil {
+		return err
+	}
+	if _, err := repairProviderSources(); err != nil {
+		return fmt.Errorf("failed to repair provider sources: %w", err)
+	}
+	if err := generateProviderBlock(); err != nil {
+		return fmt.Errorf("failed to generate the provider block: %w", err)
+	}
+	if err := generateStateTargetOutput(); err != nil {
+		return fmt.Errorf("failed to generate the state target output: %w", err)
+	}
+	args := append([]string{"init"}, initArgs...)
+	err := executeTerraformCommand(terraformPath, logFile, args...)
+	if err == nil {
+		return nil
+	}
+	// State written with a deprecated source makes init look for that provider;
+	// the backend is initialized by then, so the state can be repaired and init rerun
+	if repaired, repairErr := repairStateProvider(terraformPath, logFile); repairErr != nil {
+		return repairErr
+	} else if repaired {
+		return executeTerraformCommand(terraformPath, logFile, args...)
+	}
+	return err
 }
 
 // Run a Terraform plan to preview configuration
 func previewConfiguration(terraformPath string, logFile *os.File) error {
-	return executeTerraformCommand(terraformPath, logFile, "plan")
+	if err := ensureWorkspace(terraformPath, logFile); err != nil {
+		recordAudit("plan", err)
+		return err
+	}
+	if err := checkStateTarget(terraformPath, logFile); err != nil {
+		recordAudit("plan", err)
+		return err
+	}
+	err := savePlan(terraformPath, logFile)
+	recordAudit("plan", err)
+	return err
 }
 
 // Run a Terraform apply to publish configuration
 func publishConfiguration(terraformPath string, logFile *os.File) error {
-	return executeTerraformCommand(terraformPath, logFile, "apply", "-auto-approve")
+	if err := ensureWorkspace(terraformPath, logFile); err != nil {
+		recordAudit("apply", err)
+		return err
+	}
+	if err := checkStateTarget(terraformPath, logFile); err != nil {
+		recordAudit("apply", err)
+		return err
+	}
+	if err := checkChangeFreeze("apply"); err != nil {
+		recordAudit("apply", err)
+		return err
+	}
+	useSavedPlan, err := checkSavedPlan()
+	if err != nil {
+		recordAudit("apply", err)
+		return err
+	}
+	// Without a saved plan the approver is shown a fresh plan, which is then applied as is
+	approvedPlan := ""
+	if applyApprover != nil {
+		if useSavedPlan {
+			var output []byte
+			if output, err = outputTerraformCommand(terraformPath, logFile, "show", "-no-color", savedPlanFile()); err == nil {
+				err = approvePlanOutput(string(output))
+			}
+		} else {
+			approvedPlan, err = approveApply(terraformPath, logFile)
+			if err == nil && approvedPlan == "" {
+				fmt.Println("No changes. Nothing to apply.")
+				recordAudit("apply", nil)
+				return nil
+			}
+		}
+		if err != nil {
+			recordAudit("apply", err)
+			return err
+		}
+	}
+	if approvedPlan != "" {
+		defer os.Remove(approvedPlan)
+	}
+
+	args := []string{"apply"}
+	tenant := getEnv("DT_ENV_URL")
+	parallelism := learnedParallelism(tenant)
+	switch {
+	case configuredParallelism > 0:
+		parallelism = configuredParallelism
+		args = append(args, parallelismArgs()...)
+	case parallelism > 0:
+		fmt.Printf("Using learned -parallelism=%d for this environment.\n", parallelism)
+		args = append(args, fmt.Sprintf("-parallelism=%d", parallelism))
+	}
+	interactiveApply := false
+	switch {
+	case useSavedPlan:
+		if confirmApply {
+			output, err := outputTerraformCommand(terraformPath, logFile, "show", "-no-color", savedPlanFile())
+			if err != nil {
+				recordAudit("apply", err)
+				return err
+			}
+			if !askApplyConfirmation(string(output)) {
+				fmt.Println("Apply cancelled.")
+				recordAudit("apply", errCancelled)
+				return nil
+			}
+		}
+		fmt.Printf("Applying the saved plan %s.\n", savedPlanFile())
+		// A saved plan cannot be applied twice, whatever the outcome
+		defer removeSavedPlan()
+		args = append(args, savedPlanFile())
+	case approvedPlan != "":
+		args = append(args, approvedPlan)
+	case planChecksEnabled():
+		planFile, err := planWithExclusions(terraformPath, logFile)
+		if err != nil {
+			recordAudit("apply", err)
+			return err
+		}
+		defer os.Remove(planFile)
+		args = append(args, planFile)
+	case confirmApply:
+		interactiveApply = true
+		args = append(args, targetArgs()...)
+		args = append(args, replaceArgs()...)
+		args = append(args, variableArgs...)
+	default:
+		args = append(args, "-auto-approve")
+		args = append(args, targetArgs()...)
+		args = append(args, replaceArgs()...)
+		args = append(args, variableArgs...)
+	}
+
+	deadline := applyDeadline()
+	if !deadline.IsZero() && time.Now().After(deadline) {
+		err := fmt.Errorf("change window closes at %s; not starting apply", changeWindowEnd.Format(time.RFC3339))
+		recordAudit("apply", err)
+		return err
+	}
+
+	counter := &rateLimitCounter{}
+	progress := &applyProgress{}
+	var observer io.Writer = io.MultiWriter(counter, progress)
+	var confirmer *applyConfirmer
+	if interactiveApply {
+		confirmer = newApplyConfirmer(observer)
+		observer = confirmer
+	}
+	err = executeObservedTerraformCommand(terraformPath, logFile, observer, deadline, args...)
+	if confirmer != nil {
+		confirmer.Close()
+		// Terraform fails with "Apply cancelled." when the answer is no
+		if confirmer.Cancelled() {
+			fmt.Println("Apply cancelled.")
+			recordAudit("apply", errCancelled)
+			return nil
+		}
+	}
+
+	rateLimited := counter.Count()
+	retryParallelism := cmp.Or(parallelism, defaultParallelism)
+	// Changes that were reviewed before apply must be reviewed again when rerun
+	reviewed := useSavedPlan || approvedPlan != "" || interactiveApply
+	for attempt := 1; err != nil && counter.Count() > 0 && attempt <= rateLimitRetries; attempt++ {
+		if reviewed && applyApprover == nil && !confirmApply {
+			err = fmt.Errorf("%w; the remaining changes of the rate-limited plan need a new review, run plan again", err)
+			break
+		}
+		delay := rateLimitBackoff << (attempt - 1)
+		if !deadline.IsZero() && time.Now().Add(delay).After(deadline) {
+			break
+		}
+		retryParallelism = max(1, retryParallelism/2)
+		fmt.Printf("Apply failed after %d rate-limited API calls; rerunning with -parallelism=%d in %s (attempt %d of %d)...\n",
+			counter.Count(), retryParallelism, delay, attempt, rateLimitRetries)
+		time.Sleep(delay)
+
+		counter = &rateLimitCounter{}
+		err = rerunRateLimitedApply(terraformPath, logFile, io.MultiWriter(counter, progress), deadline, retryParallelism, progress.Completed(), reviewed)
+		rateLimited += counter.Count()
+	}
+
+	if err != nil && !deadline.IsZero() && !time.Now().Before(deadline) {
+		if reportErr := reportInterruptedApply(terraformPath, logFile, progress); reportErr != nil {
+			fmt.Printf("Warning: %v\n", reportErr)
+		}
+		err = fmt.Errorf("apply interrupted at the end of the change window: %w", err)
+	}
+	recordAudit("apply", err)
+	reportDeployment("apply", progress.Completed(), err)
+	if configuredParallelism == 0 {
+		adjustParallelism(tenant, parallelism, rateLimited)
+	}
+	if err == nil {
+		if targetErr := verifyStateTargetRecorded(terraformPath, logFile); targetErr != nil {
+			fmt.Printf("Warning: %v\n", targetErr)
+		}
+		if outputErr := surfaceOutputs(terraformPath, logFile); outputErr != nil {
+			fmt.Printf("Warning: %v\n", outputErr)
+		}
+		// Replacements are one-off; later applies in the session must not recreate again
+		replaceAddresses = nil
+		err = verifyAppliedObjects(terraformPath, logFile, progress.Completed())
+	}
+	return err
 }
 
 // Run a Terraform destroy to remove configuration
 func removeConfiguration(terraformPath string, logFile *os.File) error {
-	return executeTerraformCommand(terraformPath, logFile, "destroy", "-auto-approve")
+	if err := ensureWorkspace(terraformPath, logFile); err != nil {
+		recordAudit("destroy", err)
+		return err
+	}
+	if err := checkStateTarget(terraformPath, logFile); err != nil {
+		recordAudit("destroy", err)
+		return err
+	}
+	if err := checkChangeFreeze("destroy"); err != nil {
+		recordAudit("destroy", err)
+		return err
+	}
+	args := append([]string{"destroy", "-auto-approve"}, parallelismArgs()...)
+	args = append(args, targetArgs()...)
+	args = append(args, variableArgs...)
+	progress := &applyProgress{}
+	err := executeObservedTerraformCommand(terraformPath, logFile, progress, time.Time{}, args...)
+	recordAudit("destroy", err)
+	reportDeployment("destroy", progress.Completed(), err)
+	return err
 }
 
 // ============================================================
 // Set environment variables from config file or prompt
 // ============================================================
 
-// Helper function to set environment variable from config or prompt if missing
-func setEnvFromConfigOrPrompt(envKey, promptMsg string, config map[string]string, reader *bufio.Reader) {
-	if _, isSet := os.LookupEnv(envKey); isSet {
-		return
+// Set by -non-interactive or CI=true; missing values fail the run instead of prompting
+var nonInteractive bool
+
+// Returned when a value would have to be prompted for in non-interactive mode
+var errMissingValue = errors.New("value required but prompting is disabled")
+
+// Dynatrace provider credentials prompted for by the wrapper itself
+var builtinEnvKeys = map[string]bool{"DT_ENV_URL": true, "DT_API_TOKEN": true, "DT_CLIENT_ID": true, "DT_CLIENT_SECRET": true, "DT_ACCOUNT_ID": true, "DT_PLATFORM_TOKEN": true, "DT_CLUSTER_URL": true, "DT_CLUSTER_API_TOKEN": true}
+
+// Environment variables set by the wrapper, as opposed to inherited from the shell;
+// they are passed to each Terraform invocation without touching the process
+// environment so no later child process inherits them by accident. The credential
+// monitor reads them from its own goroutine, hence the lock
+var (
+	exportedEnvMu sync.RWMutex
+	exportedEnv   = make(map[string]string)
+)
+
+// Set environment variable for Terraform invocations
+func exportEnv(envKey, value string) {
+	exportedEnvMu.Lock()
+	defer exportedEnvMu.Unlock()
+	exportedEnv[envKey] = value
+}
+
+// Forget all environment variables previously set by the wrapper
+func clearExportedEnv() {
+	exportedEnvMu.Lock()
+	defer exportedEnvMu.Unlock()
+	clear(exportedEnv)
+}
+
+// Replace all variables set by the wrapper with a snapshot taken earlier
+func replaceExportedEnv(snapshot map[string]string) {
+	exportedEnvMu.Lock()
+	defer exportedEnvMu.Unlock()
+	exportedEnv = maps.Clone(snapshot)
+}
+
+// Copy of the variables set by the wrapper
+func exportedEnvSnapshot() map[string]string {
+	exportedEnvMu.RLock()
+	defer exportedEnvMu.RUnlock()
+	return maps.Clone(exportedEnv)
+}
+
+// Value of an environment variable set by the wrapper or inherited from the shell
+func lookupEnv(envKey string) (string, bool) {
+	exportedEnvMu.RLock()
+	value, found := exportedEnv[envKey]
+	exportedEnvMu.RUnlock()
+	if found {
+		return value, true
 	}
+	return os.LookupEnv(envKey)
+}
 
-	if configValue, found := config[envKey]; found {
-		os.Setenv(envKey, configValue)
-		return
+// Value of an environment variable, empty if unset
+func getEnv(envKey string) string {
+	value, _ := lookupEnv(envKey)
+	return value
+}
+
+// Environment of a Terraform invocation: the shell's environment overlaid with
+// the variables set by the wrapper
+func terraformEnv() []string {
+	exported := exportedEnvSnapshot()
+	env := make([]string, 0, len(os.Environ())+len(exported))
+	for _, entry := range os.Environ() {
+		name, _, _ := strings.Cut(entry, "=")
+		if _, overridden := exported[name]; !overridden {
+			env = append(env, entry)
+		}
+	}
+	if target := stateTargetEnv(); target != "" {
+		env = append(env, target)
 	}
+	for envKey, value := range exported {
+		env = append(env, envKey+"="+value)
+	}
+	return env
+}
+
+// Set an environment variable from the first credential provider in the chain that
+// has a value for it; config may override the prompt text and supply a default or
+// mark the key required
+func setEnvFromConfigOrPrompt(envKey, promptMsg string, config map[string]string, reader *bufio.Reader) error {
+	chain, err := credentialChain(config)
+	if err != nil {
+		return err
+	}
+	req := credentialRequest{EnvKey: envKey, PromptMsg: promptMsg, Config: config, Reader: reader}
+	for _, provider := range chain {
+		value, found, err := provider.Resolve(req)
+		if err != nil {
+			return err
+		}
+		if found {
+			exportEnv(envKey, value)
+			return nil
+		}
+	}
+	return nil
+}
+
+var declaredVarSuffixes = []string{".prompt", ".default", ".required"}
+
+// Check whether a key was declared in config through prompt, default or required settings
+func isDeclaredVar(envKey string, config map[string]string) bool {
+	for _, suffix := range declaredVarSuffixes {
+		if _, found := config[envKey+suffix]; found {
+			return true
+		}
+	}
+	return false
+}
+
+// Additional variables (e.g. TF_VAR_*) declared in config, excluding the built-in
+// Dynatrace keys and those of credential sets
+func declaredVars(config map[string]string) []string {
+	seen := make(map[string]bool)
+	var keys []string
+	for key := range config {
+		for _, suffix := range declaredVarSuffixes {
+			name, found := strings.CutSuffix(key, suffix)
+			if found && name != "" && !builtinEnvKeys[name] && !strings.Contains(name, ".") && !seen[name] {
+				seen[name] = true
+				keys = append(keys, name)
+			}
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
 
-	fmt.Print(promptMsg)
-	inputValue, _ := reader.ReadString('\n')
-	inputValue = strings.TrimSpace(inputValue)
-	os.Setenv(envKey, inputValue)
+// Environment variable to set, with the message used when prompting for it
+type promptedVar struct {
+	envKey, promptMsg string
+}
+
+var apiTokenVars = []promptedVar{
+	{"DT_ENV_URL", "Input Dynatrace environment URL (SaaS: https://########.live.dynatrace.com or Managed: https://<dynatrace-host>/e/########): "},
+	{"DT_API_TOKEN", "Input Dynatrace API token (dt0c01.########.########): "},
+}
+
+var oauthClientVars = []promptedVar{
+	{"DT_CLIENT_ID", "Input Dynatrace OAuth client ID (dt0s02.########): "},
+	{"DT_CLIENT_SECRET", "Input Dynatrace OAuth client secret (dt0s02.########.########): "},
+	{"DT_ACCOUNT_ID", "Input Dynatrace OAuth account ID (urn:dtaccount:{your-account-UUID}): "},
+}
+
+var platformTokenVars = []promptedVar{
+	{"DT_ENV_URL", "Input Dynatrace environment URL (SaaS: https://########.live.dynatrace.com or Managed: https://<dynatrace-host>/e/########): "},
+	{"DT_PLATFORM_TOKEN", "Input Dynatrace platform token (dt0s16.########.########): "},
+}
+
+// Append vars not already in the list; modes share DT_ENV_URL
+func appendPromptedVars(vars []promptedVar, more ...promptedVar) []promptedVar {
+	for _, v := range more {
+		if !slices.ContainsFunc(vars, func(existing promptedVar) bool { return existing.envKey == v.envKey }) {
+			vars = append(vars, v)
+		}
+	}
+	return vars
+}
+
+// Names of the additional credential sets listed in credential_sets (e.g. source, target)
+func credentialSets(config map[string]string) []string {
+	var sets []string
+	for _, set := range strings.Split(config["credential_sets"], ",") {
+		if set = strings.TrimSpace(set); set != "" {
+			sets = append(sets, set)
+		}
+	}
+	return sets
+}
+
+// Copy a credential set's "<set>.DT_*" keys into config under the env keys they are exported
+// under (DT_<SET>_*), returning the variables to set; set credentials are required
+// unless configured otherwise
+func expandCredentialSet(set string, config map[string]string) []promptedVar {
+	var setVars []promptedVar
+	if config[set+".api_token"] != "false" {
+		setVars = append(setVars, apiTokenVars...)
+	}
+	if config[set+".oauth_client"] == "true" {
+		setVars = append(setVars, oauthClientVars...)
+	}
+	if config[set+".platform_token"] == "true" {
+		setVars = appendPromptedVars(setVars, platformTokenVars...)
+	}
+
+	var vars []promptedVar
+	for _, v := range setVars {
+		envKey := "DT_" + strings.ToUpper(set) + "_" + strings.TrimPrefix(v.envKey, "DT_")
+		for _, suffix := range append([]string{""}, declaredVarSuffixes...) {
+			if value, found := config[set+"."+v.envKey+suffix]; found {
+				config[envKey+suffix] = value
+			}
+		}
+		if _, found := config[envKey+".required"]; !found {
+			config[envKey+".required"] = "true"
+		}
+		vars = append(vars, promptedVar{envKey, "[" + set + "] " + v.promptMsg})
+	}
+	return vars
 }
 
 // Set environment variables based on config file or prompt if missing
-func setEnvironmentVars(config map[string]string, apiToken, oauthClient bool) {
+func setEnvironmentVars(config map[string]string, apiToken, oauthClient bool) error {
 	reader := bufio.NewReader(os.Stdin)
 
+	var vars []promptedVar
 	if apiToken {
-		setEnvFromConfigOrPrompt("DT_ENV_URL", "Input Dynatrace environment URL (SaaS: https://########.live.dynatrace.com or Managed: https://<dynatrace-host>/e/########): ", config, reader)
-		setEnvFromConfigOrPrompt("DT_API_TOKEN", "Input Dynatrace API token (dt0c01.########.########): ", config, reader)
+		vars = append(vars, apiTokenVars...)
 	}
-
 	if oauthClient {
-		setEnvFromConfigOrPrompt("DT_CLIENT_ID", "Input Dynatrace OAuth client ID (dt0s02.########): ", config, reader)
-		setEnvFromConfigOrPrompt("DT_CLIENT_SECRET", "Input Dynatrace OAuth client secret (dt0s02.########.########): ", config, reader)
-		setEnvFromConfigOrPrompt("DT_ACCOUNT_ID", "Input Dynatrace OAuth account ID (urn:dtaccount:{your-account-UUID}): ", config, reader)
+		vars = append(vars, oauthClientVars...)
+	}
+	if config["platform_token"] == "true" {
+		vars = appendPromptedVars(vars, platformTokenVars...)
+	}
+	if config["managed_cluster"] == "true" {
+		vars = append(vars, managedClusterVars...)
+	}
+
+	expanded := make(map[string]string, len(config))
+	for key, value := range config {
+		expanded[key] = value
 	}
+	for _, set := range credentialSets(config) {
+		vars = append(vars, expandCredentialSet(set, expanded)...)
+	}
+
+	for _, envKey := range declaredVars(config) {
+		vars = append(vars, promptedVar{envKey, fmt.Sprintf("Input %s: ", envKey)})
+	}
+
+	var missing []string
+	for _, v := range vars {
+		err := setEnvFromConfigOrPrompt(v.envKey, v.promptMsg, expanded, reader)
+		if errors.Is(err, errMissingValue) {
+			missing = append(missing, v.envKey)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("non-interactive mode: %d required value(s) missing; set them in the environment or %s:\n  - %s",
+			len(missing), activeConfigFile(), strings.Join(missing, "\n  - "))
+	}
+	return nil
+}
+
+// Open the configuration file in the operator's preferred editor, if one is configured
+func editConfiguration(fileName string) error {
+	config, _, _, err := loadConfig(fileName)
+	if err != nil || config["editor"] == "" {
+		return nil
+	}
+
+	fmt.Print("Edit configuration before reloading? (y/n): ")
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	if strings.ToLower(strings.TrimSpace(answer)) != "y" {
+		return nil
+	}
+
+	editorArgs := strings.Fields(config["editor"])
+	cmd := exec.Command(editorArgs[0], append(editorArgs[1:], fileName)...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// Reload configuration file and re-resolve environment variables set by the
+// wrapper; when any step fails the previously exported environment is restored
+// so the menu keeps running with the credentials it had
+func reloadConfiguration(fileName string) (bool, bool, error) {
+	config, apiToken, oauthClient, err := loadConfig(fileName)
+	if err != nil {
+		return false, false, err
+	}
+	previous := exportedEnvSnapshot()
+	clearExportedEnv()
+	if oauthClient, err = reloadSetup(config, apiToken, oauthClient); err != nil {
+		replaceExportedEnv(previous)
+		return false, false, err
+	}
+	return apiToken, oauthClient, nil
+}
+
+// Run the setup steps of startup that depend on the configuration, for a reload
+func reloadSetup(config map[string]string, apiToken, oauthClient bool) (bool, error) {
+	if err := setupSettings(config); err != nil {
+		return false, err
+	}
+	if err := setupStateHandling(config); err != nil {
+		return false, err
+	}
+	oauthClient, err := setupCredentials(config, apiToken, oauthClient)
+	if err != nil {
+		return false, err
+	}
+	if err := setupFeatures(config, selectedTargets); err != nil {
+		return false, err
+	}
+	setupWorkspace(config)
+	setupOutputs(config)
+	if err := audit.configureWebhook(config); err != nil {
+		return false, fmt.Errorf("audit webhook: %w", err)
+	}
+	if err := checkCredentials(config, apiToken, oauthClient); err != nil {
+		return false, err
+	}
+	return oauthClient, nil
+}
+
+// ============================================================
+// Setup shared by startup and reload
+// ============================================================
+
+// Apply the wrapper's own settings and create the approver
+func setupSettings(config map[string]string) error {
+	if err := applyUserSettings(config); err != nil {
+		return fmt.Errorf("settings: %w", err)
+	}
+	var err error
+	if applyApprover, err = newApprover(config); err != nil {
+		return fmt.Errorf("approver: %w", err)
+	}
+	return nil
+}
+
+// Configure the backend, init options, state backups and state encryption
+func setupStateHandling(config map[string]string) error {
+	if err := setupBackend(config); err != nil {
+		return fmt.Errorf("backend: %w", err)
+	}
+	if err := setupInitOptions(config); err != nil {
+		return fmt.Errorf("init: %w", err)
+	}
+	if err := setupStateBackups(config); err != nil {
+		return fmt.Errorf("state backups: %w", err)
+	}
+	if err := setupStateEncryption(config); err != nil {
+		return fmt.Errorf("state encryption: %w", err)
+	}
+	return nil
+}
+
+// Resolve the credentials and export them for Terraform; returns whether an
+// OAuth client is used, which account management mode may turn on
+func setupCredentials(config map[string]string, apiToken, oauthClient bool) (bool, error) {
+	if err := setupSessionCache(config); err != nil {
+		return false, fmt.Errorf("session cache: %w", err)
+	}
+	if err := configureTLS(config); err != nil {
+		return false, fmt.Errorf("TLS: %w", err)
+	}
+	if err := resolveManagedNodes(config); err != nil {
+		return false, fmt.Errorf("Managed cluster node: %w", err)
+	}
+	if err := loginAccessToken(config); err != nil {
+		return false, fmt.Errorf("access token: %w", err)
+	}
+	oauthClient, err := setupIAMMode(config, oauthClient)
+	if err != nil {
+		return false, fmt.Errorf("account management mode: %w", err)
+	}
+	if err := setEnvironmentVars(config, apiToken, oauthClient); err != nil {
+		return false, fmt.Errorf("environment variables: %w", err)
+	}
+	if err := setupTerraformCloud(config); err != nil {
+		return false, fmt.Errorf("HCP Terraform: %w", err)
+	}
+	return oauthClient, nil
+}
+
+// Configure exclusions, targets and the optional checks and run controls of
+// plan and apply
+func setupFeatures(config map[string]string, targets []string) error {
+	if err := setupExclusions(config); err != nil {
+		return fmt.Errorf("exclusions: %w", err)
+	}
+	if err := selectTargets(targets); err != nil {
+		return fmt.Errorf("targets: %w", err)
+	}
+	setupScopeCheck(config)
+	setupSchemaCheck(config)
+	setupReadinessCheck(config)
+	setupImpactAnalysis(config)
+	setupSLOPreview(config)
+	setupApplyVerification(config)
+	setupProviderBlock(config)
+	setupDeploymentEvents(config)
+	if err := setupSavedPlans(config); err != nil {
+		return fmt.Errorf("saved plans: %w", err)
+	}
+	if err := setupVariables(config); err != nil {
+		return fmt.Errorf("variables: %w", err)
+	}
+	if err := setupRunControls(config); err != nil {
+		return fmt.Errorf("parallelism and timeouts: %w", err)
+	}
+	if err := setupRateLimitRetries(config); err != nil {
+		return fmt.Errorf("rate limit retries: %w", err)
+	}
+	if err := setupChangeFreeze(config); err != nil {
+		return fmt.Errorf("change freezes: %w", err)
+	}
+	if err := setupStateLocking(config); err != nil {
+		return fmt.Errorf("state locking: %w", err)
+	}
+	setupApplyConfirmation(config)
+	setupJSONProgress(config)
+	return nil
+}
+
+// Validate the exported credentials, the account and AutomationEngine access
+func checkCredentials(config map[string]string, apiToken, oauthClient bool) error {
+	if err := preflightCredentials(config, apiToken, oauthClient); err != nil {
+		return fmt.Errorf("credential pre-flight check failed:\n  %w", err)
+	}
+	if iamMode {
+		if err := preflightAccount(); err != nil {
+			return fmt.Errorf("account pre-flight check failed:\n  %w", err)
+		}
+	}
+	if err := checkAutomationReadiness(oauthClient); err != nil {
+		return fmt.Errorf("AutomationEngine pre-flight check failed: %w", err)
+	}
+	return nil
 }
 
 // ============================================================
@@ -265,13 +990,28 @@ func setEnvironmentVars(config map[string]string, apiToken, oauthClient bool) {
 // ============================================================
 
 // Display menu and handle user input
-func displayMenu(terraformPath string, logFile *os.File) {
+func displayMenu(terraformPath string, logFile *os.File, monitor *credentialMonitor) {
 	for {
+		if banner := monitor.Banner(); banner != "" {
+			fmt.Println("\n!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!")
+			fmt.Println(banner)
+			fmt.Println("Update your credentials before running plan or apply.")
+			fmt.Println("!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!")
+		}
 		fmt.Println("\n--------------------------")
 		fmt.Println("Select an option:")
 		fmt.Println("1. Preview configuration (terraform plan)")
 		fmt.Println("2. Publish configuration (terraform apply)")
 		fmt.Println("3. Remove configuration (terraform destroy)")
+		fmt.Println("5. Reload configuration")
+		fmt.Println("6. Select target resources")
+		fmt.Println("7. Validate configuration (terraform fmt and validate)")
+		fmt.Println("8. Recreate resources on the next apply (-replace)")
+		fmt.Println("9. Show resource dependency graph (terraform graph)")
+		fmt.Println("10. Destroy selected resources")
+		fmt.Println("11. Open terraform console")
+		fmt.Println("12. Taint or untaint a resource")
+		// Exit keeps its original number and stays last as options are added
 		fmt.Println("4. Exit")
 		fmt.Print("Enter your choice: ")
 
@@ -284,51 +1024,315 @@ func displayMenu(terraformPath string, logFile *os.File) {
 			fmt.Println("\nRunning Terraform plan to preview configuration...")
 			if err := previewConfiguration(terraformPath, logFile); err != nil {
 				log.Printf("Failed to preview configuration: %v\n", err)
+				explainTerraformError(err)
 			}
 			fmt.Println("Completed Terraform plan.")
 		case "2":
 			fmt.Println("\nRunning Terraform apply to publish configuration...")
 			if err := publishConfiguration(terraformPath, logFile); err != nil {
 				log.Printf("Failed to publish configuration: %v\n", err)
+				explainTerraformError(err)
 			}
 			fmt.Println("Completed Terraform apply.")
 		case "3":
 			fmt.Println("\nRunning Terraform destroy to remove configuration...")
 			if err := removeConfiguration(terraformPath, logFile); err != nil {
 				log.Printf("Failed to remove configuration: %v\n", err)
+				explainTerraformError(err)
 			}
 			fmt.Println("Completed Terraform destroy.")
 		case "4":
 			fmt.Println("Exiting.")
 			return
+		case "5":
+			if err := editConfiguration(activeConfigFile()); err != nil {
+				log.Printf("Failed to open editor: %v\n", err)
+			}
+			fmt.Printf("\nReloading %s...\n", activeConfigFile())
+			apiToken, oauthClient, err := reloadConfiguration(activeConfigFile())
+			if err != nil {
+				log.Printf("Failed to reload configuration: %v\n", err)
+				continue
+			}
+			monitor.Reset(apiToken, oauthClient)
+			if config, _, _, err := loadConfig(activeConfigFile()); err == nil {
+				if err := applyOutputMapping(terraformPath, logFile, config); err != nil {
+					log.Printf("Failed to map promoted outputs: %v\n", err)
+				}
+			}
+			fmt.Println("Configuration reloaded.")
+		case "6":
+			if err := pickTargets(terraformPath, logFile); err != nil {
+				log.Printf("Failed to select targets: %v\n", err)
+			}
+		case "7":
+			fmt.Println("\nValidating configuration...")
+			if err := validateConfiguration(terraformPath, logFile); err != nil {
+				log.Printf("Validation failed: %v\n", err)
+			}
+		case "8":
+			if err := pickReplacements(terraformPath, logFile); err != nil {
+				log.Printf("Failed to select resources to recreate: %v\n", err)
+			}
+		case "9":
+			if err := showDependencyGraph(terraformPath, logFile); err != nil {
+				log.Printf("Failed to show dependency graph: %v\n", err)
+			}
+		case "10":
+			if err := selectiveDestroy(terraformPath, logFile); err != nil {
+				log.Printf("Failed to destroy selected resources: %v\n", err)
+				explainTerraformError(err)
+			}
+		case "11":
+			if err := openConsole(terraformPath, logFile); err != nil {
+				log.Printf("Terraform console failed: %v\n", err)
+			}
+		case "12":
+			if err := manageTaint(terraformPath, logFile); err != nil {
+				log.Printf("Failed to change taint: %v\n", err)
+				explainTerraformError(err)
+			}
 		default:
-			fmt.Println("Invalid choice. Please enter 1, 2, 3, or 4.")
+			fmt.Println("Invalid choice. Please enter a number from 1 to 12.")
 		}
 	}
 }
 
 // ============================================================
 
+// Repeatable key=value command-line flag
+type keyValueFlag map[string]string
+
+func (f keyValueFlag) String() string {
+	pairs := make([]string, 0, len(f))
+	for key, value := range f {
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (f keyValueFlag) Set(value string) error {
+	key, val, found := strings.Cut(value, "=")
+	if !found || strings.TrimSpace(key) == "" {
+		return fmt.Errorf("expected key=value, got %q", value)
+	}
+	f[strings.TrimSpace(key)] = val
+	return nil
+}
+
 func main() {
+	// Wrapper log lines may quote API responses and command output
+	log.SetOutput(newScrubWriter(os.Stderr))
+
+	planFlag := flag.Bool("plan", false, "Run 'terraform plan' and save the plan without menu; exits 2 when it has changes, 0 when not")
 	applyFlag := flag.Bool("apply", false, "Run 'terraform apply' to publish configuration without menu")
 	destroyFlag := flag.Bool("destroy", false, "Run 'terraform destroy' to remove configuration without menu")
 	consoleFlag := flag.Bool("console", false, "Output Terraform stdout/stderr onto console instead of log file")
+	sharePlanFlag := flag.Bool("share-plan", false, "Serve a read-only plan report on a localhost port and exit")
+	sharePortFlag := flag.Int("share-port", 0, "Port for -share-plan (0 picks a free port)")
+	shareTokenFlag := flag.Bool("share-token", false, "Protect the -share-plan link with a one-time token")
+	shareTimeoutFlag := flag.Duration("share-timeout", 30*time.Minute, "Stop the -share-plan server after this duration")
+	revalidateFlag := flag.Duration("revalidate-interval", 5*time.Minute, "Re-validate credentials in the background during interactive sessions (0 disables)")
+	detectFlag := flag.Bool("detect", false, "Pre-populate wrapper.cfg or wrapper.toml from the dynatrace provider block in the bundled .tf files and exit")
+	flag.StringVar(&cliWorkspace, "workspace", "", "Select this Terraform workspace before every plan, apply and destroy (overrides the workspace key)")
+	listWorkspacesFlag := flag.Bool("list-workspaces", false, "List the Terraform workspaces and exit")
+	newWorkspaceFlag := flag.String("new-workspace", "", "Create and select a Terraform workspace and exit")
+	deleteWorkspaceFlag := flag.String("delete-workspace", "", "Delete an empty Terraform workspace (-force deletes one that still holds resources) and exit")
+	gcWorkspacesFlag := flag.Bool("gc-workspaces", false, "List workspaces of decommissioned environments and offer guided cleanup")
+	historyFlag := flag.Int("history", 0, "Print the last N recorded plan/apply/destroy runs and exit")
+	trendsFlag := flag.Int("trends", 0, "Summarize the runs recorded in the last N days by week and operation and exit")
+	lintConfigFlag := flag.Bool("lint-config", false, "Validate wrapper.cfg and referenced files, exiting non-zero on errors")
+	convertConfigFlag := flag.Bool("convert-config", false, "Convert wrapper.cfg to wrapper.toml with typed values and exit")
+	describeFlag := flag.String("describe", "", "Describe the resources and variables in the package as 'json' or 'markdown' and exit")
+	describeOutFlag := flag.String("describe-out", "", "Write the -describe output to this file instead of stdout")
+	flag.Var(keyValueFlag(templateVars), "tmpl-var", "Value for rendering wrapper.cfg.tmpl as key=value (repeatable)")
+	flag.Var(cliTargets, "target", "Limit plan, apply and destroy to this resource or module address (repeatable)")
+	pickTargetsFlag := flag.Bool("pick-targets", false, "Choose the resources to target from the state and plan before running")
+	flag.Var(cliReplacements, "replace", "Recreate this resource on plan and apply instead of updating it in place (repeatable)")
+	flag.IntVar(&cliParallelism, "parallelism", 0, "Limit concurrent Dynatrace API operations of plan, apply and destroy (overrides parallelism and the learned value)")
+	flag.DurationVar(&cliTimeout, "timeout", 0, "Interrupt any Terraform command running longer than this (overrides timeout and timeout.<command>)")
+	flag.StringVar(&cliLockTimeout, "lock-timeout", "", "Wait this long for the state lock before failing (overrides lock_timeout)")
+	flag.BoolVar(&cliAutoUnlock, "auto-unlock", false, "Force-unlock a state lock older than auto_unlock_age (default 1h) without asking, then retry")
+	flag.BoolVar(&cliConfirmApply, "confirm-apply", false, "Show the plan summary and ask before apply changes anything instead of auto-approving (interactive runs only)")
+	flag.BoolVar(&cliJSONProgress, "json", false, "Run plan, apply and destroy with -json, showing a live progress line and logging the structured events")
+	flag.StringVar(&cliWorkingDir, "chdir", "", "Run against the stack in this subdirectory of the bundle (overrides working_dir); the wrapper changes into it rather than passing -chdir to Terraform")
+	flag.StringVar(&cliStacksAction, "stacks", "", "Run plan, apply or destroy in every stack of the stacks key, in dependency order")
+	flag.StringVar(&cliRestoreState, "restore-state", "", "Restore the local state from the snapshot with this timestamp in backups/ ('list' shows them) and exit")
+	flag.BoolVar(&cliRemoteRun, "remote-run", false, "Trigger a run in the HCP Terraform workspace of backend = cloud, follow it and apply it once confirmed, then exit")
+	flag.Var(cliVars, "var", "Set a Terraform input variable as key=value for plan, apply and destroy (repeatable)")
+	flag.BoolVar(&cliInitUpgrade, "upgrade", false, "Upgrade providers and modules to the newest versions the constraints allow on init")
+	flag.BoolVar(&cliReconfigure, "reconfigure", false, "Reinitialize a changed backend without migrating the existing state")
+	flag.BoolVar(&cliMigrateState, "migrate-state", false, "Copy the existing state to a changed backend on init (asks first; needs -force in non-interactive mode)")
+	flag.Var(cliBackendConfigs, "backend-config", "Pass a backend setting as key=value or a backend config file to init (repeatable, overrides backend_config.<key>)")
+	flag.Var(cliVarFiles, "var-file", "Pass a Terraform variable file to plan, apply and destroy after those in var_file (repeatable)")
+	flag.BoolVar(&forceGuards, "force", false, "Proceed even when a safety check (such as a state/environment mismatch) would block the run")
+	flag.BoolVar(&recordStateTarget, "record-state-target", false, "Plan and apply state that holds resources but records no environment, recording DT_ENV_URL in it on the next untargeted apply")
+	nonInteractiveFlag := flag.Bool("non-interactive", false, "Fail instead of prompting for missing values (implied by CI=true)")
+	newFlag := flag.String("new", "", "Scaffold a new package from a gallery template ('list' shows the gallery) and exit")
+	newDirFlag := flag.String("new-dir", "", "Directory for -new (defaults to the template name)")
+	eventsFlag := flag.String("events", "", "Publish progress events to these renderers (comma-separated: console, tui, jsonl, sse)")
+	eventsFileFlag := flag.String("events-file", "events.jsonl", "File the jsonl event renderer appends to")
+	eventsAddrFlag := flag.String("events-addr", "127.0.0.1:0", "Listen address of the sse event renderer")
+	windowEndFlag := flag.String("window-end", "", "End of the change window (RFC 3339 or HH:MM); apply is interrupted gracefully before it closes")
+	loginFlag := flag.Bool("login", false, "Sign in with the Dynatrace SSO device flow for login_client_id, store the refresh token in the OS keychain and exit")
+	forgetCredentialsFlag := flag.Bool("forget-credentials", false, "Clear the session cache of prompted credentials and exit")
+	rotateTokenFlag := flag.Bool("rotate-token", false, "Create a replacement for the configured API token with the same scopes, store it and exit")
+	listTenantsFlag := flag.Bool("list-tenants", false, "Print the workspace tenants, including those resolved from the account (tenant_source = account), and exit")
+	allTenantsFlag := flag.Bool("all-tenants", false, "With -plan or -apply, run in the workspace of every tenant (workspace.<name> entries and, with tenant_source = account, the account's matching environments); requires oauth_client = true")
+	flag.Var(cliImports, "import", "Import an existing Dynatrace object into state as address=id (repeatable), then exit")
+	importCSVFlag := flag.String("import-csv", "", "Import the address,id rows of this CSV file into state, then exit")
+	migrateFlag := flag.String("migrate", "", "Copy the comma-separated resource types (e.g. dashboard,alerting,management_zone_v2) from the -migrate-from tenant to the -migrate-to tenant, report the ID mapping and exit")
+	migrateFromFlag := flag.String("migrate-from", "source", "Credential set of the tenant -migrate and -clone-tenant export from")
+	migrateToFlag := flag.String("migrate-to", "target", "Credential set of the tenant -migrate and -clone-tenant apply to")
+	cloneTenantFlag := flag.String("clone-tenant", "", "Copy the comma-separated resource types (or all) from the -migrate-from tenant to the -migrate-to tenant, rewriting IDs and names with the clone_rewrite.<n> rules, and exit")
+	convertMonacoFlag := flag.String("convert-monaco", "", "Convert the Monaco project in this directory into .tf files and templates in the bundle and exit")
+	exportFlag := flag.String("export", "", "Export the comma-separated resource types (e.g. dashboard,alerting) from the environment into .tf files with import blocks, import them into state, then exit")
+	exportZoneFlag := flag.String("export-zone", "", "Only adopt exported objects referencing this management zone (by name)")
+	exportOwnerFlag := flag.String("export-owner", "", "Only adopt exported objects with this owner or an owner:<name> tag")
+	exportNameFlag := flag.String("export-name", "", "Only adopt exported objects whose name matches this regular expression")
+	flag.Var(cliStateMoves, "state-mv", "Move a state entry as source=destination after a preview and state backup (repeatable), then exit")
+	flag.Var(cliStateRemovals, "state-rm", "Remove a resource from state without destroying it, after a preview and state backup (repeatable), then exit")
+	flag.Var(cliProviderReplacements, "state-replace-provider", "Move state entries from one provider to another as from=to after a preview and state backup, then exit")
+	dryRunFlag := flag.Bool("dry-run", false, "Only preview the -state-mv, -state-rm and -state-replace-provider changes")
+	driftFlag := flag.Bool("drift", false, "Run a refresh-only plan, list resources changed outside Terraform and exit with 0 (no drift), 2 (drift) or 1 (error)")
+	stateAuditFlag := flag.Bool("state-audit", false, "Check state against the live environment for objects deleted outside Terraform and unmanaged objects matching naming_prefix, and exit with 0 (healthy), 2 (findings) or 1 (error)")
+	liveDiffFlag := flag.Bool("live-diff", false, "Show the JSON of each settings object in the configuration side by side with its live value in the environment, and exit with 0 (in sync), 2 (differences) or 1 (error)")
+	inventoryFlag := flag.String("inventory", "", "Count the environment's configuration objects per type, marking those managed by this bundle's state, as 'html' or 'csv' and exit")
+	inventoryOutFlag := flag.String("inventory-out", "", "Write the -inventory report to this file instead of stdout")
+	dashboardPullFlag := flag.String("dashboard-pull", "", "Pull the JSON of the dashboard with this ID into the bundle, declaring and importing a dynatrace_json_dashboard for it when none references the file, and exit")
+	dashboardFileFlag := flag.String("dashboard-file", "", "File -dashboard-pull writes to (default dashboards/<name>.json)")
+	dashboardPreviewFlag := flag.String("dashboard-preview", "", "Show this dashboard JSON file side by side with the live dashboard, and exit with 0 (in sync), 2 (differences) or 1 (error)")
+	dashboardPushFlag := flag.String("dashboard-push", "", "Apply this dashboard JSON file by applying only the dynatrace_json_dashboard referencing it, and exit")
+	validateFlag := flag.Bool("validate", false, "Check formatting and validate the configuration, reporting problems by file and line, and exit")
+	ciLocalFlag := flag.Bool("ci-local", false, "Run the CI checks (fmt, validate, policy, plan) and exit with the failed stage's code, or 2 when the plan has changes")
+	installHookFlag := flag.Bool("install-hook", false, "Install a git pre-push hook that runs -ci-local and exit")
+	showConfigFlag := flag.Bool("show-effective-config", false, "Print the merged configuration (secrets masked) and exit")
 	flag.Parse()
 
 	if *applyFlag && *destroyFlag {
 		log.Fatal("Cannot use both -apply and -destroy flags simultaneously.")
 	}
-
-	terraformPath, err := checkTerraformExecutable()
+	if *allTenantsFlag && *planFlag == *applyFlag {
+		log.Fatal("-all-tenants requires exactly one of -plan or -apply.")
+	}
+	passthrough, err := passthroughArgs()
 	if err != nil {
-		log.Fatalf("Error preparing Terraform executable: %v", err)
+		log.Fatal(err)
+	}
+
+	if err := configureEventRenderers(*eventsFlag, *eventsFileFlag, *eventsAddrFlag); err != nil {
+		log.Fatalf("Error configuring event renderers: %v", err)
+	}
+	defer events.Close()
+
+	ci, _ := strconv.ParseBool(os.Getenv("CI"))
+	nonInteractive = *nonInteractiveFlag || *ciLocalFlag || ci
+
+	if *newFlag != "" {
+		userConfig := make(map[string]string)
+		if err := readUserConfig(userConfig); err != nil {
+			log.Fatalf("Error loading configuration: %v", err)
+		}
+		if err := newPackage(*newFlag, *newDirFlag, userConfig["template_gallery"]); err != nil {
+			log.Fatalf("Error creating package: %v", err)
+		}
+		return
+	}
+
+	if *convertConfigFlag {
+		if err := convertConfigToTOML(configFileName, tomlConfigFileName); err != nil {
+			log.Fatalf("Error converting configuration: %v", err)
+		}
+		return
+	}
+
+	if *lintConfigFlag {
+		if !lintConfig(activeConfigFile()) {
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *forgetCredentialsFlag {
+		if err := forgetSessionCredentials(); err != nil {
+			log.Fatalf("Error clearing cached credentials: %v", err)
+		}
+		return
+	}
+
+	if *installHookFlag {
+		if err := installPrePushHook(); err != nil {
+			log.Fatalf("Error installing pre-push hook: %v", err)
+		}
+		return
 	}
 
-	config, apiToken, oauthClient, err := loadConfig(configFileName)
+	if *historyFlag > 0 {
+		if err := showHistory(auditDirName, *historyFlag); err != nil {
+			log.Fatalf("Error reading history: %v", err)
+		}
+		return
+	}
+
+	if *trendsFlag > 0 {
+		if err := showTrends(auditDirName, *trendsFlag); err != nil {
+			log.Fatalf("Error reading history: %v", err)
+		}
+		return
+	}
+
+	if *detectFlag {
+		if err := runDetect(activeConfigFile()); err != nil {
+			log.Fatalf("Error detecting configuration: %v", err)
+		}
+		return
+	}
+
+	config, apiToken, oauthClient, err := loadConfig(activeConfigFile())
 	if err != nil {
 		log.Fatalf("Error loading configuration: %v", err)
 	}
 
+	if *showConfigFlag {
+		showEffectiveConfig(config)
+		return
+	}
+
+	if *loginFlag {
+		if err := deviceLogin(config); err != nil {
+			exitf(exitAuthFailure, "Login failed: %v", err)
+		}
+		return
+	}
+
+	if err := setupSettings(config); err != nil {
+		log.Fatalf("Error configuring %v", err)
+	}
+
+	terraformPath, err := checkTerraformExecutable(config)
+	if err != nil {
+		log.Fatalf("Error preparing Terraform executable: %v", err)
+	}
+	if terraformPath, err = enterWorkingDir(config, terraformPath); err != nil {
+		log.Fatalf("Error changing working directory: %v", err)
+	}
+	if *convertMonacoFlag != "" {
+		if err := convertMonaco(bundlePath(*convertMonacoFlag)); err != nil {
+			log.Fatalf("Error converting Monaco project: %v", err)
+		}
+		return
+	}
+	if err := setupStateHandling(config); err != nil {
+		log.Fatalf("Error configuring %v", err)
+	}
+	if cliRestoreState != "" {
+		if err := restoreState(cliRestoreState); err != nil {
+			log.Fatalf("Error restoring state: %v", err)
+		}
+		return
+	}
+
 	var logFile *os.File
 	if !*consoleFlag {
 		fmt.Printf("Redirecting Terraform output to %s...\n", logFileName)
@@ -339,16 +1343,245 @@ func main() {
 		defer logFile.Close()
 	}
 
-	setEnvironmentVars(config, apiToken, oauthClient)
+	if *describeFlag != "" {
+		if err := initTerraform(terraformPath, logFile); err != nil {
+			exitf(exitInitFailure, "Error initializing Terraform: %v", err)
+		}
+		if err := runDescribe(terraformPath, logFile, *describeFlag, *describeOutFlag); err != nil {
+			log.Fatalf("Error describing package: %v", err)
+		}
+		return
+	}
+
+	if oauthClient, err = setupCredentials(config, apiToken, oauthClient); err != nil {
+		exitf(exitAuthFailure, "Error configuring %v", err)
+	}
+
+	if *rotateTokenFlag {
+		if err := rotateAPIToken(config); err != nil {
+			log.Fatalf("Error rotating API token: %v", err)
+		}
+		return
+	}
+
+	if err := setupFeatures(config, cliTargets.values); err != nil {
+		log.Fatalf("Error configuring %v", err)
+	}
+	if err := selectReplacements(cliReplacements.values); err != nil {
+		log.Fatalf("Error selecting replacements: %v", err)
+	}
+
+	if err := resolveAccountTenants(config); err != nil {
+		log.Fatalf("Error resolving tenants from account: %v", err)
+	}
+	if *listTenantsFlag {
+		listTenants(config)
+		return
+	}
+
+	if err := setupChangeWindow(*windowEndFlag, config); err != nil {
+		log.Fatalf("Error configuring change window: %v", err)
+	}
+	if !changeWindowEnd.IsZero() {
+		fmt.Printf("Change window ends at %s; apply stops %s before.\n", changeWindowEnd.Format(time.RFC3339), changeWindowMargin)
+	}
+
+	if audit, err = openAuditStore(bundlePath(auditDirName)); err != nil {
+		fmt.Printf("Warning: audit trail disabled: %v\n", err)
+	}
+	defer audit.Close()
+	if err := audit.configureWebhook(config); err != nil {
+		log.Fatalf("Error configuring audit webhook: %v", err)
+	}
+
+	if err := checkCredentials(config, apiToken, oauthClient); err != nil {
+		exitf(exitAuthFailure, "Error: %v", err)
+	}
+
+	if cliStacksAction != "" {
+		os.Exit(runStacks(config, cliStacksAction))
+	}
+	if cliRemoteRun {
+		os.Exit(runRemote())
+	}
+
+	// Arguments after "--" are passed to Terraform as-is
+	if len(passthrough) > 0 {
+		if passthrough[0] != "init" {
+			if err := initTerraform(terraformPath, logFile); err != nil {
+				exitf(exitInitFailure, "Error initializing Terraform: %v", err)
+			}
+		}
+		os.Exit(runPassthrough(terraformPath, logFile, passthrough))
+	}
 
 	if err := initTerraform(terraformPath, logFile); err != nil {
-		log.Fatalf("Error initializing Terraform: %v", err)
+		exitf(exitInitFailure, "Error initializing Terraform: %v", err)
+	}
+
+	switch {
+	case *listWorkspacesFlag:
+		if err := printWorkspaces(terraformPath, logFile); err != nil {
+			log.Fatalf("Failed to list workspaces: %v", err)
+		}
+		return
+	case *newWorkspaceFlag != "":
+		if err := newWorkspace(terraformPath, logFile, *newWorkspaceFlag); err != nil {
+			log.Fatalf("Failed to create workspace: %v", err)
+		}
+		fmt.Printf("Created and selected workspace %s.\n", *newWorkspaceFlag)
+		return
+	case *deleteWorkspaceFlag != "":
+		if err := deleteWorkspaceChecked(terraformPath, logFile, *deleteWorkspaceFlag); err != nil {
+			log.Fatalf("Failed to delete workspace: %v", err)
+		}
+		fmt.Printf("Deleted workspace %s.\n", *deleteWorkspaceFlag)
+		return
+	}
+
+	setupWorkspace(config)
+	setupOutputs(config)
+	if err := ensureWorkspace(terraformPath, logFile); err != nil {
+		log.Fatalf("Error selecting workspace: %v", err)
+	}
+
+	if err := migrateRenamedResources(terraformPath, logFile); err != nil {
+		log.Fatalf("Error migrating renamed resources: %v", err)
+	}
+
+	if err := applyOutputMapping(terraformPath, logFile, config); err != nil {
+		log.Fatalf("Error mapping promoted outputs: %v", err)
+	}
+
+	if len(cliImports.values) > 0 || *importCSVFlag != "" {
+		items, err := importItems(*importCSVFlag)
+		if err != nil {
+			log.Fatalf("Error reading imports: %v", err)
+		}
+		if err := importResources(terraformPath, logFile, items); err != nil {
+			log.Fatalf("Import incomplete: %v", err)
+		}
+		return
+	}
+
+	if *exportFlag != "" {
+		filter, err := newExportFilter(*exportZoneFlag, *exportOwnerFlag, *exportNameFlag)
+		if err != nil {
+			log.Fatalf("Error configuring export filters: %v", err)
+		}
+		if err := runExport(terraformPath, logFile, *exportFlag, filter); err != nil {
+			log.Fatalf("Export incomplete: %v", err)
+		}
+		return
+	}
+
+	if *migrateFlag != "" {
+		if err := runMigration(terraformPath, logFile, *migrateFlag, *migrateFromFlag, *migrateToFlag); err != nil {
+			log.Fatalf("Migration incomplete: %v", err)
+		}
+		return
+	}
+
+	if *cloneTenantFlag != "" {
+		if err := runCloneTenant(terraformPath, logFile, config, *cloneTenantFlag, *migrateFromFlag, *migrateToFlag); err != nil {
+			log.Fatalf("Clone incomplete: %v", err)
+		}
+		return
+	}
+
+	if operations, err := stateOperations(); err != nil {
+		log.Fatalf("Error reading state operations: %v", err)
+	} else if len(operations) > 0 {
+		if err := runStateSurgery(terraformPath, logFile, operations, *dryRunFlag); err != nil {
+			log.Fatalf("State surgery failed: %v", err)
+		}
+		return
+	}
+
+	if *driftFlag {
+		os.Exit(detectDrift(terraformPath, logFile))
+	}
+
+	if *stateAuditFlag {
+		os.Exit(auditState(terraformPath, logFile, config["naming_prefix"]))
+	}
+
+	if *liveDiffFlag {
+		os.Exit(runLiveDiff(terraformPath, logFile))
+	}
+
+	if *inventoryFlag != "" {
+		if err := runInventory(terraformPath, logFile, *inventoryFlag, *inventoryOutFlag); err != nil {
+			log.Fatalf("Inventory failed: %v", err)
+		}
+		return
+	}
+
+	if *dashboardPullFlag != "" {
+		if err := pullDashboard(terraformPath, logFile, *dashboardPullFlag, *dashboardFileFlag); err != nil {
+			log.Fatalf("Dashboard pull failed: %v", err)
+		}
+		return
+	}
+
+	if *dashboardPreviewFlag != "" {
+		os.Exit(previewDashboard(terraformPath, logFile, *dashboardPreviewFlag))
+	}
+
+	if *dashboardPushFlag != "" {
+		if err := pushDashboard(terraformPath, logFile, *dashboardPushFlag); err != nil {
+			explainTerraformError(err)
+			exitf(exitApplyFailure, "Failed to push dashboard: %v", err)
+		}
+		fmt.Println("Completed dashboard push.")
+		return
+	}
+
+	if *validateFlag {
+		if err := validateConfiguration(terraformPath, logFile); err != nil {
+			log.Fatalf("Validation failed: %v", err)
+		}
+		return
+	}
+
+	if *pickTargetsFlag {
+		if err := pickTargets(terraformPath, logFile); err != nil {
+			log.Fatalf("Error selecting targets: %v", err)
+		}
+	}
+
+	if *ciLocalFlag {
+		os.Exit(runCIPipeline(terraformPath, logFile, config))
+	}
+
+	if *gcWorkspacesFlag {
+		if err := collectWorkspaceGarbage(terraformPath, logFile, config); err != nil {
+			log.Fatalf("Failed to clean up workspaces: %v", err)
+		}
+		return
+	}
+
+	if *sharePlanFlag {
+		if err := sharePlan(terraformPath, logFile, *sharePortFlag, *shareTokenFlag, *shareTimeoutFlag); err != nil {
+			log.Fatalf("Failed to share plan: %v", err)
+		}
+		return
+	}
+
+	if *allTenantsFlag {
+		os.Exit(reconcileTenants(terraformPath, logFile, config, *applyFlag))
+	}
+
+	if *planFlag {
+		fmt.Println("\nRunning Terraform plan to preview configuration...")
+		os.Exit(planExitCode(terraformPath, logFile))
 	}
 
 	if *applyFlag {
 		fmt.Println("\nRunning Terraform apply to publish configuration...")
 		if err := publishConfiguration(terraformPath, logFile); err != nil {
-			log.Fatalf("Failed to publish configuration: %v", err)
+			explainTerraformError(err)
+			exitf(exitApplyFailure, "Failed to publish configuration: %v", err)
 		}
 		fmt.Println("Completed Terraform apply.")
 		return
@@ -357,11 +1590,17 @@ func main() {
 	if *destroyFlag {
 		fmt.Println("\nRunning Terraform destroy to remove configuration...")
 		if err := removeConfiguration(terraformPath, logFile); err != nil {
-			log.Fatalf("Failed to remove configuration: %v", err)
+			explainTerraformError(err)
+			exitf(exitDestroyFailure, "Failed to remove configuration: %v", err)
 		}
 		fmt.Println("Completed Terraform destroy.")
 		return
 	}
 
-	displayMenu(terraformPath, logFile)
+	if nonInteractive {
+		log.Fatal("The interactive menu is unavailable in non-interactive mode; use -plan, -apply, -destroy or -share-plan.")
+	}
+
+	monitor := startCredentialMonitor(*revalidateFlag, apiToken, oauthClient)
+	displayMenu(terraformPath, logFile, monitor)
 }
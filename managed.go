@@ -0,0 +1,136 @@
+/**
+* @license
+* Copyright 2020 Dynatrace LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// ============================================================
+// Dynatrace Managed clusters
+// ============================================================
+
+var managedClusterVars = []promptedVar{
+	{"DT_CLUSTER_URL", "Input Dynatrace Managed cluster URL (https://<dynatrace-host>): "},
+	{"DT_CLUSTER_API_TOKEN", "Input Dynatrace Managed cluster API token: "},
+}
+
+// Configure TLS for the wrapper's own API calls and the provider: client
+// certificates from client_cert/client_key, extra trusted CAs from ca_cert, and
+// no verification at all when skip_tls_verify = true (warned about loudly)
+func configureTLS(config map[string]string) error {
+	certFile, keyFile, caFile := config["client_cert"], config["client_key"], config["ca_cert"]
+	skipVerify := config["skip_tls_verify"] == "true"
+	if certFile == "" && keyFile == "" && caFile == "" && !skipVerify {
+		return nil
+	}
+
+	tlsConfig := &tls.Config{}
+	if certFile != "" || keyFile != "" {
+		if certFile == "" || keyFile == "" {
+			return fmt.Errorf("client_cert and client_key must be set together")
+		}
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			return fmt.Errorf("failed to parse client certificate: %w", err)
+		}
+		if time.Now().After(leaf.NotAfter) {
+			return fmt.Errorf("client certificate %s expired on %s", certFile, leaf.NotAfter.Format("2006-01-02"))
+		}
+		if remaining := time.Until(leaf.NotAfter); remaining < tokenExpiryWarning(config) {
+			fmt.Printf("Warning: client certificate %s expires in %d day(s).\n", certFile, int(remaining.Hours()/24))
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+		// Honoured by the Dynatrace provider's HTTP client
+		exportEnv("DYNATRACE_HTTP_CLIENT_CERT", certFile)
+		exportEnv("DYNATRACE_HTTP_CLIENT_KEY", keyFile)
+	}
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return fmt.Errorf("failed to read ca_cert: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("ca_cert %s contains no PEM certificates", caFile)
+		}
+		tlsConfig.RootCAs = pool
+		exportEnv("SSL_CERT_FILE", caFile)
+	}
+	if skipVerify {
+		fmt.Println(strings.Repeat("!", 72))
+		fmt.Println("WARNING: TLS certificate verification is DISABLED (skip_tls_verify = true).")
+		fmt.Println("Credentials are sent to servers whose identity is not verified. Use this")
+		fmt.Println("only for Managed clusters with self-signed certificates on trusted networks.")
+		fmt.Println(strings.Repeat("!", 72))
+		publishf("guard", "warning", "TLS certificate verification is disabled")
+		tlsConfig.InsecureSkipVerify = true
+		exportEnv("DYNATRACE_HTTP_INSECURE", "true")
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	httpClient.Transport = transport
+	return nil
+}
+
+// Pick the first reachable node of managed_nodes as DT_CLUSTER_URL and, with
+// managed_environment_id, derive DT_ENV_URL from it; explicit URLs win
+func resolveManagedNodes(config map[string]string) error {
+	var nodes []string
+	for _, node := range strings.Split(config["managed_nodes"], ",") {
+		if node = strings.TrimRight(strings.TrimSpace(node), "/"); node != "" {
+			nodes = append(nodes, node)
+		}
+	}
+	if len(nodes) == 0 {
+		return nil
+	}
+
+	var failures []string
+	for _, node := range nodes {
+		if _, err := probeTenant(node); err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", node, err))
+			continue
+		}
+		fmt.Printf("Using Managed cluster node %s.\n", node)
+		if _, set := lookupEnv("DT_CLUSTER_URL"); !set && config["DT_CLUSTER_URL"] == "" {
+			exportEnv("DT_CLUSTER_URL", node)
+		}
+		if id := config["managed_environment_id"]; id != "" {
+			if _, set := lookupEnv("DT_ENV_URL"); !set && config["DT_ENV_URL"] == "" {
+				exportEnv("DT_ENV_URL", node+"/e/"+id)
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("no Managed cluster node is reachable:\n  %s", strings.Join(failures, "\n  "))
+}
@@ -0,0 +1,159 @@
+/**
+* @license
+* Copyright 2020 Dynatrace LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ============================================================
+// Migrate state for resources renamed between package versions
+// ============================================================
+
+// Load rename map (old address = new address) shipped with the package
+func loadRenameMap(fileName string) (map[string]string, error) {
+	renames := make(map[string]string)
+
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		oldAddress, newAddress, ok := parseConfigLine(scanner.Text())
+		if ok && newAddress != "" {
+			renames[oldAddress] = newAddress
+		}
+	}
+
+	return renames, scanner.Err()
+}
+
+// List resource addresses currently tracked in state
+func listStateResources(terraformPath string, logFile *os.File) ([]string, error) {
+	release, err := acquireState()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	var stderr bytes.Buffer
+	cmd := terraformCommand(terraformPath, "state", "list")
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if strings.Contains(stderr.String(), "No state file was found") {
+			return nil, nil
+		}
+		if logFile != nil {
+			logFile.WriteString(scrubSecrets(stderr.String()))
+		} else {
+			os.Stderr.WriteString(scrubSecrets(stderr.String()))
+		}
+		return nil, err
+	}
+	return strings.Fields(string(out)), nil
+}
+
+// Check whether a state address is the renamed address or lives below it (module or indexed resource)
+func matchesAddress(address, prefix string) bool {
+	return address == prefix || strings.HasPrefix(address, prefix+".") || strings.HasPrefix(address, prefix+"[")
+}
+
+// Save a copy of the current state before modifying it
+func backupState(terraformPath string, logFile *os.File) (string, error) {
+	out, err := outputTerraformCommand(terraformPath, logFile, "state", "pull")
+	if err != nil {
+		return "", err
+	}
+
+	backupPath := fmt.Sprintf("terraform.tfstate.%s.backup", time.Now().Format("20060102-150405"))
+	if err := os.WriteFile(backupPath, out, 0600); err != nil {
+		return "", err
+	}
+	if stateEncryptionKey != "" {
+		if err := encryptStateFile(backupPath); err != nil {
+			return "", err
+		}
+		backupPath += encryptedStateSuffix
+	}
+	return backupPath, nil
+}
+
+// Move state entries for renamed resources so they are not destroyed and recreated
+func migrateRenamedResources(terraformPath string, logFile *os.File) error {
+	renames, err := loadRenameMap(renameMapFileName)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load %s: %w", renameMapFileName, err)
+	}
+
+	addresses, err := listStateResources(terraformPath, logFile)
+	if err != nil {
+		return fmt.Errorf("failed to list state: %w", err)
+	}
+
+	var pending []string
+	for oldAddress, newAddress := range renames {
+		oldFound, newFound := false, false
+		for _, address := range addresses {
+			oldFound = oldFound || matchesAddress(address, oldAddress)
+			newFound = newFound || matchesAddress(address, newAddress)
+		}
+		if oldFound && !newFound {
+			pending = append(pending, oldAddress)
+		}
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+	sort.Strings(pending)
+
+	fmt.Printf("\nFound %d renamed resource address(es) in state. Migrating...\n", len(pending))
+	backupPath, err := backupState(terraformPath, logFile)
+	if err != nil {
+		return fmt.Errorf("failed to back up state: %w", err)
+	}
+	fmt.Printf("State backed up to %s.\n", backupPath)
+
+	failed := 0
+	for _, oldAddress := range pending {
+		newAddress := renames[oldAddress]
+		if err := executeTerraformCommand(terraformPath, logFile, "state", "mv", oldAddress, newAddress); err != nil {
+			fmt.Printf("  FAILED  %s -> %s (%v)\n", oldAddress, newAddress, err)
+			failed++
+			continue
+		}
+		fmt.Printf("  moved   %s -> %s\n", oldAddress, newAddress)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d move(s) failed; restore with 'terraform state push %s' if needed", failed, len(pending), backupPath)
+	}
+	fmt.Println("Completed state migration.")
+	return nil
+}
@@ -0,0 +1,754 @@
+/**
+* @license
+* Copyright 2020 Dynatrace LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Directory the converted Monaco templates are written to
+const monacoTemplatesDir = "monaco"
+
+var (
+	monacoParamPattern    = regexp.MustCompile(`\{\{\s*\.([A-Za-z_][A-Za-z0-9_]*)\s*\}\}`)
+	monacoTemplatePattern = regexp.MustCompile(`\{\{.*?\}\}`)
+	hclIdentifierPattern  = regexp.MustCompile(`[^A-Za-z0-9_]+`)
+)
+
+// Monaco configuration from a project's config YAML
+type monacoConfig struct {
+	Project    string
+	ID         string
+	Name       string
+	Template   string
+	Parameters map[string]any
+	API        string
+	Schema     string
+	Scope      string
+	Skip       bool
+	Dir        string
+}
+
+// Key other configurations reference a configuration by: its API or schema
+func (c monacoConfig) typeKey() string {
+	if c.Schema != "" {
+		return c.Schema
+	}
+	return c.API
+}
+
+// Terraform resource type the configuration converts to, or "" when unsupported
+func (c monacoConfig) resourceType() string {
+	switch {
+	case c.Schema != "":
+		return "dynatrace_generic_setting"
+	case c.API == "dashboard":
+		return "dynatrace_json_dashboard"
+	}
+	return ""
+}
+
+func (c monacoConfig) resourceName() string {
+	return strings.Trim(hclIdentifierPattern.ReplaceAllString(c.Project+"_"+c.ID, "_"), "_")
+}
+
+func (c monacoConfig) address() string {
+	return c.resourceType() + "." + c.resourceName()
+}
+
+// ============================================================
+// YAML subset
+// ============================================================
+
+// Line of YAML with its indentation
+type yamlLine struct {
+	indent int
+	text   string
+}
+
+// Strip a trailing comment outside quotes
+func stripYAMLComment(line string) string {
+	var quote rune
+	for i, r := range line {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// Parse the block-style YAML Monaco projects are written in: mappings,
+// sequences, plain and quoted scalars, block scalars and flow sequences of
+// scalars. Anchors, tags and multi-document files are not supported
+func parseYAML(content string) (any, error) {
+	var lines []yamlLine
+	for _, raw := range strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n") {
+		if strings.TrimSpace(raw) == "---" {
+			continue
+		}
+		text := strings.TrimRight(raw, " \t")
+		trimmed := strings.TrimLeft(text, " ")
+		if strings.TrimSpace(stripYAMLComment(trimmed)) == "" {
+			// Blank lines are kept for block scalars
+			lines = append(lines, yamlLine{-1, ""})
+			continue
+		}
+		lines = append(lines, yamlLine{len(text) - len(trimmed), trimmed})
+	}
+	p := &yamlParser{lines: lines}
+	p.skipBlank()
+	if p.pos >= len(p.lines) {
+		return nil, nil
+	}
+	value, err := p.parseBlock(p.lines[p.pos].indent)
+	if err != nil {
+		return nil, err
+	}
+	if p.skipBlank(); p.pos < len(p.lines) {
+		return nil, fmt.Errorf("line %d: unexpected indentation", p.pos+1)
+	}
+	return value, nil
+}
+
+type yamlParser struct {
+	lines []yamlLine
+	pos   int
+}
+
+func (p *yamlParser) skipBlank() {
+	for p.pos < len(p.lines) && p.lines[p.pos].indent < 0 {
+		p.pos++
+	}
+}
+
+func (p *yamlParser) parseBlock(indent int) (any, error) {
+	p.skipBlank()
+	if p.pos < len(p.lines) && isYAMLSequenceItem(p.lines[p.pos].text) {
+		return p.parseSequence(indent)
+	}
+	return p.parseMapping(indent)
+}
+
+func isYAMLSequenceItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+func (p *yamlParser) parseSequence(indent int) (any, error) {
+	var items []any
+	for p.skipBlank(); p.pos < len(p.lines); p.skipBlank() {
+		line := p.lines[p.pos]
+		if line.indent != indent || !isYAMLSequenceItem(line.text) {
+			break
+		}
+		rest := strings.TrimLeft(strings.TrimPrefix(line.text, "-"), " ")
+		if strings.TrimSpace(stripYAMLComment(rest)) == "" {
+			p.pos++
+			p.skipBlank()
+			if p.pos >= len(p.lines) || p.lines[p.pos].indent <= indent {
+				items = append(items, nil)
+				continue
+			}
+			item, err := p.parseBlock(p.lines[p.pos].indent)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+			continue
+		}
+		// The item's content continues at the column after "- "
+		p.lines[p.pos] = yamlLine{indent + len(line.text) - len(rest), rest}
+		if _, _, isKey := cutYAMLKey(rest); isKey || isYAMLSequenceItem(rest) {
+			item, err := p.parseBlock(p.lines[p.pos].indent)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+			continue
+		}
+		p.pos++
+		value, err := parseYAMLScalar(stripYAMLComment(rest))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", p.pos, err)
+		}
+		items = append(items, value)
+	}
+	return items, nil
+}
+
+// Split "key: value" at the first ": " (or trailing ":") outside quotes
+func cutYAMLKey(text string) (string, string, bool) {
+	var quote rune
+	for i, r := range text {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == ':' && (i == len(text)-1 || text[i+1] == ' '):
+			key := strings.TrimSpace(text[:i])
+			if unquoted, err := strconv.Unquote(key); err == nil {
+				key = unquoted
+			} else if len(key) > 1 && key[0] == '\'' && key[len(key)-1] == '\'' {
+				key = key[1 : len(key)-1]
+			}
+			return key, strings.TrimSpace(text[i+1:]), true
+		}
+	}
+	return "", "", false
+}
+
+func (p *yamlParser) parseMapping(indent int) (any, error) {
+	mapping := make(map[string]any)
+	for p.skipBlank(); p.pos < len(p.lines); p.skipBlank() {
+		line := p.lines[p.pos]
+		if line.indent < indent {
+			break
+		}
+		if line.indent > indent {
+			return nil, fmt.Errorf("line %d: unexpected indentation", p.pos+1)
+		}
+		key, rest, ok := cutYAMLKey(stripYAMLComment(line.text))
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected key: value, got %q", p.pos+1, line.text)
+		}
+		p.pos++
+
+		switch {
+		case rest == "|" || rest == "|-" || rest == ">" || rest == ">-":
+			mapping[key] = p.parseBlockScalar(indent, rest)
+		case rest != "":
+			value, err := parseYAMLScalar(rest)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", p.pos, err)
+			}
+			mapping[key] = value
+		default:
+			p.skipBlank()
+			// Sequences may sit at the key's own indentation
+			if p.pos < len(p.lines) && (p.lines[p.pos].indent > indent ||
+				p.lines[p.pos].indent == indent && isYAMLSequenceItem(p.lines[p.pos].text)) {
+				value, err := p.parseBlock(p.lines[p.pos].indent)
+				if err != nil {
+					return nil, err
+				}
+				mapping[key] = value
+			} else {
+				mapping[key] = nil
+			}
+		}
+	}
+	return mapping, nil
+}
+
+// Collect the lines of a literal (|) or folded (>) block scalar
+func (p *yamlParser) parseBlockScalar(indent int, style string) string {
+	var parts []string
+	blockIndent := -1
+	for p.pos < len(p.lines) {
+		line := p.lines[p.pos]
+		if line.indent >= 0 && line.indent <= indent {
+			break
+		}
+		if line.indent < 0 {
+			parts = append(parts, "")
+		} else {
+			if blockIndent < 0 {
+				blockIndent = line.indent
+			}
+			parts = append(parts, strings.Repeat(" ", max(line.indent-blockIndent, 0))+line.text)
+		}
+		p.pos++
+	}
+	for len(parts) > 0 && parts[len(parts)-1] == "" {
+		parts = parts[:len(parts)-1]
+	}
+	separator := "\n"
+	if strings.HasPrefix(style, ">") {
+		separator = " "
+	}
+	text := strings.Join(parts, separator)
+	if !strings.HasSuffix(style, "-") {
+		text += "\n"
+	}
+	return text
+}
+
+// Parse a scalar or a flow sequence of scalars
+func parseYAMLScalar(text string) (any, error) {
+	text = strings.TrimSpace(text)
+	switch {
+	case text == "" || text == "~" || text == "null":
+		return nil, nil
+	case strings.HasPrefix(text, "{") && strings.HasSuffix(text, "}"):
+		mapping := map[string]any{}
+		inner := strings.TrimSpace(text[1 : len(text)-1])
+		if inner == "" {
+			return mapping, nil
+		}
+		for _, part := range splitYAMLFlow(inner) {
+			key, rest, ok := cutYAMLKey(strings.TrimSpace(part))
+			if !ok {
+				return nil, fmt.Errorf("expected key: value in %s", text)
+			}
+			value, err := parseYAMLScalar(rest)
+			if err != nil {
+				return nil, err
+			}
+			mapping[key] = value
+		}
+		return mapping, nil
+	case strings.HasPrefix(text, "[") && strings.HasSuffix(text, "]"):
+		items := []any{}
+		inner := strings.TrimSpace(text[1 : len(text)-1])
+		if inner == "" {
+			return items, nil
+		}
+		for _, part := range splitYAMLFlow(inner) {
+			item, err := parseYAMLScalar(part)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		return items, nil
+	case strings.HasPrefix(text, `"`):
+		value, err := strconv.Unquote(text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid quoted string %s", text)
+		}
+		return value, nil
+	case strings.HasPrefix(text, "'"):
+		if len(text) < 2 || !strings.HasSuffix(text, "'") {
+			return nil, fmt.Errorf("invalid quoted string %s", text)
+		}
+		return strings.ReplaceAll(text[1:len(text)-1], "''", "'"), nil
+	case text == "true" || text == "false":
+		return text == "true", nil
+	}
+	if number, err := strconv.ParseInt(text, 10, 64); err == nil {
+		return number, nil
+	}
+	if number, err := strconv.ParseFloat(text, 64); err == nil {
+		return number, nil
+	}
+	return text, nil
+}
+
+// Split the items of a flow collection at top-level commas outside quotes
+func splitYAMLFlow(text string) []string {
+	var parts []string
+	var quote rune
+	start, depth := 0, 0
+	for i, r := range text {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '[' || r == '{':
+			depth++
+		case r == ']' || r == '}':
+			depth--
+		case r == ',' && depth == 0:
+			parts = append(parts, text[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, text[start:])
+}
+
+// ============================================================
+// Monaco project conversion
+// ============================================================
+
+// HCL string literal, escaping template sequences
+func hclString(value string) string {
+	quoted := strconv.Quote(value)
+	return strings.NewReplacer("${", "$${", "%{", "%%{").Replace(quoted)
+}
+
+// Project directories of a Monaco root by project name: the projects of its
+// manifest.yaml, where each subdirectory of a grouping is a project named
+// <group>.<subdirectory>, or the root itself when there is no manifest
+func monacoProjects(root string) (map[string]string, error) {
+	projects := make(map[string]string)
+	content, err := os.ReadFile(filepath.Join(root, "manifest.yaml"))
+	if os.IsNotExist(err) {
+		projects[filepath.Base(root)] = root
+		return projects, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	document, err := parseYAML(string(content))
+	if err != nil {
+		return nil, fmt.Errorf("manifest.yaml: %w", err)
+	}
+	manifest, _ := document.(map[string]any)
+	entries, _ := manifest["projects"].([]any)
+	for _, raw := range entries {
+		entry, _ := raw.(map[string]any)
+		name, _ := entry["name"].(string)
+		path, _ := entry["path"].(string)
+		if name == "" {
+			continue
+		}
+		if path == "" {
+			path = name
+		}
+		dir := filepath.Join(root, filepath.FromSlash(path))
+		if entry["type"] != "grouping" {
+			projects[name] = dir
+			continue
+		}
+		subdirs, err := os.ReadDir(dir)
+		if err != nil {
+			return nil, fmt.Errorf("grouping %s: %w", name, err)
+		}
+		for _, subdir := range subdirs {
+			if subdir.IsDir() {
+				projects[name+"."+subdir.Name()] = filepath.Join(dir, subdir.Name())
+			}
+		}
+	}
+	return projects, nil
+}
+
+// Project a directory belongs to: the one with the deepest directory containing it
+func monacoProjectOf(dir string, projects map[string]string) string {
+	project, depth := "", -1
+	for name, projectDir := range projects {
+		rel, err := filepath.Rel(projectDir, dir)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		if len(projectDir) > depth {
+			project, depth = name, len(projectDir)
+		}
+	}
+	return project
+}
+
+// Read the configurations of every config YAML in the projects below a Monaco root
+func readMonacoConfigs(root string) ([]monacoConfig, error) {
+	projects, err := monacoProjects(root)
+	if err != nil {
+		return nil, err
+	}
+	var configs []monacoConfig
+	err = filepath.WalkDir(root, func(path string, entry os.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		dir := filepath.Dir(path)
+		project := monacoProjectOf(dir, projects)
+		if project == "" {
+			return nil
+		}
+		ext, base := filepath.Ext(path), filepath.Base(path)
+		if ext != ".yaml" && ext != ".yml" || base == "manifest.yaml" || base == "manifest.yml" || strings.HasPrefix(base, "delete.") {
+			return nil
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		document, err := parseYAML(string(content))
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		top, _ := document.(map[string]any)
+		entries, _ := top["configs"].([]any)
+		if len(entries) == 0 {
+			return nil
+		}
+
+		for i, raw := range entries {
+			entry, _ := raw.(map[string]any)
+			body, _ := entry["config"].(map[string]any)
+			config := monacoConfig{Project: project, Dir: dir, Parameters: map[string]any{}}
+			config.ID = fmt.Sprint(entry["id"])
+			if entry["id"] == nil {
+				return fmt.Errorf("%s: config %d has no id", path, i+1)
+			}
+			if name, ok := body["name"]; ok {
+				config.Parameters["name"] = name
+				config.Name = fmt.Sprint(name)
+			}
+			config.Template, _ = body["template"].(string)
+			config.Skip, _ = body["skip"].(bool)
+			if parameters, ok := body["parameters"].(map[string]any); ok {
+				for key, value := range parameters {
+					config.Parameters[key] = value
+				}
+			}
+			switch configType := entry["type"].(type) {
+			case string:
+				config.API = configType
+			case map[string]any:
+				if api, ok := configType["api"].(string); ok {
+					config.API = api
+				} else if api, ok := configType["api"].(map[string]any); ok {
+					config.API, _ = api["name"].(string)
+				}
+				if settings, ok := configType["settings"].(map[string]any); ok {
+					config.Schema, _ = settings["schema"].(string)
+					config.Scope = fmt.Sprint(settings["scope"])
+					if settings["scope"] == nil {
+						config.Scope = "environment"
+					}
+				}
+			}
+			configs = append(configs, config)
+		}
+		return nil
+	})
+	return configs, err
+}
+
+// HCL expression of a Monaco parameter: literal values, environment parameters
+// read now, and references to other converted configurations
+func monacoParameter(value any, config monacoConfig, addresses map[string]string) (string, error) {
+	reference := func(project, typeKey, id, property string) (string, error) {
+		if property != "id" {
+			return "", fmt.Errorf("references to property %q are not supported", property)
+		}
+		address, ok := addresses[project+"/"+typeKey+"/"+id]
+		if !ok {
+			return "", fmt.Errorf("reference to %s/%s/%s, which is not converted", project, typeKey, id)
+		}
+		return address + ".id", nil
+	}
+
+	switch typed := value.(type) {
+	case string:
+		return hclString(typed), nil
+	case bool, int64, float64:
+		return fmt.Sprint(typed), nil
+	case []any:
+		parts := make([]string, len(typed))
+		for i, item := range typed {
+			parts[i] = fmt.Sprint(item)
+		}
+		switch len(parts) {
+		case 2:
+			return reference(config.Project, config.typeKey(), parts[0], parts[1])
+		case 3:
+			return reference(config.Project, parts[0], parts[1], parts[2])
+		case 4:
+			return reference(parts[0], parts[1], parts[2], parts[3])
+		}
+		return "", fmt.Errorf("unsupported list parameter %v", typed)
+	case map[string]any:
+		switch typed["type"] {
+		case "value":
+			return monacoParameter(typed["value"], config, addresses)
+		case "environment":
+			if envValue, ok := os.LookupEnv(fmt.Sprint(typed["name"])); ok {
+				return hclString(envValue), nil
+			}
+			if fallback, ok := typed["default"]; ok {
+				return monacoParameter(fallback, config, addresses)
+			}
+			return "", fmt.Errorf("environment variable %v is not set", typed["name"])
+		case "reference":
+			project, typeKey, id := config.Project, config.typeKey(), fmt.Sprint(typed["configId"])
+			if p, ok := typed["project"].(string); ok {
+				project = p
+			}
+			if t, ok := typed["configType"].(string); ok {
+				typeKey = t
+			}
+			return reference(project, typeKey, id, fmt.Sprint(typed["property"]))
+		}
+		return "", fmt.Errorf("parameter type %v is not supported", typed["type"])
+	}
+	return "", fmt.Errorf("unsupported parameter %v", value)
+}
+
+// Rewrite a Monaco Go template into a Terraform template: {{ .param }} becomes
+// ${param} and Terraform's own template sequences are escaped
+func convertMonacoTemplate(template string) (string, []string, error) {
+	escaped := strings.NewReplacer("${", "$${", "%{", "%%{").Replace(template)
+	seen := make(map[string]bool)
+	var params []string
+	converted := monacoParamPattern.ReplaceAllStringFunc(escaped, func(match string) string {
+		name := monacoParamPattern.FindStringSubmatch(match)[1]
+		if !seen[name] {
+			seen[name] = true
+			params = append(params, name)
+		}
+		return "${" + name + "}"
+	})
+	if leftover := monacoTemplatePattern.FindString(converted); leftover != "" {
+		return "", nil, fmt.Errorf("template construct %s is not supported", leftover)
+	}
+	return converted, params, nil
+}
+
+// Convert one configuration into its resource block, writing its template below
+// monaco/<project>/
+func convertMonacoConfig(config monacoConfig, addresses map[string]string) (string, error) {
+	content, err := os.ReadFile(filepath.Join(config.Dir, config.Template))
+	if err != nil {
+		return "", err
+	}
+	template, params, err := convertMonacoTemplate(string(content))
+	if err != nil {
+		return "", err
+	}
+	width := 0
+	for _, name := range params {
+		width = max(width, len(name))
+	}
+	var vars []string
+	for _, name := range params {
+		value, ok := config.Parameters[name]
+		if !ok {
+			return "", fmt.Errorf("template uses parameter %s, which is not defined", name)
+		}
+		expression, err := monacoParameter(value, config, addresses)
+		if err != nil {
+			return "", fmt.Errorf("parameter %s: %w", name, err)
+		}
+		vars = append(vars, fmt.Sprintf("    %-*s = %s", width, name, expression))
+	}
+
+	templatePath := filepath.ToSlash(filepath.Join(monacoTemplatesDir, config.Project, config.resourceName()+filepath.Ext(config.Template)))
+	if err := os.MkdirAll(filepath.Dir(templatePath), 0755); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(templatePath, []byte(template), 0644); err != nil {
+		return "", err
+	}
+	rendered := fmt.Sprintf("templatefile(%s, {\n%s\n  })", hclString(templatePath), strings.Join(vars, "\n"))
+	if len(vars) == 0 {
+		rendered = fmt.Sprintf("file(%s)", hclString(templatePath))
+	}
+
+	var block strings.Builder
+	fmt.Fprintf(&block, "# Monaco config %s/%s\n", config.Project, config.ID)
+	fmt.Fprintf(&block, "resource %q %q {\n", config.resourceType(), config.resourceName())
+	switch config.resourceType() {
+	case "dynatrace_generic_setting":
+		fmt.Fprintf(&block, "  schema = %s\n  scope  = %s\n  value  = %s\n", hclString(config.Schema), hclString(config.Scope), rendered)
+	case "dynatrace_json_dashboard":
+		fmt.Fprintf(&block, "  contents = %s\n", rendered)
+	}
+	block.WriteString("}\n")
+	return block.String(), nil
+}
+
+// File the resources converted from a Monaco project are written to
+func monacoFileName(project string) string {
+	return "monaco_" + hclIdentifierPattern.ReplaceAllString(project, "_") + ".tf"
+}
+
+// Convert a Monaco project into Terraform: dashboards become
+// dynatrace_json_dashboard and settings dynatrace_generic_setting resources in
+// monaco_<project>.tf, with their templates below monaco/
+func convertMonaco(root string) error {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return err
+	}
+	configs, err := readMonacoConfigs(root)
+	if err != nil {
+		return err
+	}
+	if len(configs) == 0 {
+		return fmt.Errorf("no Monaco configurations found below %s", root)
+	}
+	sort.Slice(configs, func(i, j int) bool {
+		if configs[i].Project != configs[j].Project {
+			return configs[i].Project < configs[j].Project
+		}
+		return configs[i].ID < configs[j].ID
+	})
+
+	addresses := make(map[string]string)
+	for _, config := range configs {
+		if config.resourceType() != "" && !config.Skip {
+			addresses[config.Project+"/"+config.typeKey()+"/"+config.ID] = config.address()
+		}
+		if _, err := os.Stat(monacoFileName(config.Project)); err == nil {
+			return fmt.Errorf("%s already exists; remove it to convert again", monacoFileName(config.Project))
+		}
+	}
+
+	blocks := make(map[string][]string)
+	var skipped []string
+	converted := 0
+	for _, config := range configs {
+		label := config.Project + "/" + config.typeKey() + "/" + config.ID
+		switch {
+		case config.Skip:
+			skipped = append(skipped, label+": skip is set")
+			continue
+		case config.resourceType() == "":
+			skipped = append(skipped, fmt.Sprintf("%s: API %q has no generic Terraform resource; deploy it and use -export", label, config.API))
+			continue
+		}
+		block, err := convertMonacoConfig(config, addresses)
+		if err != nil {
+			skipped = append(skipped, fmt.Sprintf("%s: %v", label, err))
+			continue
+		}
+		blocks[config.Project] = append(blocks[config.Project], block)
+		converted++
+	}
+
+	projects := make([]string, 0, len(blocks))
+	for project := range blocks {
+		projects = append(projects, project)
+	}
+	sort.Strings(projects)
+	for _, project := range projects {
+		fileName := monacoFileName(project)
+		if err := os.WriteFile(fileName, []byte(strings.Join(blocks[project], "\n")), 0644); err != nil {
+			return err
+		}
+		fmt.Printf("Wrote %s (%d resource(s)).\n", fileName, len(blocks[project]))
+	}
+
+	fmt.Printf("Converted %d of %d configuration(s); templates are in %s/.\n", converted, len(configs), monacoTemplatesDir)
+	if len(skipped) > 0 {
+		fmt.Printf("Not converted (%d):\n  %s\n", len(skipped), strings.Join(skipped, "\n  "))
+	}
+	if converted > 0 {
+		fmt.Println("Objects Monaco already deployed still exist; import them (-import ADDRESS=ID) before applying to avoid duplicates.")
+	}
+	return nil
+}
@@ -0,0 +1,174 @@
+/**
+* @license
+* Copyright 2020 Dynatrace LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ============================================================
+// Periodic credential validation during interactive sessions
+// ============================================================
+
+// Background validator that re-checks credentials and records a warning banner
+type credentialMonitor struct {
+	mu             sync.Mutex
+	banner         string
+	baselineScopes []string
+	apiToken       bool
+	oauthClient    bool
+}
+
+// Start validating credentials on the given interval; returns nil when disabled
+func startCredentialMonitor(interval time.Duration, apiToken, oauthClient bool) *credentialMonitor {
+	if interval <= 0 || (!apiToken && !oauthClient) {
+		return nil
+	}
+
+	m := &credentialMonitor{apiToken: apiToken, oauthClient: oauthClient}
+	go func() {
+		m.check()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			m.check()
+		}
+	}()
+	return m
+}
+
+// Current warning banner, empty if credentials are still valid
+func (m *credentialMonitor) Banner() string {
+	if m == nil {
+		return ""
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.banner
+}
+
+// Forget the previous scope baseline after credentials were reloaded and re-check
+func (m *credentialMonitor) Reset(apiToken, oauthClient bool) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	m.apiToken, m.oauthClient = apiToken, oauthClient
+	m.baselineScopes = nil
+	m.banner = ""
+	m.mu.Unlock()
+	go m.check()
+}
+
+// Validate credentials once and update the banner
+func (m *credentialMonitor) check() {
+	m.mu.Lock()
+	apiToken, oauthClient := m.apiToken, m.oauthClient
+	m.mu.Unlock()
+
+	var problems []string
+	if apiToken {
+		if problem := m.checkAPIToken(); problem != "" {
+			problems = append(problems, problem)
+		}
+	}
+	if oauthClient {
+		if problem := checkOAuthClient(); problem != "" {
+			problems = append(problems, problem)
+		}
+	}
+
+	for _, problem := range problems {
+		publishf("validator", "warning", "%s", problem)
+	}
+	if len(problems) == 0 {
+		publishf("validator", "info", "Credentials are valid")
+	}
+
+	m.mu.Lock()
+	m.banner = strings.Join(problems, "\n")
+	m.mu.Unlock()
+}
+
+// Check the API token is still valid and its scopes are unchanged
+func (m *credentialMonitor) checkAPIToken() string {
+	info, err := lookupAPIToken(getEnv("DT_ENV_URL"), getEnv("DT_API_TOKEN"))
+	var apiErr *apiError
+	if errors.As(err, &apiErr) && (apiErr.StatusCode == 401 || apiErr.StatusCode == 403 || apiErr.StatusCode == 404) {
+		return "Dynatrace API token has been revoked or is no longer valid."
+	}
+	if err != nil {
+		// Transient network problems should not raise an alarm
+		return ""
+	}
+	if !info.Enabled {
+		return "Dynatrace API token has been disabled."
+	}
+	if info.ExpirationDate != "" {
+		if expiry, err := time.Parse(time.RFC3339, info.ExpirationDate); err == nil && time.Now().After(expiry) {
+			return "Dynatrace API token has expired."
+		}
+	}
+
+	scopes := append([]string(nil), info.Scopes...)
+	sort.Strings(scopes)
+	m.mu.Lock()
+	baseline := m.baselineScopes
+	if baseline == nil {
+		m.baselineScopes = scopes
+	}
+	m.mu.Unlock()
+	if baseline == nil {
+		return ""
+	}
+	if removed := missingScopes(baseline, scopes); len(removed) > 0 {
+		return fmt.Sprintf("Dynatrace API token scopes changed; no longer granted: %s", strings.Join(removed, ", "))
+	}
+	return ""
+}
+
+// Check the OAuth client can still obtain an access token
+func checkOAuthClient() string {
+	_, err := requestOAuthToken(getEnv("DT_CLIENT_ID"), getEnv("DT_CLIENT_SECRET"), getEnv("DT_ACCOUNT_ID"), "")
+	var apiErr *apiError
+	if errors.As(err, &apiErr) && apiErr.StatusCode >= 400 && apiErr.StatusCode < 500 {
+		return "Dynatrace OAuth client credentials have been revoked or are no longer valid."
+	}
+	return ""
+}
+
+// Scopes in required that are absent from granted
+func missingScopes(required, granted []string) []string {
+	grantedSet := make(map[string]bool, len(granted))
+	for _, scope := range granted {
+		grantedSet[scope] = true
+	}
+
+	var missing []string
+	for _, scope := range required {
+		if !grantedSet[scope] {
+			missing = append(missing, scope)
+		}
+	}
+	return missing
+}
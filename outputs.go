@@ -0,0 +1,93 @@
+/**
+* @license
+* Copyright 2020 Dynatrace LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// File the outputs are written to after apply (outputs_file), empty to only print them
+var outputsFile string
+
+// ============================================================
+// Outputs after apply
+// ============================================================
+
+// Read outputs_file
+func setupOutputs(config map[string]string) {
+	outputsFile = strings.TrimSpace(config["outputs_file"])
+}
+
+// Print the outputs of the current workspace, masking sensitive values, and write
+// them as returned by terraform output -json to outputs_file when configured
+func surfaceOutputs(terraformPath string, logFile *os.File) error {
+	out, err := outputTerraformCommand(terraformPath, logFile, "output", "-json")
+	if err != nil {
+		return fmt.Errorf("failed to read outputs: %w", err)
+	}
+	var outputs map[string]struct {
+		Sensitive bool            `json:"sensitive"`
+		Value     json.RawMessage `json:"value"`
+	}
+	if err := json.Unmarshal(out, &outputs); err != nil {
+		return fmt.Errorf("failed to parse outputs: %w", err)
+	}
+	if len(outputs) == 0 {
+		return nil
+	}
+
+	names := make([]string, 0, len(outputs))
+	for name := range outputs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Println("\nOutputs:")
+	for _, name := range names {
+		output := outputs[name]
+		var text string
+		switch {
+		case output.Sensitive:
+			text = "(sensitive)"
+		case json.Unmarshal(output.Value, &text) == nil:
+			// Strings such as dashboard URLs are printed without quotes
+		default:
+			var indented bytes.Buffer
+			if json.Indent(&indented, output.Value, "  ", "  ") == nil {
+				text = indented.String()
+			} else {
+				text = string(output.Value)
+			}
+		}
+		fmt.Printf("  %s = %s\n", name, text)
+	}
+
+	if outputsFile != "" {
+		// The file holds sensitive values too, for downstream automation
+		if err := os.WriteFile(outputsFile, out, 0600); err != nil {
+			return fmt.Errorf("failed to write %s: %w", outputsFile, err)
+		}
+		fmt.Printf("Outputs written to %s.\n", outputsFile)
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+/**
+* @license
+* Copyright 2020 Dynatrace LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"slices"
+	"strings"
+)
+
+// ============================================================
+// Pass-through of arbitrary Terraform commands
+// ============================================================
+
+// Arguments following a literal "--" on the command line; any other argument
+// left over after the flags is refused rather than run as a Terraform command
+func passthroughArgs() ([]string, error) {
+	rest := flag.Args()
+	if len(rest) == 0 {
+		return nil, nil
+	}
+	if at := len(os.Args) - len(rest); at > 1 && os.Args[at-1] == "--" {
+		return rest, nil
+	}
+	return nil, fmt.Errorf("unexpected argument %q; pass Terraform commands after --, as in: -- %s", rest[0], strings.Join(rest, " "))
+}
+
+// Whether a Terraform command changes the state, so it must run in the
+// configured workspace against state recorded for DT_ENV_URL
+func changesState(args []string) bool {
+	switch args[0] {
+	case "apply", "destroy", "import", "refresh", "taint", "untaint":
+		return true
+	case "state":
+		return len(args) > 1 && slices.Contains([]string{"mv", "rm", "push", "replace-provider"}, args[1])
+	}
+	return false
+}
+
+// Run the arguments following "--" as a Terraform command with the wrapper's
+// environment, showing its output on the console and copying it to the log
+// file; returns the command's exit code
+func runPassthrough(terraformPath string, logFile *os.File, args []string) int {
+	var stdout, stderr io.Writer = os.Stdout, os.Stderr
+	if logFile != nil {
+		fmt.Fprintf(logFile, "\n$ terraform %s\n", strings.Join(args, " "))
+		stdout, stderr = io.MultiWriter(os.Stdout, logFile), io.MultiWriter(os.Stderr, logFile)
+	}
+	scrubbedStdout, scrubbedStderr := newScrubWriter(stdout), newScrubWriter(stderr)
+
+	if changesState(args) {
+		err := ensureWorkspace(terraformPath, logFile)
+		if err == nil {
+			err = checkStateTarget(terraformPath, logFile)
+		}
+		if err == nil && (args[0] == "apply" || args[0] == "destroy") {
+			err = checkChangeFreeze(args[0])
+		}
+		if err != nil {
+			recordAudit("terraform "+args[0], err)
+			fmt.Fprintf(os.Stderr, "Not running terraform %s: %v\n", args[0], err)
+			return 1
+		}
+	}
+
+	cmd := terraformCommand(terraformPath, args...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = scrubbedStdout
+	cmd.Stderr = scrubbedStderr
+
+	if args[0] == "apply" || args[0] == "destroy" {
+		if err := snapshotLocalState(); err != nil {
+			recordAudit("terraform "+args[0], err)
+			fmt.Fprintf(os.Stderr, "Not running terraform %s: %v\n", args[0], err)
+			return 1
+		}
+	}
+	release, err := acquireState()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to run terraform %s: %v\n", args[0], err)
+		return 1
+	}
+	publishf("runner", "start", "Running terraform %s", args[0])
+	err = cmd.Run()
+	release()
+	scrubbedStdout.Flush()
+	scrubbedStderr.Flush()
+	recordAudit("terraform "+args[0], err)
+
+	var exitErr *exec.ExitError
+	switch {
+	case errors.As(err, &exitErr):
+		publishf("runner", "error", "terraform %s exited with code %d", args[0], exitErr.ExitCode())
+		return exitErr.ExitCode()
+	case err != nil:
+		fmt.Fprintf(os.Stderr, "Failed to run terraform %s: %v\n", args[0], err)
+		return 1
+	}
+	publishf("runner", "done", "terraform %s completed", args[0])
+	return 0
+}
+
+// Attach terraform console to the terminal with the wrapper's environment and
+// variables; its output is neither logged nor scrubbed since it is interactive
+func openConsole(terraformPath string, logFile *os.File) error {
+	if nonInteractive {
+		return fmt.Errorf("terraform console is unavailable in non-interactive mode")
+	}
+	if err := ensureWorkspace(terraformPath, logFile); err != nil {
+		return err
+	}
+	cmd := terraformCommand(terraformPath, append([]string{"console"}, variableArgs...)...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+
+	// Ctrl+C belongs to the console; the wrapper must survive it
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	defer signal.Stop(interrupts)
+
+	release, err := acquireState()
+	if err != nil {
+		return err
+	}
+	defer release()
+	fmt.Println("Starting terraform console; type exit or press Ctrl+D to return to the menu.")
+	err = cmd.Run()
+	recordAudit("terraform console", err)
+	return err
+}
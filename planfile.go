@@ -0,0 +1,203 @@
+/**
+* @license
+* Copyright 2020 Dynatrace LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Prefix of the plan written by the plan step and applied by the apply step
+const savedPlanFilePrefix = "tfplan."
+
+// Saved plans older than this are not applied (plan_max_age; 0 disables the check)
+var planMaxAge = time.Hour
+
+// ============================================================
+// Saved plan files
+// ============================================================
+
+// Saved plan of the current workspace; each workspace keeps its own, so planning
+// every tenant or switching workspaces does not replace another tenant's plan
+func savedPlanFile() string {
+	return savedPlanFilePrefix + currentWorkspace()
+}
+
+// Metadata recording what the current workspace's saved plan was created from
+func savedPlanMetaFile() string {
+	return savedPlanFile() + ".meta"
+}
+
+// Read plan_max_age
+func setupSavedPlans(config map[string]string) error {
+	planMaxAge = time.Hour
+	if value := config["plan_max_age"]; value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid plan_max_age: %w", err)
+		}
+		planMaxAge = parsed
+	}
+	return nil
+}
+
+// Hash of everything a plan depends on besides the state: the configuration
+// files, the variables passed to Terraform, the environment and the targets
+func planFingerprint() (string, error) {
+	hash := sha256.New()
+	err := filepath.WalkDir(".", func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if path != "." && strings.HasPrefix(entry.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		name := entry.Name()
+		if strings.HasSuffix(name, ".tf") || strings.HasSuffix(name, ".tf.json") ||
+			strings.HasSuffix(name, ".tfvars") || strings.HasSuffix(name, ".tfvars.json") {
+			content, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(hash, "file %s %x\n", filepath.ToSlash(path), sha256.Sum256(content))
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	if content, err := os.ReadFile(".terraform.lock.hcl"); err == nil {
+		fmt.Fprintf(hash, "lock %x\n", sha256.Sum256(content))
+	}
+
+	var vars []string
+	for _, entry := range terraformEnv() {
+		if strings.HasPrefix(entry, "TF_VAR_") {
+			vars = append(vars, entry)
+		}
+	}
+	sort.Strings(vars)
+	for _, entry := range vars {
+		fmt.Fprintf(hash, "var %s\n", entry)
+	}
+	for _, arg := range variableArgs {
+		varFile, isFile := strings.CutPrefix(arg, "-var-file=")
+		if !isFile {
+			continue
+		}
+		if content, err := os.ReadFile(varFile); err == nil {
+			fmt.Fprintf(hash, "var-file %s %x\n", varFile, sha256.Sum256(content))
+		}
+	}
+	fmt.Fprintf(hash, "args %s %s\n", strings.Join(replaceArgs(), " "), strings.Join(variableArgs, " "))
+	fmt.Fprintf(hash, "env %s\nworkspace %s\ntargets %s\n",
+		hashEnvironmentURL(getEnv("DT_ENV_URL")), currentWorkspace(), strings.Join(targetArgs(), " "))
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// Plan with the run's parallelism, targets, replacements and variables into
+// planFileName, through the plan checks when any are enabled
+func writePlan(terraformPath string, logFile *os.File, planFileName string) error {
+	if planChecksEnabled() {
+		planFile, err := planWithExclusions(terraformPath, logFile)
+		if err != nil {
+			return err
+		}
+		return os.Rename(planFile, planFileName)
+	}
+	args := append([]string{"plan", "-out=" + planFileName}, parallelismArgs()...)
+	args = append(args, targetArgs()...)
+	args = append(args, replaceArgs()...)
+	args = append(args, variableArgs...)
+	return executeTerraformCommand(terraformPath, logFile, args...)
+}
+
+// Plan to the saved plan file (verifying exclusions, scopes and schemas when enabled),
+// record what it was created from and print its summary
+func savePlan(terraformPath string, logFile *os.File) error {
+	removeSavedPlan()
+	planFileName := savedPlanFile()
+	if err := writePlan(terraformPath, logFile, planFileName); err != nil {
+		return err
+	}
+
+	fingerprint, err := planFingerprint()
+	if err != nil {
+		return fmt.Errorf("failed to fingerprint plan inputs: %w", err)
+	}
+	meta := fmt.Sprintf("# Inputs of %s; the plan is not applied once they change\ncreated = %s\nfingerprint = %s\n",
+		planFileName, time.Now().UTC().Format(time.RFC3339), fingerprint)
+	if err := os.WriteFile(savedPlanMetaFile(), []byte(meta), 0600); err != nil {
+		return err
+	}
+
+	fmt.Printf("Plan saved to %s; the next apply in workspace %s applies exactly these changes:\n", planFileName, currentWorkspace())
+	return renderPlanSummary(terraformPath, logFile, planFileName)
+}
+
+// Report whether a saved plan is waiting to be applied in the current workspace,
+// failing when it is stale
+func checkSavedPlan() (bool, error) {
+	planFileName, metaFileName := savedPlanFile(), savedPlanMetaFile()
+	if _, err := os.Stat(planFileName); os.IsNotExist(err) {
+		return false, nil
+	}
+
+	meta := make(map[string]string)
+	if file, err := os.Open(metaFileName); err == nil {
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			if key, value, ok := parseConfigLine(scanner.Text()); ok {
+				meta[key] = value
+			}
+		}
+		file.Close()
+	}
+	created, err := time.Parse(time.RFC3339, meta["created"])
+	if err != nil {
+		return false, fmt.Errorf("saved plan %s has no readable %s; run plan again", planFileName, metaFileName)
+	}
+	if age := time.Since(created); planMaxAge > 0 && age > planMaxAge {
+		return false, fmt.Errorf("saved plan %s is %s old (plan_max_age %s); run plan again", planFileName, age.Round(time.Minute), planMaxAge)
+	}
+	fingerprint, err := planFingerprint()
+	if err != nil {
+		return false, fmt.Errorf("failed to fingerprint plan inputs: %w", err)
+	}
+	if fingerprint != meta["fingerprint"] {
+		return false, fmt.Errorf("saved plan %s is stale: configuration, variables, environment or workspace changed since it was created; run plan again", planFileName)
+	}
+	return true, nil
+}
+
+// Delete the current workspace's saved plan once it has been applied or replaced
+func removeSavedPlan() {
+	os.Remove(savedPlanFile())
+	os.Remove(savedPlanMetaFile())
+}
@@ -0,0 +1,142 @@
+/**
+* @license
+* Copyright 2020 Dynatrace LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckSavedPlan(t *testing.T) {
+	write := func(t *testing.T, name, content string) {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		change func(t *testing.T)
+		want   string
+	}{
+		{"unchanged", func(t *testing.T) {}, ""},
+		{"edited configuration", func(t *testing.T) { write(t, "main.tf", "# edited\n") }, "stale"},
+		{"new module file", func(t *testing.T) { write(t, "modules/alerting/main.tf", "# added\n") }, "stale"},
+		{"new tfvars", func(t *testing.T) { write(t, "prod.tfvars", "name = \"prod\"\n") }, "stale"},
+		{"edited var file", func(t *testing.T) { write(t, "extra.vars", "name = \"other\"\n") }, "stale"},
+		{"upgraded providers", func(t *testing.T) { write(t, ".terraform.lock.hcl", "# upgraded\n") }, "stale"},
+		{"new TF_VAR", func(t *testing.T) { t.Setenv("TF_VAR_name", "other") }, "stale"},
+		{"exported TF_VAR", func(t *testing.T) { exportEnv("TF_VAR_name", "other") }, "stale"},
+		{"other -var", func(t *testing.T) { variableArgs = []string{"-var-file=extra.vars", "-var=name=other"} }, "stale"},
+		{"other environment", func(t *testing.T) { exportEnv("DT_ENV_URL", "https://def67890.live.dynatrace.com") }, "stale"},
+		{"same environment with a trailing slash", func(t *testing.T) { exportEnv("DT_ENV_URL", "https://ABC12345.live.dynatrace.com/") }, ""},
+		{"other targets", func(t *testing.T) { selectedTargets = []string{"dynatrace_alerting.a"} }, "stale"},
+		{"replacements", func(t *testing.T) { replaceAddresses = []string{"dynatrace_alerting.a"} }, "stale"},
+		{"provider cache", func(t *testing.T) { write(t, ".terraform/modules/x/main.tf", "# cached\n") }, ""},
+		{"unrelated file", func(t *testing.T) { write(t, "README.md", "# notes\n") }, ""},
+		{"expired", func(t *testing.T) { planMaxAge = time.Minute }, "old"},
+		{"lost metadata", func(t *testing.T) { os.Remove(savedPlanMetaFile()) }, "no readable"},
+		{"edited fingerprint", func(t *testing.T) {
+			content, _ := os.ReadFile(savedPlanMetaFile())
+			write(t, savedPlanMetaFile(), strings.Replace(string(content), "fingerprint = ", "fingerprint = 0", 1))
+		}, "stale"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Chdir(t.TempDir())
+			t.Setenv("DT_ENV_URL", "https://abc12345.live.dynatrace.com")
+			t.Setenv("TF_WORKSPACE", "")
+			t.Cleanup(func() {
+				clearExportedEnv()
+				variableArgs, selectedTargets, replaceAddresses = nil, nil, nil
+				planMaxAge = time.Hour
+			})
+			variableArgs = []string{"-var-file=extra.vars"}
+			write(t, "main.tf", "resource \"dynatrace_alerting\" \"a\" {}\n")
+			write(t, "extra.vars", "name = \"prod\"\n")
+
+			fingerprint, err := planFingerprint()
+			if err != nil {
+				t.Fatalf("planFingerprint: %v", err)
+			}
+			write(t, savedPlanFile(), "plan")
+			created := time.Now().Add(-2 * time.Minute).UTC().Format(time.RFC3339)
+			write(t, savedPlanMetaFile(), fmt.Sprintf("created = %s\nfingerprint = %s\n", created, fingerprint))
+
+			test.change(t)
+			saved, err := checkSavedPlan()
+			switch {
+			case test.want == "" && (err != nil || !saved):
+				t.Errorf("checkSavedPlan() = %v, %v; want a usable plan", saved, err)
+			case test.want != "" && (err == nil || !strings.Contains(err.Error(), test.want)):
+				t.Errorf("checkSavedPlan() = %v, %v; want an error containing %q", saved, err, test.want)
+			}
+		})
+	}
+}
+
+func TestCheckSavedPlanWithoutPlan(t *testing.T) {
+	t.Chdir(t.TempDir())
+	if saved, err := checkSavedPlan(); saved || err != nil {
+		t.Errorf("checkSavedPlan() = %v, %v; want no saved plan", saved, err)
+	}
+}
+
+func TestCheckSavedPlanPerWorkspace(t *testing.T) {
+	t.Chdir(t.TempDir())
+	t.Setenv("DT_ENV_URL", "https://abc12345.live.dynatrace.com")
+	t.Cleanup(clearExportedEnv)
+	if err := os.WriteFile("main.tf", []byte("resource \"dynatrace_alerting\" \"a\" {}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Plan two tenants in turn, as -all-tenants -plan does
+	tenants := map[string]string{"prod": "https://abc12345.live.dynatrace.com", "staging": "https://def67890.live.dynatrace.com"}
+	for _, workspace := range []string{"prod", "staging"} {
+		t.Setenv("TF_WORKSPACE", workspace)
+		exportEnv("DT_ENV_URL", tenants[workspace])
+		fingerprint, err := planFingerprint()
+		if err != nil {
+			t.Fatalf("planFingerprint: %v", err)
+		}
+		created := time.Now().UTC().Format(time.RFC3339)
+		os.WriteFile(savedPlanFile(), []byte("plan"), 0644)
+		os.WriteFile(savedPlanMetaFile(), []byte(fmt.Sprintf("created = %s\nfingerprint = %s\n", created, fingerprint)), 0644)
+	}
+
+	for _, workspace := range []string{"prod", "staging"} {
+		t.Setenv("TF_WORKSPACE", workspace)
+		exportEnv("DT_ENV_URL", tenants[workspace])
+		if saved, err := checkSavedPlan(); !saved || err != nil {
+			t.Errorf("workspace %s: checkSavedPlan() = %v, %v; want its own plan", workspace, saved, err)
+		}
+	}
+
+	t.Setenv("TF_WORKSPACE", "dev")
+	if saved, err := checkSavedPlan(); saved || err != nil {
+		t.Errorf("workspace dev: checkSavedPlan() = %v, %v; want no saved plan", saved, err)
+	}
+}
@@ -0,0 +1,266 @@
+/**
+* @license
+* Copyright 2020 Dynatrace LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// Attribute changes shown per resource before the rest is only counted
+const maxAttributeDiffs = 20
+
+// Longest attribute value shown in a diff
+const maxDiffValueLength = 60
+
+// Changes of a saved plan with the attribute values before and after
+type planDiff struct {
+	ResourceChanges []struct {
+		Address string `json:"address"`
+		Type    string `json:"type"`
+		Change  struct {
+			Actions         []string `json:"actions"`
+			Before          any      `json:"before"`
+			After           any      `json:"after"`
+			AfterUnknown    any      `json:"after_unknown"`
+			BeforeSensitive any      `json:"before_sensitive"`
+			AfterSensitive  any      `json:"after_sensitive"`
+		} `json:"change"`
+	} `json:"resource_changes"`
+}
+
+// Kinds of change in the order the summary lists them, with their marker and color
+var planActionKinds = []struct {
+	name   string
+	marker string
+	color  string
+}{
+	{"add", "+", "\033[32m"},
+	{"change", "~", "\033[33m"},
+	{"replace", "±", "\033[35m"},
+	{"destroy", "-", "\033[31m"},
+}
+
+// ============================================================
+// Plan summary
+// ============================================================
+
+// Kind of change for a resource's planned actions, or "" when nothing changes
+func planActionKind(actions []string) string {
+	switch strings.Join(actions, ",") {
+	case "create":
+		return "add"
+	case "update":
+		return "change"
+	case "delete":
+		return "destroy"
+	case "delete,create", "create,delete":
+		return "replace"
+	}
+	return ""
+}
+
+// Flatten nested objects and lists into dotted attribute paths
+func flattenAttributes(prefix string, value any, out map[string]any) {
+	switch value := value.(type) {
+	case map[string]any:
+		for key, nested := range value {
+			path := key
+			if prefix != "" {
+				path = prefix + "." + key
+			}
+			flattenAttributes(path, nested, out)
+		}
+	case []any:
+		for i, nested := range value {
+			flattenAttributes(fmt.Sprintf("%s[%d]", prefix, i), nested, out)
+		}
+	default:
+		if prefix != "" {
+			out[prefix] = value
+		}
+	}
+}
+
+// Whether a path is marked in a sensitive or unknown structure, which holds
+// true either at the attribute itself or at one of its parents
+func markedAttribute(marks map[string]any, path string) bool {
+	for marked, value := range marks {
+		if value == true && (marked == path || strings.HasPrefix(path, marked+".") || strings.HasPrefix(path, marked+"[")) {
+			return true
+		}
+	}
+	return false
+}
+
+// Attribute value as shown in a diff
+func formatDiffValue(value any) string {
+	encoded, _ := json.Marshal(value)
+	text := string(encoded)
+	if len(text) > maxDiffValueLength {
+		text = text[:maxDiffValueLength-3] + "..."
+	}
+	return text
+}
+
+// Attribute-level changes between before and after of an updated resource
+func attributeDiffs(before, after, afterUnknown, beforeSensitive, afterSensitive any) []string {
+	oldValues, newValues := make(map[string]any), make(map[string]any)
+	flattenAttributes("", before, oldValues)
+	flattenAttributes("", after, newValues)
+	unknown, sensitive := make(map[string]any), make(map[string]any)
+	flattenAttributes("", afterUnknown, unknown)
+	flattenAttributes("", beforeSensitive, sensitive)
+	flattenAttributes("", afterSensitive, sensitive)
+	if afterUnknown == true {
+		unknown[""] = true
+	}
+
+	paths := make(map[string]bool)
+	for path := range oldValues {
+		paths[path] = true
+	}
+	for path := range newValues {
+		paths[path] = true
+	}
+	for path, value := range unknown {
+		if value == true {
+			paths[path] = true
+		}
+	}
+	sorted := make([]string, 0, len(paths))
+	for path := range paths {
+		sorted = append(sorted, path)
+	}
+	sort.Strings(sorted)
+
+	var diffs []string
+	for _, path := range sorted {
+		oldValue, hadValue := oldValues[path]
+		newValue, hasValue := newValues[path]
+		newText := formatDiffValue(newValue)
+		switch {
+		case markedAttribute(unknown, path):
+			newText = "(known after apply)"
+		case markedAttribute(sensitive, path):
+			if hadValue && hasValue && formatDiffValue(oldValue) == newText {
+				continue
+			}
+			diffs = append(diffs, fmt.Sprintf("~ %s: (sensitive value)", path))
+			continue
+		case hadValue && hasValue && formatDiffValue(oldValue) == newText:
+			continue
+		}
+		switch {
+		case !hadValue || oldValue == nil:
+			diffs = append(diffs, fmt.Sprintf("+ %s: %s", path, newText))
+		case !hasValue && !markedAttribute(unknown, path):
+			diffs = append(diffs, fmt.Sprintf("- %s: %s", path, formatDiffValue(oldValue)))
+		default:
+			diffs = append(diffs, fmt.Sprintf("~ %s: %s → %s", path, formatDiffValue(oldValue), newText))
+		}
+	}
+	return diffs
+}
+
+// Print the changes of a saved plan grouped by resource type, with the changed
+// attributes of updated resources; colored when writing to a terminal
+func renderPlanSummary(terraformPath string, logFile *os.File, planFile string) error {
+	out, err := outputTerraformCommand(terraformPath, logFile, "show", "-json", planFile)
+	if err != nil {
+		return fmt.Errorf("failed to read plan: %w", err)
+	}
+	var plan planDiff
+	if err := json.Unmarshal(out, &plan); err != nil {
+		return fmt.Errorf("failed to parse plan: %w", err)
+	}
+	color := term.IsTerminal(int(os.Stdout.Fd())) && os.Getenv("NO_COLOR") == ""
+	paint := func(code, text string) string {
+		if !color {
+			return text
+		}
+		return code + text + "\033[0m"
+	}
+
+	totals := make(map[string]int)
+	byType := make(map[string][]int)
+	var types []string
+	for i, change := range plan.ResourceChanges {
+		kind := planActionKind(change.Change.Actions)
+		if kind == "" {
+			continue
+		}
+		totals[kind]++
+		if _, found := byType[change.Type]; !found {
+			types = append(types, change.Type)
+		}
+		byType[change.Type] = append(byType[change.Type], i)
+	}
+	if len(types) == 0 {
+		fmt.Println("No changes. The Dynatrace configuration matches the bundle.")
+		return nil
+	}
+	sort.Strings(types)
+
+	countText := func(counts map[string]int) string {
+		var parts []string
+		for _, kind := range planActionKinds {
+			if counts[kind.name] > 0 {
+				parts = append(parts, paint(kind.color, fmt.Sprintf("%d to %s", counts[kind.name], kind.name)))
+			}
+		}
+		return strings.Join(parts, ", ")
+	}
+	fmt.Printf("Plan: %s\n", countText(totals))
+
+	for _, resourceType := range types {
+		counts := make(map[string]int)
+		for _, i := range byType[resourceType] {
+			counts[planActionKind(plan.ResourceChanges[i].Change.Actions)]++
+		}
+		fmt.Printf("\n%s (%s)\n", resourceType, countText(counts))
+		for _, i := range byType[resourceType] {
+			change := plan.ResourceChanges[i]
+			kind := planActionKind(change.Change.Actions)
+			for _, k := range planActionKinds {
+				if k.name == kind {
+					fmt.Printf("  %s %s\n", paint(k.color, k.marker), change.Address)
+				}
+			}
+			if kind != "change" {
+				continue
+			}
+			diffs := attributeDiffs(change.Change.Before, change.Change.After, change.Change.AfterUnknown,
+				change.Change.BeforeSensitive, change.Change.AfterSensitive)
+			for n, diff := range diffs {
+				if n == maxAttributeDiffs {
+					fmt.Printf("      ... and %d more attribute change(s)\n", len(diffs)-n)
+					break
+				}
+				fmt.Printf("      %s\n", diff)
+			}
+		}
+	}
+	renderPlanImpact(plan)
+	return nil
+}
@@ -0,0 +1,241 @@
+/**
+* @license
+* Copyright 2020 Dynatrace LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Scopes the Dynatrace provider needs for typical packages; override with required_scopes
+var defaultRequiredScopes = []string{"ReadConfig", "WriteConfig", "settings.read", "settings.write"}
+
+// Days before expiry an API token warning is printed by default
+const defaultExpiryWarningDays = 14
+
+// ============================================================
+// Pre-flight credential validation before Terraform runs
+// ============================================================
+
+// Scopes the package's API tokens must carry
+func requiredScopes(config map[string]string) []string {
+	value, found := config["required_scopes"]
+	if !found {
+		if config["deployment_events"] == "true" {
+			return append(append([]string(nil), defaultRequiredScopes...), "events.ingest")
+		}
+		return defaultRequiredScopes
+	}
+	var scopes []string
+	for _, scope := range strings.Split(value, ",") {
+		if scope = strings.TrimSpace(scope); scope != "" {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes
+}
+
+// Scopes the package's OAuth clients must be granted, from required_oauth_scopes
+func requiredOAuthScopes(config map[string]string) []string {
+	return strings.FieldsFunc(config["required_oauth_scopes"], func(r rune) bool { return r == ',' || r == ' ' })
+}
+
+// How long before expiry to warn about an API token, from token_expiry_warning_days
+func tokenExpiryWarning(config map[string]string) time.Duration {
+	days := defaultExpiryWarningDays
+	if value, err := strconv.Atoi(config["token_expiry_warning_days"]); err == nil && value >= 0 {
+		days = value
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// Check an API token is valid, enabled, unexpired, issued by the tenant of
+// envURL and has the required scopes; network failures are reported as
+// warnings so offline runs are not blocked
+func preflightAPIToken(label, envURL, token string, required []string, warnWithin time.Duration) error {
+	info, err := lookupAPIToken(envURL, token)
+	var apiErr *apiError
+	if errors.As(err, &apiErr) && (apiErr.StatusCode == 401 || apiErr.StatusCode == 403 || apiErr.StatusCode == 404) {
+		return fmt.Errorf("%s was rejected by %s (%w)", label, envURL, err)
+	}
+	if err != nil {
+		fmt.Printf("Warning: could not validate %s: %v\n", label, err)
+		return nil
+	}
+	if info.TenantID != "" && !strings.EqualFold(info.TenantID, tenantID(envURL)) {
+		publishf("guard", "warning", "%s for %s belongs to tenant %s", label, envURL, info.TenantID)
+		return &tenantMismatchError{Label: label, EnvURL: envURL, Tenant: info.TenantID}
+	}
+	if !info.Enabled {
+		return fmt.Errorf("%s %q is disabled", label, info.Name)
+	}
+	if info.ExpirationDate != "" {
+		if expiry, err := time.Parse(time.RFC3339, info.ExpirationDate); err == nil {
+			if time.Now().After(expiry) {
+				return fmt.Errorf("%s %q expired on %s", label, info.Name, expiry.Format(time.RFC3339))
+			}
+			if remaining := time.Until(expiry); remaining < warnWithin {
+				fmt.Printf("Warning: %s %q expires in %d day(s) on %s; rotate it with -rotate-token.\n",
+					label, info.Name, int(remaining.Hours()/24), expiry.Format("2006-01-02"))
+				publishf("validator", "warning", "%s expires on %s", label, expiry.Format(time.RFC3339))
+			}
+		}
+	}
+	if missing := missingScopes(required, info.Scopes); len(missing) > 0 {
+		return fmt.Errorf("%s %q is missing scopes: %s", label, info.Name, strings.Join(missing, ", "))
+	}
+	publishf("validator", "info", "%s has the required scopes", label)
+	return nil
+}
+
+// Check an OAuth client can complete a client_credentials grant for the account
+// with the required scopes, explaining the likely cause of a rejection
+func preflightOAuthClient(label, clientID, clientSecret, accountID string, required []string) error {
+	if !strings.HasPrefix(clientSecret, clientID+".") {
+		return fmt.Errorf("%s secret does not belong to client ID %s", label, clientID)
+	}
+
+	token, err := requestOAuthToken(clientID, clientSecret, accountID, strings.Join(required, " "))
+	var apiErr *apiError
+	if errors.As(err, &apiErr) && apiErr.StatusCode >= 400 && apiErr.StatusCode < 500 {
+		var reply struct {
+			Error       string `json:"error"`
+			Description string `json:"error_description"`
+		}
+		json.Unmarshal([]byte(apiErr.Body), &reply)
+		reason := reply.Error
+		switch reply.Error {
+		case "invalid_client", "unauthorized_client":
+			reason = fmt.Sprintf("client ID %s is unknown or its secret is wrong", clientID)
+		case "invalid_resource", "invalid_target":
+			reason = fmt.Sprintf("client is not bound to account %s", accountID)
+		case "invalid_scope":
+			reason = fmt.Sprintf("client is not granted all of the scopes %s", strings.Join(required, ", "))
+		}
+		if reason == "" {
+			reason = err.Error()
+		}
+		if reply.Description != "" {
+			reason += " (" + reply.Description + ")"
+		}
+		return fmt.Errorf("%s was rejected: %s", label, reason)
+	}
+	if err != nil {
+		fmt.Printf("Warning: could not validate %s: %v\n", label, err)
+		return nil
+	}
+
+	if token.Scope != "" {
+		if missing := missingScopes(required, strings.Fields(token.Scope)); len(missing) > 0 {
+			return fmt.Errorf("%s is missing scopes: %s", label, strings.Join(missing, ", "))
+		}
+	}
+	publishf("validator", "info", "%s obtained an access token", label)
+	return nil
+}
+
+// Validate the configured API tokens and OAuth clients, including those of
+// credential sets, before terraform init; -force downgrades a token/tenant
+// mismatch to a warning, every other failure stops the run
+func preflightCredentials(config map[string]string, apiToken, oauthClient bool) error {
+	required := requiredScopes(config)
+	warnWithin := tokenExpiryWarning(config)
+	requiredOAuth := requiredOAuthScopes(config)
+
+	var problems []string
+	check := func(label, envURL, token string) {
+		if envURL == "" || token == "" {
+			return
+		}
+		err := preflightAPIToken(label, envURL, token, required, warnWithin)
+		var mismatch *tenantMismatchError
+		if errors.As(err, &mismatch) && forceGuards {
+			fmt.Printf("Warning: %v; continuing because of -force.\n", err)
+			publishf("guard", "warning", "%s (forced)", err)
+			return
+		}
+		if err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	checkOAuth := func(label, prefix string) {
+		clientID, clientSecret := getEnv(prefix+"CLIENT_ID"), getEnv(prefix+"CLIENT_SECRET")
+		if clientID == "" || clientSecret == "" {
+			return
+		}
+		if err := preflightOAuthClient(label, clientID, clientSecret, getEnv(prefix+"ACCOUNT_ID"), requiredOAuth); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	if apiToken {
+		check("API token", getEnv("DT_ENV_URL"), getEnv("DT_API_TOKEN"))
+	}
+	if oauthClient {
+		checkOAuth("OAuth client", "DT_")
+	}
+	for _, set := range credentialSets(config) {
+		prefix := "DT_" + strings.ToUpper(set) + "_"
+		if config[set+".api_token"] != "false" {
+			check("["+set+"] API token", getEnv(prefix+"ENV_URL"), getEnv(prefix+"API_TOKEN"))
+		}
+		if config[set+".oauth_client"] == "true" {
+			checkOAuth("["+set+"] OAuth client", prefix)
+		}
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%s", strings.Join(problems, "\n  "))
+}
+
+// ============================================================
+// Token/environment tenant mismatch
+// ============================================================
+
+// Tenant ID of an environment URL: the /e/<id> path segment of Managed and
+// ActiveGate URLs, otherwise the first label of the SaaS host name
+func tenantID(envURL string) string {
+	parsed, err := url.Parse(strings.TrimSpace(envURL))
+	if err != nil || parsed.Host == "" {
+		return envURL
+	}
+	if id, found := strings.CutPrefix(parsed.Path, "/e/"); found {
+		return strings.Trim(id, "/")
+	}
+	host, _, _ := strings.Cut(parsed.Hostname(), ".")
+	return host
+}
+
+// Token issued by a different tenant than the environment URL it is used with;
+// the only preflight failure -force overrides
+type tenantMismatchError struct {
+	Label  string
+	EnvURL string
+	Tenant string
+}
+
+func (e *tenantMismatchError) Error() string {
+	return fmt.Sprintf("%s belongs to tenant %s, not tenant %s configured in %s; "+
+		"check the token and environment URL, or rerun with -force", e.Label, e.Tenant, tenantID(e.EnvURL), e.EnvURL)
+}
@@ -0,0 +1,64 @@
+/**
+* @license
+* Copyright 2020 Dynatrace LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"dynatrace-terraform-wrapper/internal/dttest"
+)
+
+func TestPreflightAPIToken(t *testing.T) {
+	server := newTestServer(t)
+	required := []string{"settings.read", "settings.write"}
+	server.AddToken("dt0c01.OK.SECRET", dttest.TokenInfo{Scopes: required})
+	server.AddToken("dt0c01.NARROW.SECRET", dttest.TokenInfo{Scopes: []string{"settings.read"}})
+	server.AddToken("dt0c01.OLD.SECRET", dttest.TokenInfo{Scopes: required, ExpirationDate: time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)})
+	server.AddToken("dt0c01.SOON.SECRET", dttest.TokenInfo{Scopes: required, ExpirationDate: time.Now().Add(48 * time.Hour).UTC().Format(time.RFC3339)})
+	server.AddToken("dt0c01.OFF.SECRET", dttest.TokenInfo{Scopes: required})
+	server.DisableToken("dt0c01.OFF.SECRET")
+	server.AddToken("dt0c01.HOME.SECRET", dttest.TokenInfo{Scopes: required, TenantID: tenantID(server.URL)})
+	server.AddToken("dt0c01.AWAY.SECRET", dttest.TokenInfo{Scopes: required, TenantID: "xyz98765"})
+
+	tests := []struct {
+		token   string
+		wantErr string
+	}{
+		{"dt0c01.OK.SECRET", ""},
+		{"dt0c01.SOON.SECRET", ""},
+		{"dt0c01.NARROW.SECRET", "missing scopes: settings.write"},
+		{"dt0c01.OLD.SECRET", "expired on"},
+		{"dt0c01.OFF.SECRET", "was rejected"},
+		{"dt0c01.GONE.SECRET", "was rejected"},
+		{"dt0c01.HOME.SECRET", ""},
+		{"dt0c01.AWAY.SECRET", "belongs to tenant xyz98765"},
+	}
+	for _, test := range tests {
+		t.Run(test.token, func(t *testing.T) {
+			err := preflightAPIToken("DT_API_TOKEN", server.URL, test.token, required, 14*24*time.Hour)
+			switch {
+			case test.wantErr == "" && err != nil:
+				t.Errorf("unexpected error: %v", err)
+			case test.wantErr != "" && (err == nil || !strings.Contains(err.Error(), test.wantErr)):
+				t.Errorf("got %v, want an error containing %q", err, test.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,169 @@
+/**
+* @license
+* Copyright 2020 Dynatrace LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Default mapping of source outputs to target variables for promotions
+const outputMapFileName = "outputs.map"
+
+// ============================================================
+// Map source environment outputs to target variables
+// ============================================================
+
+// Read "<source output>[.<key>] = <target variable>" mappings
+func loadOutputMap(fileName string) (map[string]string, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	mapping := make(map[string]string)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if output, variable, ok := parseConfigLine(scanner.Text()); ok {
+			mapping[output] = strings.TrimPrefix(variable, "var.")
+		}
+	}
+	return mapping, scanner.Err()
+}
+
+// Output values of the source environment, read from a state file or from the
+// state of another workspace
+func sourceOutputs(terraformPath string, logFile *os.File, source string) (map[string]json.RawMessage, error) {
+	if info, err := os.Stat(source); err == nil && !info.IsDir() {
+		data, err := os.ReadFile(source)
+		if err != nil {
+			return nil, err
+		}
+		var state struct {
+			Outputs map[string]struct {
+				Value json.RawMessage `json:"value"`
+			} `json:"outputs"`
+		}
+		if err := json.Unmarshal(data, &state); err != nil {
+			return nil, fmt.Errorf("failed to parse state file %s: %w", source, err)
+		}
+		outputs := make(map[string]json.RawMessage)
+		for name, output := range state.Outputs {
+			outputs[name] = output.Value
+		}
+		return outputs, nil
+	}
+
+	current := currentWorkspace()
+	if err := selectWorkspace(terraformPath, logFile, source); err != nil {
+		return nil, fmt.Errorf("failed to select source workspace %s: %w", source, err)
+	}
+	defer func() {
+		if err := selectWorkspace(terraformPath, logFile, current); err != nil {
+			fmt.Printf("Warning: failed to switch back to workspace %s: %v\n", current, err)
+		}
+	}()
+
+	out, err := outputTerraformCommand(terraformPath, logFile, "output", "-json")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read outputs of workspace %s: %w", source, err)
+	}
+	var raw map[string]struct {
+		Value json.RawMessage `json:"value"`
+	}
+	if err := json.Unmarshal(out, &raw); err != nil {
+		return nil, fmt.Errorf("failed to parse outputs of workspace %s: %w", source, err)
+	}
+	outputs := make(map[string]json.RawMessage)
+	for name, output := range raw {
+		outputs[name] = output.Value
+	}
+	return outputs, nil
+}
+
+// Look up "<output>" or "<output>.<key>" (an element of a map or object output)
+func mappedOutputValue(outputs map[string]json.RawMessage, ref string) (json.RawMessage, error) {
+	name, key, hasKey := strings.Cut(ref, ".")
+	value, found := outputs[name]
+	if !found {
+		return nil, fmt.Errorf("source has no output %s", name)
+	}
+	if !hasKey {
+		return value, nil
+	}
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(value, &object); err != nil {
+		return nil, fmt.Errorf("output %s is not a map", name)
+	}
+	if value, found = object[key]; !found {
+		return nil, fmt.Errorf("output %s has no key %s", name, key)
+	}
+	return value, nil
+}
+
+// Export the mapped source outputs as TF_VAR_ variables for the target run when
+// promote_from names the source workspace or state file
+func applyOutputMapping(terraformPath string, logFile *os.File, config map[string]string) error {
+	source := config["promote_from"]
+	if source == "" {
+		return nil
+	}
+	mapFile := config["output_map"]
+	if mapFile == "" {
+		mapFile = outputMapFileName
+	}
+	mapping, err := loadOutputMap(mapFile)
+	if err != nil {
+		return fmt.Errorf("failed to read output map: %w", err)
+	}
+	outputs, err := sourceOutputs(terraformPath, logFile, source)
+	if err != nil {
+		return err
+	}
+
+	refs := make([]string, 0, len(mapping))
+	for ref := range mapping {
+		refs = append(refs, ref)
+	}
+	sort.Strings(refs)
+
+	var problems []string
+	for _, ref := range refs {
+		value, err := mappedOutputValue(outputs, ref)
+		if err != nil {
+			problems = append(problems, err.Error())
+			continue
+		}
+		// Strings are passed as-is, other types in HCL-compatible JSON syntax
+		var text string
+		if json.Unmarshal(value, &text) != nil {
+			text = string(value)
+		}
+		exportEnv("TF_VAR_"+mapping[ref], text)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("output mapping from %s failed:\n  %s", source, strings.Join(problems, "\n  "))
+	}
+	fmt.Printf("Mapped %d output(s) from %s to target variables.\n", len(refs), source)
+	return nil
+}
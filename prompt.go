@@ -0,0 +1,80 @@
+/**
+* @license
+* Copyright 2020 Dynatrace LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// ============================================================
+// Masked and validated credential prompts
+// ============================================================
+
+// Read a line of input, without echo for secrets when stdin is a terminal
+func readPromptInput(envKey string, reader *bufio.Reader) (string, error) {
+	if isSecretKey(envKey) && term.IsTerminal(int(os.Stdin.Fd())) {
+		input, err := term.ReadPassword(int(os.Stdin.Fd()))
+		fmt.Println()
+		return strings.TrimSpace(string(input)), err
+	}
+	input, err := reader.ReadString('\n')
+	return strings.TrimSpace(input), err
+}
+
+// Check the shape of a Dynatrace credential or URL entered at a prompt; keys of
+// credential sets (DT_<SET>_API_TOKEN) are checked like the built-in ones
+func validateCredentialInput(envKey, value string) error {
+	if !strings.HasPrefix(envKey, "DT_") {
+		return nil
+	}
+	switch {
+	case envKey == "DT_CLUSTER_API_TOKEN":
+		// Managed cluster tokens have no fixed format
+	case strings.HasSuffix(envKey, "_API_TOKEN"):
+		if !strings.HasPrefix(value, "dt0c01.") {
+			return fmt.Errorf("API tokens start with \"dt0c01.\"")
+		}
+	case strings.HasSuffix(envKey, "_PLATFORM_TOKEN"):
+		if !strings.HasPrefix(value, "dt0s16.") {
+			return fmt.Errorf("platform tokens start with \"dt0s16.\"")
+		}
+	case strings.HasSuffix(envKey, "_CLIENT_ID"), strings.HasSuffix(envKey, "_CLIENT_SECRET"):
+		if !strings.HasPrefix(value, "dt0s02.") {
+			return fmt.Errorf("OAuth client IDs and secrets start with \"dt0s02.\"")
+		}
+	case strings.HasSuffix(envKey, "_ACCOUNT_ID"):
+		if !strings.HasPrefix(value, "urn:dtaccount:") {
+			return fmt.Errorf("account IDs are of the form urn:dtaccount:<uuid>")
+		}
+	case strings.HasSuffix(envKey, "_ENV_URL"), envKey == "DT_CLUSTER_URL":
+		parsed, err := url.Parse(value)
+		if err != nil || parsed.Host == "" || (parsed.Scheme != "https" && parsed.Scheme != "http") {
+			return fmt.Errorf("expected a tenant URL such as https://<id>.live.dynatrace.com")
+		}
+		if parsed.Path != "" && parsed.Path != "/" && !strings.HasPrefix(parsed.Path, "/e/") {
+			return fmt.Errorf("tenant URLs have no path other than /e/<environment-id> for Managed")
+		}
+	}
+	return nil
+}
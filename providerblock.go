@@ -0,0 +1,175 @@
+/**
+* @license
+* Copyright 2020 Dynatrace LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const providerSource = "dynatrace-oss/dynatrace"
+
+// Dynatrace provider version pinned in generated provider blocks unless
+// provider_version or the dependency lock file say otherwise
+const defaultProviderVersion = "1.80.0"
+
+// File the wrapper writes when the bundle does not declare the provider
+const generatedProviderFileName = "dynatrace_provider.tf"
+
+// Version pinned in generated provider blocks, from provider_version
+var providerVersion = defaultProviderVersion
+
+var (
+	// Sources the Dynatrace provider was once required from: manual installs of
+	// early releases, and the hashicorp namespace Terraform implies without a source
+	deprecatedSourcePattern = regexp.MustCompile(`(source\s*=\s*")(?:registry\.terraform\.io/)?(?:dynatrace\.com/com/dynatrace|hashicorp/dynatrace)(")`)
+	deprecatedStatePattern  = regexp.MustCompile(`provider\[\\"((?:registry\.terraform\.io/)?(?:dynatrace\.com/com/dynatrace|hashicorp/dynatrace))\\"\]`)
+	dynatraceSourcePattern  = regexp.MustCompile(`source\s*=\s*"(?:registry\.terraform\.io/)?dynatrace-oss/dynatrace"`)
+	lockedProviderPattern   = regexp.MustCompile(`provider "registry\.terraform\.io/dynatrace-oss/dynatrace" \{\s*version\s*=\s*"([^"]+)"`)
+)
+
+// ============================================================
+// Provider declaration
+// ============================================================
+
+// Pin generated provider blocks to provider_version when set
+func setupProviderBlock(config map[string]string) {
+	providerVersion = defaultProviderVersion
+	if version := config["provider_version"]; version != "" {
+		providerVersion = version
+	}
+}
+
+// Rewrite deprecated Dynatrace provider source addresses in the .tf files of
+// the working directory; returns whether any file changed
+func repairProviderSources() (bool, error) {
+	files, err := filepath.Glob("*.tf")
+	if err != nil {
+		return false, err
+	}
+	repaired := false
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return repaired, err
+		}
+		fixed := deprecatedSourcePattern.ReplaceAll(content, []byte("${1}"+providerSource+"${2}"))
+		if bytes.Equal(fixed, content) {
+			continue
+		}
+		if err := os.WriteFile(file, fixed, 0644); err != nil {
+			return repaired, err
+		}
+		fmt.Printf("Replaced the deprecated Dynatrace provider source in %s with %s.\n", file, providerSource)
+		repaired = true
+	}
+	return repaired, nil
+}
+
+// Whether the configuration requires the Dynatrace provider and declares a
+// provider "dynatrace" block
+func providerDeclarations(blocks []*hclBlock) (required, configured bool) {
+	for _, block := range blocks {
+		switch {
+		case block.Type == "provider" && len(block.Labels) > 0 && block.Labels[0] == "dynatrace":
+			configured = true
+		case block.Type == "terraform":
+			for _, nested := range block.Blocks {
+				if nested.Type != "required_providers" {
+					continue
+				}
+				for _, expr := range nested.Attributes {
+					if dynatraceSourcePattern.MatchString(expr) {
+						required = true
+					}
+				}
+			}
+		}
+	}
+	return required, configured
+}
+
+// Version to pin: the one already locked, so that generating the block does not
+// change the installed provider, or providerVersion
+func pinnedProviderVersion() string {
+	if content, err := os.ReadFile(".terraform.lock.hcl"); err == nil {
+		if match := lockedProviderPattern.FindSubmatch(content); match != nil {
+			return string(match[1])
+		}
+	}
+	return providerVersion
+}
+
+// Write a required_providers block, and a provider block when there is none,
+// for bundles that use Dynatrace resources without declaring the provider
+func generateProviderBlock() error {
+	blocks, err := parseTerraformFiles(".")
+	if err != nil {
+		return err
+	}
+	required, configured := providerDeclarations(blocks)
+	if required {
+		return nil
+	}
+	usesDynatrace := false
+	for _, block := range blocks {
+		if (block.Type == "resource" || block.Type == "data") && len(block.Labels) > 0 && strings.HasPrefix(block.Labels[0], "dynatrace_") {
+			usesDynatrace = true
+		}
+	}
+	if !usesDynatrace && !configured {
+		return nil
+	}
+
+	version := pinnedProviderVersion()
+	var content strings.Builder
+	fmt.Fprintf(&content, "# Generated by the wrapper because no .tf file required the Dynatrace provider\n\n")
+	fmt.Fprintf(&content, "terraform {\n  required_providers {\n    dynatrace = {\n      source  = %q\n      version = %q\n    }\n  }\n}\n", providerSource, version)
+	if !configured {
+		fmt.Fprintf(&content, "\n# The environment URL and credentials come from DT_ENV_URL and DT_API_TOKEN\n# (or the OAuth variables), which the wrapper sets from its configuration\nprovider \"dynatrace\" {}\n")
+	}
+	if err := os.WriteFile(generatedProviderFileName, []byte(content.String()), 0644); err != nil {
+		return err
+	}
+	fmt.Printf("Generated %s requiring %s %s.\n", generatedProviderFileName, providerSource, version)
+	return nil
+}
+
+// Point state recorded with a deprecated provider source at the current one;
+// returns whether the state changed
+func repairStateProvider(terraformPath string, logFile *os.File) (bool, error) {
+	out, err := outputTerraformCommand(terraformPath, logFile, "state", "pull")
+	if err != nil || len(out) == 0 {
+		return false, nil
+	}
+	sources := make(map[string]bool)
+	for _, match := range deprecatedStatePattern.FindAllSubmatch(out, -1) {
+		sources[string(match[1])] = true
+	}
+	for source := range sources {
+		fmt.Printf("Replacing the deprecated provider %s in the state with %s.\n", source, providerSource)
+		if err := executeTerraformCommand(terraformPath, logFile, "state", "replace-provider", "-auto-approve", source, "registry.terraform.io/"+providerSource); err != nil {
+			return false, fmt.Errorf("failed to replace provider %s in the state: %w", source, err)
+		}
+	}
+	return len(sources) > 0, nil
+}
@@ -0,0 +1,214 @@
+/**
+* @license
+* Copyright 2020 Dynatrace LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Terraform's default -parallelism
+const defaultParallelism = 10
+
+// Number of rate-limit notices during one apply that triggers a reduction
+const rateLimitThreshold = 5
+
+// Attempts of a wrapper API call answered with HTTP 429, and the longest wait
+// between them
+const (
+	apiRateLimitAttempts = 4
+	maxRetryAfterDelay   = time.Minute
+)
+
+// Reruns of a rate-limited apply and the wait before the first one, which
+// doubles for each further rerun
+const (
+	defaultRateLimitRetries = 3
+	defaultRateLimitBackoff = 30 * time.Second
+)
+
+// Set from rate_limit_retries (0 disables reruns) and rate_limit_backoff
+var (
+	rateLimitRetries int
+	rateLimitBackoff time.Duration
+)
+
+// ============================================================
+// Learn parallelism from observed API rate limiting
+// ============================================================
+
+var rateLimitPattern = regexp.MustCompile(`(?i)\b429\b|too many requests|rate limit`)
+
+// Writer that counts output lines reporting rate-limited API calls
+type rateLimitCounter struct {
+	mu      sync.Mutex
+	count   int
+	partial []byte
+}
+
+func (c *rateLimitCounter) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.partial = append(c.partial, p...)
+	for {
+		newline := bytes.IndexByte(c.partial, '\n')
+		if newline < 0 {
+			break
+		}
+		if rateLimitPattern.Match(c.partial[:newline]) {
+			c.count++
+		}
+		c.partial = c.partial[newline+1:]
+	}
+	return len(p), nil
+}
+
+// Number of rate-limit notices seen so far
+func (c *rateLimitCounter) Count() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.partial) > 0 && rateLimitPattern.Match(c.partial) {
+		return c.count + 1
+	}
+	return c.count
+}
+
+// Most recently learned parallelism for a tenant, or 0 if none was recorded
+func learnedParallelism(tenant string) int {
+	if tenant == "" {
+		return 0
+	}
+	events, err := queryAuditEvents(bundlePath(auditDirName), auditFilter{Kind: "parallelism", Tenant: tenant})
+	if err != nil || len(events) == 0 {
+		return 0
+	}
+	value, err := strconv.Atoi(events[len(events)-1].Fields["value"])
+	if err != nil || value < 1 {
+		return 0
+	}
+	return value
+}
+
+// Halve parallelism after heavy rate limiting and creep back up after clean runs,
+// persisting the new value for the tenant in the audit store
+func adjustParallelism(tenant string, current, rateLimited int) {
+	if tenant == "" {
+		return
+	}
+
+	next := current
+	switch {
+	case rateLimited >= rateLimitThreshold:
+		if current == 0 {
+			current = defaultParallelism
+		}
+		next = max(1, current/2)
+		fmt.Printf("Observed %d rate-limited API calls; subsequent runs against this environment will use -parallelism=%d.\n", rateLimited, next)
+	case rateLimited == 0 && current > 0 && current < defaultParallelism:
+		next = current + 1
+	}
+	if next == current {
+		return
+	}
+
+	err := audit.Record(auditEvent{
+		Kind:   "parallelism",
+		Tenant: tenant,
+		Result: "learned",
+		Fields: map[string]string{"value": strconv.Itoa(next), "rate_limited": strconv.Itoa(rateLimited)},
+	})
+	if err != nil {
+		fmt.Printf("Warning: failed to record learned parallelism: %v\n", err)
+	}
+}
+
+// ============================================================
+// Rerun applies and API calls that hit the rate limit
+// ============================================================
+
+// Read rate_limit_retries and rate_limit_backoff
+func setupRateLimitRetries(config map[string]string) error {
+	rateLimitRetries = defaultRateLimitRetries
+	if value := config["rate_limit_retries"]; value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			return fmt.Errorf("rate_limit_retries must be a non-negative integer, got %q", value)
+		}
+		rateLimitRetries = parsed
+	}
+	rateLimitBackoff = defaultRateLimitBackoff
+	if value := config["rate_limit_backoff"]; value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid rate_limit_backoff: %w", err)
+		}
+		rateLimitBackoff = parsed
+	}
+	return nil
+}
+
+// Wait before retrying an API call answered with HTTP 429: the Retry-After
+// seconds when the server sent them, otherwise 2s doubling per attempt
+func retryAfterDelay(retryAfter string, attempt int) time.Duration {
+	delay := time.Second << attempt
+	if seconds, err := strconv.Atoi(strings.TrimSpace(retryAfter)); err == nil && seconds >= 0 {
+		delay = time.Duration(seconds) * time.Second
+	}
+	return min(delay, maxRetryAfterDelay)
+}
+
+// Rerun an apply that failed after rate limiting with the given parallelism.
+// The rerun plans afresh against the state the failed apply left behind, so
+// completed operations are not repeated; replacements that already happened
+// are dropped for the same reason. When the failed apply was reviewed, the new
+// plan goes to the approver, or to the user with -confirm-apply, before it is
+// applied.
+func rerunRateLimitedApply(terraformPath string, logFile *os.File, observer io.Writer, deadline time.Time, parallelism int, completed []string, reviewed bool) error {
+	replaceAddresses = slices.DeleteFunc(replaceAddresses, func(address string) bool {
+		return slices.Contains(completed, address+" (creation)")
+	})
+
+	planFile, err := writeApplyPlan(terraformPath, logFile)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(planFile)
+	if reviewed {
+		output, err := outputTerraformCommand(terraformPath, logFile, "show", "-no-color", planFile)
+		if err != nil {
+			return err
+		}
+		if applyApprover != nil {
+			if err := approvePlanOutput(string(output)); err != nil {
+				return err
+			}
+		} else if _, changes := summarizePlan(string(output)); changes && !askApplyConfirmation(string(output)) {
+			return fmt.Errorf("the remaining changes were not confirmed; run apply again to continue")
+		}
+	}
+	return executeObservedTerraformCommand(terraformPath, logFile, observer, deadline, "apply", fmt.Sprintf("-parallelism=%d", parallelism), planFile)
+}
@@ -0,0 +1,100 @@
+/**
+* @license
+* Copyright 2020 Dynatrace LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRateLimitCounter(t *testing.T) {
+	tests := []struct {
+		name   string
+		writes []string
+		want   int
+	}{
+		{"no output", nil, 0},
+		{"clean apply", []string{"dynatrace_alerting.a: Creating...\n", "Apply complete! Resources: 1 added.\n"}, 0},
+		{"status code", []string{"Error: 429 returned by /api/v2/settings/objects\n"}, 1},
+		{"reason phrase", []string{"Error: Too Many Requests\n"}, 1},
+		{"rate limit", []string{"Warning: Rate limit reached, retrying\n"}, 1},
+		{"one per line", []string{"429\n429\nok\ntoo many requests\n"}, 3},
+		{"one per line with several notices", []string{"429 Too Many Requests: rate limit exceeded\n"}, 1},
+		{"line split across writes", []string{"Error: Too Many ", "Requests\nok\n"}, 1},
+		{"notice split at the newline", []string{"Error: 429", "\n", "ok\n"}, 1},
+		{"several lines in chunks", []string{"a\n4", "29\nb", "\nrate ", "limit\n"}, 2},
+		{"unterminated last line", []string{"ok\nError: 429"}, 1},
+		{"other numbers", []string{"id=14290\nelapsed 4.29s\nport 8429\n"}, 0},
+		{"carriage returns", []string{"Error: 429\r\n"}, 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var counter rateLimitCounter
+			for _, chunk := range test.writes {
+				if n, err := counter.Write([]byte(chunk)); n != len(chunk) || err != nil {
+					t.Fatalf("Write(%q) = %d, %v", chunk, n, err)
+				}
+			}
+			if got := counter.Count(); got != test.want {
+				t.Errorf("Count() = %d, want %d", got, test.want)
+			}
+		})
+	}
+}
+
+func TestRateLimitCounterConcurrentWrites(t *testing.T) {
+	var counter rateLimitCounter
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 50 {
+				counter.Write([]byte("Error: 429 Too Many Requests\n"))
+			}
+		}()
+	}
+	wg.Wait()
+	if got := counter.Count(); got != 400 {
+		t.Errorf("Count() = %d, want 400", got)
+	}
+}
+
+func TestRetryAfterDelay(t *testing.T) {
+	tests := []struct {
+		retryAfter string
+		attempt    int
+		want       time.Duration
+	}{
+		{"", 1, 2 * time.Second},
+		{"", 2, 4 * time.Second},
+		{"", 3, 8 * time.Second},
+		{"", 10, maxRetryAfterDelay},
+		{"5", 1, 5 * time.Second},
+		{" 0 ", 3, 0},
+		{"600", 1, maxRetryAfterDelay},
+		{"-1", 1, 2 * time.Second},
+		{"Wed, 21 Oct 2026 07:28:00 GMT", 2, 4 * time.Second},
+	}
+	for _, test := range tests {
+		if got := retryAfterDelay(test.retryAfter, test.attempt); got != test.want {
+			t.Errorf("retryAfterDelay(%q, %d) = %v, want %v", test.retryAfter, test.attempt, got, test.want)
+		}
+	}
+}
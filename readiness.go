@@ -0,0 +1,183 @@
+/**
+* @license
+* Copyright 2020 Dynatrace LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Set when the environment is checked for the prerequisites of the planned resource types
+var planReadinessCheck bool
+
+// Planned creation or update of a resource subject to a readiness check
+type readinessItem struct {
+	Address string
+	After   map[string]any
+}
+
+// Environment prerequisite of a set of resource types; check returns one
+// actionable message per unmet prerequisite
+type readinessCheck struct {
+	name  string
+	types []string
+	check func(items []readinessItem) ([]string, error)
+}
+
+var readinessChecks = []readinessCheck{
+	{
+		name:  "synthetic locations",
+		types: []string{"dynatrace_http_monitor", "dynatrace_browser_monitor"},
+		check: checkSyntheticLocations,
+	},
+	{
+		name:  "Kubernetes connection",
+		types: []string{"dynatrace_k8s_cluster_anomalies", "dynatrace_k8s_namespace_anomalies", "dynatrace_k8s_node_anomalies", "dynatrace_k8s_pvc_anomalies", "dynatrace_k8s_workload_anomalies"},
+		check: checkKubernetesConnection,
+	},
+	{
+		name:  "log monitoring",
+		types: []string{"dynatrace_log_processing", "dynatrace_log_custom_attribute", "dynatrace_log_events", "dynatrace_log_metrics", "dynatrace_log_timestamp", "dynatrace_log_storage"},
+		check: checkLogMonitoring,
+	},
+}
+
+// ============================================================
+// Environment readiness for planned resource types
+// ============================================================
+
+// Enable the readiness check for API token runs unless readiness_check = false
+func setupReadinessCheck(config map[string]string) {
+	planReadinessCheck = getEnv("DT_API_TOKEN") != "" && config["readiness_check"] != "false"
+}
+
+// Synthetic locations the planned monitors run from must exist and be enabled
+func checkSyntheticLocations(items []readinessItem) ([]string, error) {
+	var response struct {
+		Locations []struct {
+			EntityID string `json:"entityId"`
+			Name     string `json:"name"`
+			Status   string `json:"status"`
+		} `json:"locations"`
+	}
+	if err := dynatraceGet("/api/v1/synthetic/locations", &response); err != nil {
+		return nil, err
+	}
+	if len(response.Locations) == 0 {
+		return []string{"no synthetic locations are available; deploy a private location or enable public locations before creating synthetic monitors"}, nil
+	}
+	status := make(map[string]string)
+	for _, location := range response.Locations {
+		status[location.EntityID] = location.Status
+	}
+
+	var problems []string
+	for _, item := range items {
+		locations, _ := item.After["locations"].([]any)
+		for _, location := range locations {
+			id, _ := location.(string)
+			switch state, found := status[id]; {
+			case id == "":
+			case !found:
+				problems = append(problems, fmt.Sprintf("%s: synthetic location %s does not exist; list the available ones under Settings > Web and mobile monitoring > Private synthetic locations", item.Address, id))
+			case state != "" && state != "ENABLED":
+				problems = append(problems, fmt.Sprintf("%s: synthetic location %s is %s; enable it or pick another location", item.Address, id, strings.ToLower(state)))
+			}
+		}
+	}
+	return problems, nil
+}
+
+// Kubernetes alerting needs at least one connected Kubernetes cluster
+func checkKubernetesConnection(items []readinessItem) ([]string, error) {
+	var response struct {
+		TotalCount int `json:"totalCount"`
+	}
+	path := "/api/v2/entities?entitySelector=" + url.QueryEscape(`type("KUBERNETES_CLUSTER")`) + "&pageSize=1"
+	if err := dynatraceGet(path, &response); err != nil {
+		return nil, err
+	}
+	if response.TotalCount > 0 {
+		return nil, nil
+	}
+	return []string{fmt.Sprintf("no Kubernetes cluster is connected, so %d Kubernetes alerting resource(s) would have nothing to alert on; connect a cluster with the Dynatrace Operator first", len(items))}, nil
+}
+
+// Log processing configuration needs log monitoring, whose settings schemas
+// are missing from environments without it
+func checkLogMonitoring(items []readinessItem) ([]string, error) {
+	_, err := fetchSettingsSchema("builtin:logmonitoring.log-dpp-rules")
+	var apiErr *apiError
+	switch {
+	case err == nil:
+		return nil, nil
+	case errors.As(err, &apiErr) && apiErr.StatusCode == 404:
+		return []string{fmt.Sprintf("log monitoring is not enabled in this environment, which %d log resource(s) need; enable Log Monitoring under Settings > Log Monitoring first", len(items))}, nil
+	default:
+		return nil, err
+	}
+}
+
+// Check the environment meets the prerequisites of the resource types the plan
+// creates or updates
+func checkPlanReadiness(plan planChanges) error {
+	if !planReadinessCheck {
+		return nil
+	}
+
+	items := make(map[string][]readinessItem)
+	for _, change := range plan.ResourceChanges {
+		if !slices.Contains(change.Change.Actions, "create") && !slices.Contains(change.Change.Actions, "update") {
+			continue
+		}
+		after, _ := change.Change.After.(map[string]any)
+		items[change.Type] = append(items[change.Type], readinessItem{Address: change.Address, After: after})
+	}
+
+	var problems []string
+	checked := 0
+	for _, readiness := range readinessChecks {
+		var planned []readinessItem
+		for _, resourceType := range readiness.types {
+			planned = append(planned, items[resourceType]...)
+		}
+		if len(planned) == 0 {
+			continue
+		}
+		found, err := readiness.check(planned)
+		if err != nil {
+			fmt.Printf("Warning: could not check %s: %v\n", readiness.name, err)
+			continue
+		}
+		problems = append(problems, found...)
+		checked++
+	}
+
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return fmt.Errorf("environment is not ready for the planned changes:\n  %s", strings.Join(problems, "\n  "))
+	}
+	if checked > 0 {
+		publishf("guard", "info", "Environment meets the prerequisites of %d planned resource group(s)", checked)
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+/**
+* @license
+* Copyright 2020 Dynatrace LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"dynatrace-terraform-wrapper/internal/dttest"
+)
+
+func TestCheckPlanReadiness(t *testing.T) {
+	var plan planChanges
+	err := json.Unmarshal([]byte(`{"resource_changes": [
+		{"address": "dynatrace_http_monitor.home", "type": "dynatrace_http_monitor",
+		 "change": {"actions": ["create"], "after": {"name": "Home", "locations": ["GEOLOCATION-1", "GEOLOCATION-2"]}}},
+		{"address": "dynatrace_k8s_node_anomalies.nodes", "type": "dynatrace_k8s_node_anomalies",
+		 "change": {"actions": ["update"], "after": {"scope": "environment"}}},
+		{"address": "dynatrace_log_processing.mask", "type": "dynatrace_log_processing",
+		 "change": {"actions": ["create"], "after": {"rule_name": "mask"}}},
+		{"address": "dynatrace_log_storage.gone", "type": "dynatrace_log_storage",
+		 "change": {"actions": ["delete"], "after": null}}
+	]}`), &plan)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ready := func(server *dttest.Server) {
+		server.AddSyntheticLocation(dttest.SyntheticLocation{EntityID: "GEOLOCATION-1", Name: "Vienna", Type: "PUBLIC"})
+		server.AddSyntheticLocation(dttest.SyntheticLocation{EntityID: "GEOLOCATION-2", Name: "Private", Type: "PRIVATE"})
+		server.AddEntity(dttest.Entity{Type: "KUBERNETES_CLUSTER", DisplayName: "prod"})
+		server.AddSchema("builtin:logmonitoring.log-dpp-rules", "1.0", "")
+	}
+	tests := []struct {
+		name  string
+		setup func(server *dttest.Server)
+		want  []string
+	}{
+		{"ready", ready, nil},
+		{
+			"locations the monitors do not use",
+			func(server *dttest.Server) {
+				ready(server)
+				server.AddSyntheticLocation(dttest.SyntheticLocation{EntityID: "GEOLOCATION-3", Status: "DISABLED"})
+			},
+			nil,
+		},
+		{
+			"not ready",
+			func(server *dttest.Server) {
+				server.AddSyntheticLocation(dttest.SyntheticLocation{EntityID: "GEOLOCATION-1", Status: "DISABLED"})
+			},
+			[]string{
+				"dynatrace_http_monitor.home: synthetic location GEOLOCATION-1 is disabled",
+				"dynatrace_http_monitor.home: synthetic location GEOLOCATION-2 does not exist",
+				"no Kubernetes cluster is connected, so 1 Kubernetes alerting resource(s)",
+				"log monitoring is not enabled in this environment, which 1 log resource(s) need",
+			},
+		},
+		{
+			"no synthetic locations",
+			func(server *dttest.Server) {
+				server.AddEntity(dttest.Entity{Type: "KUBERNETES_CLUSTER", DisplayName: "prod"})
+				server.AddSchema("builtin:logmonitoring.log-dpp-rules", "1.0", "")
+			},
+			[]string{"no synthetic locations are available"},
+		},
+		{
+			"checks that fail are skipped",
+			func(server *dttest.Server) {
+				server.Fail("/api/v1/synthetic/locations", 500, "internal error", -1)
+				server.Fail("/api/v2/entities", 403, "missing scope", -1)
+				server.Fail("/api/v2/settings/schemas/builtin:logmonitoring.log-dpp-rules", 503, "unavailable", -1)
+			},
+			nil,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := newTestServer(t)
+			useTestEnvironment(t, server, "settings.read", "entities.read", "ReadSyntheticData")
+			planReadinessCheck = true
+			t.Cleanup(func() { planReadinessCheck = false })
+			test.setup(server)
+
+			err := checkPlanReadiness(plan)
+			if test.want == nil {
+				if err != nil {
+					t.Errorf("checkPlanReadiness: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("checkPlanReadiness accepted an environment that is not ready")
+			}
+			for _, problem := range test.want {
+				if !strings.Contains(err.Error(), problem) {
+					t.Errorf("missing %q in:\n%v", problem, err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+/**
+* @license
+* Copyright 2020 Dynatrace LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Values of the repeatable -replace flag
+var cliReplacements = &listFlag{}
+
+// Addresses the next plan and apply recreate
+var replaceAddresses []string
+
+// ============================================================
+// Recreate specific resources
+// ============================================================
+
+// -replace arguments for plan and apply
+func replaceArgs() []string {
+	args := make([]string, 0, len(replaceAddresses))
+	for _, address := range replaceAddresses {
+		args = append(args, "-replace="+address)
+	}
+	return args
+}
+
+// Recreate the given addresses on the next plan and apply, refusing excluded ones
+func selectReplacements(addresses []string) error {
+	for _, address := range addresses {
+		for _, ex := range excludedResources {
+			if matchesAddress(address, ex) {
+				return fmt.Errorf("cannot replace %s: it is excluded by %s", address, ex)
+			}
+		}
+	}
+	replaceAddresses = addresses
+	if len(addresses) > 0 {
+		fmt.Printf("The next plan and apply recreate %s.\n", strings.Join(addresses, ", "))
+	}
+	return nil
+}
+
+// Let the user choose resources in state to recreate on the next plan and apply
+func pickReplacements(terraformPath string, logFile *os.File) error {
+	if nonInteractive {
+		return fmt.Errorf("the resource picker is unavailable in non-interactive mode; use -replace")
+	}
+	addresses, err := listStateResources(terraformPath, logFile)
+	if err != nil {
+		return fmt.Errorf("failed to list state: %w", err)
+	}
+	var resources []pickerResource
+	for _, address := range addresses {
+		if !strings.HasPrefix(address, "data.") && !strings.Contains(address, ".data.") {
+			resources = append(resources, pickerResource{address, "in state"})
+		}
+	}
+	if len(resources) == 0 {
+		fmt.Println("No resources in state.")
+		return nil
+	}
+	return selectReplacements(chooseResources(resources, "Resources to recreate (e.g. 1,3-5; empty for none): "))
+}
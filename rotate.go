@@ -0,0 +1,214 @@
+/**
+* @license
+* Copyright 2020 Dynatrace LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Lifetime of a rotated API token unless token_rotation_days says otherwise
+const defaultRotationDays = 90
+
+// ============================================================
+// API token rotation
+// ============================================================
+
+// Token created by the Tokens API
+type createdAPIToken struct {
+	ID             string `json:"id"`
+	Token          string `json:"token"`
+	ExpirationDate string `json:"expirationDate"`
+}
+
+// Create an API token with the given scopes using a token holding apiTokens.write
+func createAPIToken(envURL, bootstrapToken, name string, scopes []string, days int) (*createdAPIToken, error) {
+	payload, _ := json.Marshal(map[string]interface{}{
+		"name":           name,
+		"scopes":         scopes,
+		"expirationDate": fmt.Sprintf("now+%dd", days),
+	})
+	req, err := http.NewRequest(http.MethodPost, strings.TrimRight(envURL, "/")+"/api/v2/apiTokens", bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Api-Token "+bootstrapToken)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := readAPIResponse(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	var created createdAPIToken
+	if err := json.Unmarshal(body, &created); err != nil {
+		return nil, fmt.Errorf("unexpected token creation response: %w", err)
+	}
+	return &created, nil
+}
+
+// Delete an API token by ID using a token holding apiTokens.write
+func deleteAPIToken(envURL, bootstrapToken, id string) error {
+	req, err := http.NewRequest(http.MethodDelete, strings.TrimRight(envURL, "/")+"/api/v2/apiTokens/"+url.PathEscape(id), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Api-Token "+bootstrapToken)
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	_, err = readAPIResponse(resp)
+	return err
+}
+
+// Replace the value of key in a wrapper.cfg or wrapper.toml file, keeping other lines
+func replaceConfigValue(fileName, key, value string) error {
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return err
+	}
+	replacement := key + " = " + value
+	if strings.HasSuffix(fileName, ".toml") {
+		replacement = fmt.Sprintf("%s = %q", key, value)
+	}
+
+	lines := strings.Split(string(data), "\n")
+	replaced := false
+	for i, line := range lines {
+		if lineKey, _, ok := parseConfigLine(line); ok && lineKey == key {
+			lines[i] = replacement
+			replaced = true
+		}
+	}
+	if !replaced {
+		return fmt.Errorf("%s not found in %s", key, fileName)
+	}
+	return os.WriteFile(fileName, []byte(strings.Join(lines, "\n")), 0600)
+}
+
+// Store a rotated token where the current one came from: the config file, a
+// file: reference or the keychain; other sources must be updated by hand
+func storeRotatedToken(config map[string]string, token string) error {
+	configValue, inConfig := config["DT_API_TOKEN"]
+	switch {
+	case inConfig:
+		prefix, ref, isRef := secretReference(configValue)
+		switch {
+		case !isRef:
+			fileName, err := definingConfigFile("DT_API_TOKEN")
+			if err != nil {
+				return err
+			}
+			if fileName == "" {
+				return fmt.Errorf("DT_API_TOKEN is not set in any configuration file; update it where it is set")
+			}
+			if strings.HasSuffix(fileName, ".tmpl") {
+				return fmt.Errorf("cannot update the rendered template %s", fileName)
+			}
+			if err := replaceConfigValue(fileName, "DT_API_TOKEN", token); err != nil {
+				return err
+			}
+			fmt.Printf("Updated DT_API_TOKEN in %s.\n", fileName)
+		case prefix == "file:":
+			if err := os.WriteFile(ref, []byte(token+"\n"), 0600); err != nil {
+				return err
+			}
+			fmt.Printf("Updated secret file %s.\n", ref)
+		default:
+			return fmt.Errorf("DT_API_TOKEN is read from %s%s; store the new token there", prefix, ref)
+		}
+	case config["keychain"] == "true":
+		account, _ := keychainAccount("DT_API_TOKEN")
+		if err := keychainSet(keychainService, account, token); err != nil {
+			return err
+		}
+		fmt.Println("Updated DT_API_TOKEN in the OS keychain.")
+	default:
+		return fmt.Errorf("DT_API_TOKEN is not stored by the wrapper; update it where it is set")
+	}
+	return nil
+}
+
+// Create a replacement for the configured API token with the same scopes using
+// a bootstrap token (DT_BOOTSTRAP_TOKEN or prompted) and store it
+func rotateAPIToken(config map[string]string) error {
+	envURL, current := getEnv("DT_ENV_URL"), getEnv("DT_API_TOKEN")
+	if envURL == "" || current == "" {
+		return fmt.Errorf("rotation requires api_token = true with DT_ENV_URL and DT_API_TOKEN")
+	}
+	info, err := lookupAPIToken(envURL, current)
+	if err != nil {
+		return fmt.Errorf("failed to look up the current token: %w", err)
+	}
+
+	bootstrap := getEnv("DT_BOOTSTRAP_TOKEN")
+	if bootstrap == "" {
+		if nonInteractive {
+			return fmt.Errorf("DT_BOOTSTRAP_TOKEN must be set in non-interactive mode")
+		}
+		fmt.Print("Input bootstrap API token with the apiTokens.write scope: ")
+		if bootstrap, err = readPromptInput("DT_BOOTSTRAP_TOKEN", bufio.NewReader(os.Stdin)); err != nil {
+			return err
+		}
+	}
+
+	days := defaultRotationDays
+	if value, found := config["token_rotation_days"]; found {
+		if days, err = strconv.Atoi(value); err != nil || days < 1 {
+			return fmt.Errorf("token_rotation_days must be a positive number of days, got %q", value)
+		}
+	}
+	name := info.Name
+	if name == "" {
+		name = "dt-tf-wrapper"
+	}
+	name = fmt.Sprintf("%s (rotated %s)", strings.SplitN(name, " (rotated ", 2)[0], time.Now().Format("2006-01-02"))
+
+	created, err := createAPIToken(envURL, bootstrap, name, info.Scopes, days)
+	if err != nil {
+		return fmt.Errorf("failed to create replacement token: %w", err)
+	}
+	fmt.Printf("Created token %s (%s) expiring %s.\n", created.ID, name, created.ExpirationDate)
+
+	if err := storeRotatedToken(config, created.Token); err != nil {
+		// The secret is only shown once; rather than print it, revoke the
+		// token nobody can use and keep the current one
+		if revokeErr := deleteAPIToken(envURL, bootstrap, created.ID); revokeErr != nil {
+			fmt.Printf("Warning: failed to revoke the unstored token %s; revoke it in Access tokens: %v\n", created.ID, revokeErr)
+		} else {
+			fmt.Printf("Revoked the new token %s; %s stays in use.\n", created.ID, info.ID)
+		}
+		return err
+	}
+	exportEnv("DT_API_TOKEN", created.Token)
+	fmt.Printf("The previous token %s stays valid until revoked; revoke it once all consumers use the new one.\n", info.ID)
+	return nil
+}
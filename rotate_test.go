@@ -0,0 +1,94 @@
+/**
+* @license
+* Copyright 2020 Dynatrace LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"dynatrace-terraform-wrapper/internal/dttest"
+)
+
+func TestRotateAPIToken(t *testing.T) {
+	const bootstrap = "dt0c01.BOOTSTRAP.SECRET"
+	tests := []struct {
+		name            string
+		tokenConfig     string
+		bootstrapScopes []string
+		wantErr         string
+		wantRevoked     bool
+	}{
+		{"stored in a secret file", "file:", []string{"apiTokens.write"}, "", false},
+		{"stored in Vault", "vault:secret/dynatrace#token", []string{"apiTokens.write"}, "store the new token there", true},
+		{"bootstrap token without apiTokens.write", "file:", []string{"apiTokens.read"}, "failed to create replacement token", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := newTestServer(t)
+			useTestEnvironment(t, server, "settings.read", "settings.write")
+			server.AddToken(bootstrap, dttest.TokenInfo{Name: "bootstrap", Scopes: test.bootstrapScopes})
+			t.Setenv("DT_BOOTSTRAP_TOKEN", bootstrap)
+			t.Cleanup(clearExportedEnv)
+
+			secretFile := filepath.Join(t.TempDir(), "token")
+			tokenConfig := test.tokenConfig
+			if tokenConfig == "file:" {
+				tokenConfig += secretFile
+			}
+			err := rotateAPIToken(map[string]string{"DT_API_TOKEN": tokenConfig})
+
+			revoked := false
+			for _, request := range server.Requests() {
+				revoked = revoked || (request.Method == "DELETE" && strings.HasPrefix(request.Path, "/api/v2/apiTokens/"))
+			}
+			if revoked != test.wantRevoked {
+				t.Errorf("revoked the new token: %v, want %v", revoked, test.wantRevoked)
+			}
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Errorf("rotateAPIToken: got %v, want an error containing %q", err, test.wantErr)
+				}
+				if getEnv("DT_API_TOKEN") != "dt0c01.TEST.SECRET" {
+					t.Error("DT_API_TOKEN changed although the rotation failed")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("rotateAPIToken: %v", err)
+			}
+
+			data, err := os.ReadFile(secretFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rotated := strings.TrimSpace(string(data))
+			if getEnv("DT_API_TOKEN") != rotated {
+				t.Errorf("DT_API_TOKEN = %q, want the rotated token %q", getEnv("DT_API_TOKEN"), rotated)
+			}
+			info, err := lookupAPIToken(server.URL, rotated)
+			if err != nil {
+				t.Fatalf("lookup of the rotated token: %v", err)
+			}
+			if !strings.HasPrefix(info.Name, "test (rotated ") || strings.Join(info.Scopes, ",") != "settings.read,settings.write" || info.ExpirationDate == "" {
+				t.Errorf("rotated token = %+v, want the name and scopes of the current one with an expiry", info)
+			}
+		})
+	}
+}
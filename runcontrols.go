@@ -0,0 +1,123 @@
+/**
+* @license
+* Copyright 2020 Dynatrace LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Time a timed-out command gets to stop after the interrupt before it is killed
+const timeoutGracePeriod = 30 * time.Second
+
+// Set by -parallelism and -timeout, which override the configuration
+var (
+	cliParallelism int
+	cliTimeout     time.Duration
+)
+
+// Parallelism for plan, apply and destroy (0 uses the learned or Terraform default)
+// and timeouts per Terraform command ("" holds the timeout of all other commands)
+var (
+	configuredParallelism int
+	commandTimeouts       map[string]time.Duration
+)
+
+// ============================================================
+// Parallelism and command timeouts
+// ============================================================
+
+// Read parallelism, timeout and timeout.<command> (e.g. timeout.apply = 30m)
+func setupRunControls(config map[string]string) error {
+	configuredParallelism = cliParallelism
+	if value := config["parallelism"]; value != "" && configuredParallelism == 0 {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 {
+			return fmt.Errorf("parallelism must be a positive integer, got %q", value)
+		}
+		configuredParallelism = parsed
+	}
+
+	commandTimeouts = make(map[string]time.Duration)
+	for key, value := range config {
+		command, isTimeout := strings.CutPrefix(key, "timeout")
+		if !isTimeout || (command != "" && !strings.HasPrefix(command, ".")) {
+			continue
+		}
+		timeout, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", key, err)
+		}
+		commandTimeouts[strings.TrimPrefix(command, ".")] = timeout
+	}
+	if cliTimeout > 0 {
+		commandTimeouts = map[string]time.Duration{"": cliTimeout}
+	}
+	return nil
+}
+
+// -parallelism argument for plan, apply and destroy when one is configured
+func parallelismArgs() []string {
+	if configuredParallelism == 0 {
+		return nil
+	}
+	return []string{fmt.Sprintf("-parallelism=%d", configuredParallelism)}
+}
+
+// Timeout of a Terraform command, 0 when it may run indefinitely
+func commandTimeout(command string) time.Duration {
+	if timeout, found := commandTimeouts[command]; found {
+		return timeout
+	}
+	return commandTimeouts[""]
+}
+
+// Interrupt a command once its timeout elapses and kill it if it has not stopped
+// after the grace period; the returned function stops the timers and reports
+// whether the timeout was reached
+func enforceTimeout(cmd *exec.Cmd, timeout time.Duration) func() bool {
+	var mu sync.Mutex
+	timedOut := false
+	var kill *time.Timer
+	interrupt := time.AfterFunc(timeout, func() {
+		mu.Lock()
+		defer mu.Unlock()
+		timedOut = true
+		fmt.Printf("\nTerraform did not finish within %s; interrupting it...\n", timeout)
+		publishf("runner", "warning", "Timed out after %s", timeout)
+		if err := cmd.Process.Signal(os.Interrupt); err != nil {
+			cmd.Process.Kill()
+			return
+		}
+		kill = time.AfterFunc(timeoutGracePeriod, func() { cmd.Process.Kill() })
+	})
+	return func() bool {
+		interrupt.Stop()
+		mu.Lock()
+		defer mu.Unlock()
+		if kill != nil {
+			kill.Stop()
+		}
+		return timedOut
+	}
+}
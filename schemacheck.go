@@ -0,0 +1,311 @@
+/**
+* @license
+* Copyright 2020 Dynatrace LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Set when planned settings values are validated against their schemas before apply
+var planSchemaCheck bool
+
+var camelBoundaryPattern = regexp.MustCompile(`([a-z0-9])([A-Z])`)
+
+// Settings 2.0 schema as returned by /api/v2/settings/schemas/{schemaId}
+type settingsSchema struct {
+	SchemaID   string                    `json:"schemaId"`
+	Properties map[string]schemaProperty `json:"properties"`
+	Types      map[string]struct {
+		Properties map[string]schemaProperty `json:"properties"`
+	} `json:"types"`
+	Enums map[string]struct {
+		Items []struct {
+			Value any `json:"value"`
+		} `json:"items"`
+	} `json:"enums"`
+}
+
+// Property of a settings schema or one of its types; Type is a primitive name
+// such as "text" or a {"$ref": "#/enums/..."} or {"$ref": "#/types/..."}
+type schemaProperty struct {
+	Type         any                `json:"type"`
+	Nullable     bool               `json:"nullable"`
+	Default      any                `json:"default"`
+	Precondition any                `json:"precondition"`
+	Items        *schemaProperty    `json:"items"`
+	Constraints  []schemaConstraint `json:"constraints"`
+}
+
+// Value constraint of a schema property
+type schemaConstraint struct {
+	Type      string   `json:"type"`
+	Minimum   *float64 `json:"minimum"`
+	Maximum   *float64 `json:"maximum"`
+	MinLength *int     `json:"minLength"`
+	MaxLength *int     `json:"maxLength"`
+}
+
+// ============================================================
+// Settings schema validation of planned values
+// ============================================================
+
+// Enable the schema check for API token runs unless schema_check = false
+func setupSchemaCheck(config map[string]string) {
+	planSchemaCheck = getEnv("DT_API_TOKEN") != "" && config["schema_check"] != "false"
+}
+
+// Whether apply first creates a plan to check: for exclusions, scopes, schemas,
+// environment readiness or the SLO preview
+func planChecksEnabled() bool {
+	return len(exclusionTargets) > 0 || planScopeCheck || planSchemaCheck || planReadinessCheck || planSLOPreview
+}
+
+// Terraform attribute name of a schema property (alertingProfile -> alerting_profile)
+func snakeCase(name string) string {
+	return strings.ToLower(camelBoundaryPattern.ReplaceAllString(name, "${1}_${2}"))
+}
+
+// Reference target of a property type such as {"$ref": "#/enums/Severity"}
+func schemaRef(propertyType any, kind string) string {
+	typed, ok := propertyType.(map[string]any)
+	if !ok {
+		return ""
+	}
+	ref, _ := typed["$ref"].(string)
+	name, found := strings.CutPrefix(ref, "#/"+kind+"/")
+	if !found {
+		return ""
+	}
+	return name
+}
+
+// Unwrap the single-element lists Terraform uses for nested blocks, and the
+// container block ("rules { rule {...} }") typed resources wrap lists in
+func unwrapBlock(value any, wantList bool) any {
+	list, ok := value.([]any)
+	if !ok {
+		return value
+	}
+	if !wantList {
+		if len(list) == 1 {
+			return list[0]
+		}
+		return value
+	}
+	if len(list) == 1 {
+		if container, ok := list[0].(map[string]any); ok && len(container) == 1 {
+			for _, inner := range container {
+				if innerList, ok := inner.([]any); ok {
+					return innerList
+				}
+			}
+		}
+	}
+	return value
+}
+
+// Validates values against one schema, collecting violations
+type schemaValidator struct {
+	schema     *settingsSchema
+	terraform  bool
+	violations []string
+}
+
+func (v *schemaValidator) violationf(path, format string, args ...any) {
+	v.violations = append(v.violations, path+": "+fmt.Sprintf(format, args...))
+}
+
+// Validate an object's properties; required properties are only checked for raw
+// settings values, as typed resources leave computed attributes out of the plan
+func (v *schemaValidator) validateObject(properties map[string]schemaProperty, object map[string]any, path string) {
+	names := make([]string, 0, len(properties))
+	for name := range properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		property := properties[name]
+		key := name
+		if v.terraform {
+			key = snakeCase(name)
+		}
+		value, present := object[key]
+		propertyPath := strings.TrimPrefix(path+"."+key, ".")
+		if !present || value == nil {
+			if !v.terraform && !property.Nullable && property.Default == nil && property.Precondition == nil {
+				v.violationf(propertyPath, "is required")
+			}
+			continue
+		}
+		v.validateValue(property, value, propertyPath)
+	}
+}
+
+func (v *schemaValidator) validateValue(property schemaProperty, value any, path string) {
+	if enum := schemaRef(property.Type, "enums"); enum != "" {
+		var allowed []string
+		for _, item := range v.schema.Enums[enum].Items {
+			allowed = append(allowed, fmt.Sprint(item.Value))
+		}
+		if len(allowed) > 0 && !slices.Contains(allowed, fmt.Sprint(value)) {
+			v.violationf(path, "%q is not one of %s", fmt.Sprint(value), strings.Join(allowed, ", "))
+		}
+		return
+	}
+	if typeName := schemaRef(property.Type, "types"); typeName != "" {
+		if object, ok := unwrapBlock(value, false).(map[string]any); ok {
+			v.validateObject(v.schema.Types[typeName].Properties, object, path)
+		}
+		return
+	}
+
+	switch property.Type {
+	case "list", "set":
+		items, ok := unwrapBlock(value, true).([]any)
+		if !ok || property.Items == nil {
+			return
+		}
+		for i, item := range items {
+			v.validateValue(*property.Items, item, fmt.Sprintf("%s[%d]", path, i))
+		}
+	case "integer", "float":
+		number, ok := value.(float64)
+		if !ok {
+			v.violationf(path, "%v is not a number", value)
+			return
+		}
+		if property.Type == "integer" && number != float64(int64(number)) {
+			v.violationf(path, "%v is not an integer", value)
+		}
+		for _, constraint := range property.Constraints {
+			if constraint.Type != "RANGE" {
+				continue
+			}
+			if constraint.Minimum != nil && number < *constraint.Minimum {
+				v.violationf(path, "%v is below the minimum of %v", value, *constraint.Minimum)
+			}
+			if constraint.Maximum != nil && number > *constraint.Maximum {
+				v.violationf(path, "%v is above the maximum of %v", value, *constraint.Maximum)
+			}
+		}
+	case "text":
+		text, ok := value.(string)
+		if !ok {
+			return
+		}
+		for _, constraint := range property.Constraints {
+			if constraint.Type != "LENGTH" {
+				continue
+			}
+			length := len([]rune(text))
+			if constraint.MinLength != nil && length < *constraint.MinLength {
+				v.violationf(path, "is shorter than %d characters", *constraint.MinLength)
+			}
+			if constraint.MaxLength != nil && length > *constraint.MaxLength {
+				v.violationf(path, "is longer than %d characters", *constraint.MaxLength)
+			}
+		}
+	}
+}
+
+// Fetch a settings schema
+func fetchSettingsSchema(schemaID string) (*settingsSchema, error) {
+	var schema settingsSchema
+	if err := dynatraceGet("/api/v2/settings/schemas/"+url.PathEscape(schemaID), &schema); err != nil {
+		return nil, err
+	}
+	return &schema, nil
+}
+
+// Schema and values of a planned settings resource: the JSON value of
+// dynatrace_generic_setting, or the attributes of a typed settings resource
+func plannedSettingsValue(resourceType string, after map[string]any) (string, map[string]any, bool) {
+	if resourceType == "dynatrace_generic_setting" {
+		schemaID, _ := after["schema"].(string)
+		raw, _ := after["value"].(string)
+		var value map[string]any
+		if schemaID == "" || json.Unmarshal([]byte(raw), &value) != nil {
+			return "", nil, false
+		}
+		return schemaID, value, false
+	}
+	schemaID, ok := settingsSchemas[resourceType]
+	return schemaID, after, ok
+}
+
+// Validate the planned values of settings resources against their schemas'
+// enums, ranges, lengths and required properties before apply
+func checkPlanSchemas(plan planChanges) error {
+	if !planSchemaCheck {
+		return nil
+	}
+
+	schemas := make(map[string]*settingsSchema)
+	var violations []string
+	checked := 0
+	for _, change := range plan.ResourceChanges {
+		if !slices.Contains(change.Change.Actions, "create") && !slices.Contains(change.Change.Actions, "update") {
+			continue
+		}
+		after, _ := change.Change.After.(map[string]any)
+		schemaID, value, terraform := plannedSettingsValue(change.Type, after)
+		if schemaID == "" || value == nil {
+			continue
+		}
+
+		schema, fetched := schemas[schemaID]
+		if !fetched {
+			var err error
+			schema, err = fetchSettingsSchema(schemaID)
+			var apiErr *apiError
+			switch {
+			case err == nil:
+			case errors.As(err, &apiErr) && apiErr.StatusCode == 404:
+				violations = append(violations, fmt.Sprintf("%s: schema %s does not exist in this environment", change.Address, schemaID))
+			default:
+				fmt.Printf("Warning: could not fetch settings schema %s: %v\n", schemaID, err)
+			}
+			schemas[schemaID] = schema
+		}
+		if schema == nil {
+			continue
+		}
+
+		validator := &schemaValidator{schema: schema, terraform: terraform}
+		validator.validateObject(schema.Properties, value, "")
+		for _, violation := range validator.violations {
+			violations = append(violations, change.Address+": "+violation)
+		}
+		checked++
+	}
+
+	if len(violations) > 0 {
+		return fmt.Errorf("planned values violate their settings schemas:\n  %s", strings.Join(violations, "\n  "))
+	}
+	if checked > 0 {
+		publishf("guard", "info", "Validated %d settings resource(s) against their schemas", checked)
+	}
+	return nil
+}
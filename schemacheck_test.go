@@ -0,0 +1,85 @@
+/**
+* @license
+* Copyright 2020 Dynatrace LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestCheckPlanSchemas(t *testing.T) {
+	server := newTestServer(t)
+	useTestEnvironment(t, server, "settings.read")
+	planSchemaCheck = true
+	t.Cleanup(func() { planSchemaCheck = false })
+
+	server.AddSchema("builtin:alerting.profile", "8.1", `{
+		"properties": {
+			"name": {"type": "text", "constraints": [{"type": "LENGTH", "maxLength": 10}]},
+			"severityLevel": {"type": {"$ref": "#/enums/Severity"}}
+		},
+		"enums": {"Severity": {"items": [{"value": "AVAILABILITY"}, {"value": "ERROR"}]}}
+	}`)
+	server.Fail("/api/v2/settings/schemas/builtin:broken", 500, "internal error", -1)
+
+	var plan planChanges
+	err := json.Unmarshal([]byte(`{"resource_changes": [
+		{"address": "dynatrace_alerting.ok", "type": "dynatrace_alerting",
+		 "change": {"actions": ["create"], "after": {"name": "Ops", "severity_level": "ERROR"}}},
+		{"address": "dynatrace_alerting.bad", "type": "dynatrace_alerting",
+		 "change": {"actions": ["update"], "after": {"name": "Operations team", "severity_level": "BOGUS"}}},
+		{"address": "dynatrace_generic_setting.missing", "type": "dynatrace_generic_setting",
+		 "change": {"actions": ["create"], "after": {"schema": "builtin:missing", "value": "{}"}}},
+		{"address": "dynatrace_generic_setting.broken", "type": "dynatrace_generic_setting",
+		 "change": {"actions": ["create"], "after": {"schema": "builtin:broken", "value": "{}"}}},
+		{"address": "dynatrace_generic_setting.gone", "type": "dynatrace_generic_setting",
+		 "change": {"actions": ["delete"], "after": null}}
+	]}`), &plan)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = checkPlanSchemas(plan)
+	if err == nil {
+		t.Fatal("checkPlanSchemas accepted values violating their schema")
+	}
+	want := []string{
+		"dynatrace_alerting.bad: name: is longer than 10 characters",
+		`dynatrace_alerting.bad: severity_level: "BOGUS" is not one of AVAILABILITY, ERROR`,
+		"dynatrace_generic_setting.missing: schema builtin:missing does not exist in this environment",
+	}
+	for _, violation := range want {
+		if !strings.Contains(err.Error(), violation) {
+			t.Errorf("missing violation %q in:\n%v", violation, err)
+		}
+	}
+	if strings.Contains(err.Error(), "dynatrace_alerting.ok") || strings.Contains(err.Error(), "broken") {
+		t.Errorf("unexpected violations in:\n%v", err)
+	}
+
+	fetches := 0
+	for _, request := range server.Requests() {
+		if request.Path == "/api/v2/settings/schemas/builtin:alerting.profile" {
+			fetches++
+		}
+	}
+	if fetches != 1 {
+		t.Errorf("fetched the alerting profile schema %d times, want once", fetches)
+	}
+}
@@ -0,0 +1,131 @@
+/**
+* @license
+* Copyright 2020 Dynatrace LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// ============================================================
+// API token scopes required by planned changes
+// ============================================================
+
+// Scopes needed by resource types managed through the classic configuration and
+// environment APIs; other dynatrace_ resources are Settings 2.0 objects
+var resourceTypeScopes = map[string][]string{
+	"dynatrace_dashboard":                  {"ReadConfig", "WriteConfig"},
+	"dynatrace_json_dashboard":             {"ReadConfig", "WriteConfig"},
+	"dynatrace_dashboard_sharing":          {"ReadConfig", "WriteConfig"},
+	"dynatrace_notification":               {"ReadConfig", "WriteConfig"},
+	"dynatrace_request_attribute":          {"ReadConfig", "WriteConfig"},
+	"dynatrace_request_naming":             {"ReadConfig", "WriteConfig"},
+	"dynatrace_calculated_service_metric":  {"ReadConfig", "WriteConfig"},
+	"dynatrace_custom_service":             {"ReadConfig", "WriteConfig"},
+	"dynatrace_application_detection_rule": {"ReadConfig", "WriteConfig"},
+	"dynatrace_web_application":            {"ReadConfig", "WriteConfig"},
+	"dynatrace_mobile_application":         {"ReadConfig", "WriteConfig"},
+	"dynatrace_http_monitor":               {"ReadSyntheticData", "ExternalSyntheticIntegration"},
+	"dynatrace_browser_monitor":            {"ReadSyntheticData", "ExternalSyntheticIntegration"},
+	"dynatrace_synthetic_location":         {"ReadSyntheticData", "ExternalSyntheticIntegration"},
+	"dynatrace_slo":                        {"slo.read", "slo.write"},
+	"dynatrace_slo_v2":                     {"settings.read", "settings.write"},
+	"dynatrace_credentials":                {"credentialVault.read", "credentialVault.write"},
+	"dynatrace_api_token":                  {"apiTokens.read", "apiTokens.write"},
+	"dynatrace_network_zone":               {"networkZones.read", "networkZones.write"},
+}
+
+// Resource types authenticated with OAuth or platform tokens rather than the API token
+var nonTokenResourcePrefixes = append([]string{"dynatrace_iam_"}, platformResourcePrefixes...)
+
+// Set when the API token's scopes are checked against each plan before apply
+var planScopeCheck bool
+
+// Enable the scope check for API token runs unless scope_check = false
+func setupScopeCheck(config map[string]string) {
+	planScopeCheck = getEnv("DT_API_TOKEN") != "" && config["scope_check"] != "false"
+}
+
+// Scopes a Dynatrace resource type needs, nil if the API token is not used for it
+func scopesForResourceType(resourceType string) []string {
+	if !strings.HasPrefix(resourceType, "dynatrace_") {
+		return nil
+	}
+	for _, prefix := range nonTokenResourcePrefixes {
+		if strings.HasPrefix(resourceType, prefix) {
+			return nil
+		}
+	}
+	if scopes, found := resourceTypeScopes[resourceType]; found {
+		return scopes
+	}
+	return []string{"settings.read", "settings.write"}
+}
+
+// Compare the scopes needed by the plan's changes with those of the API token
+// and list the missing ones together with the resource types needing them
+func checkPlanScopes(plan planChanges) error {
+	if !planScopeCheck {
+		return nil
+	}
+
+	neededBy := make(map[string][]string)
+	for _, change := range plan.ResourceChanges {
+		if len(change.Change.Actions) == 1 && change.Change.Actions[0] == "no-op" {
+			continue
+		}
+		for _, scope := range scopesForResourceType(change.Type) {
+			if !slices.Contains(neededBy[scope], change.Type) {
+				neededBy[scope] = append(neededBy[scope], change.Type)
+			}
+		}
+	}
+	if len(neededBy) == 0 {
+		return nil
+	}
+
+	info, err := lookupAPIToken(getEnv("DT_ENV_URL"), getEnv("DT_API_TOKEN"))
+	var apiErr *apiError
+	if err != nil && !errors.As(err, &apiErr) {
+		fmt.Printf("Warning: could not check API token scopes: %v\n", err)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to look up API token scopes: %w", err)
+	}
+
+	needed := make([]string, 0, len(neededBy))
+	for scope := range neededBy {
+		needed = append(needed, scope)
+	}
+	sort.Strings(needed)
+	missing := missingScopes(needed, info.Scopes)
+	if len(missing) == 0 {
+		publishf("guard", "info", "API token has the %d scope(s) the plan needs", len(needed))
+		return nil
+	}
+
+	lines := make([]string, 0, len(missing))
+	for _, scope := range missing {
+		lines = append(lines, fmt.Sprintf("%s (needed by %s)", scope, strings.Join(neededBy[scope], ", ")))
+	}
+	return fmt.Errorf("API token %q lacks scopes the plan needs; add:\n  %s", info.Name, strings.Join(lines, "\n  "))
+}
@@ -0,0 +1,107 @@
+/**
+* @license
+* Copyright 2020 Dynatrace LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package main
+
+import (
+	"bytes"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Replacement for scrubbed secrets
+const scrubbedValue = "********"
+
+// ============================================================
+// Credential scrubbing of log and console output
+// ============================================================
+
+// Dynatrace tokens keep their public prefix and ID ("dt0c01.ABC") and lose the
+// secret part; bearer and Api-Token authorization values are masked entirely
+var (
+	dynatraceTokenPattern = regexp.MustCompile(`\b(dt0[a-z][0-9]{2}\.[A-Za-z0-9]+)\.[A-Za-z0-9]+`)
+	authorizationPattern  = regexp.MustCompile(`(?i)\b(bearer|api-token)(\s+)[A-Za-z0-9_.~+/=-]+`)
+)
+
+// Mask token-shaped strings and the values of the secrets in the environment
+func scrubSecrets(text string) string {
+	text = dynatraceTokenPattern.ReplaceAllString(text, "$1."+scrubbedValue)
+	text = authorizationPattern.ReplaceAllString(text, "$1$2"+scrubbedValue)
+	exported := exportedEnvSnapshot()
+	envKeys := make([]string, 0, len(exported)+len(builtinEnvKeys))
+	for envKey := range exported {
+		envKeys = append(envKeys, envKey)
+	}
+	for envKey := range builtinEnvKeys {
+		envKeys = append(envKeys, envKey)
+	}
+	for _, envKey := range envKeys {
+		if !isSecretKey(envKey) {
+			continue
+		}
+		// Short values would mask unrelated text
+		if value := getEnv(envKey); len(value) >= 8 {
+			text = strings.ReplaceAll(text, value, scrubbedValue)
+		}
+	}
+	return text
+}
+
+// Writer that scrubs secrets before passing output on; the last word of a write
+// is held back until whitespace follows so tokens split across writes are caught
+type scrubWriter struct {
+	mu      sync.Mutex
+	w       io.Writer
+	pending []byte
+}
+
+func newScrubWriter(w io.Writer) *scrubWriter {
+	return &scrubWriter{w: w}
+}
+
+func (s *scrubWriter) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.pending = append(s.pending, p...)
+	cut := bytes.LastIndexAny(s.pending, " \t\r\n") + 1
+	if len(s.pending)-cut > 64*1024 {
+		cut = len(s.pending)
+	}
+	if cut == 0 {
+		return len(p), nil
+	}
+	if _, err := io.WriteString(s.w, scrubSecrets(string(s.pending[:cut]))); err != nil {
+		return 0, err
+	}
+	s.pending = append(s.pending[:0], s.pending[cut:]...)
+	return len(p), nil
+}
+
+// Write out any held-back output
+func (s *scrubWriter) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.pending) == 0 {
+		return nil
+	}
+	_, err := io.WriteString(s.w, scrubSecrets(string(s.pending)))
+	s.pending = s.pending[:0]
+	return err
+}
@@ -0,0 +1,196 @@
+/**
+* @license
+* Copyright 2020 Dynatrace LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ============================================================
+// Session cache of prompted credentials
+// ============================================================
+
+// How long prompted values are reused, from session_cache_ttl; 0 disables the cache
+var sessionCacheTTL time.Duration
+
+// Cached value with its expiry
+type sessionEntry struct {
+	Value   string    `json:"value"`
+	Expires time.Time `json:"expires"`
+}
+
+// Enable the session cache when session_cache_ttl is set
+func setupSessionCache(config map[string]string) error {
+	sessionCacheTTL = 0
+	value := config["session_cache_ttl"]
+	if value == "" {
+		return nil
+	}
+	ttl, err := time.ParseDuration(value)
+	if err != nil {
+		return fmt.Errorf("invalid session_cache_ttl: %w", err)
+	}
+	sessionCacheTTL = ttl
+	return nil
+}
+
+// Keychain account holding the session cache key
+const sessionKeyAccount = "session-cache-key"
+
+// Directory holding the cache, outside the package directory
+func sessionCacheDir() (string, error) {
+	cacheHome, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(cacheHome, "dt-tf-wrapper"), nil
+}
+
+// Entries are scoped to the package directory and the tenant URL in use; the
+// URL itself only to the directory
+func sessionCacheKey(envKey string) string {
+	dir, _ := os.Getwd()
+	envURL := ""
+	if envKey != "DT_ENV_URL" {
+		envURL = getEnv("DT_ENV_URL")
+	}
+	sum := sha256.Sum256([]byte(dir + "\n" + hashEnvironmentURL(envURL)))
+	return hex.EncodeToString(sum[:8]) + "/" + envKey
+}
+
+// AES-GCM cipher keyed by a random key kept in the OS keychain rather than next
+// to the cache; without a usable keychain nothing is cached
+func sessionCipher(create bool) (cipher.AEAD, error) {
+	encoded, err := keychainGet(keychainService, sessionKeyAccount)
+	if (err != nil || encoded == "") && create {
+		key := make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+		encoded = hex.EncodeToString(key)
+		if err = keychainSet(keychainService, sessionKeyAccount, encoded); err != nil {
+			return nil, fmt.Errorf("no OS keychain to keep the cache key in: %w", err)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	key, err := hex.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Decrypt the cache, dropping expired entries
+func loadSessionCache(dir string, aead cipher.AEAD) map[string]sessionEntry {
+	entries := make(map[string]sessionEntry)
+	data, err := os.ReadFile(filepath.Join(dir, "session.cache"))
+	if err != nil || len(data) < aead.NonceSize() {
+		return entries
+	}
+	plain, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], nil)
+	if err != nil || json.Unmarshal(plain, &entries) != nil {
+		return make(map[string]sessionEntry)
+	}
+	for key, entry := range entries {
+		if time.Now().After(entry.Expires) {
+			delete(entries, key)
+		}
+	}
+	return entries
+}
+
+// Look up a prompted value cached by an earlier run
+func lookupSessionCache(envKey string) (string, bool) {
+	if sessionCacheTTL <= 0 {
+		return "", false
+	}
+	dir, err := sessionCacheDir()
+	if err != nil {
+		return "", false
+	}
+	aead, err := sessionCipher(false)
+	if err != nil {
+		return "", false
+	}
+	entry, found := loadSessionCache(dir, aead)[sessionCacheKey(envKey)]
+	return entry.Value, found
+}
+
+// Cache a prompted value for session_cache_ttl
+func storeSessionCache(envKey, value string) {
+	if sessionCacheTTL <= 0 || value == "" {
+		return
+	}
+	err := func() error {
+		dir, err := sessionCacheDir()
+		if err != nil {
+			return err
+		}
+		aead, err := sessionCipher(true)
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return err
+		}
+		entries := loadSessionCache(dir, aead)
+		entries[sessionCacheKey(envKey)] = sessionEntry{Value: value, Expires: time.Now().Add(sessionCacheTTL)}
+		plain, err := json.Marshal(entries)
+		if err != nil {
+			return err
+		}
+		nonce := make([]byte, aead.NonceSize())
+		if _, err := rand.Read(nonce); err != nil {
+			return err
+		}
+		return os.WriteFile(filepath.Join(dir, "session.cache"), aead.Seal(nonce, nonce, plain, nil), 0600)
+	}()
+	if err != nil {
+		fmt.Printf("Warning: not caching %s for this session: %v\n", envKey, err)
+	}
+}
+
+// Remove the session cache
+func forgetSessionCredentials() error {
+	dir, err := sessionCacheDir()
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(filepath.Join(dir, "session.cache")); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	fmt.Println("Cleared cached session credentials.")
+	return nil
+}
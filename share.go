@@ -0,0 +1,219 @@
+/**
+* @license
+* Copyright 2020 Dynatrace LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ============================================================
+// Share plan report via temporary local web server
+// ============================================================
+
+type planLine struct {
+	Class string
+	Text  string
+}
+
+var planReportTemplate = template.Must(template.New("plan").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Terraform plan</title>
+<style>
+body { font-family: sans-serif; margin: 2em; background: #fafafa; }
+pre { background: #1e1e1e; color: #d4d4d4; padding: 1em; border-radius: 4px; overflow-x: auto; }
+.add { color: #6a9955; }
+.change { color: #dcdcaa; }
+.destroy { color: #f44747; }
+.replace { color: #ce9178; }
+.header { color: #ffffff; font-weight: bold; }
+.summary { color: #569cd6; font-weight: bold; }
+</style>
+</head>
+<body>
+<h1>Terraform plan</h1>
+<p>Generated {{.Generated}}</p>
+<pre>{{range .Lines}}<span class="{{.Class}}">{{.Text}}</span>
+{{end}}</pre>
+</body>
+</html>
+`))
+
+// Run a Terraform plan and capture its output for rendering
+func capturePlanOutput(terraformPath string, logFile *os.File) (string, error) {
+	var out bytes.Buffer
+	args := append([]string{"plan", "-no-color"}, targetArgs()...)
+	args = append(args, replaceArgs()...)
+	cmd := terraformCommand(terraformPath, append(args, variableArgs...)...)
+	if logFile != nil {
+		scrubbedLog := newScrubWriter(logFile)
+		defer scrubbedLog.Flush()
+		cmd.Stdout = io.MultiWriter(scrubbedLog, &out)
+		cmd.Stderr = io.MultiWriter(scrubbedLog, &out)
+	} else {
+		cmd.Stdout = &out
+		cmd.Stderr = &out
+	}
+	release, err := acquireState()
+	if err != nil {
+		return "", err
+	}
+	defer release()
+	err = cmd.Run()
+	return scrubSecrets(out.String()), err
+}
+
+// Classify plan output lines for highlighting
+func classifyPlanLines(output string) []planLine {
+	var lines []planLine
+	for _, text := range strings.Split(strings.TrimRight(output, "\n"), "\n") {
+		trimmed := strings.TrimSpace(text)
+		class := ""
+		switch {
+		case strings.HasPrefix(trimmed, "-/+"), strings.HasPrefix(trimmed, "+/-"):
+			class = "replace"
+		case strings.HasPrefix(trimmed, "+"):
+			class = "add"
+		case strings.HasPrefix(trimmed, "~"):
+			class = "change"
+		case strings.HasPrefix(trimmed, "-"):
+			class = "destroy"
+		case strings.HasPrefix(trimmed, "#"):
+			class = "header"
+		case strings.HasPrefix(trimmed, "Plan:"), strings.HasPrefix(trimmed, "No changes."):
+			class = "summary"
+		}
+		lines = append(lines, planLine{Class: class, Text: text})
+	}
+	return lines
+}
+
+// Render plan report as HTML
+func renderPlanReport(output string) ([]byte, error) {
+	var buf bytes.Buffer
+	err := planReportTemplate.Execute(&buf, struct {
+		Generated string
+		Lines     []planLine
+	}{
+		Generated: time.Now().Format(time.RFC1123),
+		Lines:     classifyPlanLines(output),
+	})
+	return buf.Bytes(), err
+}
+
+// Generate random token for one-time access
+func generateShareToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Serve the plan report on localhost until it times out or the one-time token is used
+func sharePlan(terraformPath string, logFile *os.File, port int, oneTime bool, timeout time.Duration) error {
+	if err := checkStateTarget(terraformPath, logFile); err != nil {
+		return err
+	}
+	fmt.Println("\nRunning Terraform plan for sharing...")
+	output, err := capturePlanOutput(terraformPath, logFile)
+	if err != nil {
+		return fmt.Errorf("plan failed: %w", err)
+	}
+
+	report, err := renderPlanReport(output)
+	if err != nil {
+		return fmt.Errorf("failed to render plan report: %w", err)
+	}
+
+	token := ""
+	if oneTime {
+		if token, err = generateShareToken(); err != nil {
+			return fmt.Errorf("failed to generate access token: %w", err)
+		}
+	}
+
+	listener, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+	if err != nil {
+		return fmt.Errorf("failed to listen on port %d: %w", port, err)
+	}
+
+	var mu sync.Mutex
+	done := make(chan struct{})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		if oneTime {
+			mu.Lock()
+			valid := token != "" && r.URL.Query().Get("token") == token
+			if valid {
+				token = ""
+			}
+			mu.Unlock()
+			if !valid {
+				http.Error(w, "Invalid or already used link", http.StatusForbidden)
+				return
+			}
+			defer close(done)
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		w.Write(report)
+	})
+
+	url := fmt.Sprintf("http://%s/", listener.Addr())
+	if oneTime {
+		url += "?token=" + token
+	}
+
+	server := &http.Server{Handler: mux}
+	go server.Serve(listener)
+
+	fmt.Printf("Plan report available at %s\n", url)
+	if oneTime {
+		fmt.Println("The link can be opened once.")
+	}
+	fmt.Printf("Server stops automatically after %s (Ctrl+C to stop now).\n", timeout)
+
+	select {
+	case <-done:
+		fmt.Println("Plan report viewed; stopping server.")
+	case <-time.After(timeout):
+		fmt.Println("Share timeout reached; stopping server.")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return server.Shutdown(ctx)
+}
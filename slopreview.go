@@ -0,0 +1,173 @@
+/**
+* @license
+* Copyright 2020 Dynatrace LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+)
+
+// Evaluation window of SLOs that do not set one
+const defaultSLOWindow = "-1w"
+
+// Set when planned SLOs are evaluated against current data before apply
+var planSLOPreview bool
+
+// Attribute names of the SLO resource types: expression, entity filter,
+// evaluation window, target and warning threshold
+var sloAttributes = map[string][5]string{
+	"dynatrace_slo":    {"metric_expression", "filter", "timeframe", "target", "warning"},
+	"dynatrace_slo_v2": {"metric_expression", "filter", "evaluation_window", "target_success", "target_warning"},
+}
+
+// ============================================================
+// Evaluate planned SLOs against current data
+// ============================================================
+
+// Enable the SLO preview for API token runs unless slo_preview = false
+func setupSLOPreview(config map[string]string) {
+	planSLOPreview = getEnv("DT_API_TOKEN") != "" && config["slo_preview"] != "false"
+}
+
+// Number of a planned attribute, which Terraform encodes as a JSON number
+func sloNumber(value any) (float64, bool) {
+	number, ok := value.(float64)
+	return number, ok
+}
+
+// Worst current value of an SLO metric expression over the evaluation window,
+// restricted to the entities of filter when set; false when there is no data
+func evaluateSLO(expression, filter, window string) (float64, bool, error) {
+	query := url.Values{}
+	query.Set("metricSelector", expression)
+	query.Set("from", window)
+	query.Set("resolution", "Inf")
+	if filter != "" {
+		query.Set("entitySelector", filter)
+	}
+	var response struct {
+		Result []struct {
+			Data []struct {
+				Values []*float64 `json:"values"`
+			} `json:"data"`
+		} `json:"result"`
+	}
+	if err := dynatraceGet("/api/v2/metrics/query?"+query.Encode(), &response); err != nil {
+		return 0, false, err
+	}
+
+	var values []float64
+	for _, result := range response.Result {
+		for _, series := range result.Data {
+			for _, value := range series.Values {
+				if value != nil {
+					values = append(values, *value)
+				}
+			}
+		}
+	}
+	if len(values) == 0 {
+		return 0, false, nil
+	}
+	return slices.Min(values), true, nil
+}
+
+// Preview one planned SLO; returns the finding to report, empty when the SLO
+// currently meets its target
+func previewSLO(resourceType string, after map[string]any) (string, error) {
+	attributes := sloAttributes[resourceType]
+	expression, _ := after[attributes[0]].(string)
+	if expression == "" {
+		// Unknown until apply, e.g. computed from another resource
+		return "", nil
+	}
+	filter, _ := after[attributes[1]].(string)
+	window, _ := after[attributes[2]].(string)
+	if window == "" {
+		window = defaultSLOWindow
+	}
+
+	if filter != "" {
+		count, err := countEntities(filter)
+		if err != nil {
+			return "", err
+		}
+		if count == 0 {
+			return fmt.Sprintf("filter %s matches no entities", strconv.Quote(filter)), nil
+		}
+	}
+	value, found, err := evaluateSLO(expression, filter, window)
+	if err != nil {
+		return "", err
+	}
+	if !found {
+		return fmt.Sprintf("metric expression returns no data over %s", window), nil
+	}
+
+	current := strconv.FormatFloat(value, 'f', 2, 64)
+	if target, ok := sloNumber(after[attributes[3]]); ok && value < target {
+		return fmt.Sprintf("currently %s over %s, below the target of %g; the SLO would be violated as soon as it is applied", current, window, target), nil
+	}
+	if warning, ok := sloNumber(after[attributes[4]]); ok && value < warning {
+		return fmt.Sprintf("currently %s over %s, below the warning threshold of %g", current, window, warning), nil
+	}
+	return "", nil
+}
+
+// Warn about planned SLOs whose target is already violated by current data or
+// whose filter matches no entities; never blocks the apply
+func previewPlannedSLOs(plan planChanges) {
+	if !planSLOPreview {
+		return
+	}
+
+	var findings []string
+	evaluated := 0
+	for _, change := range plan.ResourceChanges {
+		if _, isSLO := sloAttributes[change.Type]; !isSLO {
+			continue
+		}
+		if !slices.Contains(change.Change.Actions, "create") && !slices.Contains(change.Change.Actions, "update") {
+			continue
+		}
+		after, _ := change.Change.After.(map[string]any)
+		finding, err := previewSLO(change.Type, after)
+		if err != nil {
+			fmt.Printf("Warning: could not evaluate %s: %v\n", change.Address, err)
+			continue
+		}
+		evaluated++
+		if finding != "" {
+			findings = append(findings, change.Address+": "+finding)
+		}
+	}
+
+	if len(findings) > 0 {
+		publishf("guard", "warning", "%d of %d planned SLO(s) need attention", len(findings), evaluated)
+		fmt.Println("\nWarning: planned SLOs evaluated against current data:")
+		for _, finding := range findings {
+			fmt.Printf("  %s\n", finding)
+		}
+		return
+	}
+	if evaluated > 0 {
+		publishf("guard", "info", "%d planned SLO(s) meet their targets on current data", evaluated)
+	}
+}
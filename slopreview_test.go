@@ -0,0 +1,107 @@
+/**
+* @license
+* Copyright 2020 Dynatrace LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package main
+
+import (
+	"net/url"
+	"testing"
+
+	"dynatrace-terraform-wrapper/internal/dttest"
+)
+
+func TestPreviewSLO(t *testing.T) {
+	server := newTestServer(t)
+	useTestEnvironment(t, server, "metrics.read", "entities.read")
+
+	server.AddEntity(dttest.Entity{Type: "SERVICE", DisplayName: "checkout", Tags: []string{"shop"}})
+	server.AddMetricData("builtin:service.successRate", 99.2, 99.9)
+	server.AddMetricData("builtin:service.availability", 97.5, 98.9)
+	server.AddMetricData("builtin:synthetic.availability")
+
+	tests := []struct {
+		name         string
+		resourceType string
+		after        string
+		want         string
+		wantErr      bool
+	}{
+		{
+			"meets target", "dynatrace_slo",
+			`{"metric_expression": "builtin:service.successRate", "filter": "type(\"SERVICE\"),tag(\"shop\")", "target": 99, "warning": 99.1}`,
+			"", false,
+		},
+		{
+			"violated target", "dynatrace_slo",
+			`{"metric_expression": "builtin:service.availability", "timeframe": "-1d", "target": 98, "warning": 99}`,
+			"currently 97.50 over -1d, below the target of 98; the SLO would be violated as soon as it is applied", false,
+		},
+		{
+			"below warning", "dynatrace_slo_v2",
+			`{"metric_expression": "builtin:service.successRate", "target_success": 95, "target_warning": 99.5}`,
+			"currently 99.20 over -1w, below the warning threshold of 99.5", false,
+		},
+		{
+			"no data", "dynatrace_slo_v2",
+			`{"metric_expression": "builtin:synthetic.availability", "evaluation_window": "-2w", "target_success": 95}`,
+			"metric expression returns no data over -2w", false,
+		},
+		{
+			"filter matching nothing", "dynatrace_slo",
+			`{"metric_expression": "builtin:service.successRate", "filter": "type(\"SERVICE\"),tag(\"gone\")", "target": 99}`,
+			`filter "type(\"SERVICE\"),tag(\"gone\")" matches no entities`, false,
+		},
+		{
+			"expression known after apply", "dynatrace_slo_v2",
+			`{"target_success": 95}`,
+			"", false,
+		},
+		{
+			"unknown metric", "dynatrace_slo_v2",
+			`{"metric_expression": "builtin:unknown", "target_success": 95}`,
+			"", true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := previewSLO(test.resourceType, plannedValues(t, test.after))
+			if test.wantErr {
+				if err == nil {
+					t.Errorf("previewSLO = %q, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("previewSLO: %v", err)
+			}
+			if got != test.want {
+				t.Errorf("previewSLO = %q, want %q", got, test.want)
+			}
+		})
+	}
+
+	filtered := 0
+	for _, request := range server.Requests() {
+		query, _ := url.ParseQuery(request.Query)
+		if request.Path == "/api/v2/metrics/query" && query.Get("entitySelector") == `type("SERVICE"),tag("shop")` {
+			filtered++
+		}
+	}
+	if filtered != 1 {
+		t.Errorf("%d metrics queries restricted to the SLO filter, want 1", filtered)
+	}
+}
@@ -0,0 +1,253 @@
+/**
+* @license
+* Copyright 2020 Dynatrace LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Set by -stacks: plan, apply or destroy every stack in the stacks list
+var cliStacksAction string
+
+// Stack of a bundle: a subdirectory run on its own, after the stacks it depends on
+type stack struct {
+	Name      string
+	Dir       string
+	DependsOn []string
+}
+
+// Outcome of running one stack
+type stackResult struct {
+	Stack    stack
+	ExitCode int
+	Skipped  string
+	Duration time.Duration
+}
+
+// ============================================================
+// Stacks
+// ============================================================
+
+// Stacks from the comma-separated stacks key with stack.<name>.dir (default
+// the name) and stack.<name>.depends_on, ordered so dependencies come first
+func parseStacks(config map[string]string) ([]stack, error) {
+	var stacks []stack
+	byName := make(map[string]stack)
+	for _, name := range strings.Split(config["stacks"], ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		if _, found := byName[name]; found {
+			return nil, fmt.Errorf("stack %s is listed twice", name)
+		}
+		s := stack{Name: name, Dir: name}
+		if dir := config["stack."+name+".dir"]; dir != "" {
+			s.Dir = dir
+		}
+		for _, dependency := range strings.Split(config["stack."+name+".depends_on"], ",") {
+			if dependency = strings.TrimSpace(dependency); dependency != "" {
+				s.DependsOn = append(s.DependsOn, dependency)
+			}
+		}
+		stacks = append(stacks, s)
+		byName[name] = s
+	}
+	for _, s := range stacks {
+		for _, dependency := range s.DependsOn {
+			if _, found := byName[dependency]; !found {
+				return nil, fmt.Errorf("stack %s depends on unknown stack %s", s.Name, dependency)
+			}
+		}
+	}
+
+	// Depth-first topological sort keeping the listed order where possible
+	var ordered []stack
+	state := make(map[string]int) // 1 visiting, 2 done
+	var visit func(s stack, path []string) error
+	visit = func(s stack, path []string) error {
+		switch state[s.Name] {
+		case 1:
+			return fmt.Errorf("stack dependencies form a cycle: %s", strings.Join(append(path, s.Name), " -> "))
+		case 2:
+			return nil
+		}
+		state[s.Name] = 1
+		for _, dependency := range s.DependsOn {
+			if err := visit(byName[dependency], append(path, s.Name)); err != nil {
+				return err
+			}
+		}
+		state[s.Name] = 2
+		ordered = append(ordered, s)
+		return nil
+	}
+	for _, s := range stacks {
+		if err := visit(s, nil); err != nil {
+			return nil, err
+		}
+	}
+	return ordered, nil
+}
+
+// Wrapper arguments of this run without -stacks and -chdir, for running a stack
+func stackChildArgs() []string {
+	var args []string
+	skipValue := false
+	for _, arg := range os.Args[1:] {
+		if skipValue {
+			skipValue = false
+			continue
+		}
+		name, _, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if strings.HasPrefix(arg, "-") && (name == "stacks" || name == "chdir") {
+			skipValue = !hasValue
+			continue
+		}
+		args = append(args, arg)
+	}
+	return args
+}
+
+// Run action (plan, apply or destroy) in every stack in dependency order, or
+// reverse order for destroy, skipping stacks whose dependencies failed; the
+// stacks run as separate wrapper processes sharing the resolved credentials
+func runStacks(config map[string]string, action string) int {
+	if action != "plan" && action != "apply" && action != "destroy" {
+		log.Printf("-stacks must be plan, apply or destroy, got %q", action)
+		return exitFailure
+	}
+	stacks, err := parseStacks(config)
+	if err != nil {
+		log.Printf("Error reading stacks: %v", err)
+		return exitFailure
+	}
+	if len(stacks) == 0 {
+		log.Printf("No stacks configured; list them in the stacks key of %s", activeConfigFile())
+		return exitFailure
+	}
+	if action == "destroy" {
+		slices.Reverse(stacks)
+	}
+	executable, err := os.Executable()
+	if err != nil {
+		log.Printf("Error locating the wrapper executable: %v", err)
+		return exitFailure
+	}
+
+	failed := make(map[string]bool)
+	var results []stackResult
+	for _, s := range stacks {
+		result := stackResult{Stack: s}
+		for _, other := range stacks {
+			blocking := slices.Contains(s.DependsOn, other.Name)
+			if action == "destroy" {
+				blocking = slices.Contains(other.DependsOn, s.Name)
+			}
+			if blocking && failed[other.Name] {
+				result.Skipped = "stack " + other.Name + " failed"
+			}
+		}
+		if result.Skipped != "" {
+			failed[s.Name] = true
+			results = append(results, result)
+			continue
+		}
+
+		fmt.Printf("\n==> Stack %s (%s): %s\n", s.Name, s.Dir, action)
+		args := append([]string{"-chdir", s.Dir, "-" + action}, stackChildArgs()...)
+		cmd := exec.Command(executable, args...)
+		// Stack directories are relative to the bundle, not to working_dir
+		cmd.Dir = bundlePath(".")
+		cmd.Env = terraformEnv()
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+		started := time.Now()
+		err := cmd.Run()
+		result.Duration = time.Since(started).Round(time.Second)
+		var exitErr *exec.ExitError
+		switch {
+		case errors.As(err, &exitErr):
+			result.ExitCode = exitErr.ExitCode()
+		case err != nil:
+			result.ExitCode = exitFailure
+		}
+		if result.ExitCode != exitOK && !(action == "plan" && result.ExitCode == exitChanges) {
+			failed[s.Name] = true
+		}
+		results = append(results, result)
+	}
+	code := reportStacks(action, results)
+	var runErr error
+	if code != exitOK && code != exitChanges {
+		var failedStacks, skippedStacks []string
+		for _, result := range results {
+			switch {
+			case result.Skipped != "":
+				skippedStacks = append(skippedStacks, result.Stack.Name)
+			case failed[result.Stack.Name]:
+				failedStacks = append(failedStacks, result.Stack.Name)
+			}
+		}
+		detail := "failed: " + strings.Join(failedStacks, ", ")
+		if len(skippedStacks) > 0 {
+			detail += "; skipped: " + strings.Join(skippedStacks, ", ")
+		}
+		runErr = errors.New(detail)
+	}
+	recordAudit("stacks "+action, runErr)
+	return code
+}
+
+// Print the outcome of each stack and return the exit code of the whole run:
+// the first failure, else exitChanges when a plan has changes
+func reportStacks(action string, results []stackResult) int {
+	fmt.Printf("\nStacks %s summary:\n", action)
+	code := exitOK
+	for _, result := range results {
+		var outcome string
+		switch {
+		case result.Skipped != "":
+			outcome = "skipped: " + result.Skipped
+		case result.ExitCode == exitOK && action == "plan":
+			outcome = "no changes"
+		case result.ExitCode == exitOK:
+			outcome = "succeeded"
+		case result.ExitCode == exitChanges && action == "plan":
+			outcome = "changes planned"
+			if code == exitOK {
+				code = exitChanges
+			}
+		default:
+			outcome = fmt.Sprintf("failed (exit code %d)", result.ExitCode)
+			if code == exitOK || code == exitChanges {
+				code = result.ExitCode
+			}
+		}
+		if result.Skipped == "" {
+			outcome += " in " + result.Duration.String()
+		}
+		fmt.Printf("  %-20s %-20s %s\n", result.Stack.Name, result.Stack.Dir, outcome)
+	}
+	return code
+}
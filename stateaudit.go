@@ -0,0 +1,321 @@
+/**
+* @license
+* Copyright 2020 Dynatrace LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Classic API endpoints for a resource type: the item path (with the ID as %s),
+// the list path, and the list's collection and ID fields
+type classicEndpoint struct {
+	Item       string
+	List       string
+	Collection string
+	IDField    string
+}
+
+// Resource types backed by classic configuration APIs
+var classicEndpoints = map[string]classicEndpoint{
+	"dynatrace_dashboard":                 {"/api/config/v1/dashboards/%s", "/api/config/v1/dashboards", "dashboards", "id"},
+	"dynatrace_json_dashboard":            {"/api/config/v1/dashboards/%s", "/api/config/v1/dashboards", "dashboards", "id"},
+	"dynatrace_http_monitor":              {"/api/v1/synthetic/monitors/%s", "/api/v1/synthetic/monitors?type=HTTP", "monitors", "entityId"},
+	"dynatrace_browser_monitor":           {"/api/v1/synthetic/monitors/%s", "/api/v1/synthetic/monitors?type=BROWSER", "monitors", "entityId"},
+	"dynatrace_calculated_service_metric": {"/api/config/v1/calculatedMetrics/service/%s", "/api/config/v1/calculatedMetrics/service", "values", "id"},
+	"dynatrace_request_attribute":         {"/api/config/v1/service/requestAttributes/%s", "/api/config/v1/service/requestAttributes", "values", "id"},
+}
+
+// Resource types backed by Settings 2.0 objects, by schema
+var settingsSchemas = map[string]string{
+	"dynatrace_alerting":           "builtin:alerting.profile",
+	"dynatrace_autotag_v2":         "builtin:tags.auto-tagging",
+	"dynatrace_maintenance":        "builtin:alerting.maintenance-window",
+	"dynatrace_management_zone_v2": "builtin:management-zones",
+	"dynatrace_slo_v2":             "builtin:monitoring.slo",
+}
+
+// Live object found by listing a resource type's API
+type liveObject struct {
+	Type string
+	ID   string
+	Name string
+}
+
+// Managed resource instance in state with its object ID
+type stateInstance struct {
+	Address string
+	Type    string
+	ID      string
+}
+
+// ============================================================
+// State audit
+// ============================================================
+
+// Managed resource instances in state with the IDs of their objects
+func stateInstances(terraformPath string, logFile *os.File) ([]stateInstance, error) {
+	out, err := outputTerraformCommand(terraformPath, logFile, "state", "pull")
+	if err != nil {
+		return nil, err
+	}
+	return parseStateInstances(out)
+}
+
+// Parse the managed resource instances of a state pull
+func parseStateInstances(out []byte) ([]stateInstance, error) {
+	if len(strings.TrimSpace(string(out))) == 0 {
+		return nil, nil
+	}
+	var state struct {
+		Resources []struct {
+			Module    string `json:"module"`
+			Mode      string `json:"mode"`
+			Type      string `json:"type"`
+			Name      string `json:"name"`
+			Instances []struct {
+				IndexKey   any `json:"index_key"`
+				Attributes struct {
+					ID string `json:"id"`
+				} `json:"attributes"`
+			} `json:"instances"`
+		} `json:"resources"`
+	}
+	if err := json.Unmarshal(out, &state); err != nil {
+		return nil, fmt.Errorf("failed to parse state: %w", err)
+	}
+
+	var instances []stateInstance
+	for _, resource := range state.Resources {
+		if resource.Mode != "managed" {
+			continue
+		}
+		address := resource.Type + "." + resource.Name
+		if resource.Module != "" {
+			address = resource.Module + "." + address
+		}
+		for _, instance := range resource.Instances {
+			instanceAddress := address
+			switch key := instance.IndexKey.(type) {
+			case string:
+				instanceAddress += fmt.Sprintf("[%q]", key)
+			case float64:
+				instanceAddress += fmt.Sprintf("[%d]", int(key))
+			}
+			instances = append(instances, stateInstance{instanceAddress, resource.Type, instance.Attributes.ID})
+		}
+	}
+	return instances, nil
+}
+
+// API path of the object behind a resource instance, or "" for unmapped types
+func objectPath(instance stateInstance) string {
+	if endpoint, ok := classicEndpoints[instance.Type]; ok {
+		return fmt.Sprintf(endpoint.Item, url.PathEscape(instance.ID))
+	}
+	if _, ok := settingsSchemas[instance.Type]; ok {
+		return "/api/v2/settings/objects/" + url.PathEscape(instance.ID)
+	}
+	return ""
+}
+
+// Display name of a settings object value, which schemas keep in different fields
+func settingsObjectName(value map[string]any) string {
+	for _, key := range []string{"name", "displayName", "summary"} {
+		if name, ok := value[key].(string); ok && name != "" {
+			return name
+		}
+	}
+	if general, ok := value["generalProperties"].(map[string]any); ok {
+		if name, ok := general["name"].(string); ok {
+			return name
+		}
+	}
+	return ""
+}
+
+// List the live objects of a resource type
+func listLiveObjects(resourceType string) ([]liveObject, error) {
+	var objects []liveObject
+	if endpoint, ok := classicEndpoints[resourceType]; ok {
+		var page map[string][]map[string]any
+		if err := dynatraceGet(endpoint.List, &page); err != nil {
+			return nil, err
+		}
+		for _, item := range page[endpoint.Collection] {
+			id, _ := item[endpoint.IDField].(string)
+			name, _ := item["name"].(string)
+			objects = append(objects, liveObject{resourceType, id, name})
+		}
+		return objects, nil
+	}
+
+	items, err := listSettingsObjects(settingsSchemas[resourceType])
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range items {
+		objects = append(objects, liveObject{resourceType, item.ObjectID, settingsObjectName(item.Value)})
+	}
+	return objects, nil
+}
+
+// Settings object with its value
+type settingsObject struct {
+	ObjectID string         `json:"objectId"`
+	Value    map[string]any `json:"value"`
+}
+
+// List all settings objects of a schema, following the result pages
+func listSettingsObjects(schemaID string) ([]settingsObject, error) {
+	var objects []settingsObject
+	path := "/api/v2/settings/objects?schemaIds=" + url.QueryEscape(schemaID) + "&fields=objectId,value&pageSize=500"
+	for path != "" {
+		var page struct {
+			Items       []settingsObject `json:"items"`
+			NextPageKey string           `json:"nextPageKey"`
+		}
+		if err := dynatraceGet(path, &page); err != nil {
+			return nil, err
+		}
+		objects = append(objects, page.Items...)
+		path = ""
+		if page.NextPageKey != "" {
+			path = "/api/v2/settings/objects?nextPageKey=" + url.QueryEscape(page.NextPageKey)
+		}
+	}
+	return objects, nil
+}
+
+// Cross-reference state against the live environment: report resources whose
+// objects were deleted outside Terraform and, when namingPrefix is set, live
+// objects named like the bundle's that state does not manage. Returns 0 when
+// healthy, 2 when there are findings and 1 on error
+func auditState(terraformPath string, logFile *os.File, namingPrefix string) int {
+	if getEnv("DT_ENV_URL") == "" || getEnv("DT_API_TOKEN") == "" {
+		fmt.Fprintln(os.Stderr, "State audit requires DT_ENV_URL and DT_API_TOKEN.")
+		return exitFailure
+	}
+	instances, err := stateInstances(terraformPath, logFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "State audit failed: %v\n", err)
+		recordAudit("state-audit", err)
+		return exitFailure
+	}
+	return auditStateInstances(instances, namingPrefix)
+}
+
+// Audit the resource instances of a state against the live environment and
+// print the findings
+func auditStateInstances(instances []stateInstance, namingPrefix string) int {
+	var missing []stateInstance
+	var unchecked []string
+	managed := make(map[string]bool)
+	for _, instance := range instances {
+		managed[instance.ID] = true
+		path := objectPath(instance)
+		if path == "" || instance.ID == "" {
+			unchecked = append(unchecked, instance.Address)
+			continue
+		}
+		err := dynatraceGet(path, nil)
+		var apiErr *apiError
+		switch {
+		case err == nil:
+		case errors.As(err, &apiErr) && apiErr.StatusCode == 404:
+			missing = append(missing, instance)
+		default:
+			unchecked = append(unchecked, fmt.Sprintf("%s (%v)", instance.Address, err))
+		}
+	}
+
+	var unmanaged []liveObject
+	if namingPrefix != "" {
+		types := make([]string, 0, len(classicEndpoints)+len(settingsSchemas))
+		for resourceType := range classicEndpoints {
+			types = append(types, resourceType)
+		}
+		for resourceType := range settingsSchemas {
+			types = append(types, resourceType)
+		}
+		sort.Strings(types)
+		seen, listed := make(map[string]bool), make(map[string]bool)
+		for _, resourceType := range types {
+			// Types sharing an API (dashboards and JSON dashboards) are listed once
+			if endpoint, ok := classicEndpoints[resourceType]; ok {
+				if listed[endpoint.List] {
+					continue
+				}
+				listed[endpoint.List] = true
+			}
+			objects, err := listLiveObjects(resourceType)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: could not list %s objects: %v\n", resourceType, err)
+				continue
+			}
+			for _, object := range objects {
+				if strings.HasPrefix(object.Name, namingPrefix) && !managed[object.ID] && !seen[object.ID] {
+					seen[object.ID] = true
+					unmanaged = append(unmanaged, object)
+				}
+			}
+		}
+	}
+
+	fmt.Printf("Audited %d resource instance(s) in state.\n", len(instances))
+	if len(missing) > 0 {
+		fmt.Printf("\nDeleted outside Terraform (%d):\n", len(missing))
+		for _, instance := range missing {
+			fmt.Printf("  %s (id %s)\n", instance.Address, instance.ID)
+		}
+		fmt.Println("Remove them from state, or apply to recreate them:")
+		for _, instance := range missing {
+			fmt.Printf("  terraform state rm '%s'\n", instance.Address)
+		}
+	}
+	if len(unmanaged) > 0 {
+		fmt.Printf("\nNamed %q but not managed (%d):\n", namingPrefix, len(unmanaged))
+		for _, object := range unmanaged {
+			fmt.Printf("  %s %q (id %s)\n", object.Type, object.Name, object.ID)
+		}
+		fmt.Println("Import them with -import ADDRESS=ID, or delete them in Dynatrace.")
+	}
+	if len(unchecked) > 0 {
+		fmt.Printf("\nNot checked (%d):\n", len(unchecked))
+		for _, address := range unchecked {
+			fmt.Printf("  %s\n", address)
+		}
+	}
+	if namingPrefix == "" {
+		fmt.Println("\nSet naming_prefix to also report unmanaged objects named like this bundle's.")
+	}
+
+	if len(missing) == 0 && len(unmanaged) == 0 {
+		fmt.Println("\nState is healthy.")
+		recordAudit("state-audit", nil)
+		return exitOK
+	}
+	publishf("state-audit", "warning", "%d deleted outside Terraform, %d unmanaged", len(missing), len(unmanaged))
+	recordAudit("state-audit", fmt.Errorf("%d deleted outside Terraform, %d unmanaged", len(missing), len(unmanaged)))
+	return exitChanges
+}
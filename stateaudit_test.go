@@ -0,0 +1,96 @@
+/**
+* @license
+* Copyright 2020 Dynatrace LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package main
+
+import (
+	"testing"
+
+	"dynatrace-terraform-wrapper/internal/dttest"
+)
+
+func TestAuditStateInstances(t *testing.T) {
+	server := newTestServer(t)
+	useTestEnvironment(t, server, "settings.read", "ReadSyntheticData")
+
+	monitor := server.AddSyntheticMonitor(dttest.SyntheticMonitor{Name: "shop-home", Type: "HTTP", Enabled: true})
+	server.AddSyntheticMonitor(dttest.SyntheticMonitor{Name: "shop-login", Type: "BROWSER", Enabled: true})
+	server.AddSyntheticMonitor(dttest.SyntheticMonitor{Name: "other-home", Type: "HTTP", Enabled: true})
+	profile := server.AddSettingsObject(dttest.SettingsObject{SchemaID: "builtin:alerting.profile", Value: []byte(`{"name": "shop-ops"}`)})
+	server.AddSettingsObject(dttest.SettingsObject{SchemaID: "builtin:management-zones", Value: []byte(`{"name": "other-zone"}`)})
+
+	managed := []stateInstance{
+		{"dynatrace_http_monitor.home", "dynatrace_http_monitor", monitor},
+		{"dynatrace_alerting.ops", "dynatrace_alerting", profile},
+		{"dynatrace_custom_service.api", "dynatrace_custom_service", "svc-1"},
+	}
+	tests := []struct {
+		name         string
+		instances    []stateInstance
+		namingPrefix string
+		want         int
+	}{
+		{"healthy", managed, "", exitOK},
+		{"deleted outside Terraform", append(managed, stateInstance{"dynatrace_alerting.gone", "dynatrace_alerting", "obj-gone"}), "", exitChanges},
+		{"unmanaged object named like the bundle", managed, "shop-", exitChanges},
+		{"no unmanaged object named like the bundle", managed, "team-", exitOK},
+		{"empty state", nil, "", exitOK},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := auditStateInstances(test.instances, test.namingPrefix); got != test.want {
+				t.Errorf("auditStateInstances = %d, want %d", got, test.want)
+			}
+		})
+	}
+}
+
+func TestListLiveObjects(t *testing.T) {
+	server := newTestServer(t)
+	useTestEnvironment(t, server, "settings.read", "ReadSyntheticData")
+
+	server.AddSyntheticMonitor(dttest.SyntheticMonitor{EntityID: "SYNTHETIC_TEST-1", Name: "Home", Type: "HTTP"})
+	server.AddSyntheticMonitor(dttest.SyntheticMonitor{EntityID: "SYNTHETIC_TEST-2", Name: "Login", Type: "BROWSER"})
+	server.AddSettingsObject(dttest.SettingsObject{ObjectID: "obj-1", SchemaID: "builtin:alerting.maintenance-window", Value: []byte(`{"generalProperties": {"name": "Patch day"}}`)})
+	server.AddSettingsObject(dttest.SettingsObject{ObjectID: "obj-2", SchemaID: "builtin:alerting.profile", Value: []byte(`{"name": "Ops"}`)})
+
+	tests := []struct {
+		resourceType string
+		want         []liveObject
+	}{
+		{"dynatrace_http_monitor", []liveObject{{"dynatrace_http_monitor", "SYNTHETIC_TEST-1", "Home"}}},
+		{"dynatrace_browser_monitor", []liveObject{{"dynatrace_browser_monitor", "SYNTHETIC_TEST-2", "Login"}}},
+		{"dynatrace_maintenance", []liveObject{{"dynatrace_maintenance", "obj-1", "Patch day"}}},
+		{"dynatrace_slo_v2", nil},
+	}
+	for _, test := range tests {
+		t.Run(test.resourceType, func(t *testing.T) {
+			got, err := listLiveObjects(test.resourceType)
+			if err != nil {
+				t.Fatalf("listLiveObjects: %v", err)
+			}
+			if len(got) != len(test.want) {
+				t.Fatalf("listLiveObjects = %+v, want %+v", got, test.want)
+			}
+			for i := range got {
+				if got[i] != test.want[i] {
+					t.Errorf("listLiveObjects = %+v, want %+v", got, test.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,228 @@
+/**
+* @license
+* Copyright 2020 Dynatrace LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Directory local state snapshots are kept in, one subdirectory per snapshot
+const stateBackupDirName = "backups"
+
+// Snapshots kept unless state_backup_keep says otherwise
+const defaultStateBackupKeep = 20
+
+// Layout of snapshot directory names
+const stateBackupTimeLayout = "20060102-150405"
+
+// Set by -restore-state: the snapshot to restore, or "list"
+var cliRestoreState string
+
+// Snapshots to keep (0 disables them) and the age after which they are removed (0 keeps them)
+var (
+	stateBackupKeep   = defaultStateBackupKeep
+	stateBackupMaxAge time.Duration
+)
+
+// ============================================================
+// Local state backup and restore
+// ============================================================
+
+// Read state_backup_keep and state_backup_max_age
+func setupStateBackups(config map[string]string) error {
+	stateBackupKeep = defaultStateBackupKeep
+	if value := config["state_backup_keep"]; value != "" {
+		keep, err := strconv.Atoi(value)
+		if err != nil || keep < 0 {
+			return fmt.Errorf("state_backup_keep must be a non-negative integer, got %q", value)
+		}
+		stateBackupKeep = keep
+	}
+	stateBackupMaxAge = 0
+	if value := config["state_backup_max_age"]; value != "" {
+		maxAge, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid state_backup_max_age: %w", err)
+		}
+		stateBackupMaxAge = maxAge
+	}
+	return nil
+}
+
+// Local state file of the current workspace
+func localStatePath() string {
+	if workspace := currentWorkspace(); workspace != "default" {
+		return filepath.Join("terraform.tfstate.d", workspace, "terraform.tfstate")
+	}
+	return "terraform.tfstate"
+}
+
+// Copy a file, creating the target directory
+func copyFile(source, target string) error {
+	content, err := os.ReadFile(source)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(target, content, 0600)
+}
+
+// Snapshot the local state and its backup file before apply or destroy; does
+// nothing for remote backends or when there is no state yet
+func snapshotLocalState() error {
+	if stateBackupKeep == 0 || initializedBackend() != "" {
+		return nil
+	}
+	files := stateFilesAtRest(localStatePath())
+	if _, err := os.Stat(files[0]); err != nil {
+		return nil
+	}
+
+	dir := filepath.Join(stateBackupDirName, time.Now().Format(stateBackupTimeLayout))
+	for _, path := range files {
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		if err := copyFile(path, filepath.Join(dir, path)); err != nil {
+			return fmt.Errorf("failed to snapshot %s: %w", path, err)
+		}
+	}
+	fmt.Printf("State snapshot saved to %s.\n", dir)
+	return pruneStateBackups()
+}
+
+// Snapshot names, oldest first
+func listStateBackups() ([]string, error) {
+	entries, err := os.ReadDir(stateBackupDirName)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, entry := range entries {
+		if _, err := time.Parse(stateBackupTimeLayout, entry.Name()); entry.IsDir() && err == nil {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Remove snapshots beyond state_backup_keep and older than state_backup_max_age
+func pruneStateBackups() error {
+	names, err := listStateBackups()
+	if err != nil {
+		return err
+	}
+	for i, name := range names {
+		created, _ := time.ParseInLocation(stateBackupTimeLayout, name, time.Local)
+		expired := stateBackupMaxAge > 0 && time.Since(created) > stateBackupMaxAge
+		if len(names)-i > stateBackupKeep || expired {
+			if err := os.RemoveAll(filepath.Join(stateBackupDirName, name)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// List the snapshots, or restore the named one after snapshotting the current state
+func restoreState(name string) error {
+	names, err := listStateBackups()
+	if err != nil {
+		return err
+	}
+	if name == "list" {
+		if len(names) == 0 {
+			fmt.Printf("No state snapshots in %s.\n", stateBackupDirName)
+		}
+		for _, name := range names {
+			var files []string
+			filepath.WalkDir(filepath.Join(stateBackupDirName, name), func(path string, entry os.DirEntry, err error) error {
+				if err == nil && !entry.IsDir() {
+					rel, _ := filepath.Rel(filepath.Join(stateBackupDirName, name), path)
+					files = append(files, rel)
+				}
+				return nil
+			})
+			fmt.Printf("%s  %s\n", name, strings.Join(files, ", "))
+		}
+		return nil
+	}
+
+	dir := filepath.Join(stateBackupDirName, name)
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return fmt.Errorf("no state snapshot %s; -restore-state list shows the available ones", name)
+	}
+	switch {
+	case nonInteractive && !forceGuards:
+		return fmt.Errorf("restoring state needs confirmation; rerun with -force in non-interactive mode")
+	case !nonInteractive:
+		fmt.Printf("Replace the local state with the snapshot %s? (y/n): ", name)
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		if strings.ToLower(strings.TrimSpace(answer)) != "y" {
+			fmt.Println("State was not changed.")
+			return nil
+		}
+	}
+
+	// Read the snapshot first; snapshotting the current state may prune it
+	files := make(map[string][]byte)
+	err = filepath.WalkDir(dir, func(path string, entry os.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		files[rel], err = os.ReadFile(path)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", dir, err)
+	}
+	if err := snapshotLocalState(); err != nil {
+		return err
+	}
+	for rel, content := range files {
+		if err = os.MkdirAll(filepath.Dir(rel), 0700); err == nil {
+			err = os.WriteFile(rel, content, 0600)
+		}
+		if err != nil {
+			break
+		}
+	}
+	recordAudit("restore-state", err)
+	if err != nil {
+		return fmt.Errorf("failed to restore %s: %w", name, err)
+	}
+	fmt.Printf("Restored the local state from %s.\n", dir)
+	return nil
+}
@@ -0,0 +1,289 @@
+/**
+* @license
+* Copyright 2020 Dynatrace LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Suffix of encrypted state files
+const encryptedStateSuffix = ".enc"
+
+// Header of encrypted state files, followed by the salt, the nonce and the ciphertext
+const encryptedStateMagic = "DTWSTATE1\n"
+
+// Key derivation parameters for state_encryption_key
+const (
+	stateKeySaltSize   = 16
+	stateKeyIterations = 600000
+)
+
+// How long an interrupted wrapper waits for Terraform to finish writing the
+// decrypted state before encrypting it and exiting
+const stateSignalGrace = time.Minute
+
+// Passphrase local state is encrypted with; empty leaves it in plain text
+var stateEncryptionKey string
+
+// Decrypted state is shared by concurrent Terraform invocations; the last one
+// to finish encrypts it again
+var (
+	stateMu      sync.Mutex
+	stateUsers   int
+	stateKeys    = make(map[string][]byte)
+	stateSignals chan os.Signal
+	stateSignal  os.Signal
+)
+
+// ============================================================
+// State encryption at rest
+// ============================================================
+
+// Read state_encryption_key and encrypt any plain-text local state left behind,
+// whether from before encryption was enabled or from an interrupted run
+func setupStateEncryption(config map[string]string) error {
+	key, err := resolveConfigValue(config["state_encryption_key"])
+	if err != nil {
+		return fmt.Errorf("failed to resolve state_encryption_key: %w", err)
+	}
+	stateEncryptionKey = key
+	if stateEncryptionKey == "" || initializedBackend() != "" {
+		return nil
+	}
+	return encryptLocalState()
+}
+
+// Local state files of every workspace, in plain-text form
+func plainStateFiles() []string {
+	var files []string
+	for _, dir := range []string{".", filepath.Join("terraform.tfstate.d", "*")} {
+		for _, name := range []string{"terraform.tfstate", "terraform.tfstate.backup"} {
+			matches, _ := filepath.Glob(filepath.Join(dir, name))
+			files = append(files, matches...)
+		}
+	}
+	return files
+}
+
+// Names local state files have on disk between Terraform invocations
+func stateFilesAtRest(path string) []string {
+	if stateEncryptionKey == "" {
+		return []string{path, path + ".backup"}
+	}
+	return []string{path + encryptedStateSuffix, path + ".backup" + encryptedStateSuffix}
+}
+
+// AES-256 key for a salt, derived once per passphrase and salt
+func stateKey(salt []byte) ([]byte, error) {
+	cacheKey := stateEncryptionKey + "\x00" + string(salt)
+	if key, found := stateKeys[cacheKey]; found {
+		return key, nil
+	}
+	key, err := pbkdf2.Key(sha256.New, stateEncryptionKey, salt, stateKeyIterations, 32)
+	if err != nil {
+		return nil, err
+	}
+	stateKeys[cacheKey] = key
+	return key, nil
+}
+
+// Encrypt a state file next to itself and remove the plain text; the salt of
+// an existing encrypted file is kept so the derived key can be reused
+func encryptStateFile(path string) error {
+	plain, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	salt := make([]byte, stateKeySaltSize)
+	if existing, err := os.ReadFile(path + encryptedStateSuffix); err == nil && len(existing) > len(encryptedStateMagic)+stateKeySaltSize {
+		copy(salt, existing[len(encryptedStateMagic):])
+	} else if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+	key, err := stateKey(salt)
+	if err != nil {
+		return err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+
+	var out bytes.Buffer
+	out.WriteString(encryptedStateMagic)
+	out.Write(salt)
+	out.Write(nonce)
+	out.Write(gcm.Seal(nil, nonce, plain, []byte(encryptedStateMagic)))
+	tmp := path + encryptedStateSuffix + ".tmp"
+	if err := os.WriteFile(tmp, out.Bytes(), 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path+encryptedStateSuffix); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+// Decrypt an encrypted state file to its plain-text name
+func decryptStateFile(path string) error {
+	sealed, err := os.ReadFile(path + encryptedStateSuffix)
+	if err != nil {
+		return err
+	}
+	if !bytes.HasPrefix(sealed, []byte(encryptedStateMagic)) {
+		return fmt.Errorf("%s is not an encrypted state file", path+encryptedStateSuffix)
+	}
+	sealed = sealed[len(encryptedStateMagic):]
+	if len(sealed) < stateKeySaltSize {
+		return fmt.Errorf("%s is truncated", path+encryptedStateSuffix)
+	}
+	key, err := stateKey(sealed[:stateKeySaltSize])
+	if err != nil {
+		return err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return err
+	}
+	sealed = sealed[stateKeySaltSize:]
+	if len(sealed) < gcm.NonceSize() {
+		return fmt.Errorf("%s is truncated", path+encryptedStateSuffix)
+	}
+	plain, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], []byte(encryptedStateMagic))
+	if err != nil {
+		return fmt.Errorf("failed to decrypt %s; is state_encryption_key correct? %w", path+encryptedStateSuffix, err)
+	}
+	return os.WriteFile(path, plain, 0600)
+}
+
+// Encrypt every plain-text local state file
+func encryptLocalState() error {
+	for _, path := range plainStateFiles() {
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		if err := encryptStateFile(path); err != nil {
+			return fmt.Errorf("failed to encrypt %s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// Decrypt the local state for a Terraform invocation; the returned function
+// encrypts it again once no invocation needs it any more
+func acquireState() (func(), error) {
+	if stateEncryptionKey == "" || initializedBackend() != "" {
+		return func() {}, nil
+	}
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	if stateSignal != nil {
+		return nil, fmt.Errorf("interrupted by %v", stateSignal)
+	}
+	stateUsers++
+	if stateUsers == 1 {
+		for _, pattern := range []string{"terraform.tfstate*" + encryptedStateSuffix, filepath.Join("terraform.tfstate.d", "*", "terraform.tfstate*"+encryptedStateSuffix)} {
+			matches, _ := filepath.Glob(pattern)
+			for _, match := range matches {
+				if err := decryptStateFile(match[:len(match)-len(encryptedStateSuffix)]); err != nil {
+					stateUsers--
+					if encryptErr := encryptLocalState(); encryptErr != nil {
+						fmt.Printf("Warning: %v; the state stays in plain text until the next run\n", encryptErr)
+					}
+					return nil, err
+				}
+			}
+		}
+		watchStateSignals()
+	}
+	return releaseState, nil
+}
+
+// Encrypt the decrypted state before exiting on SIGINT or SIGTERM; Terraform
+// receives a Ctrl-C as well, so the wrapper exits once the last invocation has
+// stopped and released the state, or after stateSignalGrace
+func watchStateSignals() {
+	stateSignals = make(chan os.Signal, 1)
+	signal.Notify(stateSignals, os.Interrupt, syscall.SIGTERM)
+	go func(signals chan os.Signal) {
+		sig, ok := <-signals
+		if !ok {
+			return
+		}
+		stateMu.Lock()
+		stateSignal = sig
+		stateMu.Unlock()
+		time.Sleep(stateSignalGrace)
+		stateMu.Lock()
+		exitOnStateSignal()
+	}(stateSignals)
+}
+
+// Encrypt the local state and exit with the shell's code for the received
+// signal; called with stateMu held, which stays locked so nothing decrypts again
+func exitOnStateSignal() {
+	if err := encryptLocalState(); err != nil {
+		fmt.Printf("Warning: %v; the state stays in plain text until the next run\n", err)
+	}
+	if stateSignal == syscall.SIGTERM {
+		os.Exit(143)
+	}
+	os.Exit(130)
+}
+
+// Encrypt the local state again after the last invocation using it
+func releaseState() {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	stateUsers--
+	if stateUsers > 0 {
+		return
+	}
+	if stateSignal != nil {
+		exitOnStateSignal()
+	}
+	signal.Stop(stateSignals)
+	close(stateSignals)
+	if err := encryptLocalState(); err != nil {
+		fmt.Printf("Warning: %v; the state stays in plain text until the next run\n", err)
+	}
+}
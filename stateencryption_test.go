@@ -0,0 +1,168 @@
+/**
+* @license
+* Copyright 2020 Dynatrace LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+const testState = `{"version": 4, "resources": [{"type": "dynatrace_alerting", "name": "secret-bearing"}]}`
+
+// Encrypt state with passphrase in a fresh directory
+func useStateEncryption(t *testing.T, passphrase string) {
+	t.Helper()
+	t.Chdir(t.TempDir())
+	stateEncryptionKey = passphrase
+	t.Cleanup(func() { stateEncryptionKey = "" })
+}
+
+func TestStateFileRoundTrip(t *testing.T) {
+	useStateEncryption(t, "correct horse battery staple")
+	if err := os.WriteFile("terraform.tfstate", []byte(testState), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := encryptStateFile("terraform.tfstate"); err != nil {
+		t.Fatalf("encryptStateFile: %v", err)
+	}
+	if _, err := os.Stat("terraform.tfstate"); !os.IsNotExist(err) {
+		t.Errorf("plain-text state still exists after encryption: %v", err)
+	}
+	sealed, err := os.ReadFile("terraform.tfstate" + encryptedStateSuffix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(sealed, []byte(encryptedStateMagic)) || bytes.Contains(sealed, []byte("secret-bearing")) {
+		t.Errorf("encrypted state is not sealed: %q", sealed)
+	}
+
+	if err := decryptStateFile("terraform.tfstate"); err != nil {
+		t.Fatalf("decryptStateFile: %v", err)
+	}
+	if plain, _ := os.ReadFile("terraform.tfstate"); string(plain) != testState {
+		t.Errorf("decrypted state = %q, want %q", plain, testState)
+	}
+
+	// Re-encrypting keeps the salt so the derived key is reused
+	if err := encryptStateFile("terraform.tfstate"); err != nil {
+		t.Fatalf("encryptStateFile again: %v", err)
+	}
+	resealed, _ := os.ReadFile("terraform.tfstate" + encryptedStateSuffix)
+	saltEnd := len(encryptedStateMagic) + stateKeySaltSize
+	if !bytes.Equal(resealed[:saltEnd], sealed[:saltEnd]) {
+		t.Error("re-encryption changed the salt")
+	}
+}
+
+func TestDecryptStateFileWithWrongKey(t *testing.T) {
+	useStateEncryption(t, "correct horse battery staple")
+	if err := os.WriteFile("terraform.tfstate", []byte(testState), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := encryptStateFile("terraform.tfstate"); err != nil {
+		t.Fatalf("encryptStateFile: %v", err)
+	}
+
+	stateEncryptionKey = "wrong passphrase"
+	err := decryptStateFile("terraform.tfstate")
+	if err == nil || !strings.Contains(err.Error(), "is state_encryption_key correct?") {
+		t.Errorf("decrypting with the wrong key: got %v", err)
+	}
+	if _, err := os.Stat("terraform.tfstate"); !os.IsNotExist(err) {
+		t.Errorf("failed decryption wrote plain-text state: %v", err)
+	}
+}
+
+func TestDecryptStateFileRejectsDamagedFiles(t *testing.T) {
+	useStateEncryption(t, "correct horse battery staple")
+	salt := strings.Repeat("s", stateKeySaltSize)
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"not encrypted", testState, "is not an encrypted state file"},
+		{"header only", encryptedStateMagic, "is truncated"},
+		{"partial salt", encryptedStateMagic + "salt", "is truncated"},
+		{"partial nonce", encryptedStateMagic + salt + "nonce", "is truncated"},
+		{"corrupt ciphertext", encryptedStateMagic + salt + strings.Repeat("n", 12) + "garbage-ciphertext", "is state_encryption_key correct?"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := os.WriteFile("terraform.tfstate"+encryptedStateSuffix, []byte(test.content), 0600); err != nil {
+				t.Fatal(err)
+			}
+			if err := decryptStateFile("terraform.tfstate"); err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("got %v, want an error containing %q", err, test.want)
+			}
+		})
+	}
+}
+
+func TestAcquireStateReferenceCounting(t *testing.T) {
+	useStateEncryption(t, "correct horse battery staple")
+	if err := os.MkdirAll("terraform.tfstate.d/prod", 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"terraform.tfstate", "terraform.tfstate.d/prod/terraform.tfstate"} {
+		if err := os.WriteFile(path, []byte(testState), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := encryptLocalState(); err != nil {
+		t.Fatalf("encryptLocalState: %v", err)
+	}
+
+	plainExists := func() bool {
+		_, err1 := os.Stat("terraform.tfstate")
+		_, err2 := os.Stat("terraform.tfstate.d/prod/terraform.tfstate")
+		if (err1 == nil) != (err2 == nil) {
+			t.Fatalf("workspace states disagree: %v, %v", err1, err2)
+		}
+		return err1 == nil
+	}
+	if plainExists() {
+		t.Fatal("plain-text state exists after encryptLocalState")
+	}
+
+	release1, err := acquireState()
+	if err != nil {
+		t.Fatalf("acquireState: %v", err)
+	}
+	release2, err := acquireState()
+	if err != nil {
+		t.Fatalf("second acquireState: %v", err)
+	}
+	if !plainExists() {
+		t.Fatal("state was not decrypted for the first user")
+	}
+	release1()
+	if !plainExists() {
+		t.Error("state was encrypted while a second user still held it")
+	}
+	release2()
+	if plainExists() {
+		t.Error("state was not encrypted after the last user released it")
+	}
+	if stateUsers != 0 {
+		t.Errorf("stateUsers = %d after both releases, want 0", stateUsers)
+	}
+}
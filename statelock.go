@@ -0,0 +1,162 @@
+/**
+* @license
+* Copyright 2020 Dynatrace LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Age a lock must reach before -auto-unlock removes it, unless auto_unlock_age is set
+const defaultAutoUnlockAge = time.Hour
+
+// Set by -lock-timeout and -auto-unlock
+var (
+	cliLockTimeout string
+	cliAutoUnlock  bool
+)
+
+// How long Terraform waits for the state lock, and when a stale lock is removed
+var (
+	lockTimeout   string
+	autoUnlock    bool
+	autoUnlockAge = defaultAutoUnlockAge
+)
+
+// Terraform commands accepting -lock-timeout
+var lockingCommands = map[string]bool{
+	"init": true, "plan": true, "apply": true, "destroy": true, "import": true, "refresh": true,
+	"taint": true, "untaint": true, "state mv": true, "state rm": true, "state push": true, "state replace-provider": true,
+}
+
+var (
+	lockIDPattern      = regexp.MustCompile(`(?m)^\s*ID:\s+(\S+)`)
+	lockCreatedPattern = regexp.MustCompile(`(?m)^\s*Created:\s+(.+)$`)
+	lockWhoPattern     = regexp.MustCompile(`(?m)^\s*Who:\s+(.+)$`)
+)
+
+// ============================================================
+// State lock timeout and stale lock recovery
+// ============================================================
+
+// Read lock_timeout, auto_unlock and auto_unlock_age; the flags take precedence
+func setupStateLocking(config map[string]string) error {
+	lockTimeout = cliLockTimeout
+	if lockTimeout == "" {
+		lockTimeout = config["lock_timeout"]
+	}
+	if lockTimeout != "" {
+		if _, err := time.ParseDuration(lockTimeout); err != nil {
+			return fmt.Errorf("invalid lock_timeout: %w", err)
+		}
+	}
+	autoUnlock = cliAutoUnlock || config["auto_unlock"] == "true"
+	autoUnlockAge = defaultAutoUnlockAge
+	if value := config["auto_unlock_age"]; value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid auto_unlock_age: %w", err)
+		}
+		autoUnlockAge = parsed
+	}
+	return nil
+}
+
+// Add -lock-timeout after the subcommand of commands that take the state lock
+func withLockTimeout(args []string) []string {
+	if lockTimeout == "" {
+		return args
+	}
+	command, at := args[0], 1
+	if (command == "state" || command == "workspace") && len(args) > 1 {
+		command, at = command+" "+args[1], 2
+	}
+	if !lockingCommands[command] {
+		return args
+	}
+	return append(append(append([]string{}, args[:at]...), "-lock-timeout="+lockTimeout), args[at:]...)
+}
+
+// Lock holding the state, as reported by Terraform
+type stateLock struct {
+	ID      string
+	Who     string
+	Created time.Time
+}
+
+// Parse the lock info of an "Error acquiring the state lock" failure
+func parseStateLock(err error) (*stateLock, bool) {
+	var cmdErr *terraformCommandError
+	if !errors.As(err, &cmdErr) || !strings.Contains(cmdErr.output, "Error acquiring the state lock") {
+		return nil, false
+	}
+	match := lockIDPattern.FindStringSubmatch(cmdErr.output)
+	if match == nil {
+		return nil, false
+	}
+	lock := &stateLock{ID: match[1]}
+	if who := lockWhoPattern.FindStringSubmatch(cmdErr.output); who != nil {
+		lock.Who = strings.TrimSpace(who[1])
+	}
+	if created := lockCreatedPattern.FindStringSubmatch(cmdErr.output); created != nil {
+		lock.Created, _ = time.Parse("2006-01-02 15:04:05.999999999 -0700 MST", strings.TrimSpace(created[1]))
+	}
+	return lock, true
+}
+
+// Offer to force-unlock a lock that blocked a command, or remove it unattended
+// with -auto-unlock once it is older than auto_unlock_age; reports whether the
+// lock was removed so the command can be retried
+func recoverStateLock(terraformPath string, logFile *os.File, lock *stateLock) bool {
+	age := "unknown age"
+	if !lock.Created.IsZero() {
+		age = time.Since(lock.Created).Round(time.Second).String()
+	}
+	fmt.Printf("\nThe state is locked (ID %s, held by %s, %s old).\n", lock.ID, lock.Who, age)
+
+	switch {
+	case autoUnlock:
+		if lock.Created.IsZero() || time.Since(lock.Created) < autoUnlockAge {
+			fmt.Printf("Not removing the lock: -auto-unlock only removes locks older than %s.\n", autoUnlockAge)
+			return false
+		}
+		fmt.Printf("Lock is older than %s; removing it because of -auto-unlock.\n", autoUnlockAge)
+	case nonInteractive:
+		return false
+	default:
+		fmt.Print("Make sure no other run is using this state. Force-unlock it and retry? (y/n): ")
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		if strings.ToLower(strings.TrimSpace(answer)) != "y" {
+			return false
+		}
+	}
+
+	err := executeTerraformCommand(terraformPath, logFile, "force-unlock", "-force", lock.ID)
+	recordAudit("force-unlock", err)
+	if err != nil {
+		fmt.Printf("Failed to force-unlock the state: %v\n", err)
+		return false
+	}
+	publishf("guard", "warning", "Force-unlocked state lock %s held by %s", lock.ID, lock.Who)
+	return true
+}
@@ -0,0 +1,197 @@
+/**
+* @license
+* Copyright 2020 Dynatrace LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Values of the repeatable state surgery flags
+var (
+	cliStateMoves           = &listFlag{keyValue: true}
+	cliStateRemovals        = &listFlag{}
+	cliProviderReplacements = &listFlag{keyValue: true}
+)
+
+// ============================================================
+// Guarded state surgery
+// ============================================================
+
+// One state mv, rm or replace-provider operation
+type stateOperation struct {
+	Command string // mv, rm or replace-provider
+	From    string
+	To      string
+}
+
+func (o stateOperation) String() string {
+	if o.Command == "rm" {
+		return "state rm " + o.From
+	}
+	return fmt.Sprintf("state %s %s -> %s", o.Command, o.From, o.To)
+}
+
+// Operations requested with -state-mv, -state-rm and -state-replace-provider
+func stateOperations() ([]stateOperation, error) {
+	var operations []stateOperation
+	for _, pair := range cliStateMoves.values {
+		from, to, ok := cutAddress(pair)
+		if !ok {
+			return nil, fmt.Errorf("-state-mv expects source=destination, got %q", pair)
+		}
+		operations = append(operations, stateOperation{"mv", from, to})
+	}
+	for _, address := range cliStateRemovals.values {
+		operations = append(operations, stateOperation{"rm", strings.TrimSpace(address), ""})
+	}
+	for _, pair := range cliProviderReplacements.values {
+		from, to, _ := strings.Cut(pair, "=")
+		operations = append(operations, stateOperation{"replace-provider", strings.TrimSpace(from), strings.TrimSpace(to)})
+	}
+	return operations, nil
+}
+
+// Fully qualified provider source, adding the default registry host
+func qualifiedProvider(source string) string {
+	if strings.Count(source, "/") == 1 {
+		return "registry.terraform.io/" + source
+	}
+	return source
+}
+
+// Resources in state using the given provider
+func resourcesUsingProvider(terraformPath string, logFile *os.File, provider string) ([]string, error) {
+	out, err := outputTerraformCommand(terraformPath, logFile, "state", "pull")
+	if err != nil {
+		return nil, err
+	}
+	var state struct {
+		Resources []struct {
+			Module   string `json:"module"`
+			Mode     string `json:"mode"`
+			Type     string `json:"type"`
+			Name     string `json:"name"`
+			Provider string `json:"provider"`
+		} `json:"resources"`
+	}
+	if err := json.Unmarshal(out, &state); err != nil {
+		return nil, fmt.Errorf("failed to parse state: %w", err)
+	}
+	marker := `provider["` + qualifiedProvider(provider) + `"]`
+	var addresses []string
+	for _, resource := range state.Resources {
+		if !strings.HasSuffix(resource.Provider, marker) {
+			continue
+		}
+		address := resource.Type + "." + resource.Name
+		if resource.Mode == "data" {
+			address = "data." + address
+		}
+		if resource.Module != "" {
+			address = resource.Module + "." + address
+		}
+		addresses = append(addresses, address)
+	}
+	return addresses, nil
+}
+
+// Preview what an operation would change without modifying state
+func previewStateOperation(terraformPath string, logFile *os.File, op stateOperation) (string, error) {
+	if op.Command == "replace-provider" {
+		addresses, err := resourcesUsingProvider(terraformPath, logFile, op.From)
+		if err != nil {
+			return "", err
+		}
+		if len(addresses) == 0 {
+			return "", fmt.Errorf("no resources in state use provider %s", op.From)
+		}
+		return fmt.Sprintf("Would move %d resource(s) to provider %s:\n  %s", len(addresses), qualifiedProvider(op.To), strings.Join(addresses, "\n  ")), nil
+	}
+
+	args := []string{"state", op.Command, "-dry-run", op.From}
+	if op.Command == "mv" {
+		args = append(args, op.To)
+	}
+	out, err := outputTerraformCommand(terraformPath, logFile, args...)
+	if err != nil {
+		return "", fmt.Errorf("%s would fail: %w", op, err)
+	}
+	return strings.TrimSpace(scrubSecrets(string(out))), nil
+}
+
+// Preview the operations, then unless dryRun confirm, back up the state and run
+// them; non-interactive runs need -force instead of confirmation
+func runStateSurgery(terraformPath string, logFile *os.File, operations []stateOperation, dryRun bool) error {
+	if err := ensureWorkspace(terraformPath, logFile); err != nil {
+		return err
+	}
+
+	fmt.Printf("State surgery in workspace %s:\n", currentWorkspace())
+	for _, op := range operations {
+		preview, err := previewStateOperation(terraformPath, logFile, op)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("\n%s\n%s\n", op, preview)
+	}
+	if dryRun {
+		fmt.Println("\nDry run; state was not changed.")
+		return nil
+	}
+
+	switch {
+	case nonInteractive && !forceGuards:
+		return fmt.Errorf("state surgery needs confirmation; rerun with -force in non-interactive mode")
+	case !nonInteractive:
+		fmt.Print("\nApply these state changes? (y/n): ")
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		if strings.ToLower(strings.TrimSpace(answer)) != "y" {
+			fmt.Println("State was not changed.")
+			return nil
+		}
+	}
+
+	backupPath, err := backupState(terraformPath, logFile)
+	if err != nil {
+		return fmt.Errorf("failed to back up state: %w", err)
+	}
+	fmt.Printf("State backed up to %s.\n", backupPath)
+
+	for _, op := range operations {
+		args := []string{"state", op.Command}
+		switch op.Command {
+		case "mv":
+			args = append(args, op.From, op.To)
+		case "rm":
+			args = append(args, op.From)
+		case "replace-provider":
+			args = append(args, "-auto-approve", qualifiedProvider(op.From), qualifiedProvider(op.To))
+		}
+		err := executeTerraformCommand(terraformPath, logFile, args...)
+		recordAudit("state "+op.Command, err)
+		if err != nil {
+			return fmt.Errorf("%s failed (restore with terraform state push %s): %w", op, backupPath, err)
+		}
+		fmt.Printf("Done: %s\n", op)
+	}
+	return nil
+}
@@ -0,0 +1,179 @@
+/**
+* @license
+* Copyright 2020 Dynatrace LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// File the wrapper writes declaring the output that records, in state, a hash
+// of the environment URL the state was applied to
+const stateTargetFileName = "dynatrace_state_target.tf"
+
+// Name of the variable and root output holding the environment URL hash
+const stateTargetOutput = "dynatrace_state_target"
+
+// Set by -force to proceed past safety guards
+var forceGuards bool
+
+// Set by -record-state-target to adopt state that holds resources but records
+// no environment, such as state applied before the wrapper recorded one
+var recordStateTarget bool
+
+// ============================================================
+// Guard against state applied to a different environment
+// ============================================================
+
+// Currently selected Terraform workspace, read without invoking Terraform
+func currentWorkspace() string {
+	if name := getEnv("TF_WORKSPACE"); name != "" {
+		return name
+	}
+	content, err := os.ReadFile(filepath.Join(".terraform", "environment"))
+	if err != nil || strings.TrimSpace(string(content)) == "" {
+		return "default"
+	}
+	return strings.TrimSpace(string(content))
+}
+
+// Hash an environment URL so the recorded target does not reveal the tenant
+func hashEnvironmentURL(envURL string) string {
+	normalized := strings.ToLower(strings.TrimRight(strings.TrimSpace(envURL), "/"))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
+
+// Declare the state target variable and output unless the bundle already does.
+// Configuration the wrapper cannot read is left to terraform init to report;
+// the output is then only missing until a run that can read it
+func generateStateTargetOutput() error {
+	blocks, err := parseTerraformFiles(".")
+	if err != nil {
+		if _, statErr := os.Stat(stateTargetFileName); statErr != nil {
+			fmt.Printf("Warning: not generating %s: %v\n", stateTargetFileName, err)
+		}
+		return nil
+	}
+	for _, block := range blocks {
+		if (block.Type == "output" || block.Type == "variable") && len(block.Labels) > 0 && block.Labels[0] == stateTargetOutput {
+			return nil
+		}
+	}
+	content := "# Generated by the wrapper: records in state a hash of the environment URL the\n" +
+		"# state was applied to; the value comes from TF_VAR_" + stateTargetOutput + "\n\n" +
+		"variable \"" + stateTargetOutput + "\" {\n  type    = string\n  default = \"\"\n}\n\n" +
+		"output \"" + stateTargetOutput + "\" {\n  value = var." + stateTargetOutput + "\n}\n"
+	return os.WriteFile(stateTargetFileName, []byte(content), 0644)
+}
+
+// Environment variable passing the hash of DT_ENV_URL to Terraform, empty without one
+func stateTargetEnv() string {
+	envURL := getEnv("DT_ENV_URL")
+	if envURL == "" {
+		return ""
+	}
+	return "TF_VAR_" + stateTargetOutput + "=" + hashEnvironmentURL(envURL)
+}
+
+// Environment hash recorded in the current workspace's state, and whether the
+// state holds any managed resources
+func recordedStateTarget(terraformPath string, logFile *os.File) (string, bool, error) {
+	out, err := outputTerraformCommand(terraformPath, logFile, "state", "pull")
+	if err != nil {
+		return "", false, fmt.Errorf("failed to read the state: %w", err)
+	}
+	if len(strings.TrimSpace(string(out))) == 0 {
+		return "", false, nil
+	}
+	var state struct {
+		Outputs map[string]struct {
+			Value any `json:"value"`
+		} `json:"outputs"`
+		Resources []struct {
+			Mode string `json:"mode"`
+		} `json:"resources"`
+	}
+	if err := json.Unmarshal(out, &state); err != nil {
+		return "", false, fmt.Errorf("failed to parse state: %w", err)
+	}
+	managed := false
+	for _, resource := range state.Resources {
+		if resource.Mode == "managed" {
+			managed = true
+		}
+	}
+	recorded, _ := state.Outputs[stateTargetOutput].Value.(string)
+	return recorded, managed, nil
+}
+
+// Verify the configured DT_ENV_URL matches the environment recorded in the
+// current workspace's state; state with resources but no recorded target is refused
+func checkStateTarget(terraformPath string, logFile *os.File) error {
+	envURL := getEnv("DT_ENV_URL")
+	if envURL == "" {
+		return nil
+	}
+	recorded, managed, err := recordedStateTarget(terraformPath, logFile)
+	if err != nil {
+		return err
+	}
+	if !managed || recorded == hashEnvironmentURL(envURL) {
+		return nil
+	}
+
+	workspace := currentWorkspace()
+	if recorded == "" {
+		if recordStateTarget {
+			publishf("guard", "warning", "State of workspace %q records no environment; continuing because of -record-state-target", workspace)
+			fmt.Printf("Warning: state of workspace %q records no environment; an untargeted apply records %s.\n", workspace, envURL)
+			return nil
+		}
+		return fmt.Errorf("state of workspace %q holds resources but records no environment it was applied to; "+
+			"if it belongs to %s, apply once with -record-state-target to record it", workspace, envURL)
+	}
+	if forceGuards {
+		publishf("guard", "warning", "State of workspace %q was applied to a different environment; continuing because of -force", workspace)
+		fmt.Printf("Warning: state of workspace %q was applied to a different environment than %s; continuing because of -force.\n", workspace, envURL)
+		return nil
+	}
+	return fmt.Errorf("state of workspace %q was applied to a different environment than the configured %s; "+
+		"check DT_ENV_URL and the selected workspace, or rerun with -force if the environment was intentionally changed", workspace, envURL)
+}
+
+// Verify a successful apply recorded the configured DT_ENV_URL in the current
+// workspace's state. Every apply updates the output, except one limited by
+// targets or exclusions; recording it then takes an untargeted apply, which
+// goes through the usual review rather than being run behind the user's back
+func verifyStateTargetRecorded(terraformPath string, logFile *os.File) error {
+	envURL := getEnv("DT_ENV_URL")
+	if envURL == "" {
+		return nil
+	}
+	recorded, managed, err := recordedStateTarget(terraformPath, logFile)
+	if err != nil || !managed || recorded == hashEnvironmentURL(envURL) {
+		return err
+	}
+	return fmt.Errorf("the apply did not record %s in the state of workspace %q, as targeted and excluded applies leave outputs alone; "+
+		"run an untargeted apply with -record-state-target to record it", envURL, currentWorkspace())
+}
@@ -0,0 +1,197 @@
+/**
+* @license
+* Copyright 2020 Dynatrace LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Matches listed when a typed address is ambiguous
+const maxAddressMatches = 20
+
+// ============================================================
+// Taint and untaint
+// ============================================================
+
+// Resources in state with at least one tainted instance
+func taintedResources(terraformPath string, logFile *os.File) (map[string]bool, error) {
+	out, err := outputTerraformCommand(terraformPath, logFile, "state", "pull")
+	if err != nil {
+		return nil, err
+	}
+	tainted := make(map[string]bool)
+	if len(strings.TrimSpace(string(out))) == 0 {
+		return tainted, nil
+	}
+	var state struct {
+		Resources []struct {
+			Module    string `json:"module"`
+			Mode      string `json:"mode"`
+			Type      string `json:"type"`
+			Name      string `json:"name"`
+			Instances []struct {
+				IndexKey any    `json:"index_key"`
+				Status   string `json:"status"`
+			} `json:"instances"`
+		} `json:"resources"`
+	}
+	if err := json.Unmarshal(out, &state); err != nil {
+		return nil, fmt.Errorf("failed to parse state: %w", err)
+	}
+	for _, resource := range state.Resources {
+		address := resource.Type + "." + resource.Name
+		if resource.Module != "" {
+			address = resource.Module + "." + address
+		}
+		for _, instance := range resource.Instances {
+			if instance.Status != "tainted" {
+				continue
+			}
+			switch key := instance.IndexKey.(type) {
+			case string:
+				tainted[fmt.Sprintf("%s[%q]", address, key)] = true
+			case float64:
+				tainted[fmt.Sprintf("%s[%d]", address, int(key))] = true
+			default:
+				tainted[address] = true
+			}
+		}
+	}
+	return tainted, nil
+}
+
+// Read a resource address, completing a number from the list or a fragment
+// matching a single address; empty input returns ""
+func completeAddress(reader *bufio.Reader, addresses []string, prompt string) string {
+	for {
+		fmt.Print(prompt)
+		input, _ := reader.ReadString('\n')
+		input = strings.TrimSpace(input)
+		if input == "" {
+			return ""
+		}
+		if n, err := strconv.Atoi(input); err == nil && n >= 1 && n <= len(addresses) {
+			return addresses[n-1]
+		}
+		var matches []string
+		for _, address := range addresses {
+			if address == input {
+				return address
+			}
+			if strings.Contains(address, input) {
+				matches = append(matches, address)
+			}
+		}
+		switch {
+		case len(matches) == 1:
+			fmt.Printf("Using %s.\n", matches[0])
+			return matches[0]
+		case len(matches) == 0:
+			fmt.Printf("No resource in state matches %q.\n", input)
+		default:
+			fmt.Printf("%d resources match %q:\n", len(matches), input)
+			for i, match := range matches {
+				if i == maxAddressMatches {
+					fmt.Printf("  ... and %d more\n", len(matches)-i)
+					break
+				}
+				fmt.Printf("  %s\n", match)
+			}
+		}
+	}
+}
+
+// Mark a resource in state as tainted so the next apply recreates it, or clear
+// the mark, for resources the Dynatrace API left half-configured
+func manageTaint(terraformPath string, logFile *os.File) error {
+	if nonInteractive {
+		return fmt.Errorf("taint and untaint are unavailable in non-interactive mode; use -replace or -- taint")
+	}
+	if err := ensureWorkspace(terraformPath, logFile); err != nil {
+		return err
+	}
+	stateAddresses, err := listStateResources(terraformPath, logFile)
+	if err != nil {
+		return fmt.Errorf("failed to list state: %w", err)
+	}
+	tainted, err := taintedResources(terraformPath, logFile)
+	if err != nil {
+		return fmt.Errorf("failed to read state: %w", err)
+	}
+	var addresses []string
+	for _, address := range stateAddresses {
+		if !strings.HasPrefix(address, "data.") && !strings.Contains(address, ".data.") {
+			addresses = append(addresses, address)
+		}
+	}
+	if len(addresses) == 0 {
+		fmt.Println("No resources in state.")
+		return nil
+	}
+	for i, address := range addresses {
+		if tainted[address] {
+			fmt.Printf("%3d. %s (tainted)\n", i+1, address)
+		} else {
+			fmt.Printf("%3d. %s\n", i+1, address)
+		}
+	}
+
+	reader := bufio.NewReader(os.Stdin)
+	address := completeAddress(reader, addresses, "Resource (number or part of the address; empty to cancel): ")
+	if address == "" {
+		return nil
+	}
+	command := "taint"
+	if tainted[address] {
+		command = "untaint"
+	}
+	fmt.Printf("%s %s? (y/n): ", strings.ToUpper(command[:1])+command[1:], address)
+	answer, _ := reader.ReadString('\n')
+	if strings.ToLower(strings.TrimSpace(answer)) != "y" {
+		fmt.Println("State was not changed.")
+		return nil
+	}
+	if command == "taint" {
+		for _, ex := range excludedResources {
+			if matchesAddress(address, ex) {
+				return fmt.Errorf("cannot taint %s: it is excluded by %s", address, ex)
+			}
+		}
+		if err := checkChangeFreeze(command); err != nil {
+			recordAudit(command, err)
+			return err
+		}
+	}
+
+	err = executeTerraformCommand(terraformPath, logFile, command, address)
+	recordAudit(command, err)
+	if err != nil {
+		return err
+	}
+	if command == "taint" {
+		fmt.Printf("%s is tainted; the next apply recreates it.\n", address)
+	} else {
+		fmt.Printf("%s is no longer tainted.\n", address)
+	}
+	return nil
+}
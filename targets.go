@@ -0,0 +1,183 @@
+/**
+* @license
+* Copyright 2020 Dynatrace LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Plan used to list the resources the picker offers
+const pickerPlanFileName = "picker.tfplan"
+
+// Values of the repeatable -target flag
+var cliTargets = &listFlag{}
+
+// Addresses chosen with -target or the picker; runs are limited to them
+var selectedTargets []string
+
+// ============================================================
+// Targeted plan, apply and destroy
+// ============================================================
+
+// -target arguments for plan, apply and destroy: the selected addresses, or
+// everything but the exclusions
+func targetArgs() []string {
+	if len(selectedTargets) == 0 {
+		return exclusionTargets
+	}
+	args := make([]string, 0, len(selectedTargets))
+	for _, target := range selectedTargets {
+		args = append(args, "-target="+target)
+	}
+	return args
+}
+
+// Limit runs to the given addresses, refusing any that are excluded
+func selectTargets(targets []string) error {
+	for _, target := range targets {
+		for _, ex := range excludedResources {
+			if matchesAddress(target, ex) {
+				return fmt.Errorf("target %s is excluded by %s", target, ex)
+			}
+		}
+	}
+	selectedTargets = targets
+	if len(targets) > 0 {
+		fmt.Printf("Limiting runs to %s.\n", strings.Join(targets, ", "))
+	}
+	return nil
+}
+
+// Resource offered by the picker with the change planned for it
+type pickerResource struct {
+	Address string
+	Action  string
+}
+
+// Resources in the state and in a fresh plan, with their planned actions
+func pickerResources(terraformPath string, logFile *os.File) ([]pickerResource, error) {
+	actions := make(map[string]string)
+	addresses, err := listStateResources(terraformPath, logFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list state: %w", err)
+	}
+	for _, address := range addresses {
+		actions[address] = "no changes"
+	}
+
+	args := append([]string{"plan", "-out=" + pickerPlanFileName}, exclusionTargets...)
+	if err := executeTerraformCommand(terraformPath, logFile, append(args, variableArgs...)...); err != nil {
+		return nil, err
+	}
+	defer os.Remove(pickerPlanFileName)
+	out, err := outputTerraformCommand(terraformPath, logFile, "show", "-json", pickerPlanFileName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read plan: %w", err)
+	}
+	var plan planChanges
+	if err := json.Unmarshal(out, &plan); err != nil {
+		return nil, fmt.Errorf("failed to parse plan: %w", err)
+	}
+	for _, change := range plan.ResourceChanges {
+		if len(change.Change.Actions) == 1 && change.Change.Actions[0] == "no-op" {
+			continue
+		}
+		actions[change.Address] = strings.Join(change.Change.Actions, ", ")
+	}
+
+	resources := make([]pickerResource, 0, len(actions))
+	for address, action := range actions {
+		resources = append(resources, pickerResource{address, action})
+	}
+	sort.Slice(resources, func(i, j int) bool { return resources[i].Address < resources[j].Address })
+	return resources, nil
+}
+
+// Parse a selection such as "1,3-5" into zero-based indexes below count
+func parseSelection(input string, count int) ([]int, error) {
+	var indexes []int
+	for _, part := range strings.Split(input, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		first, last, isRange := strings.Cut(part, "-")
+		if !isRange {
+			last = first
+		}
+		from, errFrom := strconv.Atoi(strings.TrimSpace(first))
+		to, errTo := strconv.Atoi(strings.TrimSpace(last))
+		if errFrom != nil || errTo != nil || from < 1 || to > count || from > to {
+			return nil, fmt.Errorf("invalid selection %q", part)
+		}
+		for n := from; n <= to; n++ {
+			indexes = append(indexes, n-1)
+		}
+	}
+	return indexes, nil
+}
+
+// Print resources numbered and read the user's selection of them
+func chooseResources(resources []pickerResource, prompt string) []string {
+	for i, resource := range resources {
+		fmt.Printf("%3d. %s (%s)\n", i+1, resource.Address, resource.Action)
+	}
+	reader := bufio.NewReader(os.Stdin)
+	for {
+		fmt.Print(prompt)
+		input, _ := reader.ReadString('\n')
+		indexes, err := parseSelection(input, len(resources))
+		if err != nil {
+			fmt.Println(err)
+			continue
+		}
+		var addresses []string
+		for _, index := range indexes {
+			addresses = append(addresses, resources[index].Address)
+		}
+		return addresses
+	}
+}
+
+// Let the user choose the resources to limit runs to; an empty selection
+// clears the targets
+func pickTargets(terraformPath string, logFile *os.File) error {
+	if nonInteractive {
+		return fmt.Errorf("the resource picker is unavailable in non-interactive mode; use -target")
+	}
+	fmt.Println("Listing resources from state and plan...")
+	resources, err := pickerResources(terraformPath, logFile)
+	if err != nil {
+		return err
+	}
+	if len(resources) == 0 {
+		fmt.Println("No resources in state or plan.")
+		return nil
+	}
+	targets := chooseResources(resources, "Resources to target (e.g. 1,3-5; empty for all): ")
+	if len(targets) == 0 {
+		fmt.Println("Targets cleared; runs cover the whole bundle.")
+	}
+	return selectTargets(targets)
+}
@@ -0,0 +1,18 @@
+terraform {
+  required_providers {
+    dynatrace = {
+      source = "dynatrace-oss/dynatrace"
+    }
+  }
+}
+
+variable "dashboard_owner" {
+  description = "Owner of the dashboard"
+  type        = string
+}
+
+resource "dynatrace_json_dashboard" "overview" {
+  contents = templatefile("${path.module}/dashboards/overview.json", {
+    owner = var.dashboard_owner
+  })
+}
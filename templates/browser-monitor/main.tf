@@ -0,0 +1,69 @@
+terraform {
+  required_providers {
+    dynatrace = {
+      source = "dynatrace-oss/dynatrace"
+    }
+  }
+}
+
+variable "url" {
+  description = "URL of the page to monitor"
+  type        = string
+}
+
+variable "locations" {
+  description = "Synthetic location IDs to run the monitor from"
+  type        = list(string)
+}
+
+variable "frequency" {
+  description = "Minutes between executions"
+  type        = number
+  default     = 15
+}
+
+resource "dynatrace_browser_monitor" "page" {
+  name      = "Page load of ${var.url}"
+  enabled   = true
+  frequency = var.frequency
+  locations = var.locations
+
+  anomaly_detection {
+    loading_time_thresholds {
+      enabled = true
+    }
+    outage_handling {
+      global_outage  = true
+      local_outage   = false
+      retry_on_error = true
+    }
+  }
+
+  key_performance_metrics {
+    load_action_kpm = "VISUALLY_COMPLETE"
+    xhr_action_kpm  = "VISUALLY_COMPLETE"
+  }
+
+  script {
+    type = "availability"
+
+    configuration {
+      device {
+        name        = "Desktop"
+        orientation = "landscape"
+      }
+    }
+
+    events {
+      event {
+        description = "Loading of \"${var.url}\""
+        navigate {
+          url = var.url
+          wait {
+            wait_for = "page_complete"
+          }
+        }
+      }
+    }
+  }
+}
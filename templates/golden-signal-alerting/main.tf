@@ -0,0 +1,68 @@
+terraform {
+  required_providers {
+    dynatrace = {
+      source = "dynatrace-oss/dynatrace"
+    }
+  }
+}
+
+variable "service_tag" {
+  description = "Tag selecting the services to alert on"
+  type        = string
+}
+
+variable "latency_threshold_ms" {
+  description = "Response time threshold in milliseconds"
+  type        = number
+  default     = 1000
+}
+
+variable "error_rate_threshold" {
+  description = "Failure rate threshold in percent"
+  type        = number
+  default     = 5
+}
+
+locals {
+  signals = {
+    latency = {
+      title     = "High response time"
+      metric    = "builtin:service.response.time"
+      threshold = var.latency_threshold_ms * 1000
+    }
+    errors = {
+      title     = "High failure rate"
+      metric    = "builtin:service.errors.total.rate"
+      threshold = var.error_rate_threshold
+    }
+  }
+}
+
+resource "dynatrace_metric_events" "golden_signal" {
+  for_each = local.signals
+
+  enabled = true
+  summary = "${each.value.title} (${var.service_tag})"
+
+  event_template {
+    title       = "${each.value.title} on {dims:dt.entity.service.name}"
+    description = "{metricname} exceeded {threshold} for services tagged ${var.service_tag}."
+    event_type  = "PERFORMANCE"
+    davis_merge = true
+  }
+
+  model_properties {
+    type               = "STATIC_THRESHOLD"
+    alert_condition    = "ABOVE"
+    alert_on_no_data   = false
+    dealerting_samples = 5
+    samples            = 5
+    threshold          = each.value.threshold
+    violating_samples  = 3
+  }
+
+  query_definition {
+    type            = "METRIC_SELECTOR"
+    metric_selector = "${each.value.metric}:filter(in(\"dt.entity.service\",entitySelector(\"type(SERVICE),tag(\\\"${var.service_tag}\\\")\"))):splitBy(\"dt.entity.service\")"
+  }
+}
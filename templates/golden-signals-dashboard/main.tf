@@ -0,0 +1,31 @@
+terraform {
+  required_providers {
+    dynatrace = {
+      source = "dynatrace-oss/dynatrace"
+    }
+  }
+}
+
+variable "dashboard_owner" {
+  description = "Owner of the dashboard"
+  type        = string
+}
+
+variable "service_tag" {
+  description = "Tag selecting the services to chart"
+  type        = string
+}
+
+variable "dashboard_name" {
+  description = "Name of the dashboard"
+  type        = string
+  default     = "Golden signals"
+}
+
+resource "dynatrace_json_dashboard" "golden_signals" {
+  contents = templatefile("${path.module}/dashboards/golden-signals.json", {
+    name        = var.dashboard_name
+    owner       = var.dashboard_owner
+    service_tag = var.service_tag
+  })
+}
@@ -0,0 +1,84 @@
+terraform {
+  required_providers {
+    dynatrace = {
+      source = "dynatrace-oss/dynatrace"
+    }
+  }
+}
+
+variable "cluster_name" {
+  description = "Name of the Kubernetes cluster to alert on"
+  type        = string
+}
+
+variable "restart_threshold" {
+  description = "Container restarts per minute that raise an event"
+  type        = number
+  default     = 3
+}
+
+variable "pending_pods_threshold" {
+  description = "Pods stuck in the Pending phase that raise an event"
+  type        = number
+  default     = 1
+}
+
+variable "throttling_threshold_millicores" {
+  description = "CPU throttling per workload, in millicores, that raises an event"
+  type        = number
+  default     = 100
+}
+
+locals {
+  cluster_filter = "filter(in(\"dt.entity.kubernetes_cluster\",entitySelector(\"type(KUBERNETES_CLUSTER),entityName.equals(\\\"${var.cluster_name}\\\")\")))"
+
+  signals = {
+    restarts = {
+      title      = "Containers restarting"
+      selector   = "builtin:kubernetes.container.restarts:${local.cluster_filter}:splitBy(\"k8s.namespace.name\",\"k8s.workload.name\"):sum"
+      threshold  = var.restart_threshold
+      event_type = "ERROR"
+    }
+    pending = {
+      title      = "Pods pending"
+      selector   = "builtin:kubernetes.pods:${local.cluster_filter}:filter(eq(\"pod_phase\",\"Pending\")):splitBy(\"k8s.namespace.name\",\"k8s.workload.name\"):sum"
+      threshold  = var.pending_pods_threshold
+      event_type = "ERROR"
+    }
+    throttling = {
+      title      = "CPU throttled"
+      selector   = "builtin:containers.cpu.throttledMilliCores:${local.cluster_filter}:splitBy(\"k8s.namespace.name\",\"k8s.workload.name\"):sum"
+      threshold  = var.throttling_threshold_millicores
+      event_type = "RESOURCE"
+    }
+  }
+}
+
+resource "dynatrace_metric_events" "kubernetes" {
+  for_each = local.signals
+
+  enabled = true
+  summary = "${each.value.title} (${var.cluster_name})"
+
+  event_template {
+    title       = "${each.value.title} in {dims:k8s.namespace.name}/{dims:k8s.workload.name}"
+    description = "{metricname} exceeded {threshold} in cluster ${var.cluster_name}."
+    event_type  = each.value.event_type
+    davis_merge = true
+  }
+
+  model_properties {
+    type               = "STATIC_THRESHOLD"
+    alert_condition    = "ABOVE"
+    alert_on_no_data   = false
+    dealerting_samples = 5
+    samples            = 5
+    threshold          = each.value.threshold
+    violating_samples  = 3
+  }
+
+  query_definition {
+    type            = "METRIC_SELECTOR"
+    metric_selector = each.value.selector
+  }
+}
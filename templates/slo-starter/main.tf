@@ -0,0 +1,70 @@
+terraform {
+  required_providers {
+    dynatrace = {
+      source = "dynatrace-oss/dynatrace"
+    }
+  }
+}
+
+variable "service_tag" {
+  description = "Tag selecting the services the SLOs cover"
+  type        = string
+}
+
+variable "availability_target" {
+  description = "Percentage of successful requests"
+  type        = number
+  default     = 99.5
+}
+
+variable "latency_threshold_ms" {
+  description = "Response time a request must stay below to count as fast, in milliseconds"
+  type        = number
+  default     = 1000
+}
+
+variable "latency_target" {
+  description = "Percentage of requests faster than latency_threshold_ms"
+  type        = number
+  default     = 95
+}
+
+locals {
+  service_filter = "type(SERVICE),tag(\"${var.service_tag}\")"
+}
+
+resource "dynatrace_slo_v2" "availability" {
+  name               = "Availability (${var.service_tag})"
+  enabled            = true
+  custom_description = "Share of requests without server-side errors"
+  evaluation_type    = "AGGREGATE"
+  evaluation_window  = "-1w"
+  filter             = local.service_filter
+  metric_expression  = "(100)*(builtin:service.errors.server.successCount:splitBy())/(builtin:service.requestCount.server:splitBy())"
+  metric_name        = "availability_${replace(lower(var.service_tag), "/[^a-z0-9]+/", "_")}"
+  target_success     = var.availability_target
+  target_warning     = var.availability_target + (100 - var.availability_target) / 2
+
+  error_budget_burn_rate {
+    burn_rate_visualization_enabled = true
+    fast_burn_threshold             = 10
+  }
+}
+
+resource "dynatrace_slo_v2" "latency" {
+  name               = "Latency below ${var.latency_threshold_ms} ms (${var.service_tag})"
+  enabled            = true
+  custom_description = "Share of requests answered within ${var.latency_threshold_ms} ms"
+  evaluation_type    = "AGGREGATE"
+  evaluation_window  = "-1w"
+  filter             = local.service_filter
+  metric_expression  = "(100)*(builtin:service.response.time:partition(\"latency\",value(\"fast\",lt(${var.latency_threshold_ms * 1000}))):filter(eq(\"latency\",\"fast\")):splitBy():count:default(0))/(builtin:service.response.time:splitBy():count)"
+  metric_name        = "latency_${replace(lower(var.service_tag), "/[^a-z0-9]+/", "_")}"
+  target_success     = var.latency_target
+  target_warning     = var.latency_target + (100 - var.latency_target) / 2
+
+  error_budget_burn_rate {
+    burn_rate_visualization_enabled = true
+    fast_burn_threshold             = 10
+  }
+}
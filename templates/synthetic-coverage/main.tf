@@ -0,0 +1,60 @@
+terraform {
+  required_providers {
+    dynatrace = {
+      source = "dynatrace-oss/dynatrace"
+    }
+  }
+}
+
+variable "endpoints" {
+  description = "URLs to monitor"
+  type        = list(string)
+}
+
+variable "locations" {
+  description = "Synthetic location IDs to run the monitors from"
+  type        = list(string)
+}
+
+variable "frequency" {
+  description = "Minutes between executions"
+  type        = number
+  default     = 15
+}
+
+resource "dynatrace_http_monitor" "endpoint" {
+  for_each = toset(var.endpoints)
+
+  name      = "Availability of ${each.value}"
+  enabled   = true
+  frequency = var.frequency
+  locations = var.locations
+
+  anomaly_detection {
+    loading_time_thresholds {
+      enabled = true
+    }
+    outage_handling {
+      global_outage = true
+    }
+  }
+
+  script {
+    request {
+      description = each.value
+      method      = "GET"
+      url         = each.value
+      configuration {
+        accept_any_certificate = false
+        follow_redirects       = true
+      }
+      validation {
+        rule {
+          type          = "httpStatusesList"
+          pass_if_found = false
+          value         = ">=400"
+        }
+      }
+    }
+  }
+}
@@ -0,0 +1,133 @@
+/**
+* @license
+* Copyright 2020 Dynatrace LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Prefix of the config keys holding the rewrite rules of -clone-tenant
+const cloneRewritePrefix = "clone_rewrite."
+
+// Regex replacement applied to the exported configuration of a clone
+type rewriteRule struct {
+	key         string
+	pattern     *regexp.Regexp
+	replacement string
+}
+
+// ============================================================
+// Tenant cloning
+// ============================================================
+
+// Parse a "<regex> => <replacement>" rewrite rule; the replacement may refer to
+// capture groups as $1 or ${name}
+func parseRewriteRule(value string) (*regexp.Regexp, string, error) {
+	expr, replacement, found := strings.Cut(value, "=>")
+	if !found {
+		return nil, "", fmt.Errorf("expected <regex> => <replacement>, got %q", value)
+	}
+	pattern, err := regexp.Compile(strings.TrimSpace(expr))
+	if err != nil {
+		return nil, "", err
+	}
+	return pattern, strings.TrimSpace(replacement), nil
+}
+
+// Rewrite rules from the clone_rewrite.<n> keys, in key order
+func cloneRewriteRules(config map[string]string) ([]rewriteRule, error) {
+	var rules []rewriteRule
+	for key, value := range config {
+		if !strings.HasPrefix(key, cloneRewritePrefix) {
+			continue
+		}
+		pattern, replacement, err := parseRewriteRule(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", key, err)
+		}
+		rules = append(rules, rewriteRule{key, pattern, replacement})
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i].key < rules[j].key })
+	return rules, nil
+}
+
+// Apply the rewrite rules to every exported file below dir, reporting how often
+// each rule matched
+func rewriteExport(dir string, rules []rewriteRule) error {
+	matches := make([]int, len(rules))
+	err := filepath.WalkDir(dir, func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if entry.Name() == ".terraform" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rewritten := string(content)
+		for i, rule := range rules {
+			matches[i] += len(rule.pattern.FindAllStringIndex(rewritten, -1))
+			rewritten = rule.pattern.ReplaceAllString(rewritten, rule.replacement)
+		}
+		if rewritten == string(content) {
+			return nil
+		}
+		return os.WriteFile(path, []byte(rewritten), 0644)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to rewrite the exported configuration: %w", err)
+	}
+	for i, rule := range rules {
+		fmt.Printf("Rewrote %d occurrence(s) of %s (%s).\n", matches[i], rule.pattern, rule.key)
+	}
+	return nil
+}
+
+// Export the given resource types ("all" for everything) from the source
+// tenant, rewrite IDs and names with the clone_rewrite rules and apply the
+// result to the target tenant
+func runCloneTenant(terraformPath string, logFile *os.File, config map[string]string, typeList, source, target string) error {
+	var types []string
+	if typeList != "all" {
+		if types = exportTypes(typeList); len(types) == 0 {
+			return fmt.Errorf("no resource types given")
+		}
+	}
+	rules, err := cloneRewriteRules(config)
+	if err != nil {
+		return err
+	}
+	if len(rules) == 0 {
+		fmt.Println("No clone_rewrite rules configured; the target receives the configuration unchanged.")
+	}
+	dir := filepath.Join(migrationsDirName, "clone-"+time.Now().Format("20060102-150405"))
+	return transferConfiguration(terraformPath, logFile, "clone", dir, types, source, target, func(dir string) error {
+		return rewriteExport(dir, rules)
+	})
+}
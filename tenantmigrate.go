@@ -0,0 +1,245 @@
+/**
+* @license
+* Copyright 2020 Dynatrace LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Directory below the working directory holding one Terraform root per migration or clone
+const migrationsDirName = "migrations"
+
+// Credential variables a credential set provides in place of the default ones
+var credentialSetKeys = []string{"ENV_URL", "API_TOKEN", "CLIENT_ID", "CLIENT_SECRET", "ACCOUNT_ID", "PLATFORM_TOKEN"}
+
+// ============================================================
+// Environment-to-environment migration
+// ============================================================
+
+// Terraform environment authenticating against a credential set's tenant: its
+// DT_<SET>_* values replace DT_* and provider-specific DYNATRACE_* overrides
+func credentialSetEnv(set string) ([]string, error) {
+	prefix := "DT_" + strings.ToUpper(set) + "_"
+	if getEnv(prefix+"ENV_URL") == "" {
+		return nil, fmt.Errorf("credential set %q has no %sENV_URL; list it in credential_sets", set, prefix)
+	}
+	replaced := make(map[string]bool)
+	for _, key := range credentialSetKeys {
+		replaced["DT_"+key] = true
+		replaced["DYNATRACE_"+key] = true
+	}
+	var env []string
+	for _, entry := range terraformEnv() {
+		if name, _, _ := strings.Cut(entry, "="); !replaced[name] {
+			env = append(env, entry)
+		}
+	}
+	for _, key := range credentialSetKeys {
+		if value := getEnv(prefix + key); value != "" {
+			env = append(env, "DT_"+key+"="+value)
+		}
+	}
+	return env, nil
+}
+
+// Run Terraform in another root directory with the given environment, logging
+// like the wrapper's own commands
+func runTerraformIn(terraformPath string, logFile *os.File, dir string, env []string, args ...string) error {
+	cmd := terraformCommand(terraformPath, append([]string{"-chdir=" + dir}, withNoColor(args)...)...)
+	cmd.Env = env
+	var out io.Writer = os.Stdout
+	if logFile != nil {
+		out = logFile
+	}
+	scrubbed := newScrubWriter(out)
+	defer scrubbed.Flush()
+	tail := &tailBuffer{max: 4096}
+	cmd.Stdout = scrubbed
+	cmd.Stderr = io.MultiWriter(scrubbed, tail)
+	if err := cmd.Run(); err != nil {
+		return &terraformCommandError{err, string(tail.data)}
+	}
+	return nil
+}
+
+// Capture the output of Terraform run in another root directory
+func outputTerraformIn(terraformPath string, logFile *os.File, dir string, env []string, args ...string) ([]byte, error) {
+	cmd := terraformCommand(terraformPath, append([]string{"-chdir=" + dir}, args...)...)
+	cmd.Env = env
+	var stderr io.Writer = os.Stderr
+	if logFile != nil {
+		stderr = logFile
+	}
+	scrubbedStderr := newScrubWriter(stderr)
+	defer scrubbedStderr.Flush()
+	cmd.Stderr = scrubbedStderr
+	return cmd.Output()
+}
+
+// Ask before a migration or clone creates objects in the target tenant
+func confirmMigration(summary, targetURL string) (bool, error) {
+	fmt.Println(summary)
+	switch {
+	case nonInteractive && !forceGuards:
+		return false, fmt.Errorf("applying to %s needs confirmation; rerun with -force in non-interactive mode", targetURL)
+	case !nonInteractive:
+		fmt.Printf("Apply to %s? (y/n): ", targetURL)
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		return strings.ToLower(strings.TrimSpace(answer)) == "y", nil
+	}
+	return true, nil
+}
+
+// Export the given resource types from the source credential set's tenant and
+// apply them to the target's in a separate Terraform root under migrations/,
+// then report the target ID each source object was created with
+func runMigration(terraformPath string, logFile *os.File, typeList, source, target string) error {
+	types := exportTypes(typeList)
+	if len(types) == 0 {
+		return fmt.Errorf("no resource types given")
+	}
+	dir := filepath.Join(migrationsDirName, time.Now().Format("20060102-150405"))
+	return transferConfiguration(terraformPath, logFile, "migrate", dir, types, source, target, nil)
+}
+
+// Export types (all when empty) from the source tenant into dir, let prepare
+// adjust the exported files when set, and apply them to the target tenant;
+// kind names the operation in messages and the audit trail
+func transferConfiguration(terraformPath string, logFile *os.File, kind, dir string, types []string, source, target string, prepare func(dir string) error) error {
+	sourceEnv, err := credentialSetEnv(source)
+	if err != nil {
+		return err
+	}
+	targetEnv, err := credentialSetEnv(target)
+	if err != nil {
+		return err
+	}
+	sourceURL := getEnv("DT_" + strings.ToUpper(source) + "_ENV_URL")
+	targetURL := getEnv("DT_" + strings.ToUpper(target) + "_ENV_URL")
+	if tenantID(sourceURL) == tenantID(targetURL) {
+		return fmt.Errorf("source and target are the same environment (%s)", tenantID(sourceURL))
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	fmt.Printf("Copying configuration from %s to %s in %s.\n", sourceURL, targetURL, dir)
+
+	// -ref keeps references between exported objects, so the target objects
+	// point at each other's new IDs rather than the source's
+	resources, err := exportConfiguration(types, dir, sourceEnv, "-ref")
+	if err != nil {
+		recordAudit(kind, err)
+		return err
+	}
+	if len(resources) == 0 {
+		fmt.Println("Nothing to copy.")
+		return nil
+	}
+	if prepare != nil {
+		if err := prepare(dir); err != nil {
+			recordAudit(kind, err)
+			return err
+		}
+	}
+
+	planFile := kind + ".tfplan"
+	steps := [][]string{{"init", "-input=false"}, {"plan", "-input=false", "-out=" + planFile}}
+	for _, args := range steps {
+		if err := runTerraformIn(terraformPath, logFile, dir, targetEnv, args...); err != nil {
+			explainTerraformError(err)
+			recordAudit(kind, err)
+			return fmt.Errorf("terraform %s failed: %w", args[0], err)
+		}
+	}
+	summary := fmt.Sprintf("Exported %d object(s).", len(resources))
+	if out, err := outputTerraformIn(terraformPath, logFile, dir, targetEnv, "show", "-no-color", planFile); err == nil {
+		for _, line := range strings.Split(string(out), "\n") {
+			if strings.HasPrefix(line, "Plan:") {
+				summary += " " + line
+			}
+		}
+	}
+	if confirmed, err := confirmMigration(summary, targetURL); err != nil {
+		return err
+	} else if !confirmed {
+		fmt.Printf("Nothing applied; the exported configuration stays in %s.\n", dir)
+		return nil
+	}
+	if err := checkChangeFreeze(kind); err != nil {
+		recordAudit(kind, err)
+		fmt.Printf("Nothing applied; the exported configuration stays in %s.\n", dir)
+		return err
+	}
+
+	applyErr := runTerraformIn(terraformPath, logFile, dir, targetEnv, "apply", "-input=false", planFile)
+	if applyErr != nil {
+		explainTerraformError(applyErr)
+	}
+
+	out, err := outputTerraformIn(terraformPath, logFile, dir, targetEnv, "state", "pull")
+	if err != nil {
+		return fmt.Errorf("failed to read the %s state: %w", kind, err)
+	}
+	instances, err := parseStateInstances(out)
+	if err != nil {
+		return err
+	}
+	targetIDs := make(map[string]string, len(instances))
+	for _, instance := range instances {
+		targetIDs[instance.Address] = instance.ID
+	}
+
+	mapFile, err := os.Create(filepath.Join(dir, "id-map.csv"))
+	if err != nil {
+		return err
+	}
+	defer mapFile.Close()
+	writer := csv.NewWriter(mapFile)
+	writer.Write([]string{"address", "source_id", "target_id"})
+	fmt.Println("\nID mapping:")
+	migrated := 0
+	for _, resource := range resources {
+		targetID := targetIDs[resource.Address()]
+		writer.Write([]string{resource.Address(), resource.ID, targetID})
+		if targetID == "" {
+			targetID = "(not created)"
+		} else {
+			migrated++
+		}
+		fmt.Printf("  %s: %s -> %s\n", resource.Address(), resource.ID, targetID)
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return err
+	}
+	fmt.Printf("Copied %d of %d object(s); the mapping is in %s.\n", migrated, len(resources), mapFile.Name())
+
+	if applyErr != nil {
+		applyErr = fmt.Errorf("apply failed: %w", applyErr)
+	}
+	recordAudit(kind, applyErr)
+	return applyErr
+}
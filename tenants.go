@@ -0,0 +1,301 @@
+/**
+* @license
+* Copyright 2020 Dynatrace LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"maps"
+	"net/http"
+	"os"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Dynatrace Account Management API; a variable so tests can point it at a fake server
+var accountAPIURL = "https://api.dynatrace.com"
+
+// Record of the tenants resolved from the account by earlier runs, so
+// -gc-workspaces can tell a tenant that left the account from a workspace
+// created by hand
+const accountTenantsFileName = "account-tenants.cfg"
+
+// ============================================================
+// Tenant list from the Account Management API
+// ============================================================
+
+// Environment of the account as listed by the Account Management API
+type accountEnvironment struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Active bool   `json:"active"`
+	URL    string `json:"url"`
+	Tags   []struct {
+		Key   string `json:"key"`
+		Value string `json:"value"`
+	} `json:"tags"`
+}
+
+// List the account's environments using the OAuth client credentials
+func listAccountEnvironments(clientID, clientSecret, accountID string) ([]accountEnvironment, error) {
+	token, err := requestOAuthToken(clientID, clientSecret, accountID, "account-env-read")
+	if err != nil {
+		return nil, fmt.Errorf("failed to obtain account token: %w", err)
+	}
+
+	uuid := strings.TrimPrefix(accountID, "urn:dtaccount:")
+	req, err := http.NewRequest(http.MethodGet, accountAPIURL+"/env/v1/accounts/"+uuid+"/environments", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := readAPIResponse(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		Data []accountEnvironment `json:"data"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("unexpected environments response: %w", err)
+	}
+	return result.Data, nil
+}
+
+// Whether an environment carries every "key:value" (or bare key) tag and its
+// name or ID matches the glob pattern
+func matchesTenantFilter(env accountEnvironment, tags []string, pattern string) bool {
+	if pattern != "" {
+		byName, _ := path.Match(pattern, env.Name)
+		byID, _ := path.Match(pattern, env.ID)
+		if !byName && !byID {
+			return false
+		}
+	}
+	for _, want := range tags {
+		key, value, hasValue := strings.Cut(want, ":")
+		found := false
+		for _, tag := range env.Tags {
+			if tag.Key == key && (!hasValue || tag.Value == value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// Add a workspace.<id> entry for every active account environment matching
+// tenant_filter_tags and tenant_filter_name when tenant_source = account, so
+// environments added to the account are picked up on the next run; static
+// workspace entries take precedence
+func resolveAccountTenants(config map[string]string) error {
+	if config["tenant_source"] != "account" {
+		return nil
+	}
+	clientID, clientSecret, accountID := getEnv("DT_CLIENT_ID"), getEnv("DT_CLIENT_SECRET"), getEnv("DT_ACCOUNT_ID")
+	if clientID == "" || clientSecret == "" || accountID == "" {
+		return fmt.Errorf("tenant_source = account requires oauth_client = true with DT_CLIENT_ID, DT_CLIENT_SECRET and DT_ACCOUNT_ID")
+	}
+
+	environments, err := listAccountEnvironments(clientID, clientSecret, accountID)
+	if err != nil {
+		return err
+	}
+
+	var tags []string
+	for _, tag := range strings.Split(config["tenant_filter_tags"], ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+
+	var added []string
+	resolved := make(map[string]string)
+	for _, env := range environments {
+		if !env.Active || !matchesTenantFilter(env, tags, config["tenant_filter_name"]) {
+			continue
+		}
+		envURL := env.URL
+		if envURL == "" {
+			envURL = "https://" + env.ID + ".live.dynatrace.com"
+		}
+		resolved[env.ID] = strings.TrimRight(envURL, "/")
+		key := "workspace." + env.ID
+		if _, found := config[key]; !found {
+			config[key] = resolved[env.ID]
+			added = append(added, env.ID)
+		}
+	}
+	sort.Strings(added)
+	fmt.Printf("Resolved %d tenant(s) from account %s (%d not configured statically).\n", len(resolved), accountID, len(added))
+	publishf("tenants", "info", "Resolved tenants from account: %s", strings.Join(added, ", "))
+	if err := recordAccountTenants(resolved); err != nil {
+		fmt.Printf("Warning: failed to update %s: %v\n", accountTenantsFileName, err)
+	}
+	return nil
+}
+
+// Tenants resolved from the account by earlier runs, by workspace name
+func readAccountTenants() map[string]string {
+	tenants := make(map[string]string)
+	content, err := os.ReadFile(accountTenantsFileName)
+	if err != nil {
+		return tenants
+	}
+	for _, line := range strings.Split(string(content), "\n") {
+		if name, envURL, ok := parseConfigLine(line); ok {
+			tenants[name] = envURL
+		}
+	}
+	return tenants
+}
+
+// Add the tenants resolved by this run to the record; tenants that are no
+// longer resolved stay in it until their workspace is collected
+func recordAccountTenants(resolved map[string]string) error {
+	tenants := readAccountTenants()
+	maps.Copy(tenants, resolved)
+	return writeAccountTenants(tenants)
+}
+
+// Drop a collected workspace from the record of resolved tenants
+func forgetAccountTenant(name string) error {
+	tenants := readAccountTenants()
+	if _, found := tenants[name]; !found {
+		return nil
+	}
+	delete(tenants, name)
+	return writeAccountTenants(tenants)
+}
+
+// Write the record of resolved tenants, one "workspace = URL" per line
+func writeAccountTenants(tenants map[string]string) error {
+	var content strings.Builder
+	content.WriteString("# Tenants resolved from the account (tenant_source = account), read by -gc-workspaces\n")
+	for _, name := range slices.Sorted(maps.Keys(tenants)) {
+		fmt.Fprintf(&content, "%s = %s\n", name, tenants[name])
+	}
+	return os.WriteFile(accountTenantsFileName, []byte(content.String()), 0644)
+}
+
+// Workspaces with a workspace.<name> entry, configured or resolved, sorted
+func tenantWorkspaces(config map[string]string) []string {
+	var names []string
+	for key := range config {
+		if name, found := strings.CutPrefix(key, "workspace."); found {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Print the configured and resolved tenants, one "workspace = URL" per line
+func listTenants(config map[string]string) {
+	for _, name := range tenantWorkspaces(config) {
+		fmt.Printf("%s = %s\n", name, config["workspace."+name])
+	}
+}
+
+// ============================================================
+// Fan-out to every tenant
+// ============================================================
+
+// Plan or apply in the workspace of every tenant with DT_ENV_URL pointed at its
+// environment, creating workspaces for newly resolved tenants; returns the exit
+// code of the worst run. Requires an OAuth client, which is valid for every
+// environment of the account while an API token belongs to one
+func reconcileTenants(terraformPath string, logFile *os.File, config map[string]string, apply bool) int {
+	names := tenantWorkspaces(config)
+	if len(names) == 0 {
+		log.Printf("No tenants to reconcile; add workspace.<name> entries or set tenant_source = account")
+		return exitFailure
+	}
+	if getEnv("DT_CLIENT_ID") == "" || getEnv("DT_CLIENT_SECRET") == "" {
+		log.Printf("-all-tenants requires oauth_client = true; an API token is valid for one environment only")
+		return exitFailure
+	}
+	workspaces, _, err := listWorkspaces(terraformPath, logFile)
+	if err != nil {
+		log.Printf("Failed to list workspaces: %v", err)
+		return exitFailure
+	}
+
+	defer func(configured, envURL string) {
+		configuredWorkspace = configured
+		exportEnv("DT_ENV_URL", envURL)
+	}(configuredWorkspace, getEnv("DT_ENV_URL"))
+
+	var failed, changed []string
+	for _, name := range names {
+		envURL := config["workspace."+name]
+		fmt.Printf("\n=== Tenant %s (%s) ===\n", name, envURL)
+		if !slices.Contains(workspaces, name) {
+			fmt.Printf("Creating workspace %s.\n", name)
+			if err := newWorkspace(terraformPath, logFile, name); err != nil {
+				log.Printf("Failed to create workspace %s: %v", name, err)
+				failed = append(failed, name)
+				continue
+			}
+		}
+		configuredWorkspace = name
+		exportEnv("DT_ENV_URL", envURL)
+
+		if !apply {
+			switch planExitCode(terraformPath, logFile) {
+			case exitOK:
+			case exitChanges:
+				changed = append(changed, name)
+			default:
+				failed = append(failed, name)
+			}
+			continue
+		}
+		if err := publishConfiguration(terraformPath, logFile); err != nil {
+			explainTerraformError(err)
+			log.Printf("Failed to publish configuration to tenant %s: %v", name, err)
+			failed = append(failed, name)
+			continue
+		}
+		fmt.Printf("Completed Terraform apply for tenant %s.\n", name)
+	}
+
+	fmt.Printf("\nReconciled %d tenant(s): %d failed, %d with changes.\n", len(names), len(failed), len(changed))
+	publishf("tenants", "info", "Reconciled %d tenant(s); failed: %s", len(names), strings.Join(failed, ", "))
+	switch {
+	case len(failed) > 0 && apply:
+		return exitApplyFailure
+	case len(failed) > 0:
+		return exitPlanFailure
+	case len(changed) > 0:
+		return exitChanges
+	}
+	return exitOK
+}
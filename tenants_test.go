@@ -0,0 +1,122 @@
+/**
+* @license
+* Copyright 2020 Dynatrace LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"dynatrace-terraform-wrapper/internal/dttest"
+)
+
+func TestListAccountEnvironments(t *testing.T) {
+	server := newTestServer(t)
+	const accountID = "urn:dtaccount:11111111-2222-3333-4444-555555555555"
+	server.AddOAuthClient("dt0s02.ACCOUNT", dttest.OAuthClient{Secret: "dt0s02.ACCOUNT.SECRET", AccountID: accountID, Scopes: []string{"account-env-read"}})
+	server.AddOAuthClient("dt0s02.NARROW", dttest.OAuthClient{Secret: "dt0s02.NARROW.SECRET", AccountID: accountID, Scopes: []string{"settings.read"}})
+	server.AddEnvironment(accountID, dttest.Environment{ID: "abc12345", Name: "Production", Active: true, URL: "https://abc12345.live.dynatrace.com",
+		Tags: []dttest.Tag{{Key: "stage", Value: "prod"}}})
+	server.AddEnvironment(accountID, dttest.Environment{ID: "def67890", Name: "Staging", Active: false})
+
+	environments, err := listAccountEnvironments("dt0s02.ACCOUNT", "dt0s02.ACCOUNT.SECRET", accountID)
+	if err != nil {
+		t.Fatalf("listAccountEnvironments: %v", err)
+	}
+	if len(environments) != 2 {
+		t.Fatalf("got %d environments, want 2", len(environments))
+	}
+	production := environments[0]
+	if production.ID != "abc12345" || !production.Active || production.URL != "https://abc12345.live.dynatrace.com" ||
+		len(production.Tags) != 1 || production.Tags[0].Key != "stage" || production.Tags[0].Value != "prod" {
+		t.Errorf("environments[0] = %+v", production)
+	}
+	if environments[1].Active {
+		t.Errorf("environments[1] should be inactive: %+v", environments[1])
+	}
+
+	_, err = listAccountEnvironments("dt0s02.NARROW", "dt0s02.NARROW.SECRET", accountID)
+	if err == nil || !strings.Contains(err.Error(), "failed to obtain account token") {
+		t.Errorf("client without account-env-read: got %v", err)
+	}
+}
+
+func TestMatchesTenantFilter(t *testing.T) {
+	env := accountEnvironment{ID: "abc12345", Name: "prod-eu"}
+	env.Tags = append(env.Tags, struct {
+		Key   string `json:"key"`
+		Value string `json:"value"`
+	}{"stage", "prod"})
+
+	tests := []struct {
+		tags    []string
+		pattern string
+		want    bool
+	}{
+		{nil, "", true},
+		{nil, "prod-*", true},
+		{nil, "abc*", true},
+		{nil, "staging-*", false},
+		{[]string{"stage"}, "", true},
+		{[]string{"stage:prod"}, "prod-*", true},
+		{[]string{"stage:dev"}, "", false},
+		{[]string{"team"}, "", false},
+	}
+	for _, test := range tests {
+		if got := matchesTenantFilter(env, test.tags, test.pattern); got != test.want {
+			t.Errorf("matchesTenantFilter(%v, %q) = %v, want %v", test.tags, test.pattern, got, test.want)
+		}
+	}
+}
+
+func TestOrphanReason(t *testing.T) {
+	server := newTestServer(t)
+	unreachable := dttest.NewServer()
+	unreachable.Close()
+	config := map[string]string{
+		"workspace":             "prod",
+		"tenant_source":         "account",
+		"workspace.prod":        server.URL + "/e/removed",
+		"workspace.live":        server.URL,
+		"workspace.removed":     server.URL + "/e/removed",
+		"workspace.unreachable": unreachable.URL,
+	}
+	resolvedBefore := map[string]string{"left": "https://ghi13579.live.dynatrace.com"}
+
+	tests := []struct {
+		workspace string
+		want      string
+	}{
+		{"prod", ""},
+		{"team-a", ""},
+		{"live", ""},
+		{"removed", "returned 404"},
+		{"unreachable", ""},
+		{"left", "no longer resolved from the account"},
+	}
+	for _, test := range tests {
+		got := orphanReason(test.workspace, config, resolvedBefore)
+		if (test.want == "") != (got == "") || !strings.Contains(got, test.want) {
+			t.Errorf("orphanReason(%q) = %q, want %q", test.workspace, got, test.want)
+		}
+	}
+
+	delete(config, "tenant_source")
+	if got := orphanReason("left", config, resolvedBefore); got != "" {
+		t.Errorf("orphanReason without tenant_source = account: got %q, want none", got)
+	}
+}
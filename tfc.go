@@ -0,0 +1,290 @@
+/**
+* @license
+* Copyright 2020 Dynatrace LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// HCP Terraform host used unless backend_config.hostname names another
+const defaultTerraformCloudHost = "app.terraform.io"
+
+// How often a remote run's status is polled
+const remoteRunPollInterval = 5 * time.Second
+
+// URL scheme of the HCP Terraform API; a variable so tests can point it at a local server
+var tfcScheme = "https"
+
+// Set by -remote-run
+var cliRemoteRun bool
+
+// HCP Terraform host, organization, workspace and API token of a bundle using
+// the cloud backend
+var terraformCloud struct {
+	Host         string
+	Organization string
+	Workspace    string
+	Token        string
+}
+
+// Remote run statuses after which nothing more happens without user action
+var remoteRunFinalStatuses = map[string]bool{
+	"applied": true, "planned_and_finished": true, "errored": true, "discarded": true,
+	"canceled": true, "force_canceled": true, "policy_soft_failed": true,
+}
+
+// ============================================================
+// HCP Terraform integration
+// ============================================================
+
+// Environment variable Terraform reads the API token of host from
+func terraformTokenEnvKey(host string) string {
+	return "TF_TOKEN_" + strings.NewReplacer(".", "_", "-", "__").Replace(host)
+}
+
+// Token stored by terraform login for host
+func terraformLoginToken(host string) string {
+	dir, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	content, err := os.ReadFile(filepath.Join(dir, ".terraform.d", "credentials.tfrc.json"))
+	if err != nil {
+		return ""
+	}
+	var credentials struct {
+		Credentials map[string]struct {
+			Token string `json:"token"`
+		} `json:"credentials"`
+	}
+	if json.Unmarshal(content, &credentials) != nil {
+		return ""
+	}
+	return credentials.Credentials[host].Token
+}
+
+// For the cloud backend, pass tfc_token to Terraform as TF_TOKEN_<host> and
+// remember the workspace for remote runs; falls back to a token already in the
+// environment or stored by terraform login
+func setupTerraformCloud(config map[string]string) error {
+	if config["backend"] != "cloud" {
+		return nil
+	}
+	terraformCloud.Host = config["backend_config.hostname"]
+	if terraformCloud.Host == "" {
+		terraformCloud.Host = defaultTerraformCloudHost
+	}
+	terraformCloud.Organization = config["backend_config.organization"]
+	terraformCloud.Workspace = config["backend_config.workspace"]
+
+	token, err := resolveConfigValue(config["tfc_token"])
+	if err != nil {
+		return fmt.Errorf("failed to resolve tfc_token: %w", err)
+	}
+	envKey := terraformTokenEnvKey(terraformCloud.Host)
+	switch {
+	case token != "":
+		exportEnv(envKey, token)
+	case getEnv(envKey) != "":
+		token = getEnv(envKey)
+	default:
+		token = terraformLoginToken(terraformCloud.Host)
+	}
+	if token == "" {
+		return fmt.Errorf("no API token for %s; set tfc_token or run terraform login", terraformCloud.Host)
+	}
+	terraformCloud.Token = token
+	return nil
+}
+
+// Call the HCP Terraform API, decoding the response into result when set
+func terraformCloudRequest(method, path string, payload, result any) error {
+	var body bytes.Buffer
+	if payload != nil {
+		if err := json.NewEncoder(&body).Encode(payload); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequest(method, tfcScheme+"://"+terraformCloud.Host+"/api/v2"+path, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+terraformCloud.Token)
+	req.Header.Set("Content-Type", "application/vnd.api+json")
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	data, err := readAPIResponse(resp)
+	if err != nil || result == nil {
+		return err
+	}
+	return json.Unmarshal(data, result)
+}
+
+// Run resource as returned by the runs endpoints
+type remoteRun struct {
+	Data struct {
+		ID         string `json:"id"`
+		Attributes struct {
+			Status  string `json:"status"`
+			Actions struct {
+				IsConfirmable bool `json:"is-confirmable"`
+			} `json:"actions"`
+		} `json:"attributes"`
+		Relationships struct {
+			Plan struct {
+				Data struct {
+					ID string `json:"id"`
+				} `json:"data"`
+			} `json:"plan"`
+		} `json:"relationships"`
+	} `json:"data"`
+}
+
+// Poll a run, printing each status change, until it waits for confirmation or
+// finishes; reports whether it got to applying
+func followRemoteRun(runID string) (remoteRun, bool, error) {
+	var run remoteRun
+	status, applying := "", false
+	for {
+		if err := terraformCloudRequest(http.MethodGet, "/runs/"+runID, nil, &run); err != nil {
+			return run, applying, fmt.Errorf("failed to read run %s: %w", runID, err)
+		}
+		if run.Data.Attributes.Status != status {
+			status = run.Data.Attributes.Status
+			applying = applying || status == "applying"
+			fmt.Printf("[%s] %s\n", time.Now().Format("15:04:05"), strings.ReplaceAll(status, "_", " "))
+		}
+		if run.Data.Attributes.Actions.IsConfirmable || remoteRunFinalStatuses[status] {
+			return run, applying, nil
+		}
+		time.Sleep(remoteRunPollInterval)
+	}
+}
+
+// Trigger a run in the HCP Terraform workspace, follow its status and apply it
+// once the user confirms the plan; returns the exit code
+func runRemote() int {
+	if terraformCloud.Token == "" {
+		log.Printf("-remote-run needs backend = cloud in %s", activeConfigFile())
+		return exitFailure
+	}
+	// A run may apply without asking when the workspace auto-applies
+	if err := checkChangeFreeze("remote run"); err != nil {
+		log.Print(err)
+		recordAudit("remote-run", err)
+		return exitApplyFailure
+	}
+	var workspace struct {
+		Data struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if err := terraformCloudRequest(http.MethodGet, "/organizations/"+terraformCloud.Organization+"/workspaces/"+terraformCloud.Workspace, nil, &workspace); err != nil {
+		log.Printf("Failed to look up workspace %s/%s: %v", terraformCloud.Organization, terraformCloud.Workspace, err)
+		return exitFailure
+	}
+
+	payload := map[string]any{"data": map[string]any{
+		"type":       "runs",
+		"attributes": map[string]any{"message": "Triggered by the Dynatrace Terraform wrapper"},
+		"relationships": map[string]any{
+			"workspace": map[string]any{"data": map[string]any{"type": "workspaces", "id": workspace.Data.ID}},
+		},
+	}}
+	var created remoteRun
+	if err := terraformCloudRequest(http.MethodPost, "/runs", payload, &created); err != nil {
+		log.Printf("Failed to create run: %v", err)
+		return exitFailure
+	}
+	runID := created.Data.ID
+	fmt.Printf("Started run %s: %s://%s/app/%s/workspaces/%s/runs/%s\n", runID, tfcScheme, terraformCloud.Host,
+		terraformCloud.Organization, terraformCloud.Workspace, runID)
+	recordAudit("remote-run", nil)
+
+	run, applying, err := followRemoteRun(runID)
+	if err != nil {
+		log.Print(err)
+		return exitFailure
+	}
+	if run.Data.Attributes.Actions.IsConfirmable {
+		if code := confirmRemoteRun(runID, run.Data.Relationships.Plan.Data.ID); code != exitOK {
+			return code
+		}
+		if run, applying, err = followRemoteRun(runID); err != nil {
+			log.Print(err)
+			return exitFailure
+		}
+		recordAudit("remote-apply", nil)
+	}
+
+	switch status := run.Data.Attributes.Status; {
+	case status == "applied" || status == "planned_and_finished" || status == "discarded":
+		return exitOK
+	case applying:
+		return exitApplyFailure
+	default:
+		return exitPlanFailure
+	}
+}
+
+// Show the planned changes of a run waiting for confirmation and apply or
+// discard it as the user decides
+func confirmRemoteRun(runID, planID string) int {
+	var plan struct {
+		Data struct {
+			Attributes struct {
+				Additions    int `json:"resource-additions"`
+				Changes      int `json:"resource-changes"`
+				Destructions int `json:"resource-destructions"`
+			} `json:"attributes"`
+		} `json:"data"`
+	}
+	if err := terraformCloudRequest(http.MethodGet, "/plans/"+planID, nil, &plan); err != nil {
+		log.Printf("Failed to read plan %s: %v", planID, err)
+		return exitPlanFailure
+	}
+	a := plan.Data.Attributes
+	fmt.Printf("Plan: %d to add, %d to change, %d to destroy.\n", a.Additions, a.Changes, a.Destructions)
+
+	apply := forceGuards
+	if !nonInteractive {
+		fmt.Print("Apply this run? (yes/no): ")
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		apply = strings.TrimSpace(answer) == "yes"
+	}
+	action, comment := "apply", "Confirmed in the Dynatrace Terraform wrapper"
+	if !apply {
+		action, comment = "discard", "Discarded in the Dynatrace Terraform wrapper"
+	}
+	if err := terraformCloudRequest(http.MethodPost, "/runs/"+runID+"/actions/"+action, map[string]string{"comment": comment}, nil); err != nil {
+		log.Printf("Failed to %s run %s: %v", action, runID, err)
+		return exitFailure
+	}
+	return exitOK
+}
@@ -0,0 +1,94 @@
+/**
+* @license
+* Copyright 2020 Dynatrace LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// Serve the runs endpoint of a fake HCP Terraform host, answering with the
+// given run status and confirmability
+func newTerraformCloudServer(t *testing.T, status string, confirmable bool) {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer tfc-token" || r.Header.Get("Content-Type") != "application/vnd.api+json" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		runID, found := strings.CutPrefix(r.URL.Path, "/api/v2/runs/")
+		if !found {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		fmt.Fprintf(w, `{"data":{"id":%q,"attributes":{"status":%q,"actions":{"is-confirmable":%t}},"relationships":{"plan":{"data":{"id":"plan-1"}}}}}`,
+			runID, status, confirmable)
+	}))
+	saved, savedScheme := terraformCloud, tfcScheme
+	tfcScheme = "http"
+	terraformCloud.Host = strings.TrimPrefix(server.URL, "http://")
+	terraformCloud.Token = "tfc-token"
+	t.Cleanup(func() {
+		terraformCloud, tfcScheme = saved, savedScheme
+		server.Close()
+	})
+}
+
+func TestFollowRemoteRun(t *testing.T) {
+	tests := []struct {
+		status       string
+		confirmable  bool
+		wantApplying bool
+	}{
+		{"planned", true, false},
+		{"applying", true, true},
+		{"errored", false, false},
+		{"applied", false, false},
+	}
+	for _, test := range tests {
+		t.Run(test.status, func(t *testing.T) {
+			newTerraformCloudServer(t, test.status, test.confirmable)
+			run, applying, err := followRemoteRun("run-1")
+			if err != nil {
+				t.Fatalf("followRemoteRun: %v", err)
+			}
+			if run.Data.ID != "run-1" || run.Data.Attributes.Status != test.status || run.Data.Relationships.Plan.Data.ID != "plan-1" {
+				t.Errorf("run = %+v", run.Data)
+			}
+			if applying != test.wantApplying {
+				t.Errorf("applying = %v, want %v", applying, test.wantApplying)
+			}
+		})
+	}
+}
+
+func TestTerraformTokenEnvKey(t *testing.T) {
+	tests := map[string]string{
+		"app.terraform.io":         "TF_TOKEN_app_terraform_io",
+		"tfe.example-corp.com":     "TF_TOKEN_tfe_example__corp_com",
+		"terraform.internal.local": "TF_TOKEN_terraform_internal_local",
+	}
+	for host, want := range tests {
+		if got := terraformTokenEnvKey(host); got != want {
+			t.Errorf("terraformTokenEnvKey(%q) = %q, want %q", host, got, want)
+		}
+	}
+}
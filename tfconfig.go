@@ -0,0 +1,341 @@
+/**
+* @license
+* Copyright 2020 Dynatrace LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ============================================================
+// Read blocks from Terraform configuration files
+// ============================================================
+
+// Block from a .tf file; attribute values are kept as raw expression text
+type hclBlock struct {
+	Type       string
+	Labels     []string
+	Attributes map[string]string
+	Blocks     []*hclBlock
+	File       string
+	Line       int
+}
+
+// Parser state for a single file
+type hclParser struct {
+	src  string
+	pos  int
+	file string
+}
+
+// Parse all .tf files in a directory into their top-level blocks
+func parseTerraformFiles(dir string) ([]*hclBlock, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.tf"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	var blocks []*hclBlock
+	for _, file := range files {
+		src, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		fileBlocks, err := parseHCL(string(src), file)
+		if err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, fileBlocks...)
+	}
+	return blocks, nil
+}
+
+// Parse HCL source into its top-level blocks
+func parseHCL(src, file string) ([]*hclBlock, error) {
+	p := &hclParser{src: src, file: file}
+	root := &hclBlock{Attributes: make(map[string]string)}
+	if err := p.parseBody(root, false); err != nil {
+		return nil, err
+	}
+	return root.Blocks, nil
+}
+
+// Current line number, for error messages and block locations
+func (p *hclParser) line() int {
+	return strings.Count(p.src[:p.pos], "\n") + 1
+}
+
+func (p *hclParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("%s:%d: %s", p.file, p.line(), fmt.Sprintf(format, args...))
+}
+
+// Parse attributes and nested blocks until the closing brace (or end of file at top level)
+func (p *hclParser) parseBody(block *hclBlock, nested bool) error {
+	for {
+		p.skipSpace(true)
+		if p.pos >= len(p.src) {
+			if nested {
+				return p.errorf("unexpected end of file in %s block", block.Type)
+			}
+			return nil
+		}
+		if p.src[p.pos] == '}' {
+			if !nested {
+				return p.errorf("unexpected '}'")
+			}
+			p.pos++
+			return nil
+		}
+
+		line := p.line()
+		name := p.readIdentifier()
+		if name == "" {
+			return p.errorf("unexpected character %q", p.src[p.pos])
+		}
+		p.skipSpace(false)
+
+		if p.pos < len(p.src) && p.src[p.pos] == '=' {
+			p.pos++
+			block.Attributes[name] = strings.TrimSpace(p.readExpression())
+			continue
+		}
+
+		child := &hclBlock{Type: name, Attributes: make(map[string]string), File: p.file, Line: line}
+		for {
+			p.skipSpace(false)
+			if p.pos >= len(p.src) {
+				return p.errorf("unexpected end of file in %s block header", name)
+			}
+			switch c := p.src[p.pos]; {
+			case c == '{':
+				p.pos++
+				if err := p.parseBody(child, true); err != nil {
+					return err
+				}
+				block.Blocks = append(block.Blocks, child)
+			case c == '"':
+				start := p.pos
+				p.skipString()
+				label, err := strconv.Unquote(p.src[start:p.pos])
+				if err != nil {
+					label = strings.Trim(p.src[start:p.pos], `"`)
+				}
+				child.Labels = append(child.Labels, label)
+				continue
+			case isIdentifierChar(c):
+				child.Labels = append(child.Labels, p.readIdentifier())
+				continue
+			default:
+				return p.errorf("unexpected character %q in %s block header", c, name)
+			}
+			break
+		}
+	}
+}
+
+func isIdentifierChar(c byte) bool {
+	return c == '_' || c == '-' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+func (p *hclParser) readIdentifier() string {
+	start := p.pos
+	for p.pos < len(p.src) && isIdentifierChar(p.src[p.pos]) {
+		p.pos++
+	}
+	return p.src[start:p.pos]
+}
+
+// Skip whitespace and comments, optionally including newlines
+func (p *hclParser) skipSpace(newlines bool) {
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r':
+			p.pos++
+		case c == '\n' && newlines:
+			p.pos++
+		case c == '#' || strings.HasPrefix(p.src[p.pos:], "//"):
+			if !newlines {
+				return
+			}
+			p.skipLineComment()
+		case strings.HasPrefix(p.src[p.pos:], "/*"):
+			p.skipBlockComment()
+		default:
+			return
+		}
+	}
+}
+
+func (p *hclParser) skipBlockComment() {
+	end := strings.Index(p.src[p.pos+2:], "*/")
+	if end < 0 {
+		p.pos = len(p.src)
+		return
+	}
+	p.pos += end + 4
+}
+
+func (p *hclParser) skipLineComment() {
+	end := strings.IndexByte(p.src[p.pos:], '\n')
+	if end < 0 {
+		p.pos = len(p.src)
+		return
+	}
+	p.pos += end
+}
+
+// Skip a quoted string including any ${...} template sequences
+func (p *hclParser) skipString() {
+	p.pos++ // opening quote
+	for p.pos < len(p.src) {
+		switch {
+		case p.src[p.pos] == '\\':
+			p.pos += 2
+		case p.src[p.pos] == '"':
+			p.pos++
+			return
+		case strings.HasPrefix(p.src[p.pos:], "${") || strings.HasPrefix(p.src[p.pos:], "%{"):
+			p.pos += 2
+			p.skipNested('}')
+		default:
+			p.pos++
+		}
+	}
+}
+
+// Skip to the matching closing character, honouring strings and nesting
+func (p *hclParser) skipNested(closing byte) {
+	depth := 1
+	for p.pos < len(p.src) {
+		switch c := p.src[p.pos]; c {
+		case '"':
+			p.skipString()
+			continue
+		case '{', '[', '(':
+			depth++
+		case '}', ']', ')':
+			depth--
+			if depth == 0 && c == closing {
+				p.pos++
+				return
+			}
+		}
+		p.pos++
+	}
+}
+
+// Skip a heredoc starting at "<<" and return true if one was found
+func (p *hclParser) skipHeredoc() bool {
+	rest := p.src[p.pos:]
+	if !strings.HasPrefix(rest, "<<") {
+		return false
+	}
+	newline := strings.IndexByte(rest, '\n')
+	if newline < 0 {
+		return false
+	}
+	marker := strings.TrimSpace(strings.TrimPrefix(strings.TrimPrefix(rest[:newline], "<<"), "-"))
+	if marker == "" {
+		return false
+	}
+
+	p.pos += newline + 1
+	for p.pos < len(p.src) {
+		end := strings.IndexByte(p.src[p.pos:], '\n')
+		lineText := p.src[p.pos:]
+		if end >= 0 {
+			lineText = p.src[p.pos : p.pos+end]
+		}
+		if strings.TrimSpace(lineText) == marker {
+			p.pos += len(lineText)
+			return true
+		}
+		if end < 0 {
+			p.pos = len(p.src)
+			return true
+		}
+		p.pos += end + 1
+	}
+	return true
+}
+
+// Read an attribute expression up to the end of the line (or an enclosing '}');
+// comments inside brackets are skipped since they may hold unbalanced brackets
+// or quotes
+func (p *hclParser) readExpression() string {
+	start := p.pos
+	depth := 0
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		lineComment := c == '#' || strings.HasPrefix(p.src[p.pos:], "//")
+		switch {
+		case c == '"':
+			p.skipString()
+			continue
+		case c == '<' && p.skipHeredoc():
+			continue
+		case strings.HasPrefix(p.src[p.pos:], "/*"):
+			p.skipBlockComment()
+			continue
+		case depth == 0 && (c == '\n' || c == '}' || lineComment):
+			expr := p.src[start:p.pos]
+			if lineComment {
+				p.skipLineComment()
+			}
+			return expr
+		case lineComment:
+			p.skipLineComment()
+			continue
+		case c == '{' || c == '[' || c == '(':
+			depth++
+		case c == '}' || c == ']' || c == ')':
+			depth--
+		}
+		p.pos++
+	}
+	return p.src[start:p.pos]
+}
+
+// Literal value of a simple quoted string expression
+func stringLiteral(expr string) (string, bool) {
+	if !strings.HasPrefix(expr, `"`) || strings.Contains(expr, "${") {
+		return "", false
+	}
+	value, err := strconv.Unquote(expr)
+	return value, err == nil
+}
+
+// Variable name referenced by a plain "var.name" expression
+func variableReference(expr string) (string, bool) {
+	name, found := strings.CutPrefix(strings.TrimSpace(expr), "var.")
+	if !found || name == "" {
+		return "", false
+	}
+	for i := 0; i < len(name); i++ {
+		if !isIdentifierChar(name[i]) {
+			return "", false
+		}
+	}
+	return name, true
+}
@@ -0,0 +1,54 @@
+/**
+* @license
+* Copyright 2020 Dynatrace LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package main
+
+import "testing"
+
+func TestParseHCLCommentsInsideExpressions(t *testing.T) {
+	const src = `locals {
+  xs = [
+    "a", # (legacy
+    "b", // unbalanced "quote
+    /* ] closing
+       bracket */ "c",
+  ]
+  ys = { a = 1 } # trailing (
+}
+
+provider "dynatrace" {
+  dt_env_url = var.env_url
+}
+`
+	blocks, err := parseHCL(src, "main.tf")
+	if err != nil {
+		t.Fatalf("parseHCL: %v", err)
+	}
+	if len(blocks) != 2 || blocks[0].Type != "locals" || blocks[1].Type != "provider" {
+		t.Fatalf("got %d blocks, want locals and provider", len(blocks))
+	}
+	if got := blocks[0].Attributes["ys"]; got != "{ a = 1 }" {
+		t.Errorf("ys = %q", got)
+	}
+	provider := blocks[1]
+	if len(provider.Labels) != 1 || provider.Labels[0] != "dynatrace" || provider.Line != 11 {
+		t.Errorf("provider block = %v at line %d", provider.Labels, provider.Line)
+	}
+	if name, ok := variableReference(provider.Attributes["dt_env_url"]); !ok || name != "env_url" {
+		t.Errorf("dt_env_url = %q", provider.Attributes["dt_env_url"])
+	}
+}
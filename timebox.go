@@ -0,0 +1,179 @@
+/**
+* @license
+* Copyright 2020 Dynatrace LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Time before the change window closes at which apply is interrupted by default
+const defaultWindowMargin = 5 * time.Minute
+
+// End of the change window and the margin before it, set from -window-end or change_window_end
+var (
+	changeWindowEnd    time.Time
+	changeWindowMargin = defaultWindowMargin
+)
+
+// ============================================================
+// Time-boxed apply within a change window
+// ============================================================
+
+// Parse a change window end given as RFC 3339 or as a local "15:04" time today
+func parseWindowEnd(value string) (time.Time, error) {
+	if end, err := time.Parse(time.RFC3339, value); err == nil {
+		return end, nil
+	}
+	clock, err := time.ParseInLocation("15:04", value, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("change window end %q must be RFC 3339 or HH:MM", value)
+	}
+	now := time.Now()
+	return time.Date(now.Year(), now.Month(), now.Day(), clock.Hour(), clock.Minute(), 0, 0, time.Local), nil
+}
+
+// Configure the change window from the flag, falling back to configuration
+func setupChangeWindow(flagValue string, config map[string]string) error {
+	value := flagValue
+	if value == "" {
+		value = config["change_window_end"]
+	}
+	if value == "" {
+		return nil
+	}
+	end, err := parseWindowEnd(value)
+	if err != nil {
+		return err
+	}
+	if margin := config["change_window_margin"]; margin != "" {
+		if changeWindowMargin, err = time.ParseDuration(margin); err != nil {
+			return fmt.Errorf("invalid change_window_margin: %w", err)
+		}
+	}
+	changeWindowEnd = end
+	return nil
+}
+
+// Time at which a running apply must be interrupted, or zero when no window is set
+func applyDeadline() time.Time {
+	if changeWindowEnd.IsZero() {
+		return time.Time{}
+	}
+	return changeWindowEnd.Add(-changeWindowMargin)
+}
+
+// Interrupt a running command at the deadline, as if Ctrl+C was pressed, so
+// Terraform finishes in-flight operations without starting new ones; the returned
+// function stops the timer and reports whether the interrupt was sent
+func interruptAtDeadline(cmd *exec.Cmd, deadline time.Time) func() bool {
+	var mu sync.Mutex
+	interrupted := false
+	timer := time.AfterFunc(time.Until(deadline), func() {
+		mu.Lock()
+		defer mu.Unlock()
+		fmt.Println("\nChange window is closing; interrupting Terraform after in-flight operations complete...")
+		publishf("window", "warning", "Change window closes at %s; interrupting apply", changeWindowEnd.Format(time.Kitchen))
+		if err := cmd.Process.Signal(os.Interrupt); err != nil {
+			// Windows cannot deliver an interrupt to another process
+			fmt.Printf("Warning: failed to interrupt Terraform gracefully: %v\n", err)
+			return
+		}
+		interrupted = true
+	})
+	return func() bool {
+		timer.Stop()
+		mu.Lock()
+		defer mu.Unlock()
+		return interrupted
+	}
+}
+
+var (
+	completedOperationPattern = regexp.MustCompile(`^(\S+): (Creation|Modifications|Destruction) complete`)
+	ansiEscapePattern         = regexp.MustCompile("\x1b\\[[0-9;]*m")
+)
+
+// Writer collecting the addresses of resource operations Terraform completed
+type applyProgress struct {
+	mu        sync.Mutex
+	completed []string
+	partial   []byte
+}
+
+func (p *applyProgress) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.partial = append(p.partial, b...)
+	for {
+		newline := bytes.IndexByte(p.partial, '\n')
+		if newline < 0 {
+			break
+		}
+		line := strings.TrimSpace(ansiEscapePattern.ReplaceAllString(string(p.partial[:newline]), ""))
+		if match := completedOperationPattern.FindStringSubmatch(line); match != nil {
+			p.completed = append(p.completed, fmt.Sprintf("%s (%s)", match[1], strings.ToLower(match[2])))
+		}
+		p.partial = p.partial[newline+1:]
+	}
+	return len(b), nil
+}
+
+// Operations completed so far
+func (p *applyProgress) Completed() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]string(nil), p.completed...)
+}
+
+// Report what an interrupted apply completed and save the plan of the remaining
+// changes for the next window
+func reportInterruptedApply(terraformPath string, logFile *os.File, progress *applyProgress) error {
+	completed := progress.Completed()
+	fmt.Printf("\nApply stopped before the change window closed. %d operation(s) completed:\n", len(completed))
+	for _, operation := range completed {
+		fmt.Printf("  %s\n", operation)
+	}
+
+	planFile := fmt.Sprintf("followup-%s.tfplan", time.Now().Format("20060102-150405"))
+	args := append([]string{"plan", "-out=" + planFile}, targetArgs()...)
+	args = append(args, variableArgs...)
+	if err := executeTerraformCommand(terraformPath, logFile, args...); err != nil {
+		return fmt.Errorf("failed to plan remaining changes: %w", err)
+	}
+	out, err := outputTerraformCommand(terraformPath, logFile, "show", "-no-color", planFile)
+	if err != nil {
+		return fmt.Errorf("failed to read follow-up plan: %w", err)
+	}
+	summary, changes := summarizePlan(string(out))
+	if !changes || summary == "" {
+		summary = "  (no remaining changes)"
+	}
+	fmt.Printf("\nNot yet applied:\n%s\n", summary)
+	fmt.Printf("\nFollow-up plan saved to %s; apply it in the next window with: terraform apply %s\n", planFile, planFile)
+
+	audit.Record(auditEvent{Kind: "window", Tenant: getEnv("DT_ENV_URL"), Result: "interrupted",
+		Detail: fmt.Sprintf("%d operation(s) completed; follow-up plan %s", len(completed), planFile)})
+	return nil
+}
@@ -0,0 +1,398 @@
+/**
+* @license
+* Copyright 2020 Dynatrace LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+// ============================================================
+// TOML configuration
+// ============================================================
+
+// Types enforced for well-known keys in wrapper.toml; keys ending in ".required"
+// are booleans, timeout.<command> keys durations and stack.<name>.depends_on lists
+var tomlKeyTypes = map[string]string{
+	"api_token":            "bool",
+	"oauth_client":         "bool",
+	"iam_mode":             "bool",
+	"keychain":             "bool",
+	"platform_token":       "bool",
+	"managed_cluster":      "bool",
+	"skip_tls_verify":      "bool",
+	"scope_check":          "bool",
+	"schema_check":         "bool",
+	"readiness_check":      "bool",
+	"impact_analysis":      "bool",
+	"slo_preview":          "bool",
+	"verify_apply":         "bool",
+	"deployment_events":    "bool",
+	"change_freeze":        "bool",
+	"auto_unlock":          "bool",
+	"apply_confirm":        "bool",
+	"init_upgrade":         "bool",
+	"json_progress":        "bool",
+	"parallelism":          "int",
+	"rate_limit_retries":   "int",
+	"state_backup_keep":    "int",
+	"timeout":              "duration",
+	"session_cache_ttl":    "duration",
+	"plan_max_age":         "duration",
+	"lock_timeout":         "duration",
+	"auto_unlock_age":      "duration",
+	"state_backup_max_age": "duration",
+	"rate_limit_backoff":   "duration",
+	"managed_nodes":        "list",
+	"include":              "list",
+	"exclude":              "list",
+	"stacks":               "list",
+	"var_file":             "list",
+	"tenant_filter_tags":   "list",
+	"credential_providers": "list",
+}
+
+// Keys that take both a value and <key>.<name> entries; TOML cannot make a key
+// both a value and a table, so the value is written under this subkey of the table
+var tomlScalarSubkeys = map[string]string{
+	"timeout":   "default",
+	"workspace": "selected",
+}
+
+// Subkey holding the value of any other key that is also a table, such as a
+// variable with .prompt or .default entries
+const tomlValueSubkey = "value"
+
+// Subkey of the table a key's own value is written under
+func tomlScalarSubkey(key string) string {
+	if subkey, found := tomlScalarSubkeys[key]; found {
+		return subkey
+	}
+	return tomlValueSubkey
+}
+
+// Type names in errors about mistyped keys
+var tomlTypeNames = map[string]string{
+	"bool":     "a boolean",
+	"int":      "an integer",
+	"duration": `a duration string such as "30m"`,
+	"list":     "a list of strings",
+}
+
+// Expected TOML type for a flattened key
+func tomlKeyType(key string) string {
+	switch {
+	case strings.HasSuffix(key, ".required"):
+		return "bool"
+	case strings.HasPrefix(key, "timeout."):
+		return "duration"
+	case strings.HasPrefix(key, "stack.") && strings.HasSuffix(key, ".depends_on"):
+		return "list"
+	}
+	return tomlKeyTypes[key]
+}
+
+// Decode a TOML file into flattened "table.key" string values
+func decodeTOMLConfig(fileName string) (map[string]string, error) {
+	var document map[string]interface{}
+	if _, err := toml.DecodeFile(fileName, &document); err != nil {
+		return nil, err
+	}
+
+	flat := make(map[string]string)
+	if err := flattenTOML("", document, flat); err != nil {
+		return nil, fmt.Errorf("%s: %w", fileName, err)
+	}
+	return flat, nil
+}
+
+// Flatten nested tables and check well-known keys have the right type
+func flattenTOML(prefix string, table map[string]interface{}, flat map[string]string) error {
+	for name, value := range table {
+		key := name
+		if prefix != "" {
+			key = prefix + "." + name
+		}
+
+		if nested, isTable := value.(map[string]interface{}); isTable {
+			if err := flattenTOML(key, nested, flat); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if prefix != "" && name == tomlScalarSubkey(prefix) {
+			key = prefix
+		}
+
+		expected := tomlKeyType(key)
+		switch v := value.(type) {
+		case bool:
+			flat[key] = strconv.FormatBool(v)
+		case int64:
+			flat[key] = strconv.FormatInt(v, 10)
+		case float64:
+			flat[key] = strconv.FormatFloat(v, 'f', -1, 64)
+		case string:
+			if expected == "list" {
+				// A single string is accepted where a list is expected
+				expected = ""
+			}
+			flat[key] = v
+		case []interface{}:
+			items := make([]string, 0, len(v))
+			for _, item := range v {
+				items = append(items, fmt.Sprint(item))
+			}
+			flat[key] = strings.Join(items, ",")
+		default:
+			flat[key] = fmt.Sprint(v)
+		}
+
+		if expected != "" && !matchesTOMLType(value, expected) {
+			return fmt.Errorf("%s must be %s, got %#v", key, tomlTypeNames[expected], value)
+		}
+	}
+	return nil
+}
+
+// Whether a decoded value has the expected type; durations are strings such as "30m"
+func matchesTOMLType(value interface{}, expected string) bool {
+	switch expected {
+	case "bool":
+		_, ok := value.(bool)
+		return ok
+	case "int":
+		_, ok := value.(int64)
+		return ok
+	case "duration":
+		text, ok := value.(string)
+		if !ok {
+			return false
+		}
+		_, err := time.ParseDuration(text)
+		return err == nil
+	case "list":
+		items, ok := value.([]interface{})
+		if !ok {
+			return false
+		}
+		for _, item := range items {
+			if _, isString := item.(string); !isString {
+				return false
+			}
+		}
+		return true
+	}
+	return true
+}
+
+// Read a TOML configuration file into config, processing includes first
+func readTOMLConfigFile(fileName string, config map[string]string, including map[string]bool) error {
+	flat, err := decodeTOMLConfig(fileName)
+	if err != nil {
+		return err
+	}
+
+	if includes, found := flat["include"]; found {
+		for _, include := range strings.Split(includes, ",") {
+			if err := readIncludedConfig(fileName, strings.TrimSpace(include), config, including); err != nil {
+				return err
+			}
+		}
+		delete(flat, "include")
+	}
+
+	for key, value := range flat {
+		config[key] = value
+	}
+	return nil
+}
+
+// The file among a TOML configuration file and its includes whose value for
+// key wins; the file's own keys override everything it includes
+func tomlConfigKeyFile(fileName, key string, including map[string]bool) (string, error) {
+	flat, err := decodeTOMLConfig(fileName)
+	if err != nil {
+		return "", err
+	}
+	if _, found := flat[key]; found && key != "include" {
+		return fileName, nil
+	}
+
+	var defining string
+	if includes, found := flat["include"]; found {
+		for _, include := range strings.Split(includes, ",") {
+			included, err := configKeyFile(includedConfigPath(fileName, strings.TrimSpace(include)), key, including)
+			if err != nil {
+				return "", err
+			}
+			if included != "" {
+				defining = included
+			}
+		}
+	}
+	return defining, nil
+}
+
+// ============================================================
+// Convert wrapper.cfg to wrapper.toml
+// ============================================================
+
+// Typed TOML value for a wrapper.cfg string value: the key's registered type,
+// inferred for other keys
+func typedTOMLValue(key, value string) (interface{}, error) {
+	switch tomlKeyType(key) {
+	case "list":
+		items := []string{}
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		return items, nil
+	case "bool":
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s must be true or false, got %q", key, value)
+		}
+		return parsed, nil
+	case "int":
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s must be an integer, got %q", key, value)
+		}
+		return parsed, nil
+	case "duration":
+		if _, err := time.ParseDuration(value); err != nil {
+			return nil, fmt.Errorf("%s must be a duration such as 30m, got %q", key, value)
+		}
+		return value, nil
+	}
+
+	if value == "true" || value == "false" {
+		return value == "true", nil
+	}
+	if number, err := strconv.ParseInt(value, 10, 64); err == nil && strconv.FormatInt(number, 10) == value {
+		return number, nil
+	}
+	return value, nil
+}
+
+// Build the nested TOML document for a wrapper.cfg file's own keys
+func configToTOMLDocument(fileName string) (map[string]interface{}, error) {
+	src, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make(map[string]string)
+	var includes []string
+	for _, line := range strings.Split(string(src), "\n") {
+		key, value, ok := parseConfigLine(line)
+		if !ok {
+			continue
+		}
+		if key == "include" {
+			includes = append(includes, value)
+			continue
+		}
+		entries[key] = value
+	}
+
+	document := make(map[string]interface{})
+	if len(includes) > 0 {
+		document["include"] = includes
+	}
+
+	keys := make([]string, 0, len(entries))
+	for key := range entries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		path := key
+		if slices.ContainsFunc(keys, func(other string) bool {
+			return strings.HasPrefix(other, key+".")
+		}) {
+			path = key + "." + tomlScalarSubkey(key)
+		}
+		parts := strings.Split(path, ".")
+		table := document
+		for _, part := range parts[:len(parts)-1] {
+			next, exists := table[part]
+			if !exists {
+				next = make(map[string]interface{})
+				table[part] = next
+			}
+			nested, isTable := next.(map[string]interface{})
+			if !isTable {
+				return nil, fmt.Errorf("key %s conflicts with value %s", key, part)
+			}
+			table = nested
+		}
+		last := parts[len(parts)-1]
+		if _, exists := table[last]; exists {
+			return nil, fmt.Errorf("key %s conflicts with a table of the same name", key)
+		}
+		typed, err := typedTOMLValue(key, entries[key])
+		if err != nil {
+			return nil, err
+		}
+		table[last] = typed
+	}
+	return document, nil
+}
+
+// Convert wrapper.cfg into wrapper.toml with typed values
+func convertConfigToTOML(cfgFileName, tomlFileName string) error {
+	if _, err := os.Stat(tomlFileName); err == nil {
+		return fmt.Errorf("%s already exists", tomlFileName)
+	}
+
+	document, err := configToTOMLDocument(cfgFileName)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(tomlFileName, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	fmt.Fprintf(file, "# Converted from %s\n\n", cfgFileName)
+	if err := toml.NewEncoder(file).Encode(document); err != nil {
+		return err
+	}
+
+	// Validate the result reads back the same keys
+	if _, err := decodeTOMLConfig(tomlFileName); err != nil {
+		return fmt.Errorf("converted file does not validate: %w", err)
+	}
+	fmt.Printf("Converted %s to %s.\n", cfgFileName, tomlFileName)
+	return nil
+}
@@ -0,0 +1,132 @@
+/**
+* @license
+* Copyright 2020 Dynatrace LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestConvertConfigToTOMLRoundTrip(t *testing.T) {
+	samples := map[string]string{"bool": "true", "int": "4", "duration": "30m", "list": "a,b"}
+	lines := []string{
+		"timeout.apply = 1h",
+		"timeout.plan = 10m",
+		"workspace = prod",
+		"workspace.prod = https://abc12345.live.dynatrace.com",
+		"workspace.default = https://def67890.live.dynatrace.com",
+		"stack.app.dir = app",
+		"stack.app.depends_on = net,dns",
+		"DT_API_TOKEN.required = true",
+		"TF_VAR_zone = prod-eu",
+		"TF_VAR_zone.prompt = Management zone",
+		"TF_VAR_zone.default = prod-eu",
+		"TF_VAR_zone.required = true",
+		"DT_ENV_URL = https://abc12345.live.dynatrace.com/#settings",
+		`note = "a # b ; c"`,
+		"padded_id = 007",
+		"retries_hint = 3",
+		"tenant_source = account",
+	}
+	for key, keyType := range tomlKeyTypes {
+		if key == "include" {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("%s = %s", key, samples[keyType]))
+	}
+	sort.Strings(lines)
+
+	dir := t.TempDir()
+	cfgFileName, tomlFileName := filepath.Join(dir, "wrapper.cfg"), filepath.Join(dir, "wrapper.toml")
+	if err := os.WriteFile(cfgFileName, []byte(strings.Join(lines, "\n")+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := convertConfigToTOML(cfgFileName, tomlFileName); err != nil {
+		t.Fatalf("convertConfigToTOML: %v", err)
+	}
+
+	fromCfg, fromTOML := make(map[string]string), make(map[string]string)
+	if err := readConfigFile(cfgFileName, fromCfg, make(map[string]bool)); err != nil {
+		t.Fatal(err)
+	}
+	if err := readConfigFile(tomlFileName, fromTOML, make(map[string]bool)); err != nil {
+		t.Fatalf("reading the converted file: %v", err)
+	}
+	if !maps.Equal(fromCfg, fromTOML) {
+		for key, value := range fromCfg {
+			if fromTOML[key] != value {
+				t.Errorf("%s: got %q from TOML, want %q", key, fromTOML[key], value)
+			}
+		}
+		for key := range fromTOML {
+			if _, found := fromCfg[key]; !found {
+				t.Errorf("%s: unexpected key in TOML", key)
+			}
+		}
+	}
+
+	converted, err := os.ReadFile(tomlFileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"parallelism = 4", `exclude = ["a", "b"]`, `default = "30m"`, `selected = "prod"`, `value = "prod-eu"`} {
+		if !strings.Contains(string(converted), want) {
+			t.Errorf("converted file lacks %s:\n%s", want, converted)
+		}
+	}
+}
+
+func TestFlattenTOMLTypes(t *testing.T) {
+	tests := []struct {
+		document string
+		want     string
+	}{
+		{`parallelism = 4`, ""},
+		{`parallelism = "4"`, "parallelism must be an integer"},
+		{`timeout = "30m"`, ""},
+		{`timeout = 30`, "timeout must be a duration"},
+		{"[timeout]\ndefault = \"30m\"\napply = \"1h\"", ""},
+		{"[timeout]\ndefault = \"soon\"", "timeout must be a duration"},
+		{"[timeout]\napply = \"soon\"", "timeout.apply must be a duration"},
+		{`exclude = ["a", "b"]`, ""},
+		{`exclude = "a"`, ""},
+		{`exclude = ["a", 1]`, "exclude must be a list of strings"},
+		{"[stack.app]\ndepends_on = 3", "stack.app.depends_on must be a list"},
+		{`scope_check = "true"`, "scope_check must be a boolean"},
+		{"[DT_API_TOKEN]\nrequired = 1", "DT_API_TOKEN.required must be a boolean"},
+		{"[parallelism]\nvalue = \"4\"", "parallelism must be an integer"},
+	}
+	for _, test := range tests {
+		fileName := filepath.Join(t.TempDir(), "wrapper.toml")
+		if err := os.WriteFile(fileName, []byte(test.document+"\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		_, err := decodeTOMLConfig(fileName)
+		switch {
+		case test.want == "" && err != nil:
+			t.Errorf("%q: unexpected error %v", test.document, err)
+		case test.want != "" && (err == nil || !strings.Contains(err.Error(), test.want)):
+			t.Errorf("%q: got %v, want an error containing %q", test.document, err, test.want)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+/**
+* @license
+* Copyright 2020 Dynatrace LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ============================================================
+// Validate configuration with terraform fmt and validate
+// ============================================================
+
+// Output of terraform validate -json
+type validateResult struct {
+	Valid        bool                 `json:"valid"`
+	ErrorCount   int                  `json:"error_count"`
+	WarningCount int                  `json:"warning_count"`
+	Diagnostics  []validateDiagnostic `json:"diagnostics"`
+}
+
+type validateDiagnostic struct {
+	Severity string `json:"severity"`
+	Summary  string `json:"summary"`
+	Detail   string `json:"detail"`
+	Range    *struct {
+		Filename string `json:"filename"`
+		Start    struct {
+			Line   int `json:"line"`
+			Column int `json:"column"`
+		} `json:"start"`
+	} `json:"range"`
+}
+
+// Diagnostic as file:line:column: severity: summary, with the detail's first line
+func (d validateDiagnostic) String() string {
+	location := "(configuration)"
+	if d.Range != nil {
+		location = fmt.Sprintf("%s:%d:%d", d.Range.Filename, d.Range.Start.Line, d.Range.Start.Column)
+	}
+	text := fmt.Sprintf("%s: %s: %s", location, d.Severity, d.Summary)
+	if detail, _, _ := strings.Cut(strings.TrimSpace(d.Detail), "\n"); detail != "" {
+		text += "\n    " + detail
+	}
+	return text
+}
+
+// Files terraform fmt would rewrite
+func unformattedFiles(terraformPath string, logFile *os.File) ([]string, error) {
+	out, err := outputTerraformCommand(terraformPath, logFile, "fmt", "-check", "-recursive", "-list=true")
+	var exitErr interface{ ExitCode() int }
+	// fmt -check exits 3 when files need formatting
+	if err != nil && !(errors.As(err, &exitErr) && exitErr.ExitCode() == 3) {
+		return nil, err
+	}
+	return strings.Fields(string(out)), nil
+}
+
+// Run terraform validate -json and decode its diagnostics
+func validateDiagnostics(terraformPath string, logFile *os.File) (*validateResult, error) {
+	out, err := outputTerraformCommand(terraformPath, logFile, "validate", "-json", "-no-color")
+	var result validateResult
+	if jsonErr := json.Unmarshal(out, &result); jsonErr != nil {
+		if err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("unexpected validate output: %w", jsonErr)
+	}
+	return &result, nil
+}
+
+// Check formatting and validate the configuration, printing each problem with its
+// file and line; fails when files are unformatted or validation reports errors
+func validateConfiguration(terraformPath string, logFile *os.File) error {
+	unformatted, err := unformattedFiles(terraformPath, logFile)
+	if err != nil {
+		return fmt.Errorf("terraform fmt failed: %w", err)
+	}
+	for _, file := range unformatted {
+		fmt.Printf("%s: not formatted (run terraform fmt)\n", file)
+	}
+
+	result, err := validateDiagnostics(terraformPath, logFile)
+	if err != nil {
+		return fmt.Errorf("terraform validate failed: %w", err)
+	}
+	for _, diagnostic := range result.Diagnostics {
+		fmt.Println(diagnostic)
+	}
+	publishf("validator", "info", "validate: %d error(s), %d warning(s), %d unformatted file(s)",
+		result.ErrorCount, result.WarningCount, len(unformatted))
+
+	switch {
+	case !result.Valid || result.ErrorCount > 0:
+		return fmt.Errorf("configuration is invalid: %d error(s), %d warning(s)", result.ErrorCount, result.WarningCount)
+	case len(unformatted) > 0:
+		return fmt.Errorf("%d file(s) are not formatted", len(unformatted))
+	}
+	fmt.Printf("Configuration is valid (%d warning(s)).\n", result.WarningCount)
+	return nil
+}
@@ -0,0 +1,86 @@
+/**
+* @license
+* Copyright 2020 Dynatrace LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Values of the repeatable -var and -var-file flags
+var (
+	cliVars     = &listFlag{keyValue: true}
+	cliVarFiles = &listFlag{}
+)
+
+// -var-file and -var arguments passed to plan, apply and destroy
+var variableArgs []string
+
+// ============================================================
+// Terraform input variables
+// ============================================================
+
+// Repeatable command-line flag keeping its values in order
+type listFlag struct {
+	values   []string
+	keyValue bool
+}
+
+func (f *listFlag) String() string {
+	if f == nil {
+		return ""
+	}
+	return strings.Join(f.values, ",")
+}
+
+func (f *listFlag) Set(value string) error {
+	if f.keyValue {
+		if key, _, found := strings.Cut(value, "="); !found || strings.TrimSpace(key) == "" {
+			return fmt.Errorf("expected key=value, got %q", value)
+		}
+	}
+	f.values = append(f.values, value)
+	return nil
+}
+
+// Var files from the comma-separated var_file key followed by those given with -var-file
+func variableFiles(config map[string]string) []string {
+	var files []string
+	for _, varFile := range strings.Split(config["var_file"], ",") {
+		if varFile = strings.TrimSpace(varFile); varFile != "" {
+			files = append(files, varFile)
+		}
+	}
+	return append(files, cliVarFiles.values...)
+}
+
+// Build the variable arguments; -var values come last so they override the var files
+func setupVariables(config map[string]string) error {
+	variableArgs = nil
+	for _, varFile := range variableFiles(config) {
+		if _, err := os.Stat(varFile); err != nil {
+			return fmt.Errorf("var file %s: %w", varFile, err)
+		}
+		variableArgs = append(variableArgs, "-var-file="+varFile)
+	}
+	for _, value := range cliVars.values {
+		variableArgs = append(variableArgs, "-var="+value)
+	}
+	return nil
+}
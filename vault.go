@@ -0,0 +1,143 @@
+/**
+* @license
+* Copyright 2020 Dynatrace LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// ============================================================
+// HashiCorp Vault secret references
+// ============================================================
+
+// Vault token obtained through AppRole login, reused for the rest of the run
+var vaultLogin struct {
+	mu    sync.Mutex
+	token string
+}
+
+// Vault token from VAULT_TOKEN, or from an AppRole login with VAULT_ROLE_ID and VAULT_SECRET_ID
+func vaultToken(addr string) (string, error) {
+	if token := getEnv("VAULT_TOKEN"); token != "" {
+		return token, nil
+	}
+
+	roleID, secretID := getEnv("VAULT_ROLE_ID"), getEnv("VAULT_SECRET_ID")
+	if roleID == "" || secretID == "" {
+		return "", fmt.Errorf("set VAULT_TOKEN, or VAULT_ROLE_ID and VAULT_SECRET_ID for AppRole login")
+	}
+
+	vaultLogin.mu.Lock()
+	defer vaultLogin.mu.Unlock()
+	if vaultLogin.token != "" {
+		return vaultLogin.token, nil
+	}
+
+	mount := getEnv("VAULT_APPROLE_MOUNT")
+	if mount == "" {
+		mount = "approle"
+	}
+	payload, _ := json.Marshal(map[string]string{"role_id": roleID, "secret_id": secretID})
+	req, err := http.NewRequest(http.MethodPost, addr+"/v1/auth/"+mount+"/login", bytes.NewReader(payload))
+	if err != nil {
+		return "", err
+	}
+	body, err := doVaultRequest(req)
+	if err != nil {
+		return "", fmt.Errorf("AppRole login failed: %w", err)
+	}
+
+	var login struct {
+		Auth struct {
+			ClientToken string `json:"client_token"`
+		} `json:"auth"`
+	}
+	if err := json.Unmarshal(body, &login); err != nil || login.Auth.ClientToken == "" {
+		return "", fmt.Errorf("AppRole login returned no token")
+	}
+	vaultLogin.token = login.Auth.ClientToken
+	return vaultLogin.token, nil
+}
+
+// Send a request to Vault, adding the namespace header when configured
+func doVaultRequest(req *http.Request) ([]byte, error) {
+	if namespace := getEnv("VAULT_NAMESPACE"); namespace != "" {
+		req.Header.Set("X-Vault-Namespace", namespace)
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	return readAPIResponse(resp)
+}
+
+// Resolve "vault:<path>#<field>" by reading the secret at path from VAULT_ADDR;
+// both KV version 1 and version 2 (".../data/...") responses are supported
+func resolveVaultSecret(ref string) (string, error) {
+	path, field, found := strings.Cut(ref, "#")
+	if !found || path == "" || field == "" {
+		return "", fmt.Errorf("vault reference %q must be of the form vault:<path>#<field>", ref)
+	}
+	addr := strings.TrimRight(getEnv("VAULT_ADDR"), "/")
+	if addr == "" {
+		return "", fmt.Errorf("vault reference %s requires VAULT_ADDR", ref)
+	}
+	token, err := vaultToken(addr)
+	if err != nil {
+		return "", fmt.Errorf("vault reference %s: %w", ref, err)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, addr+"/v1/"+strings.TrimLeft(path, "/"), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", token)
+	body, err := doVaultRequest(req)
+	var apiErr *apiError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+		return "", fmt.Errorf("vault secret %s: %w", path, errSecretNotFound)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read vault secret %s: %w", path, err)
+	}
+
+	var secret struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &secret); err != nil {
+		return "", fmt.Errorf("failed to parse vault secret %s: %w", path, err)
+	}
+	data := secret.Data
+	if nested, isKV2 := data["data"].(map[string]interface{}); isKV2 && data["metadata"] != nil {
+		data = nested
+	}
+	value, found := data[field]
+	if !found {
+		return "", fmt.Errorf("vault secret %s has no field %s: %w", path, field, errSecretNotFound)
+	}
+	if s, isString := value.(string); isString {
+		return s, nil
+	}
+	return fmt.Sprint(value), nil
+}
@@ -0,0 +1,177 @@
+/**
+* @license
+* Copyright 2020 Dynatrace LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Set when the objects an apply created or modified are checked in the environment afterwards
+var postApplyVerify bool
+
+// Outcome of verifying one applied object
+type verification struct {
+	Address string
+	Status  string
+	Detail  string
+}
+
+// Verification statuses, in report order
+const (
+	verifyLive       = "live"
+	verifyWarning    = "warning"
+	verifyMissing    = "missing"
+	verifyUnverified = "unverified"
+)
+
+// ============================================================
+// Post-apply verification
+// ============================================================
+
+// Enable verification for API token runs unless verify_apply = false
+func setupApplyVerification(config map[string]string) {
+	postApplyVerify = getEnv("DT_API_TOKEN") != "" && config["verify_apply"] != "false"
+}
+
+// Alerting profile IDs referenced by problem notifications
+func notifiedAlertingProfiles() (map[string]bool, error) {
+	profiles := make(map[string]bool)
+	objects, err := listSettingsObjects("builtin:problem.notifications")
+	if err != nil {
+		return nil, err
+	}
+	for _, object := range objects {
+		if profile, ok := object.Value["alertingProfile"].(string); ok {
+			profiles[profile] = true
+		}
+	}
+	return profiles, nil
+}
+
+// Check that an applied object exists and is active: dashboards have tiles to
+// render, monitors and settings objects are enabled and alerting profiles are
+// used by a problem notification
+func verifyObject(instance stateInstance, notified func() map[string]bool) verification {
+	result := verification{Address: instance.Address, Status: verifyLive}
+	path := objectPath(instance)
+	if path == "" || instance.ID == "" {
+		result.Status, result.Detail = verifyUnverified, "no API check for "+instance.Type
+		return result
+	}
+	var object map[string]any
+	err := dynatraceGet(path, &object)
+	var apiErr *apiError
+	switch {
+	case errors.As(err, &apiErr) && apiErr.StatusCode == 404:
+		result.Status, result.Detail = verifyMissing, fmt.Sprintf("object %s not found", instance.ID)
+		return result
+	case err != nil:
+		result.Status, result.Detail = verifyUnverified, err.Error()
+		return result
+	}
+
+	if value, ok := object["value"].(map[string]any); ok {
+		object = value
+	}
+	switch {
+	case object["enabled"] == false:
+		result.Status, result.Detail = verifyWarning, "disabled"
+	case instance.Type == "dynatrace_dashboard" || instance.Type == "dynatrace_json_dashboard":
+		if tiles, _ := object["tiles"].([]any); len(tiles) == 0 {
+			result.Status, result.Detail = verifyWarning, "has no tiles to render"
+		}
+	case instance.Type == "dynatrace_alerting":
+		if profiles := notified(); profiles != nil && !profiles[instance.ID] {
+			result.Status, result.Detail = verifyWarning, "not used by any problem notification"
+		}
+	}
+	return result
+}
+
+// Verify the objects of the resources an apply created or modified, given as
+// the "address (creation|modifications)" operations it completed, and print a
+// report; returns an error when objects are missing from the environment
+func verifyAppliedObjects(terraformPath string, logFile *os.File, completed []string) error {
+	if !postApplyVerify {
+		return nil
+	}
+	applied := make(map[string]bool)
+	for _, operation := range completed {
+		address, kind, _ := strings.Cut(operation, " (")
+		if kind != "destruction)" {
+			applied[address] = true
+		}
+	}
+	if len(applied) == 0 {
+		return nil
+	}
+	instances, err := stateInstances(terraformPath, logFile)
+	if err != nil {
+		fmt.Printf("Warning: could not verify the applied objects: %v\n", err)
+		return nil
+	}
+
+	var profiles map[string]bool
+	profilesLoaded := false
+	notified := func() map[string]bool {
+		if !profilesLoaded {
+			profilesLoaded = true
+			if profiles, err = notifiedAlertingProfiles(); err != nil {
+				fmt.Printf("Warning: could not list problem notifications: %v\n", err)
+			}
+		}
+		return profiles
+	}
+
+	counts := make(map[string]int)
+	var results []verification
+	for _, instance := range instances {
+		if !applied[instance.Address] {
+			continue
+		}
+		result := verifyObject(instance, notified)
+		counts[result.Status]++
+		results = append(results, result)
+	}
+	if len(results) == 0 {
+		return nil
+	}
+
+	fmt.Printf("\nVerified %d applied object(s): %d live, %d warning(s), %d missing, %d unverified.\n",
+		len(results), counts[verifyLive], counts[verifyWarning], counts[verifyMissing], counts[verifyUnverified])
+	for _, status := range []string{verifyMissing, verifyWarning, verifyUnverified} {
+		for _, result := range results {
+			if result.Status == status {
+				fmt.Printf("  %-10s %s: %s\n", result.Status, result.Address, result.Detail)
+			}
+		}
+	}
+
+	var verifyErr error
+	if counts[verifyMissing] > 0 {
+		verifyErr = fmt.Errorf("post-apply verification found %d object(s) missing from the environment", counts[verifyMissing])
+		publishf("verify", "error", "%d applied object(s) missing", counts[verifyMissing])
+	} else {
+		publishf("verify", "info", "%d applied object(s) live, %d warning(s)", counts[verifyLive], counts[verifyWarning])
+	}
+	recordAudit("verify", verifyErr)
+	return verifyErr
+}
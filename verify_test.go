@@ -0,0 +1,75 @@
+/**
+* @license
+* Copyright 2020 Dynatrace LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"dynatrace-terraform-wrapper/internal/dttest"
+)
+
+func TestVerifyObject(t *testing.T) {
+	server := newTestServer(t)
+	useTestEnvironment(t, server, "settings.read", "ReadSyntheticData")
+
+	used := server.AddSettingsObject(dttest.SettingsObject{SchemaID: "builtin:alerting.profile", Value: []byte(`{"name": "Ops"}`)})
+	unused := server.AddSettingsObject(dttest.SettingsObject{SchemaID: "builtin:alerting.profile", Value: []byte(`{"name": "Unused"}`)})
+	server.AddSettingsObject(dttest.SettingsObject{SchemaID: "builtin:problem.notifications", Value: []byte(`{"alertingProfile": "` + used + `"}`)})
+	zone := server.AddSettingsObject(dttest.SettingsObject{SchemaID: "builtin:management-zones", Value: []byte(`{"name": "Prod", "enabled": false}`)})
+	enabled := server.AddSyntheticMonitor(dttest.SyntheticMonitor{Name: "Home", Type: "HTTP", Enabled: true})
+	disabled := server.AddSyntheticMonitor(dttest.SyntheticMonitor{Name: "Login", Type: "HTTP"})
+	server.Fail("/api/config/v1/dashboards/dash-1", 500, "internal error", -1)
+
+	lookups := 0
+	notified := func() map[string]bool {
+		lookups++
+		profiles, err := notifiedAlertingProfiles()
+		if err != nil {
+			t.Fatalf("notifiedAlertingProfiles: %v", err)
+		}
+		return profiles
+	}
+
+	tests := []struct {
+		name       string
+		instance   stateInstance
+		wantStatus string
+		wantDetail string
+	}{
+		{"notified alerting profile", stateInstance{"dynatrace_alerting.ops", "dynatrace_alerting", used}, verifyLive, ""},
+		{"unused alerting profile", stateInstance{"dynatrace_alerting.unused", "dynatrace_alerting", unused}, verifyWarning, "not used by any problem notification"},
+		{"disabled settings object", stateInstance{"dynatrace_management_zone_v2.prod", "dynatrace_management_zone_v2", zone}, verifyWarning, "disabled"},
+		{"enabled monitor", stateInstance{"dynatrace_http_monitor.home", "dynatrace_http_monitor", enabled}, verifyLive, ""},
+		{"disabled monitor", stateInstance{"dynatrace_http_monitor.login", "dynatrace_http_monitor", disabled}, verifyWarning, "disabled"},
+		{"deleted object", stateInstance{"dynatrace_alerting.gone", "dynatrace_alerting", "obj-gone"}, verifyMissing, "object obj-gone not found"},
+		{"failing API", stateInstance{"dynatrace_dashboard.ops", "dynatrace_dashboard", "dash-1"}, verifyUnverified, "internal error"},
+		{"unmapped type", stateInstance{"dynatrace_custom_service.api", "dynatrace_custom_service", "svc-1"}, verifyUnverified, "no API check for dynatrace_custom_service"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := verifyObject(test.instance, notified)
+			if got.Address != test.instance.Address || got.Status != test.wantStatus || !strings.Contains(got.Detail, test.wantDetail) {
+				t.Errorf("verifyObject = %+v, want status %s with detail %q", got, test.wantStatus, test.wantDetail)
+			}
+		})
+	}
+	if lookups != 2 {
+		t.Errorf("listed problem notifications %d times, want once per alerting profile", lookups)
+	}
+}
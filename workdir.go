@@ -0,0 +1,81 @@
+/**
+* @license
+* Copyright 2020 Dynatrace LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Set by -chdir, which overrides working_dir
+var cliWorkingDir string
+
+// Bundle directory holding the wrapper configuration and audit trail once the
+// wrapper works in a stack below it; empty while working in the bundle itself
+var bundleDir string
+
+// ============================================================
+// Working directory
+// ============================================================
+
+// Path of a bundle-level file such as the configuration, independent of the
+// stack the wrapper works in
+func bundlePath(name string) string {
+	if bundleDir == "" || filepath.IsAbs(name) {
+		return name
+	}
+	return filepath.Join(bundleDir, name)
+}
+
+// Switch to the stack directory from -chdir or working_dir, so that Terraform,
+// its plans and the log operate on that stack; returns terraformPath adjusted
+// to stay valid from the stack directory. Unlike terraform -chdir, the wrapper
+// itself changes directory: it reads and writes stack files (saved plans,
+// generated .tf files and the Terraform log) besides running Terraform
+// there, and forwarding -chdir would leave those in the bundle directory
+func enterWorkingDir(config map[string]string, terraformPath string) (string, error) {
+	dir := cliWorkingDir
+	if dir == "" {
+		dir = config["working_dir"]
+	}
+	if dir == "" || dir == "." {
+		return terraformPath, nil
+	}
+
+	root, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	// A bundle-local executable, such as terraform.exe on Windows which has no
+	// "./" prefix, would no longer be found; one from PATH is already absolute
+	if !filepath.IsAbs(terraformPath) {
+		if _, err := os.Stat(terraformPath); err == nil {
+			terraformPath = filepath.Join(root, terraformPath)
+		}
+	}
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return "", fmt.Errorf("working directory %s does not exist", dir)
+	}
+	if err := os.Chdir(dir); err != nil {
+		return "", err
+	}
+	bundleDir = root
+	fmt.Printf("Working in %s.\n", dir)
+	return terraformPath, nil
+}
@@ -0,0 +1,58 @@
+/**
+* @license
+* Copyright 2020 Dynatrace LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEnterWorkingDirKeepsLocalTerraform(t *testing.T) {
+	root := t.TempDir()
+	t.Chdir(root)
+	t.Cleanup(func() { bundleDir = "" })
+	if err := os.Mkdir("alerting", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile("terraform.exe", nil, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		terraformPath string
+		want          string
+	}{
+		{"terraform.exe", filepath.Join(root, "terraform.exe")},
+		{"./terraform.exe", filepath.Join(root, "terraform.exe")},
+		{"/usr/local/bin/terraform", "/usr/local/bin/terraform"},
+	}
+	for _, test := range tests {
+		t.Chdir(root)
+		got, err := enterWorkingDir(map[string]string{"working_dir": "alerting"}, test.terraformPath)
+		if err != nil {
+			t.Fatalf("enterWorkingDir(%q): %v", test.terraformPath, err)
+		}
+		if got != test.want {
+			t.Errorf("enterWorkingDir(%q) = %q, want %q", test.terraformPath, got, test.want)
+		}
+	}
+	if _, err := enterWorkingDir(map[string]string{"working_dir": "missing"}, "terraform"); err == nil {
+		t.Error("missing working directory: want an error")
+	}
+}
@@ -0,0 +1,297 @@
+/**
+* @license
+* Copyright 2020 Dynatrace LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+const workspaceArchiveDir = "workspace-archive"
+
+// ============================================================
+// Terraform workspaces
+// ============================================================
+
+// List Terraform workspaces and the currently selected one
+func listWorkspaces(terraformPath string, logFile *os.File) ([]string, string, error) {
+	out, err := outputTerraformCommand(terraformPath, logFile, "workspace", "list")
+	if err != nil {
+		return nil, "", err
+	}
+
+	var workspaces []string
+	current := ""
+	scanner := bufio.NewScanner(strings.NewReader(string(out)))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if name, found := strings.CutPrefix(line, "* "); found {
+			current = name
+			line = name
+		}
+		if line != "" {
+			workspaces = append(workspaces, line)
+		}
+	}
+	return workspaces, current, scanner.Err()
+}
+
+// Select a Terraform workspace
+func selectWorkspace(terraformPath string, logFile *os.File, name string) error {
+	return executeTerraformCommand(terraformPath, logFile, "workspace", "select", name)
+}
+
+// Workspace selected before every plan, apply and destroy: -workspace, else the
+// workspace config key; empty leaves the current selection alone
+var (
+	cliWorkspace        string
+	configuredWorkspace string
+)
+
+// Read the workspace key unless -workspace was given
+func setupWorkspace(config map[string]string) {
+	configuredWorkspace = cliWorkspace
+	if configuredWorkspace == "" {
+		configuredWorkspace = strings.TrimSpace(config["workspace"])
+	}
+}
+
+// Switch to the configured workspace if another one is selected
+func ensureWorkspace(terraformPath string, logFile *os.File) error {
+	if configuredWorkspace == "" || currentWorkspace() == configuredWorkspace {
+		return nil
+	}
+	workspaces, _, err := listWorkspaces(terraformPath, logFile)
+	if err != nil {
+		return fmt.Errorf("failed to list workspaces: %w", err)
+	}
+	if !slices.Contains(workspaces, configuredWorkspace) {
+		return fmt.Errorf("workspace %s does not exist; create it with -new-workspace %s", configuredWorkspace, configuredWorkspace)
+	}
+	fmt.Printf("Selecting workspace %s.\n", configuredWorkspace)
+	return selectWorkspace(terraformPath, logFile, configuredWorkspace)
+}
+
+// Print the workspaces, marking the selected one
+func printWorkspaces(terraformPath string, logFile *os.File) error {
+	workspaces, current, err := listWorkspaces(terraformPath, logFile)
+	if err != nil {
+		return err
+	}
+	for _, name := range workspaces {
+		marker := " "
+		if name == current {
+			marker = "*"
+		}
+		fmt.Printf("%s %s\n", marker, name)
+	}
+	return nil
+}
+
+// Create a workspace; Terraform selects it
+func newWorkspace(terraformPath string, logFile *os.File, name string) error {
+	return executeTerraformCommand(terraformPath, logFile, "workspace", "new", name)
+}
+
+// Delete a workspace, refusing one that still holds resources unless -force is given
+func deleteWorkspaceChecked(terraformPath string, logFile *os.File, name string) error {
+	if name == "default" {
+		return fmt.Errorf("the default workspace cannot be deleted")
+	}
+	workspaces, current, err := listWorkspaces(terraformPath, logFile)
+	if err != nil {
+		return fmt.Errorf("failed to list workspaces: %w", err)
+	}
+	if !slices.Contains(workspaces, name) {
+		return fmt.Errorf("workspace %s does not exist", name)
+	}
+	if err := selectWorkspace(terraformPath, logFile, name); err != nil {
+		return err
+	}
+	addresses, err := listStateResources(terraformPath, logFile)
+	if err != nil {
+		return fmt.Errorf("failed to list state of workspace %s: %w", name, err)
+	}
+	if len(addresses) > 0 && !forceGuards {
+		if current != name {
+			selectWorkspace(terraformPath, logFile, current)
+		}
+		return fmt.Errorf("workspace %s still manages %d resource(s); destroy them first or rerun with -force to abandon them", name, len(addresses))
+	}
+	if err := deleteWorkspace(terraformPath, logFile, name); err != nil {
+		return err
+	}
+	if current != name {
+		return selectWorkspace(terraformPath, logFile, current)
+	}
+	return nil
+}
+
+// ============================================================
+// Garbage-collect workspaces of decommissioned tenants
+// ============================================================
+
+// Check whether an environment still exists; unauthenticated requests to a live
+// tenant are rejected with 401, while removed tenants answer 404
+func probeTenant(envURL string) (bool, error) {
+	resp, err := httpClient.Get(strings.TrimRight(envURL, "/") + "/api/v1/config/clusterversion")
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode != http.StatusNotFound, nil
+}
+
+// Reason a workspace is considered orphaned, or empty if it is still in use or
+// nothing shows its tenant is gone: the tenant of its workspace.<name> entry
+// answers 404, or a tenant resolved from the account earlier is no longer
+// resolved. Workspaces without an entry, such as per-team workspaces targeting
+// DT_ENV_URL, are left alone
+func orphanReason(name string, config map[string]string, resolvedBefore map[string]string) string {
+	if name == config["workspace"] {
+		return ""
+	}
+	envURL := config["workspace."+name]
+	if envURL == "" {
+		if previous, found := resolvedBefore[name]; found && config["tenant_source"] == "account" {
+			return previous + " is no longer resolved from the account"
+		}
+		return ""
+	}
+	exists, err := probeTenant(envURL)
+	if err != nil {
+		fmt.Printf("Could not reach %s for workspace %s: %v\n", envURL, name, err)
+		return ""
+	}
+	if !exists {
+		return envURL + " returned 404"
+	}
+	return ""
+}
+
+// Pull a workspace's state into the archive directory
+func archiveWorkspaceState(terraformPath string, logFile *os.File, name string) (string, error) {
+	out, err := outputTerraformCommand(terraformPath, logFile, "state", "pull")
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(workspaceArchiveDir, 0700); err != nil {
+		return "", err
+	}
+	archivePath := filepath.Join(workspaceArchiveDir, fmt.Sprintf("%s-%s.tfstate", name, time.Now().Format("20060102-150405")))
+	if err := os.WriteFile(archivePath, out, 0600); err != nil {
+		return "", err
+	}
+	return archivePath, nil
+}
+
+// Delete a workspace after switching away from it
+func deleteWorkspace(terraformPath string, logFile *os.File, name string) error {
+	if err := selectWorkspace(terraformPath, logFile, "default"); err != nil {
+		return err
+	}
+	return executeTerraformCommand(terraformPath, logFile, "workspace", "delete", "-force", name)
+}
+
+// List orphaned workspaces and offer guided cleanup for each; their tenant is
+// gone and the configured credentials belong to DT_ENV_URL, so the state is
+// archived rather than destroyed
+func collectWorkspaceGarbage(terraformPath string, logFile *os.File, config map[string]string) error {
+	workspaces, current, err := listWorkspaces(terraformPath, logFile)
+	if err != nil {
+		return fmt.Errorf("failed to list workspaces: %w", err)
+	}
+	resolvedBefore := readAccountTenants()
+
+	reader := bufio.NewReader(os.Stdin)
+	deleted := make(map[string]bool)
+	found := 0
+	for _, name := range workspaces {
+		if name == "default" {
+			continue
+		}
+		reason := orphanReason(name, config, resolvedBefore)
+		if reason == "" {
+			continue
+		}
+		found++
+
+		if err := selectWorkspace(terraformPath, logFile, name); err != nil {
+			return fmt.Errorf("failed to select workspace %s: %w", name, err)
+		}
+		addresses, err := listStateResources(terraformPath, logFile)
+		if err != nil {
+			return fmt.Errorf("failed to list state of workspace %s: %w", name, err)
+		}
+
+		fmt.Printf("\nWorkspace %q looks orphaned (%s) and holds %d resource(s) in state.\n", name, reason, len(addresses))
+		for i, address := range addresses {
+			if i == 10 {
+				fmt.Printf("  ... and %d more\n", len(addresses)-10)
+				break
+			}
+			fmt.Printf("  %s\n", address)
+		}
+
+		if nonInteractive {
+			fmt.Printf("Skipped workspace %s (non-interactive).\n", name)
+			continue
+		}
+		fmt.Print("[a]rchive state then delete workspace, or [s]kip? ")
+		choice, _ := reader.ReadString('\n')
+		switch strings.ToLower(strings.TrimSpace(choice)) {
+		case "a":
+			archivePath, err := archiveWorkspaceState(terraformPath, logFile, name)
+			if err != nil {
+				log.Printf("Failed to archive state of workspace %s: %v\n", name, err)
+				continue
+			}
+			fmt.Printf("State archived to %s.\n", archivePath)
+		default:
+			fmt.Printf("Skipped workspace %s.\n", name)
+			continue
+		}
+
+		if err := deleteWorkspace(terraformPath, logFile, name); err != nil {
+			log.Printf("Failed to delete workspace %s: %v\n", name, err)
+			continue
+		}
+		deleted[name] = true
+		fmt.Printf("Deleted workspace %s.\n", name)
+		if err := forgetAccountTenant(name); err != nil {
+			fmt.Printf("Warning: failed to update %s: %v\n", accountTenantsFileName, err)
+		}
+	}
+
+	if found == 0 {
+		fmt.Println("No orphaned workspaces found.")
+	}
+
+	restore := current
+	if deleted[current] || current == "" {
+		restore = "default"
+	}
+	return selectWorkspace(terraformPath, logFile, restore)
+}